@@ -2,82 +2,100 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
 )
 
 // DB is the database connection
 var DB *sql.DB
 
-// Initialize sets up the database connection and creates tables if they don't exist
-func Initialize(dbPath string) error {
-	var err error
-	DB, err = sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return err
-	}
+// Driver is the dialect of the open connection
+var Driver = SQLite
 
-	if err = DB.Ping(); err != nil {
-		return err
-	}
+// Open sets up a SQLite database connection without touching the schema
+func Open(dbPath string) error {
+	return OpenDriver(SQLite, dbPath)
+}
 
-	err = createTables()
+// OpenDriver sets up a connection for the given dialect without touching the schema
+func OpenDriver(driver Dialect, dsn string) error {
+	conn, err := sql.Open(string(driver), driver.connectionString(dsn))
 	if err != nil {
 		return err
 	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return err
+	}
 
-	log.Println("Database initialized successfully")
+	DB = conn
+	Driver = driver
 	return nil
 }
 
-// createTables creates the necessary tables if they don't exist
-func createTables() error {
-	// Create Session table
-	_, err := DB.Exec(`
-	CREATE TABLE IF NOT EXISTS sessions (
-		id TEXT PRIMARY KEY,
-		last_heartbeat DATETIME NOT NULL
-	)`)
-	if err != nil {
+// Initialize sets up a SQLite database connection and applies pending migrations
+func Initialize(dbPath string) error {
+	return InitializeDriver(SQLite, dbPath)
+}
+
+// InitializeDriver sets up the connection and applies pending migrations.
+// It refuses to start against a database migrated by a newer binary.
+func InitializeDriver(driver Dialect, dsn string) error {
+	if err := OpenDriver(driver, dsn); err != nil {
 		return err
 	}
 
-	// Create Agent table
-	_, err = DB.Exec(`
-	CREATE TABLE IF NOT EXISTS agents (
-		id TEXT PRIMARY KEY,
-		is_online BOOLEAN NOT NULL,
-		name TEXT NOT NULL,
-		role TEXT NOT NULL,
-		prompt TEXT NOT NULL,
-		model TEXT NOT NULL,
-		reasoning_log TEXT,
-		session_id TEXT,
-		FOREIGN KEY (session_id) REFERENCES sessions(id)
-	)`)
+	applied, err := MigrateUp(DB, 0)
 	if err != nil {
 		return err
 	}
+	if applied > 0 {
+		log.Printf("Applied %d database migration(s)", applied)
+	}
 
-	// Create Message table
-	_, err = DB.Exec(`
-	CREATE TABLE IF NOT EXISTS messages (
-		id TEXT PRIMARY KEY,
-		created_at DATETIME NOT NULL,
-		content TEXT NOT NULL,
-		agent_id TEXT NOT NULL,
-		session_id TEXT NOT NULL,
-		FOREIGN KEY (agent_id) REFERENCES agents(id),
-		FOREIGN KEY (session_id) REFERENCES sessions(id)
-	)`)
+	indexed, err := EnsureSearchIndex(DB)
 	if err != nil {
 		return err
 	}
+	if !indexed {
+		log.Println("Full-text search unavailable (build with -tags sqlite_fts5); falling back to substring matching")
+	}
 
+	log.Printf("Database initialized successfully (%s)", driver)
 	return nil
 }
 
+// IsForeignKeyViolation reports whether err is the database refusing a
+// write that would break a foreign key
+func IsForeignKeyViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23503"
+	}
+	return false
+}
+
+// IsUniqueViolation reports whether err is a write that would have stored
+// a duplicate primary key or unique value
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
+
 // Close closes the database connection
 func Close() error {
 	if DB != nil {
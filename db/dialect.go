@@ -0,0 +1,99 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL flavour spoken by a database driver
+type Dialect string
+
+const (
+	// SQLite is the default, file-backed dialect
+	SQLite Dialect = "sqlite3"
+
+	// Postgres is used when several replicas share one database
+	Postgres Dialect = "postgres"
+)
+
+// ParseDialect maps a DB_DRIVER setting to a Dialect.
+// An empty name selects SQLite.
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "sqlite", "sqlite3":
+		return SQLite, nil
+	case "postgres", "postgresql", "pg":
+		return Postgres, nil
+	default:
+		return "", fmt.Errorf("unsupported database driver %q (expected sqlite3 or postgres)", name)
+	}
+}
+
+// Rebind rewrites the ? placeholders used throughout the repositories
+// into the dialect's own style. Queries must not contain literal question marks.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// connectionString adds the settings the application relies on to a DSN.
+// SQLite only enforces foreign keys on connections that ask for it, and
+// takes the write lock when a transaction begins so that transactions
+// reading before they write cannot interleave.
+func (d Dialect) connectionString(dsn string) string {
+	if d != SQLite {
+		return dsn
+	}
+	settings := []struct {
+		keys  []string
+		value string
+	}{
+		{[]string{"_foreign_keys=", "_fk="}, "_foreign_keys=on"},
+		{[]string{"_txlock="}, "_txlock=immediate"},
+	}
+	for _, setting := range settings {
+		if containsAny(dsn, setting.keys) {
+			continue
+		}
+		if strings.Contains(dsn, "?") {
+			dsn += "&" + setting.value
+		} else {
+			dsn += "?" + setting.value
+		}
+	}
+	return dsn
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrationsDir returns the directory holding the dialect's migrations
+func (d Dialect) migrationsDir() string {
+	if d == Postgres {
+		return "migrations/postgres"
+	}
+	return "migrations/sqlite"
+}
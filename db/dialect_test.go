@@ -0,0 +1,26 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDialect(t *testing.T) {
+	for name, want := range map[string]Dialect{"": SQLite, "sqlite3": SQLite, "SQLite": SQLite, "postgres": Postgres, "postgresql": Postgres} {
+		got, err := ParseDialect(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, got, name)
+	}
+
+	_, err := ParseDialect("mysql")
+	assert.Error(t, err)
+}
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE agents SET name = ?, role = ? WHERE id = ?"
+	assert.Equal(t, query, SQLite.Rebind(query))
+	assert.Equal(t, "UPDATE agents SET name = $1, role = $2 WHERE id = $3", Postgres.Rebind(query))
+	assert.Equal(t, "SELECT 1", Postgres.Rebind("SELECT 1"))
+}
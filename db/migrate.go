@@ -0,0 +1,447 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockKey identifies the Postgres advisory lock held while migrating
+const migrationLockKey = 0x63686174636f6c6c // "chatcoll"
+
+var (
+	// ErrDatabaseAhead is returned when the database has migrations this binary does not know about
+	ErrDatabaseAhead = errors.New("database schema is newer than this binary")
+
+	// ErrChecksumMismatch is returned when an applied migration was changed after it ran
+	ErrChecksumMismatch = errors.New("applied migration does not match its source")
+)
+
+// Migration is a numbered schema change with its up and down SQL
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool
+	Unknown   bool
+}
+
+// Migrations returns the migrations embedded in the binary for the
+// current Driver, ordered by version
+func Migrations() ([]Migration, error) {
+	migrationsDir := Driver.migrationsDir()
+	entries, err := fs.ReadDir(migrationFiles, migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		// File names look like 0001_initial_schema.up.sql
+		name := entry.Name()
+		base, direction, ok := cutDirection(name)
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name>.up.sql or .down.sql", name)
+		}
+		number, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", name)
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join(migrationsDir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up step", m.Version)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func cutDirection(name string) (string, string, bool) {
+	if base, ok := strings.CutSuffix(name, ".up.sql"); ok {
+		return base, "up", true
+	}
+	if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func ensureMigrationsTable(conn *sql.DB) error {
+	timestamp := "DATETIME"
+	if Driver == Postgres {
+		timestamp = "TIMESTAMPTZ"
+	}
+
+	_, err := conn.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at ` + timestamp + ` NOT NULL
+	)`)
+	return err
+}
+
+func appliedMigrations(conn *sql.DB) (map[int]appliedMigration, error) {
+	if err := ensureMigrationsTable(conn); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query("SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var m appliedMigration
+		if err := rows.Scan(&version, &m.name, &m.checksum, &m.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = m
+	}
+	return applied, rows.Err()
+}
+
+// Verify checks that every applied migration is known to this binary and unchanged
+func Verify(conn *sql.DB) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+
+	for version, a := range applied {
+		m, ok := known[version]
+		if !ok {
+			return fmt.Errorf("%w: migration %d is applied but unknown", ErrDatabaseAhead, version)
+		}
+		if m.Checksum != a.checksum {
+			return fmt.Errorf("%w: migration %d (%s)", ErrChecksumMismatch, version, m.Name)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies pending migrations in order, stopping after target
+// (0 applies all of them). It returns the number of migrations applied.
+// Servers sharing a database may migrate it at the same time; each
+// migration is applied by only one of them.
+func MigrateUp(conn *sql.DB, target int) (int, error) {
+	unlock, err := lockMigrations(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if err := Verify(conn); err != nil {
+		return 0, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		// Another server may have applied it since applied was read
+		skipped := false
+		err := migrationTx(conn, func(tx *sql.Tx) error {
+			done, err := isApplied(tx, m.Version)
+			if err != nil || done {
+				skipped = done
+				return err
+			}
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err = tx.Exec(
+				Driver.Rebind("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)"),
+				m.Version, m.Name, m.Checksum, time.Now(),
+			)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("applying migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if skipped {
+			continue
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// MigrateDown reverts the most recently applied migrations, at most steps of them.
+// It returns the number of migrations reverted.
+func MigrateDown(conn *sql.DB, steps int) (int, error) {
+	unlock, err := lockMigrations(conn)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if err := Verify(conn); err != nil {
+		return 0, err
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return count, fmt.Errorf("migration %d (%s) cannot be reverted", m.Version, m.Name)
+		}
+
+		err := migrationTx(conn, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(Driver.Rebind("DELETE FROM schema_migrations WHERE version = ?"), m.Version)
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("reverting migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Status lists every known migration and whether it has been applied
+func Status(conn *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.appliedAt
+			status.Modified = a.checksum != m.Checksum
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Anything left was applied by a newer binary
+	for version, a := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Version:   version,
+			Name:      a.name,
+			Applied:   true,
+			AppliedAt: a.appliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// lockMigrations keeps other servers from migrating the database until the
+// returned function is called. On Postgres it holds an advisory lock on a
+// connection of its own. SQLite migration transactions take the write lock
+// when they begin, and MigrateUp checks again inside them that a migration
+// is still pending, so no lock is needed there.
+func lockMigrations(conn *sql.DB) (func(), error) {
+	if Driver != Postgres {
+		return func() {}, nil
+	}
+
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("locking migrations: %w", err)
+	}
+	return func() {
+		c.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+		c.Close()
+	}, nil
+}
+
+// isApplied reports whether a migration is recorded as applied
+func isApplied(tx *sql.Tx, version int) (bool, error) {
+	var count int
+	err := tx.QueryRow(Driver.Rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), version).Scan(&count)
+	return count > 0, err
+}
+
+func inTx(conn *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrationTx runs fn in a transaction for applying or reverting a migration.
+// SQLite changes tables by rebuilding them, which must not fire foreign key
+// actions, so enforcement is off on the connection while the migration runs.
+// Rows the migration leaves referencing missing parents fail it instead.
+func migrationTx(conn *sql.DB, fn func(tx *sql.Tx) error) error {
+	if Driver != SQLite {
+		return inTx(conn, fn)
+	}
+
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var enforced bool
+	if err := c.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enforced); err != nil {
+		return err
+	}
+	if _, err := c.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	if enforced {
+		defer c.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := foreignKeyCheck(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// foreignKeyCheck fails if any row references a missing parent
+func foreignKeyCheck(tx *sql.Tx) error {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return err
+		}
+		return fmt.Errorf("a row in %s references a missing row in %s", table, parent)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,301 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "Migration versions should be contiguous")
+		assert.NotEmpty(t, m.Down, "Migration %d should be reversible", m.Version)
+		assert.Len(t, m.Checksum, 64)
+	}
+}
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	defer func(d Dialect) { Driver = d }(Driver)
+
+	Driver = SQLite
+	sqlite, err := Migrations()
+	require.NoError(t, err)
+
+	Driver = Postgres
+	postgres, err := Migrations()
+	require.NoError(t, err)
+
+	require.Len(t, postgres, len(sqlite), "Every migration needs a Postgres counterpart")
+	for i := range sqlite {
+		assert.Equal(t, sqlite[i].Version, postgres[i].Version)
+		assert.Equal(t, sqlite[i].Name, postgres[i].Name)
+		assert.NotEmpty(t, postgres[i].Down, "Migration %d should be reversible", postgres[i].Version)
+	}
+}
+
+func TestConcurrentMigrateUp(t *testing.T) {
+	testDBPath := "./migrate_concurrent_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	// Each replica has a pool of its own on the shared database
+	const replicas = 4
+	var wg sync.WaitGroup
+	applied := make([]int, replicas)
+	errs := make([]error, replicas)
+	for i := 0; i < replicas; i++ {
+		conn, err := sql.Open(string(SQLite), Driver.connectionString(testDBPath))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			applied[i], errs[i] = MigrateUp(conn, 0)
+		}(i)
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range applied {
+		assert.NoError(t, errs[i], "Replica %d should start", i)
+		total += applied[i]
+	}
+	assert.Equal(t, len(migrations), total, "Every migration should be applied exactly once")
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	testDBPath := "./migrate_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, Open(testDBPath))
+	defer Close()
+
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	applied, err := MigrateUp(DB, 0)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), applied)
+
+	// Applying again is a no-op
+	applied, err = MigrateUp(DB, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	statuses, err := Status(DB)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.True(t, s.Applied)
+		assert.False(t, s.Modified)
+	}
+
+	// Revert everything and check the schema is gone
+	reverted, err := MigrateDown(DB, len(migrations))
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), reverted)
+
+	var count int
+	err = DB.QueryRow("SELECT count(name) FROM sqlite_master WHERE type='table' AND name='sessions'").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestInitializeRefusesNewerDatabase(t *testing.T) {
+	testDBPath := "./ahead_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, Initialize(testDBPath))
+	_, err := DB.Exec(
+		"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+		9999, "from_the_future", "checksum", time.Now(),
+	)
+	require.NoError(t, err)
+	require.NoError(t, Close())
+
+	err = Initialize(testDBPath)
+	assert.True(t, errors.Is(err, ErrDatabaseAhead), "Expected ErrDatabaseAhead, got %v", err)
+	Close()
+}
+
+func TestInitializeDetectsModifiedMigration(t *testing.T) {
+	testDBPath := "./checksum_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, Initialize(testDBPath))
+	_, err := DB.Exec("UPDATE schema_migrations SET checksum = 'tampered' WHERE version = 1")
+	require.NoError(t, err)
+	require.NoError(t, Close())
+
+	err = Initialize(testDBPath)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch), "Expected ErrChecksumMismatch, got %v", err)
+	Close()
+}
+
+func TestReasoningLogMigration(t *testing.T) {
+	testDBPath := "./reasoning_migrate_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, Open(testDBPath))
+	defer Close()
+
+	_, err := MigrateUp(DB, 4)
+	require.NoError(t, err)
+	_, err = DB.Exec(
+		"INSERT INTO agents (id, created_at, is_online, name, role, prompt, model, reasoning_log) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		"agent1", time.Now().UTC(), true, "Agent", "assistant", "prompt", "gpt-4", "first\nsecond",
+	)
+	require.NoError(t, err)
+
+	// Each line of the old log becomes one thought, in order
+	_, err = MigrateUp(DB, 5)
+	require.NoError(t, err)
+	rows, err := DB.Query("SELECT step_type, content FROM reasoning_entries WHERE agent_id = ? ORDER BY created_at, id", "agent1")
+	require.NoError(t, err)
+	var lines []string
+	for rows.Next() {
+		var step, content string
+		require.NoError(t, rows.Scan(&step, &content))
+		assert.Equal(t, "thought", step)
+		lines = append(lines, content)
+	}
+	require.NoError(t, rows.Err())
+	rows.Close()
+	assert.Equal(t, []string{"first", "second"}, lines)
+
+	// Reverting joins them back into the column
+	_, err = MigrateDown(DB, 1)
+	require.NoError(t, err)
+	var log string
+	require.NoError(t, DB.QueryRow("SELECT reasoning_log FROM agents WHERE id = ?", "agent1").Scan(&log))
+	assert.Equal(t, "first\nsecond", log)
+}
+
+func TestForeignKeysMigration(t *testing.T) {
+	testDBPath := "./fk_migrate_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	// Seed rows left dangling by deletes made before keys were enforced
+	require.NoError(t, Open(testDBPath+"?_foreign_keys=off"))
+	_, err := MigrateUp(DB, 8)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO sessions (id, last_heartbeat, created_at) VALUES (?, ?, ?)", []interface{}{"s1", now, now}},
+		{"INSERT INTO agents (id, created_at, is_online, name, role, prompt, model, session_id, template_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			[]interface{}{"a1", now, true, "Agent", "assistant", "prompt", "gpt-4", "s1", nil}},
+		{"INSERT INTO agents (id, created_at, is_online, name, role, prompt, model, session_id, template_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			[]interface{}{"a2", now, true, "Agent", "assistant", "prompt", "gpt-4", "gone", nil}},
+		{"INSERT INTO agents (id, created_at, is_online, name, role, prompt, model, session_id, template_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			[]interface{}{"a3", now, true, "Agent", "assistant", "prompt", "gpt-4", "s1", "gone"}},
+		{"INSERT INTO messages (id, created_at, content, agent_id, session_id) VALUES (?, ?, ?, ?, ?)", []interface{}{"m1", now, "kept", "a1", "s1"}},
+		{"INSERT INTO messages (id, created_at, content, agent_id, session_id) VALUES (?, ?, ?, ?, ?)", []interface{}{"m2", now, "lost", "a1", "gone"}},
+		{"INSERT INTO messages (id, created_at, content, agent_id, session_id, parent_id, thread_root_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			[]interface{}{"m3", now, "orphaned reply", "a1", "s1", "gone", "gone"}},
+		{"INSERT INTO messages (id, created_at, content, agent_id, session_id, parent_id, thread_root_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			[]interface{}{"m4", now, "nested reply", "a1", "s1", "m3", "gone"}},
+		{"INSERT INTO message_revisions (message_id, revision, content, editor_id, created_at) VALUES (?, ?, ?, ?, ?)", []interface{}{"m2", 1, "lost", "a1", now}},
+		{"INSERT INTO session_members (session_id, user_id, joined_at, is_online) VALUES (?, ?, ?, ?)", []interface{}{"s1", "gone", now, true}},
+	} {
+		_, err := DB.Exec(stmt.query, stmt.args...)
+		require.NoError(t, err, stmt.query)
+	}
+	require.NoError(t, Close())
+
+	require.NoError(t, Open(testDBPath))
+	defer Close()
+	_, err = MigrateUp(DB, 0)
+	require.NoError(t, err)
+
+	count := func(query string, args ...interface{}) int {
+		var n int
+		require.NoError(t, DB.QueryRow(query, args...).Scan(&n))
+		return n
+	}
+	assert.Equal(t, 2, count("SELECT count(*) FROM agents"))
+	assert.Equal(t, 0, count("SELECT count(*) FROM agents WHERE template_id IS NOT NULL"))
+	assert.Equal(t, 3, count("SELECT count(*) FROM messages"))
+	assert.Equal(t, 1, count("SELECT count(*) FROM messages WHERE id = 'm3' AND parent_id IS NULL AND thread_root_id IS NULL"))
+	assert.Equal(t, 1, count("SELECT count(*) FROM messages WHERE id = 'm4' AND thread_root_id = 'm3'"))
+	assert.Equal(t, 0, count("SELECT count(*) FROM message_revisions"))
+	assert.Equal(t, 0, count("SELECT count(*) FROM session_members"))
+
+	// References are now checked, and deleting a session takes its content with it
+	_, err = DB.Exec("INSERT INTO messages (id, created_at, content, agent_id, session_id) VALUES (?, ?, ?, ?, ?)", "m5", now, "hi", "a1", "gone")
+	assert.True(t, IsForeignKeyViolation(err), "Expected a foreign key violation, got %v", err)
+	_, err = DB.Exec("DELETE FROM agents WHERE id = 'a1'")
+	assert.True(t, IsForeignKeyViolation(err), "Messages should keep their author, got %v", err)
+	_, err = DB.Exec("DELETE FROM sessions WHERE id = 's1'")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count("SELECT count(*) FROM agents"))
+	assert.Equal(t, 0, count("SELECT count(*) FROM messages"))
+
+	_, err = MigrateDown(DB, 1)
+	require.NoError(t, err)
+}
+
+func TestUserWorkspacesMigration(t *testing.T) {
+	testDBPath := "./user_workspaces_migrate_test.db"
+	_ = os.Remove(testDBPath)
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, Open(testDBPath))
+	defer Close()
+
+	_, err := MigrateUp(DB, 15)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	for _, stmt := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO workspaces (id, created_at, name) VALUES (?, ?, ?)", []interface{}{"acme", now, "Acme"}},
+		{"INSERT INTO sessions (id, last_heartbeat, created_at, workspace_id) VALUES (?, ?, ?, ?)", []interface{}{"s1", now, now, "acme"}},
+		{"INSERT INTO users (id, created_at, name) VALUES (?, ?, ?)", []interface{}{"u1", now, "Ada"}},
+		{"INSERT INTO users (id, created_at, name) VALUES (?, ?, ?)", []interface{}{"u2", now, "Bob"}},
+		{"INSERT INTO session_members (session_id, user_id, joined_at, is_online) VALUES (?, ?, ?, ?)", []interface{}{"s1", "u1", now, true}},
+	} {
+		_, err := DB.Exec(stmt.query, stmt.args...)
+		require.NoError(t, err, stmt.query)
+	}
+
+	// Users move to the workspace of the session they joined
+	_, err = MigrateUp(DB, 16)
+	require.NoError(t, err)
+	workspace := func(userID string) string {
+		var id string
+		require.NoError(t, DB.QueryRow("SELECT workspace_id FROM users WHERE id = ?", userID).Scan(&id))
+		return id
+	}
+	assert.Equal(t, "acme", workspace("u1"))
+	assert.Equal(t, "default", workspace("u2"))
+
+	_, err = MigrateDown(DB, 1)
+	require.NoError(t, err)
+	var count int
+	require.NoError(t, DB.QueryRow("SELECT count(*) FROM users").Scan(&count))
+	assert.Equal(t, 2, count)
+	require.NoError(t, DB.QueryRow("SELECT count(*) FROM session_members").Scan(&count))
+	assert.Equal(t, 1, count)
+}
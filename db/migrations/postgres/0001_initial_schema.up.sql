@@ -0,0 +1,30 @@
+-- Foreign keys are declared but not enforced by the SQLite schema, so they
+-- are left out here to keep both backends accepting the same data.
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	last_heartbeat TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS agents (
+	id TEXT PRIMARY KEY,
+	is_online BOOLEAN NOT NULL,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	model TEXT NOT NULL,
+	reasoning_log TEXT,
+	session_id TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_agents_session_id ON agents (session_id);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	content TEXT NOT NULL,
+	agent_id TEXT NOT NULL,
+	session_id TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_id ON messages (agent_id);
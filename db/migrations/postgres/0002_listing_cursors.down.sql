@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_messages_agent_created;
+DROP INDEX IF EXISTS idx_messages_session_created;
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_id ON messages (agent_id);
+
+DROP INDEX IF EXISTS idx_agents_created;
+DROP INDEX IF EXISTS idx_sessions_created;
+
+ALTER TABLE agents DROP COLUMN created_at;
+ALTER TABLE sessions DROP COLUMN created_at;
@@ -0,0 +1,20 @@
+ALTER TABLE sessions ADD COLUMN created_at TIMESTAMPTZ;
+UPDATE sessions SET created_at = last_heartbeat;
+ALTER TABLE sessions ALTER COLUMN created_at SET NOT NULL;
+
+-- Agents had no creation time; their first message or their session is the best guess
+ALTER TABLE agents ADD COLUMN created_at TIMESTAMPTZ;
+UPDATE agents SET created_at = COALESCE(
+	(SELECT MIN(created_at) FROM messages WHERE messages.agent_id = agents.id),
+	(SELECT created_at FROM sessions WHERE sessions.id = agents.session_id),
+	now()
+);
+ALTER TABLE agents ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_created ON sessions (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_agents_created ON agents (created_at, id);
+
+DROP INDEX IF EXISTS idx_messages_session_created;
+DROP INDEX IF EXISTS idx_messages_agent_id;
+CREATE INDEX idx_messages_session_created ON messages (session_id, created_at, id);
+CREATE INDEX idx_messages_agent_created ON messages (agent_id, created_at, id);
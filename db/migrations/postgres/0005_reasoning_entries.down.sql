@@ -0,0 +1,8 @@
+ALTER TABLE agents ADD COLUMN reasoning_log TEXT;
+
+UPDATE agents SET reasoning_log = (
+	SELECT string_agg(content, E'\n' ORDER BY created_at, id)
+	FROM reasoning_entries WHERE reasoning_entries.agent_id = agents.id
+);
+
+DROP TABLE IF EXISTS reasoning_entries;
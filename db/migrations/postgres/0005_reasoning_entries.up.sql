@@ -0,0 +1,22 @@
+-- One row per reasoning step, replacing the newline-joined agents.reasoning_log
+CREATE TABLE IF NOT EXISTS reasoning_entries (
+	id TEXT PRIMARY KEY,
+	agent_id TEXT NOT NULL,
+	session_id TEXT,
+	created_at TIMESTAMPTZ NOT NULL,
+	step_type TEXT NOT NULL,
+	message_id TEXT,
+	content TEXT NOT NULL,
+	payload JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_reasoning_agent_created ON reasoning_entries (agent_id, created_at, id);
+
+-- Each line of an existing log becomes a thought stamped with the agent's
+-- creation time; the zero-padded line number in the ID keeps them in order
+INSERT INTO reasoning_entries (id, agent_id, session_id, created_at, step_type, content)
+SELECT 'legacy-' || agents.id || '-' || lpad(lines.n::text, 6, '0'), agents.id, agents.session_id, agents.created_at, 'thought', lines.line
+FROM agents, unnest(string_to_array(agents.reasoning_log, E'\n')) WITH ORDINALITY AS lines (line, n)
+WHERE agents.reasoning_log IS NOT NULL AND agents.reasoning_log <> '';
+
+ALTER TABLE agents DROP COLUMN reasoning_log;
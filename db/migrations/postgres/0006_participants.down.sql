@@ -0,0 +1,11 @@
+-- Messages written by users cannot be kept without an agent to attribute them to
+DELETE FROM message_revisions WHERE message_id IN (SELECT id FROM messages WHERE agent_id IS NULL);
+DELETE FROM messages WHERE agent_id IS NULL;
+
+DROP INDEX IF EXISTS idx_messages_user_created;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_one_author;
+ALTER TABLE messages DROP COLUMN user_id;
+ALTER TABLE messages ALTER COLUMN agent_id SET NOT NULL;
+
+DROP TABLE IF EXISTS session_members;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,27 @@
+-- People who take part in sessions alongside agents
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	name TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_created ON users (created_at, id);
+
+-- Users belong to any number of sessions, each with its own presence.
+-- Agents stay bound to their one session through agents.session_id.
+CREATE TABLE IF NOT EXISTS session_members (
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	joined_at TIMESTAMPTZ NOT NULL,
+	is_online BOOLEAN NOT NULL,
+	PRIMARY KEY (session_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_members_user ON session_members (user_id);
+
+-- A message is written by exactly one agent or user
+ALTER TABLE messages ALTER COLUMN agent_id DROP NOT NULL;
+ALTER TABLE messages ADD COLUMN user_id TEXT;
+ALTER TABLE messages ADD CONSTRAINT messages_one_author CHECK ((agent_id IS NULL) <> (user_id IS NULL));
+
+CREATE INDEX IF NOT EXISTS idx_messages_user_created ON messages (user_id, created_at, id);
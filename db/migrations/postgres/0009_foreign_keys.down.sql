@@ -0,0 +1,26 @@
+-- Rows removed by the cleanup in the up migration are not restored
+DROP INDEX IF EXISTS idx_reasoning_message;
+DROP INDEX IF EXISTS idx_messages_parent;
+DROP INDEX IF EXISTS idx_agents_session;
+
+ALTER TABLE session_members
+	DROP CONSTRAINT IF EXISTS fk_session_members_user,
+	DROP CONSTRAINT IF EXISTS fk_session_members_session;
+
+ALTER TABLE reasoning_entries
+	DROP CONSTRAINT IF EXISTS fk_reasoning_message,
+	DROP CONSTRAINT IF EXISTS fk_reasoning_session,
+	DROP CONSTRAINT IF EXISTS fk_reasoning_agent;
+
+ALTER TABLE message_revisions
+	DROP CONSTRAINT IF EXISTS fk_message_revisions_message;
+
+ALTER TABLE messages
+	DROP CONSTRAINT IF EXISTS fk_messages_parent,
+	DROP CONSTRAINT IF EXISTS fk_messages_session,
+	DROP CONSTRAINT IF EXISTS fk_messages_user,
+	DROP CONSTRAINT IF EXISTS fk_messages_agent;
+
+ALTER TABLE agents
+	DROP CONSTRAINT IF EXISTS fk_agents_template,
+	DROP CONSTRAINT IF EXISTS fk_agents_session;
@@ -0,0 +1,71 @@
+-- Foreign keys are enforced from now on, each relation with an explicit
+-- delete policy:
+--   session -> its agents, messages and memberships: cascade
+--   agent -> its reasoning entries: cascade; -> its messages: restrict
+--   user -> its memberships: cascade; -> its messages: restrict
+--   message -> its revisions: cascade; -> its replies: restrict;
+--              -> reasoning entries citing it: set null
+--   template -> agents made from it: set null
+-- Restrictions use the default NO ACTION so they are checked once a
+-- statement's cascades have run, which lets a session delete its agents
+-- together with their messages.
+
+-- Earlier deletes left rows pointing at nothing; clear them up so the
+-- constraints hold. Content that is no longer reachable is dropped.
+UPDATE agents SET session_id = NULL WHERE session_id = '';
+UPDATE agents SET template_id = NULL, template_version = NULL, pinned = FALSE
+WHERE template_id IS NOT NULL AND template_id NOT IN (SELECT id FROM agent_templates);
+DELETE FROM agents WHERE session_id IS NOT NULL AND session_id NOT IN (SELECT id FROM sessions);
+
+DELETE FROM messages
+WHERE session_id NOT IN (SELECT id FROM sessions)
+	OR (agent_id IS NOT NULL AND agent_id NOT IN (SELECT id FROM agents))
+	OR (user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users));
+
+-- Replies whose parent is gone become top-level messages, and the rest of
+-- their thread follows them
+UPDATE messages SET parent_id = NULL, thread_root_id = NULL
+WHERE parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM messages);
+
+WITH RECURSIVE threads (id, root_id) AS (
+	SELECT id, id FROM messages WHERE parent_id IS NULL
+	UNION ALL
+	SELECT messages.id, threads.root_id FROM messages JOIN threads ON messages.parent_id = threads.id
+)
+UPDATE messages SET thread_root_id = threads.root_id
+FROM threads
+WHERE threads.id = messages.id AND messages.parent_id IS NOT NULL
+	AND messages.thread_root_id NOT IN (SELECT id FROM messages);
+
+DELETE FROM message_revisions WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM reasoning_entries WHERE agent_id NOT IN (SELECT id FROM agents);
+UPDATE reasoning_entries SET session_id = NULL WHERE session_id NOT IN (SELECT id FROM sessions);
+UPDATE reasoning_entries SET message_id = NULL WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM session_members
+WHERE session_id NOT IN (SELECT id FROM sessions) OR user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE agents
+	ADD CONSTRAINT fk_agents_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+	ADD CONSTRAINT fk_agents_template FOREIGN KEY (template_id) REFERENCES agent_templates(id) ON DELETE SET NULL;
+
+ALTER TABLE messages
+	ADD CONSTRAINT fk_messages_agent FOREIGN KEY (agent_id) REFERENCES agents(id),
+	ADD CONSTRAINT fk_messages_user FOREIGN KEY (user_id) REFERENCES users(id),
+	ADD CONSTRAINT fk_messages_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+	ADD CONSTRAINT fk_messages_parent FOREIGN KEY (parent_id) REFERENCES messages(id);
+
+ALTER TABLE message_revisions
+	ADD CONSTRAINT fk_message_revisions_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE;
+
+ALTER TABLE reasoning_entries
+	ADD CONSTRAINT fk_reasoning_agent FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE,
+	ADD CONSTRAINT fk_reasoning_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL,
+	ADD CONSTRAINT fk_reasoning_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE SET NULL;
+
+ALTER TABLE session_members
+	ADD CONSTRAINT fk_session_members_session FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+	ADD CONSTRAINT fk_session_members_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_agents_session ON agents (session_id);
+CREATE INDEX IF NOT EXISTS idx_messages_parent ON messages (parent_id);
+CREATE INDEX IF NOT EXISTS idx_reasoning_message ON reasoning_entries (message_id);
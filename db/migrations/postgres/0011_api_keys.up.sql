@@ -0,0 +1,16 @@
+-- API keys authenticate clients. Only a SHA-256 hash of each key is kept,
+-- along with its first characters so people can tell keys apart. scopes holds
+-- a JSON array; keys restricted to a session go when the session does.
+CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes JSONB NOT NULL DEFAULT '[]',
+	session_id TEXT REFERENCES sessions(id) ON DELETE CASCADE,
+	revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_created ON api_keys (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_session ON api_keys (session_id);
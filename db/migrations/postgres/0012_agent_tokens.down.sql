@@ -0,0 +1,5 @@
+-- Agent tokens would become keys for their whole session, so they are dropped
+DELETE FROM api_keys WHERE agent_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_api_keys_agent;
+
+ALTER TABLE api_keys DROP COLUMN agent_id;
@@ -0,0 +1,6 @@
+-- Keys acting for a user would lose every restriction, so they are dropped
+DELETE FROM api_keys WHERE user_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_api_keys_user;
+
+ALTER TABLE api_keys DROP COLUMN user_id;
+ALTER TABLE session_members DROP COLUMN role;
@@ -0,0 +1,10 @@
+-- Every workspace's records fall back into one shared space
+DROP INDEX IF EXISTS idx_api_keys_workspace;
+DROP INDEX IF EXISTS idx_agent_templates_workspace;
+DROP INDEX IF EXISTS idx_sessions_workspace;
+
+ALTER TABLE api_keys DROP COLUMN workspace_id;
+ALTER TABLE agent_templates DROP COLUMN workspace_id;
+ALTER TABLE sessions DROP COLUMN workspace_id;
+
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,3 @@
+-- Sessions may cap how many messages they hold, pausing when they reach it.
+-- Zero means no cap.
+ALTER TABLE sessions ADD COLUMN max_messages INTEGER NOT NULL DEFAULT 0;
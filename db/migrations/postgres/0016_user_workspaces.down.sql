@@ -0,0 +1,4 @@
+-- Users are shared by every workspace again
+DROP INDEX IF EXISTS idx_users_workspace;
+
+ALTER TABLE users DROP COLUMN workspace_id;
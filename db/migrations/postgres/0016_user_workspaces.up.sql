@@ -0,0 +1,13 @@
+-- Users belong to a workspace like sessions do, so one tenant cannot see,
+-- rename or delete another's users; they go with their workspace. Users
+-- move to the workspace of the first session they joined, the rest stay in
+-- the default one.
+ALTER TABLE users ADD COLUMN workspace_id TEXT NOT NULL DEFAULT 'default' REFERENCES workspaces(id) ON DELETE CASCADE;
+
+UPDATE users SET workspace_id = (
+	SELECT s.workspace_id FROM session_members sm JOIN sessions s ON s.id = sm.session_id
+	WHERE sm.user_id = users.id ORDER BY sm.joined_at, sm.session_id LIMIT 1
+)
+WHERE id IN (SELECT user_id FROM session_members);
+
+CREATE INDEX IF NOT EXISTS idx_users_workspace ON users (workspace_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS agents;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	last_heartbeat DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS agents (
+	id TEXT PRIMARY KEY,
+	is_online BOOLEAN NOT NULL,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	model TEXT NOT NULL,
+	reasoning_log TEXT,
+	session_id TEXT,
+	FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	content TEXT NOT NULL,
+	agent_id TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	FOREIGN KEY (agent_id) REFERENCES agents(id),
+	FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
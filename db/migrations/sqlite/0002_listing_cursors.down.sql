@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_messages_agent_created;
+DROP INDEX IF EXISTS idx_messages_session_created;
+DROP INDEX IF EXISTS idx_agents_created;
+DROP INDEX IF EXISTS idx_sessions_created;
+
+ALTER TABLE agents DROP COLUMN created_at;
+ALTER TABLE sessions DROP COLUMN created_at;
@@ -0,0 +1,15 @@
+ALTER TABLE sessions ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+UPDATE sessions SET created_at = last_heartbeat;
+
+-- Agents had no creation time; their first message or their session is the best guess
+ALTER TABLE agents ADD COLUMN created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
+UPDATE agents SET created_at = COALESCE(
+	(SELECT MIN(created_at) FROM messages WHERE messages.agent_id = agents.id),
+	(SELECT created_at FROM sessions WHERE sessions.id = agents.session_id),
+	created_at
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_created ON sessions (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_agents_created ON agents (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_created ON messages (agent_id, created_at, id);
@@ -0,0 +1,6 @@
+-- Replies point at the message they answer and at the top of their thread;
+-- both are NULL for top-level messages
+ALTER TABLE messages ADD COLUMN parent_id TEXT;
+ALTER TABLE messages ADD COLUMN thread_root_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages (thread_root_id, created_at, id);
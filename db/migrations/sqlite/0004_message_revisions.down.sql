@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS message_revisions;
+
+ALTER TABLE messages DROP COLUMN edited_by;
+ALTER TABLE messages DROP COLUMN edited_at;
+ALTER TABLE messages DROP COLUMN revision;
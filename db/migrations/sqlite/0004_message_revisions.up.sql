@@ -0,0 +1,16 @@
+ALTER TABLE messages ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE messages ADD COLUMN edited_at DATETIME;
+ALTER TABLE messages ADD COLUMN edited_by TEXT;
+
+-- Every version of a message's content, starting with the original as revision 1
+CREATE TABLE IF NOT EXISTS message_revisions (
+	message_id TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	editor_id TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (message_id, revision)
+);
+
+INSERT INTO message_revisions (message_id, revision, content, editor_id, created_at)
+SELECT id, 1, content, agent_id, created_at FROM messages;
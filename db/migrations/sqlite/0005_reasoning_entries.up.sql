@@ -0,0 +1,30 @@
+-- One row per reasoning step, replacing the newline-joined agents.reasoning_log
+CREATE TABLE IF NOT EXISTS reasoning_entries (
+	id TEXT PRIMARY KEY,
+	agent_id TEXT NOT NULL,
+	session_id TEXT,
+	created_at DATETIME NOT NULL,
+	step_type TEXT NOT NULL,
+	message_id TEXT,
+	content TEXT NOT NULL,
+	payload TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_reasoning_agent_created ON reasoning_entries (agent_id, created_at, id);
+
+-- Each line of an existing log becomes a thought stamped with the agent's
+-- creation time; the zero-padded line number in the ID keeps them in order
+WITH RECURSIVE lines (agent_id, session_id, created_at, n, line, rest) AS (
+	SELECT id, session_id, created_at, 0, NULL, reasoning_log || char(10)
+	FROM agents WHERE reasoning_log IS NOT NULL AND reasoning_log <> ''
+	UNION ALL
+	SELECT agent_id, session_id, created_at, n + 1,
+		substr(rest, 1, instr(rest, char(10)) - 1),
+		substr(rest, instr(rest, char(10)) + 1)
+	FROM lines WHERE rest <> ''
+)
+INSERT INTO reasoning_entries (id, agent_id, session_id, created_at, step_type, content)
+SELECT printf('legacy-%s-%06d', agent_id, n), agent_id, session_id, created_at, 'thought', line
+FROM lines WHERE n > 0;
+
+ALTER TABLE agents DROP COLUMN reasoning_log;
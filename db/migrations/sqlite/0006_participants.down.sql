@@ -0,0 +1,31 @@
+-- Messages written by users cannot be kept without an agent to attribute them to
+CREATE TABLE messages_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	content TEXT NOT NULL,
+	agent_id TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	parent_id TEXT,
+	thread_root_id TEXT,
+	revision INTEGER NOT NULL DEFAULT 1,
+	edited_at DATETIME,
+	edited_by TEXT,
+	FOREIGN KEY (agent_id) REFERENCES agents(id),
+	FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
+
+INSERT INTO messages_old (id, created_at, content, agent_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by)
+SELECT id, created_at, content, agent_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by
+FROM messages WHERE agent_id IS NOT NULL;
+
+DELETE FROM message_revisions WHERE message_id NOT IN (SELECT id FROM messages_old);
+
+DROP TABLE messages;
+ALTER TABLE messages_old RENAME TO messages;
+
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_created ON messages (agent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages (thread_root_id, created_at, id);
+
+DROP TABLE IF EXISTS session_members;
+DROP TABLE IF EXISTS users;
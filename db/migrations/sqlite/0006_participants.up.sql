@@ -0,0 +1,54 @@
+-- People who take part in sessions alongside agents
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_created ON users (created_at, id);
+
+-- Users belong to any number of sessions, each with its own presence.
+-- Agents stay bound to their one session through agents.session_id.
+CREATE TABLE IF NOT EXISTS session_members (
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	joined_at DATETIME NOT NULL,
+	is_online BOOLEAN NOT NULL,
+	PRIMARY KEY (session_id, user_id),
+	FOREIGN KEY (session_id) REFERENCES sessions(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_members_user ON session_members (user_id);
+
+-- A message is written by exactly one agent or user. SQLite cannot relax
+-- NOT NULL in place, so the table is rebuilt; the search triggers dropped
+-- with it are recreated on startup.
+CREATE TABLE messages_new (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	content TEXT NOT NULL,
+	agent_id TEXT,
+	user_id TEXT,
+	session_id TEXT NOT NULL,
+	parent_id TEXT,
+	thread_root_id TEXT,
+	revision INTEGER NOT NULL DEFAULT 1,
+	edited_at DATETIME,
+	edited_by TEXT,
+	CHECK ((agent_id IS NULL) <> (user_id IS NULL)),
+	FOREIGN KEY (agent_id) REFERENCES agents(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
+
+INSERT INTO messages_new (id, created_at, content, agent_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by)
+SELECT id, created_at, content, agent_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by FROM messages;
+
+DROP TABLE messages;
+ALTER TABLE messages_new RENAME TO messages;
+
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_created ON messages (agent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_user_created ON messages (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages (thread_root_id, created_at, id);
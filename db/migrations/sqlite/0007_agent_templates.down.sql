@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_agents_template;
+
+ALTER TABLE agents DROP COLUMN pinned;
+ALTER TABLE agents DROP COLUMN template_version;
+ALTER TABLE agents DROP COLUMN template_id;
+
+DROP TABLE IF EXISTS agent_templates;
@@ -0,0 +1,22 @@
+-- Reusable agent definitions instantiated into sessions. version counts
+-- updates so agents can tell which revision of the template they run.
+CREATE TABLE IF NOT EXISTS agent_templates (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	model TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_agent_templates_created ON agent_templates (created_at, id);
+
+-- Agents remember the template and version they were made from; pinned
+-- agents are left alone when the template changes
+ALTER TABLE agents ADD COLUMN template_id TEXT REFERENCES agent_templates(id);
+ALTER TABLE agents ADD COLUMN template_version INTEGER;
+ALTER TABLE agents ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_agents_template ON agents (template_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_sessions_status;
+
+ALTER TABLE sessions DROP COLUMN closed_at;
+ALTER TABLE sessions DROP COLUMN status;
+ALTER TABLE sessions DROP COLUMN tags;
+ALTER TABLE sessions DROP COLUMN goal;
+ALTER TABLE sessions DROP COLUMN title;
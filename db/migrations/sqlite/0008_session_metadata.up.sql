@@ -0,0 +1,9 @@
+-- Session metadata and lifecycle. tags holds a JSON array of strings.
+-- Sessions that already exist keep accepting messages, so they start out running.
+ALTER TABLE sessions ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN goal TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE sessions ADD COLUMN status TEXT NOT NULL DEFAULT 'running';
+ALTER TABLE sessions ADD COLUMN closed_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_status ON sessions (status);
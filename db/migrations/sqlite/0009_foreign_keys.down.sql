@@ -0,0 +1,100 @@
+-- Back to the constraints declared before delete policies existed. Rows
+-- removed by the cleanup in the up migration are not restored.
+CREATE TABLE agents_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	is_online BOOLEAN NOT NULL,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	model TEXT NOT NULL,
+	session_id TEXT,
+	template_id TEXT REFERENCES agent_templates(id),
+	template_version INTEGER,
+	pinned BOOLEAN NOT NULL DEFAULT FALSE,
+	FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
+
+INSERT INTO agents_old (id, created_at, is_online, name, role, prompt, model, session_id, template_id, template_version, pinned)
+SELECT id, created_at, is_online, name, role, prompt, model, session_id, template_id, template_version, pinned FROM agents;
+
+CREATE TABLE messages_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	content TEXT NOT NULL,
+	agent_id TEXT,
+	user_id TEXT,
+	session_id TEXT NOT NULL,
+	parent_id TEXT,
+	thread_root_id TEXT,
+	revision INTEGER NOT NULL DEFAULT 1,
+	edited_at DATETIME,
+	edited_by TEXT,
+	CHECK ((agent_id IS NULL) <> (user_id IS NULL)),
+	FOREIGN KEY (agent_id) REFERENCES agents(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	FOREIGN KEY (session_id) REFERENCES sessions(id)
+);
+
+INSERT INTO messages_old (id, created_at, content, agent_id, user_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by)
+SELECT id, created_at, content, agent_id, user_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by FROM messages;
+
+CREATE TABLE message_revisions_old (
+	message_id TEXT NOT NULL,
+	revision INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	editor_id TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (message_id, revision)
+);
+
+INSERT INTO message_revisions_old (message_id, revision, content, editor_id, created_at)
+SELECT message_id, revision, content, editor_id, created_at FROM message_revisions;
+
+CREATE TABLE reasoning_entries_old (
+	id TEXT PRIMARY KEY,
+	agent_id TEXT NOT NULL,
+	session_id TEXT,
+	created_at DATETIME NOT NULL,
+	step_type TEXT NOT NULL,
+	message_id TEXT,
+	content TEXT NOT NULL,
+	payload TEXT
+);
+
+INSERT INTO reasoning_entries_old (id, agent_id, session_id, created_at, step_type, message_id, content, payload)
+SELECT id, agent_id, session_id, created_at, step_type, message_id, content, payload FROM reasoning_entries;
+
+CREATE TABLE session_members_old (
+	session_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	joined_at DATETIME NOT NULL,
+	is_online BOOLEAN NOT NULL,
+	PRIMARY KEY (session_id, user_id),
+	FOREIGN KEY (session_id) REFERENCES sessions(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+INSERT INTO session_members_old (session_id, user_id, joined_at, is_online)
+SELECT session_id, user_id, joined_at, is_online FROM session_members;
+
+DROP TABLE session_members;
+DROP TABLE reasoning_entries;
+DROP TABLE message_revisions;
+DROP TABLE messages;
+DROP TABLE agents;
+
+ALTER TABLE agents_old RENAME TO agents;
+ALTER TABLE messages_old RENAME TO messages;
+ALTER TABLE message_revisions_old RENAME TO message_revisions;
+ALTER TABLE reasoning_entries_old RENAME TO reasoning_entries;
+ALTER TABLE session_members_old RENAME TO session_members;
+
+CREATE INDEX IF NOT EXISTS idx_agents_created ON agents (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_agents_template ON agents (template_id);
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_created ON messages (agent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_user_created ON messages (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages (thread_root_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_reasoning_agent_created ON reasoning_entries (agent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_session_members_user ON session_members (user_id);
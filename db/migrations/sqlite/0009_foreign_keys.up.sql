@@ -0,0 +1,141 @@
+-- Foreign keys are enforced from now on, each relation with an explicit
+-- delete policy:
+--   session -> its agents, messages and memberships: cascade
+--   agent -> its reasoning entries: cascade; -> its messages: restrict
+--   user -> its memberships: cascade; -> its messages: restrict
+--   message -> its revisions: cascade; -> its replies: restrict;
+--              -> reasoning entries citing it: set null
+--   template -> agents made from it: set null
+-- Restrictions use the default NO ACTION so they are checked once a
+-- statement's cascades have run, which lets a session delete its agents
+-- together with their messages.
+
+-- Earlier deletes left rows pointing at nothing; clear them up so the
+-- constraints hold. Content that is no longer reachable is dropped.
+UPDATE agents SET session_id = NULL WHERE session_id = '';
+UPDATE agents SET template_id = NULL, template_version = NULL, pinned = FALSE
+WHERE template_id IS NOT NULL AND template_id NOT IN (SELECT id FROM agent_templates);
+DELETE FROM agents WHERE session_id IS NOT NULL AND session_id NOT IN (SELECT id FROM sessions);
+
+DELETE FROM messages
+WHERE session_id NOT IN (SELECT id FROM sessions)
+	OR (agent_id IS NOT NULL AND agent_id NOT IN (SELECT id FROM agents))
+	OR (user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users));
+
+-- Replies whose parent is gone become top-level messages, and the rest of
+-- their thread follows them
+UPDATE messages SET parent_id = NULL, thread_root_id = NULL
+WHERE parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM messages);
+
+WITH RECURSIVE threads (id, root_id) AS (
+	SELECT id, id FROM messages WHERE parent_id IS NULL
+	UNION ALL
+	SELECT messages.id, threads.root_id FROM messages JOIN threads ON messages.parent_id = threads.id
+)
+UPDATE messages SET thread_root_id = (SELECT root_id FROM threads WHERE threads.id = messages.id)
+WHERE parent_id IS NOT NULL AND thread_root_id NOT IN (SELECT id FROM messages);
+
+DELETE FROM message_revisions WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM reasoning_entries WHERE agent_id NOT IN (SELECT id FROM agents);
+UPDATE reasoning_entries SET session_id = NULL WHERE session_id NOT IN (SELECT id FROM sessions);
+UPDATE reasoning_entries SET message_id = NULL WHERE message_id NOT IN (SELECT id FROM messages);
+DELETE FROM session_members
+WHERE session_id NOT IN (SELECT id FROM sessions) OR user_id NOT IN (SELECT id FROM users);
+
+-- SQLite cannot change a table's constraints in place, so every child table
+-- is rebuilt. The search triggers dropped with messages are recreated on startup.
+CREATE TABLE agents_new (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	is_online BOOLEAN NOT NULL,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	model TEXT NOT NULL,
+	session_id TEXT REFERENCES sessions(id) ON DELETE CASCADE,
+	template_id TEXT REFERENCES agent_templates(id) ON DELETE SET NULL,
+	template_version INTEGER,
+	pinned BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO agents_new (id, created_at, is_online, name, role, prompt, model, session_id, template_id, template_version, pinned)
+SELECT id, created_at, is_online, name, role, prompt, model, session_id, template_id, template_version, pinned FROM agents;
+
+CREATE TABLE messages_new (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	content TEXT NOT NULL,
+	agent_id TEXT REFERENCES agents(id),
+	user_id TEXT REFERENCES users(id),
+	session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	parent_id TEXT REFERENCES messages(id),
+	thread_root_id TEXT,
+	revision INTEGER NOT NULL DEFAULT 1,
+	edited_at DATETIME,
+	edited_by TEXT,
+	CHECK ((agent_id IS NULL) <> (user_id IS NULL))
+);
+
+INSERT INTO messages_new (id, created_at, content, agent_id, user_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by)
+SELECT id, created_at, content, agent_id, user_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by FROM messages;
+
+CREATE TABLE message_revisions_new (
+	message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	revision INTEGER NOT NULL,
+	content TEXT NOT NULL,
+	editor_id TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY (message_id, revision)
+);
+
+INSERT INTO message_revisions_new (message_id, revision, content, editor_id, created_at)
+SELECT message_id, revision, content, editor_id, created_at FROM message_revisions;
+
+CREATE TABLE reasoning_entries_new (
+	id TEXT PRIMARY KEY,
+	agent_id TEXT NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+	session_id TEXT REFERENCES sessions(id) ON DELETE SET NULL,
+	created_at DATETIME NOT NULL,
+	step_type TEXT NOT NULL,
+	message_id TEXT REFERENCES messages(id) ON DELETE SET NULL,
+	content TEXT NOT NULL,
+	payload TEXT
+);
+
+INSERT INTO reasoning_entries_new (id, agent_id, session_id, created_at, step_type, message_id, content, payload)
+SELECT id, agent_id, session_id, created_at, step_type, message_id, content, payload FROM reasoning_entries;
+
+CREATE TABLE session_members_new (
+	session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	joined_at DATETIME NOT NULL,
+	is_online BOOLEAN NOT NULL,
+	PRIMARY KEY (session_id, user_id)
+);
+
+INSERT INTO session_members_new (session_id, user_id, joined_at, is_online)
+SELECT session_id, user_id, joined_at, is_online FROM session_members;
+
+DROP TABLE session_members;
+DROP TABLE reasoning_entries;
+DROP TABLE message_revisions;
+DROP TABLE messages;
+DROP TABLE agents;
+
+ALTER TABLE agents_new RENAME TO agents;
+ALTER TABLE messages_new RENAME TO messages;
+ALTER TABLE message_revisions_new RENAME TO message_revisions;
+ALTER TABLE reasoning_entries_new RENAME TO reasoning_entries;
+ALTER TABLE session_members_new RENAME TO session_members;
+
+CREATE INDEX IF NOT EXISTS idx_agents_created ON agents (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_agents_template ON agents (template_id);
+CREATE INDEX IF NOT EXISTS idx_agents_session ON agents (session_id);
+CREATE INDEX IF NOT EXISTS idx_messages_session_created ON messages (session_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_agent_created ON messages (agent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_user_created ON messages (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages (thread_root_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_messages_parent ON messages (parent_id);
+CREATE INDEX IF NOT EXISTS idx_reasoning_agent_created ON reasoning_entries (agent_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_reasoning_message ON reasoning_entries (message_id);
+CREATE INDEX IF NOT EXISTS idx_session_members_user ON session_members (user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE sessions DROP COLUMN version;
+ALTER TABLE agents DROP COLUMN version;
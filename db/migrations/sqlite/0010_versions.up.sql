@@ -0,0 +1,4 @@
+-- version counts changes to agents and sessions so clients can detect
+-- concurrent edits. Messages already count theirs in revision.
+ALTER TABLE agents ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE sessions ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
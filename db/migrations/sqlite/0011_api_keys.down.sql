@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_api_keys_session;
+DROP INDEX IF EXISTS idx_api_keys_created;
+
+DROP TABLE IF EXISTS api_keys;
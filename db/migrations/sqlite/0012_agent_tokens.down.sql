@@ -0,0 +1,24 @@
+-- Agent tokens would become keys for their whole session, so they are
+-- dropped. SQLite cannot drop a column with a foreign key, so the table is rebuilt.
+DELETE FROM api_keys WHERE agent_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_api_keys_agent;
+
+CREATE TABLE api_keys_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '[]',
+	session_id TEXT REFERENCES sessions(id) ON DELETE CASCADE,
+	revoked_at DATETIME
+);
+
+INSERT INTO api_keys_old (id, created_at, name, prefix, key_hash, scopes, session_id, revoked_at)
+SELECT id, created_at, name, prefix, key_hash, scopes, session_id, revoked_at FROM api_keys;
+
+DROP TABLE api_keys;
+ALTER TABLE api_keys_old RENAME TO api_keys;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_created ON api_keys (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_session ON api_keys (session_id);
@@ -0,0 +1,5 @@
+-- Agent tokens are API keys bound to one agent, which requests made with
+-- them can only speak as. They go when the agent does.
+ALTER TABLE api_keys ADD COLUMN agent_id TEXT REFERENCES agents(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_agent ON api_keys (agent_id);
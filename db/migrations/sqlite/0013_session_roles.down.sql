@@ -0,0 +1,28 @@
+-- Keys acting for a user would lose every restriction, so they are dropped.
+-- SQLite cannot drop a column with a foreign key, so the table is rebuilt.
+DELETE FROM api_keys WHERE user_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_api_keys_user;
+
+CREATE TABLE api_keys_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '[]',
+	session_id TEXT REFERENCES sessions(id) ON DELETE CASCADE,
+	revoked_at DATETIME,
+	agent_id TEXT REFERENCES agents(id) ON DELETE CASCADE
+);
+
+INSERT INTO api_keys_old (id, created_at, name, prefix, key_hash, scopes, session_id, revoked_at, agent_id)
+SELECT id, created_at, name, prefix, key_hash, scopes, session_id, revoked_at, agent_id FROM api_keys;
+
+DROP TABLE api_keys;
+ALTER TABLE api_keys_old RENAME TO api_keys;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_created ON api_keys (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_session ON api_keys (session_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_agent ON api_keys (agent_id);
+
+ALTER TABLE session_members DROP COLUMN role;
@@ -0,0 +1,9 @@
+-- Users are owners, members or viewers of the sessions they belong to.
+-- Everyone who joined before roles existed could post, so they are members.
+ALTER TABLE session_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+-- API keys can act for a user, who is then held to their role in each
+-- session. They go when the user does.
+ALTER TABLE api_keys ADD COLUMN user_id TEXT REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id);
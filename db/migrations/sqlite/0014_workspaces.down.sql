@@ -0,0 +1,71 @@
+-- Every workspace's records fall back into one shared space. SQLite cannot
+-- drop a column with a foreign key, so the tables are rebuilt.
+DROP INDEX IF EXISTS idx_api_keys_workspace;
+DROP INDEX IF EXISTS idx_agent_templates_workspace;
+DROP INDEX IF EXISTS idx_sessions_workspace;
+
+CREATE TABLE sessions_old (
+	id TEXT PRIMARY KEY,
+	last_heartbeat DATETIME NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00+00:00',
+	title TEXT NOT NULL DEFAULT '',
+	goal TEXT NOT NULL DEFAULT '',
+	tags TEXT NOT NULL DEFAULT '[]',
+	status TEXT NOT NULL DEFAULT 'running',
+	closed_at DATETIME,
+	version INTEGER NOT NULL DEFAULT 1
+);
+
+INSERT INTO sessions_old (id, last_heartbeat, created_at, title, goal, tags, status, closed_at, version)
+SELECT id, last_heartbeat, created_at, title, goal, tags, status, closed_at, version FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_old RENAME TO sessions;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_created ON sessions (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_sessions_status ON sessions (status);
+
+CREATE TABLE agent_templates_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	prompt TEXT NOT NULL,
+	model TEXT NOT NULL
+);
+
+INSERT INTO agent_templates_old (id, created_at, updated_at, version, name, role, prompt, model)
+SELECT id, created_at, updated_at, version, name, role, prompt, model FROM agent_templates;
+
+DROP TABLE agent_templates;
+ALTER TABLE agent_templates_old RENAME TO agent_templates;
+
+CREATE INDEX IF NOT EXISTS idx_agent_templates_created ON agent_templates (created_at, id);
+
+CREATE TABLE api_keys_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL DEFAULT '[]',
+	session_id TEXT REFERENCES sessions(id) ON DELETE CASCADE,
+	revoked_at DATETIME,
+	agent_id TEXT REFERENCES agents(id) ON DELETE CASCADE,
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO api_keys_old (id, created_at, name, prefix, key_hash, scopes, session_id, revoked_at, agent_id, user_id)
+SELECT id, created_at, name, prefix, key_hash, scopes, session_id, revoked_at, agent_id, user_id FROM api_keys;
+
+DROP TABLE api_keys;
+ALTER TABLE api_keys_old RENAME TO api_keys;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_created ON api_keys (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_session ON api_keys (session_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_agent ON api_keys (agent_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id);
+
+DROP TABLE IF EXISTS workspaces;
@@ -0,0 +1,25 @@
+-- Workspaces own sessions, agent templates and API keys, so tenants sharing
+-- one deployment never see each other's records. Limits of 0 are unlimited.
+CREATE TABLE IF NOT EXISTS workspaces (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name TEXT NOT NULL,
+	max_sessions INTEGER NOT NULL DEFAULT 0,
+	max_agents INTEGER NOT NULL DEFAULT 0,
+	max_messages INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspaces_created ON workspaces (created_at, id);
+
+-- Everything created before workspaces existed belongs to the default one
+INSERT INTO workspaces (id, created_at, name) VALUES ('default', CURRENT_TIMESTAMP, 'Default');
+
+-- A workspace cannot be deleted while it has sessions or templates; its
+-- keys go with it
+ALTER TABLE sessions ADD COLUMN workspace_id TEXT NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE agent_templates ADD COLUMN workspace_id TEXT NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE api_keys ADD COLUMN workspace_id TEXT NOT NULL DEFAULT 'default' REFERENCES workspaces(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_workspace ON sessions (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_agent_templates_workspace ON agent_templates (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_workspace ON api_keys (workspace_id);
@@ -0,0 +1,17 @@
+-- Users are shared by every workspace again. SQLite cannot drop a column
+-- with a foreign key, so the table is rebuilt.
+DROP INDEX IF EXISTS idx_users_workspace;
+
+CREATE TABLE users_old (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name TEXT NOT NULL
+);
+
+INSERT INTO users_old (id, created_at, name)
+SELECT id, created_at, name FROM users;
+
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE INDEX IF NOT EXISTS idx_users_created ON users (created_at, id);
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// SearchTable is the SQLite FTS5 table indexing message content
+const SearchTable = "messages_fts"
+
+// EnsureSearchIndex creates the full-text index over message content and
+// reports whether one is available. It is not a versioned migration because
+// FTS5 only exists when go-sqlite3 is built with the sqlite_fts5 tag; without
+// it search falls back to substring matching.
+func EnsureSearchIndex(conn *sql.DB) (bool, error) {
+	if Driver == Postgres {
+		_, err := conn.Exec("CREATE INDEX IF NOT EXISTS idx_messages_search ON messages USING GIN (to_tsvector('simple', content))")
+		return err == nil, err
+	}
+
+	var enabled bool
+	if err := conn.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil || !enabled {
+		return false, err
+	}
+
+	err := inTx(conn, func(tx *sql.Tx) error {
+		var exists int
+		if err := tx.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", SearchTable).Scan(&exists); err != nil {
+			return err
+		}
+
+		if exists == 0 {
+			// The table keeps its own copy of the content, keyed by message ID,
+			// because message rowids are not stable across VACUUM
+			statements := []string{
+				"CREATE VIRTUAL TABLE " + SearchTable + " USING fts5(content, message_id UNINDEXED)",
+				"INSERT INTO " + SearchTable + " (content, message_id) SELECT content, id FROM messages",
+			}
+			for _, statement := range statements {
+				if _, err := tx.Exec(statement); err != nil {
+					return err
+				}
+			}
+		}
+
+		triggers := []string{
+			`CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+				INSERT INTO messages_fts (content, message_id) VALUES (new.content, new.id);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+				UPDATE messages_fts SET content = new.content WHERE message_id = old.id;
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+				DELETE FROM messages_fts WHERE message_id = old.id;
+			END`,
+		}
+		for _, trigger := range triggers {
+			if _, err := tx.Exec(trigger); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err == nil, err
+}
@@ -0,0 +1,198 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the services
+const (
+	MessageCreated = "message.created"
+	MessageUpdated = "message.updated"
+	MessageDeleted = "message.deleted"
+
+	AgentPresence    = "agent.presence"
+	AgentReasoning   = "agent.reasoning"
+	SessionHeartbeat = "session.heartbeat"
+	SessionUpdated   = "session.updated"
+	SessionDeleted   = "session.deleted"
+
+	ParticipantPresence = "participant.presence"
+
+	StreamReset = "stream.reset"
+)
+
+// subscriberBuffer is the number of undelivered events a subscriber may
+// accumulate before it is considered too slow and dropped
+const subscriberBuffer = 64
+
+// Event represents a change that happened inside a session
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	SessionID string      `json:"sessionId"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Broker is an in-process publish/subscribe hub for session events.
+// It keeps a bounded history so subscribers can resume from a previous event ID.
+type Broker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events of one session, or of every session
+// when SessionID is empty
+type Subscription struct {
+	SessionID string
+
+	ch     chan Event
+	broker *Broker
+	once   sync.Once
+}
+
+// Default is the broker shared by the services and handlers
+var Default = NewBroker(1024)
+
+// NewBroker creates a new Broker that remembers up to historySize events
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		historySize: historySize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the next event ID and delivers the event to all matching subscribers.
+// Subscribers that cannot keep up are closed so they can resume with their last event ID.
+func (b *Broker) Publish(eventType, sessionID string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{
+		ID:        b.lastID,
+		Type:      eventType,
+		SessionID: sessionID,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+
+	if b.historySize > 0 {
+		if len(b.history) >= b.historySize {
+			b.history = b.history[1:]
+		}
+		b.history = append(b.history, event)
+	}
+
+	for sub := range b.subscribers {
+		if !sub.matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a subscription for a session. It returns the buffered
+// events published after lastEventID so the caller can replay them before
+// reading from the subscription. When some of those events have already been
+// evicted from the history, or lastEventID is unknown to the broker, the replay
+// starts with a StreamReset event telling the caller to refetch its state.
+func (b *Broker) Subscribe(sessionID string, lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription{
+		SessionID: sessionID,
+		ch:        make(chan Event, subscriberBuffer),
+		broker:    b,
+	}
+	b.subscribers[sub] = struct{}{}
+
+	var missed []Event
+	if lastEventID > 0 {
+		if b.evicted(lastEventID) {
+			missed = append(missed, b.reset(sessionID, lastEventID))
+		}
+		for _, event := range b.history {
+			if event.ID > lastEventID && sub.matches(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	return sub, missed
+}
+
+// LastID returns the ID of the most recently published event
+func (b *Broker) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastID
+}
+
+// evicted reports whether events published after lastEventID are no longer
+// in the history; the caller must hold b.mu
+func (b *Broker) evicted(lastEventID uint64) bool {
+	if lastEventID > b.lastID {
+		return true
+	}
+	if lastEventID == b.lastID {
+		return false
+	}
+	return len(b.history) == 0 || b.history[0].ID > lastEventID+1
+}
+
+// reset builds the StreamReset event sent ahead of an incomplete replay.
+// It carries the ID preceding the oldest replayable event so a client that
+// resumes from it gets the rest of the history; the caller must hold b.mu.
+func (b *Broker) reset(sessionID string, lastEventID uint64) Event {
+	id := b.lastID
+	if len(b.history) > 0 && lastEventID <= b.lastID {
+		id = b.history[0].ID - 1
+	}
+	return Event{
+		ID:        id,
+		Type:      StreamReset,
+		SessionID: sessionID,
+		CreatedAt: time.Now(),
+		Data:      map[string]uint64{"lastEventId": lastEventID},
+	}
+}
+
+// remove drops a subscriber; the caller must hold b.mu
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+// Events returns the channel on which events are delivered.
+// The channel is closed when the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close unregisters the subscription
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.mu.Lock()
+		defer s.broker.mu.Unlock()
+		s.broker.remove(s)
+	})
+}
+
+func (s *Subscription) matches(event Event) bool {
+	return s.SessionID == "" || s.SessionID == event.SessionID
+}
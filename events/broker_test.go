@@ -0,0 +1,90 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	broker := NewBroker(10)
+
+	sub, missed := broker.Subscribe("session1", 0)
+	defer sub.Close()
+	assert.Empty(t, missed)
+
+	broker.Publish(MessageCreated, "session2", "ignored")
+	event := broker.Publish(MessageCreated, "session1", "hello")
+
+	received := <-sub.Events()
+	assert.Equal(t, event.ID, received.ID)
+	assert.Equal(t, MessageCreated, received.Type)
+	assert.Equal(t, "hello", received.Data)
+	assert.Len(t, sub.Events(), 0, "Events for other sessions should not be delivered")
+}
+
+func TestSubscribeReplaysMissedEvents(t *testing.T) {
+	broker := NewBroker(3)
+
+	first := broker.Publish(MessageCreated, "session1", "one")
+	broker.Publish(MessageUpdated, "session1", "two")
+	broker.Publish(MessageCreated, "session2", "other")
+	broker.Publish(MessageDeleted, "session1", "three")
+
+	sub, missed := broker.Subscribe("session1", first.ID)
+	defer sub.Close()
+
+	// The first event has been evicted from the history; only later ones are replayed
+	assert.Len(t, missed, 2)
+	assert.Equal(t, "two", missed[0].Data)
+	assert.Equal(t, "three", missed[1].Data)
+}
+
+func TestSubscribeSignalsEvictedEvents(t *testing.T) {
+	broker := NewBroker(2)
+
+	first := broker.Publish(MessageCreated, "session1", "one")
+	broker.Publish(MessageCreated, "session1", "two")
+	broker.Publish(MessageCreated, "session1", "three")
+	broker.Publish(MessageCreated, "session1", "four")
+
+	// "two" has been evicted, so the replay starts with a reset
+	sub, missed := broker.Subscribe("session1", first.ID)
+	defer sub.Close()
+	assert.Len(t, missed, 3)
+	assert.Equal(t, StreamReset, missed[0].Type)
+	assert.Equal(t, "session1", missed[0].SessionID)
+	assert.Equal(t, uint64(2), missed[0].ID)
+	assert.Equal(t, "three", missed[1].Data)
+	assert.Equal(t, "four", missed[2].Data)
+
+	// An ID the broker never issued, e.g. from before a restart, also resets
+	unknown, missed := broker.Subscribe("session1", 100)
+	defer unknown.Close()
+	assert.Len(t, missed, 1)
+	assert.Equal(t, StreamReset, missed[0].Type)
+	assert.Equal(t, broker.LastID(), missed[0].ID)
+
+	// A client that is up to date gets nothing
+	current, missed := broker.Subscribe("session1", broker.LastID())
+	defer current.Close()
+	assert.Empty(t, missed)
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	broker := NewBroker(0)
+
+	sub, _ := broker.Subscribe("", 0)
+	for i := 0; i < subscriberBuffer+1; i++ {
+		broker.Publish(MessageCreated, "session1", i)
+	}
+
+	count := 0
+	for range sub.Events() {
+		count++
+	}
+	assert.Equal(t, subscriberBuffer, count, "Channel should be closed after the buffer overflows")
+
+	// Closing an already dropped subscription is a no-op
+	sub.Close()
+}
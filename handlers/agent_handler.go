@@ -1,21 +1,31 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
 	"github.com/chatcollab/chatcollab/services"
 )
 
+// runTimeout bounds how long a single agent turn may wait on its model
+const runTimeout = 2 * time.Minute
+
 // AgentHandler handles HTTP requests for agents
 type AgentHandler struct {
 	service *services.AgentService
+	runner  *services.AgentRunner
 }
 
 // NewAgentHandler creates a new AgentHandler
-func NewAgentHandler() *AgentHandler {
+func NewAgentHandler(service *services.AgentService, runner *services.AgentRunner) *AgentHandler {
 	return &AgentHandler{
-		service: services.NewAgentService(),
+		service: service,
+		runner:  runner,
 	}
 }
 
@@ -34,7 +44,15 @@ func (h *AgentHandler) Create(c *gin.Context) {
 		return
 	}
 	
-	agent, err := h.service.CreateAgent(input.Name, input.Role, input.Prompt, input.Model, input.SessionID)
+	agent, err := scoped(c, h.service).CreateAgent(input.Name, input.Role, input.Prompt, input.Model, input.SessionID)
+	if errors.Is(err, services.ErrUnknownSession) || errors.Is(err, repositories.ErrInvalidReference) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Session not found"})
+		return
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -47,32 +65,38 @@ func (h *AgentHandler) Create(c *gin.Context) {
 func (h *AgentHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 	
-	agent, err := h.service.GetAgent(id)
+	agent, err := scoped(c, h.service).GetAgent(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
 		return
 	}
+	if cached(c, agentETag(agent)) {
+		return
+	}
 	
 	c.JSON(http.StatusOK, agent)
 }
 
-// Update updates an agent
+// Update updates an agent. With If-Match the agent must still be at that version.
 func (h *AgentHandler) Update(c *gin.Context) {
+	service := scoped(c, h.service)
 	id := c.Param("id")
 	
-	agent, err := h.service.GetAgent(id)
+	agent, err := service.GetAgent(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
 		return
 	}
+	if preconditionFailed(c, agent.Version) {
+		return
+	}
 	
 	var input struct {
-		IsOnline     *bool   `json:"isOnline"`
-		Name         *string `json:"name"`
-		Role         *string `json:"role"`
-		Prompt       *string `json:"prompt"`
-		Model        *string `json:"model"`
-		ReasoningLog *string `json:"reasoningLog"`
+		IsOnline *bool   `json:"isOnline"`
+		Name     *string `json:"name"`
+		Role     *string `json:"role"`
+		Prompt   *string `json:"prompt"`
+		Model    *string `json:"model"`
 	}
 	
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -95,23 +119,48 @@ func (h *AgentHandler) Update(c *gin.Context) {
 	if input.Model != nil {
 		agent.Model = *input.Model
 	}
-	if input.ReasoningLog != nil {
-		agent.ReasoningLog = *input.ReasoningLog
-	}
 	
-	if err := h.service.UpdateAgent(agent); err != nil {
+	err = service.UpdateAgent(agent)
+	if errors.Is(err, repositories.ErrConflict) {
+		conflict(c, "Agent was modified concurrently; retry")
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
+	c.Header("ETag", agentETag(agent))
 	c.JSON(http.StatusOK, agent)
 }
 
-// Delete deletes an agent
+// Delete deletes an agent. With If-Match the agent must still be at that version.
 func (h *AgentHandler) Delete(c *gin.Context) {
+	service := scoped(c, h.service)
 	id := c.Param("id")
 	
-	err := h.service.DeleteAgent(id)
+	agent, err := service.GetAgent(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+	if preconditionFailed(c, agent.Version) {
+		return
+	}
+	
+	err = service.DeleteAgent(id, conditional(c, agent.Version))
+	if errors.Is(err, repositories.ErrConflict) {
+		conflict(c, "Agent was modified concurrently; retry")
+		return
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrReferenced) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Agent has written messages; delete its session instead"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -120,22 +169,15 @@ func (h *AgentHandler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// List lists all agents
+// List lists one page of agents
 func (h *AgentHandler) List(c *gin.Context) {
-	agents, err := h.service.ListAgents()
+	page, err := pageRequest(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	
-	c.JSON(http.StatusOK, agents)
-}
-
-// ListSessionAgents lists all agents for a session
-func (h *AgentHandler) ListSessionAgents(c *gin.Context) {
-	sessionID := c.Param("id")
-	
-	agents, err := h.service.ListSessionAgents(sessionID)
+	agents, err := scoped(c, h.service).PageAgents(page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -162,7 +204,7 @@ func (h *AgentHandler) UpdateOnlineStatus(c *gin.Context) {
 		return
 	}
 	
-	err := h.service.SetAgentOnlineStatus(id, *input.IsOnline)
+	err := scoped(c, h.service).SetAgentOnlineStatus(id, *input.IsOnline)
 	
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
@@ -172,26 +214,55 @@ func (h *AgentHandler) UpdateOnlineStatus(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// AppendReasoningLog appends to an agent's reasoning log
-func (h *AgentHandler) AppendReasoningLog(c *gin.Context) {
+// ReissueToken revokes an agent's tokens and responds with the agent carrying
+// a new one
+func (h *AgentHandler) ReissueToken(c *gin.Context) {
+	agent, err := scoped(c, h.service).ReissueToken(c.Param("id"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, agent)
+}
+
+// Run asks the agent's model for its next message and posts it to the agent's session
+func (h *AgentHandler) Run(c *gin.Context) {
 	id := c.Param("id")
 	
-	var input struct {
-		Log string `json:"log" binding:"required"`
-	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), runTimeout)
+	defer cancel()
 	
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	turn, err := scoped(c, h.runner).RunAgent(ctx, id)
+	if rateLimited(c, err) {
 		return
 	}
-	
-	err := h.service.AppendAgentReasoningLog(id, input.Log)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		var apiErr *providers.APIError
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+		case errors.Is(err, providers.ErrUnknownModel):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrSessionNotRunning), errors.Is(err, services.ErrMessageLimit):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrQuotaExceeded):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, context.DeadlineExceeded):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		case errors.As(err, &apiErr), errors.Is(err, providers.ErrUnavailable):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 	
-	c.Status(http.StatusNoContent)
+	c.JSON(http.StatusCreated, turn)
 }
 
 // RegisterRoutes registers routes for the agent handler
@@ -204,8 +275,7 @@ func (h *AgentHandler) RegisterRoutes(router *gin.Engine) {
 		agents.PUT("/:id", h.Update)
 		agents.DELETE("/:id", h.Delete)
 		agents.PUT("/:id/online", h.UpdateOnlineStatus)
-		agents.POST("/:id/reasoning", h.AppendReasoningLog)
+		agents.POST("/:id/run", h.Run)
+		agents.POST("/:id/token", h.ReissueToken)
 	}
-	
-	router.GET("/api/sessions/:id/agents", h.ListSessionAgents)
 }
\ No newline at end of file
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// ArchiveHandler handles HTTP requests for exporting and importing sessions
+type ArchiveHandler struct {
+	service *services.ArchiveService
+}
+
+// NewArchiveHandler creates a new ArchiveHandler
+func NewArchiveHandler(service *services.ArchiveService) *ArchiveHandler {
+	return &ArchiveHandler{
+		service: service,
+	}
+}
+
+// Export downloads a session as a JSON bundle, JSON lines or a Markdown
+// transcript, chosen with ?format=json|jsonl|markdown
+func (h *ArchiveHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	var contentType, extension string
+	switch format {
+	case "json":
+		contentType, extension = "application/json; charset=utf-8", "json"
+	case "jsonl":
+		contentType, extension = "application/x-ndjson; charset=utf-8", "jsonl"
+	case "markdown":
+		contentType, extension = "text/markdown; charset=utf-8", "md"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, jsonl or markdown"})
+		return
+	}
+	
+	bundle, err := scoped(c, h.service).ExportSession(c.Param("id"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="session-%s.%s"`, bundle.Session.ID, extension))
+	if format == "json" {
+		c.JSON(http.StatusOK, bundle)
+		return
+	}
+	
+	var body bytes.Buffer
+	if format == "jsonl" {
+		err = bundle.WriteJSONL(&body)
+	} else {
+		err = bundle.WriteMarkdown(&body)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+// Import recreates a session from a JSON bundle. Records get fresh IDs
+// unless ?ids=preserve is given. The response lists the session's agents
+// with the tokens issued to them.
+func (h *ArchiveHandler) Import(c *gin.Context) {
+	ids := c.DefaultQuery("ids", "fresh")
+	if ids != "fresh" && ids != "preserve" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ids must be fresh or preserve"})
+		return
+	}
+	
+	var bundle services.SessionBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	imported, err := scoped(c, h.service).ImportSession(&bundle, ids == "preserve")
+	if errors.Is(err, services.ErrInvalidBundle) || errors.Is(err, repositories.ErrInvalidReference) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Bundled IDs are already in use"})
+		return
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, imported)
+}
+
+// RegisterRoutes registers routes for the archive handler
+func (h *ArchiveHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/api/sessions/:id/export", h.Export)
+	router.POST("/api/sessions/import", h.Import)
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// apiKeyContextKey is where Authenticate leaves the request's API key
+const apiKeyContextKey = "apiKey"
+
+// routeResources maps the path segments naming a resource to the scopes
+// guarding it. The last of them in a route decides.
+var routeResources = map[string]string{
+	"sessions":        "sessions",
+	"participants":    "sessions",
+	"members":         "sessions",
+	"orchestrator":    "sessions",
+	"export":          "sessions",
+	"import":          "sessions",
+	"agents":          "agents",
+	"reasoning":       "agents",
+	"messages":        "messages",
+	"stream":          "messages",
+	"ws":              "messages",
+	"agent-templates": "templates",
+	"users":           "users",
+}
+
+// routeAccess overrides the access routes need when their method misleads:
+// polling for new messages only reads, and WebSocket clients can post
+var routeAccess = map[string]string{
+	"/api/sessions/:id/messages/new": "read",
+	"/api/sessions/:id/ws":           "write",
+}
+
+// routeRoles overrides the session role routes need. Reads need a viewer
+// and other changes an owner; members may post and keep the session going,
+// and WebSocket clients acting for a user only listen.
+var routeRoles = map[string]models.SessionRole{
+	"POST /api/messages":                                models.RoleMember,
+	"PUT /api/messages/:id":                             models.RoleMember,
+	"PUT /api/sessions/:id/heartbeat":                   models.RoleMember,
+	"PUT /api/sessions/:id/participants/:userId/online": models.RoleMember,
+	"POST /api/agents/:id/run":                          models.RoleMember,
+	"GET /api/sessions/:id/ws":                          models.RoleViewer,
+}
+
+// AuthHandler authenticates API requests and manages API keys
+type AuthHandler struct {
+	service *services.AuthService
+}
+
+// NewAuthHandler creates a new AuthHandler
+func NewAuthHandler(service *services.AuthService) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+	}
+}
+
+// Authenticate is middleware that lets API requests through only with an
+// API key granting the route's scope. Keys restricted to a session may only
+// reach that session and its agents and messages, and agent tokens may only
+// change their own agent. Keys acting for a user may only reach sessions the
+// user is a member of, as far as their role there allows. Every key belongs
+// to a workspace and only reaches what that workspace owns; only keys of the
+// default workspace may manage workspaces.
+func (h *AuthHandler) Authenticate(c *gin.Context) {
+	if !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.Next()
+		return
+	}
+	
+	key, err := h.service.Authenticate(credentials(c))
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		c.Header("WWW-Authenticate", `Bearer realm="chatcollab"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "A valid API key is required"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(apiKeyContextKey, key)
+	
+	route := c.FullPath()
+	if route == "" {
+		c.Next()
+		return
+	}
+	scope := requiredScope(c.Request.Method, route)
+	if !key.Allows(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + string(scope) + " scope"})
+		return
+	}
+	if strings.HasPrefix(route, "/api/workspaces") && key.WorkspaceID != models.DefaultWorkspaceID {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Only keys of the default workspace can manage workspaces"})
+		return
+	}
+	if strings.HasPrefix(route, "/api/sessions/:id") {
+		found, err := scoped(c, h.service).HasSession(c.Param("id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+	}
+	if key.AgentID != "" && scope == models.ScopeAgentsWrite &&
+		(!strings.HasPrefix(route, "/api/agents/:id") || c.Param("id") != key.AgentID) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Agent tokens can only act as their own agent"})
+		return
+	}
+	
+	if key.SessionID == "" && key.UserID == "" {
+		c.Next()
+		return
+	}
+	sessionID, err := h.requestSession(c)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if key.SessionID != "" && sessionID != key.SessionID {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is restricted to another session"})
+		return
+	}
+	if key.UserID != "" && !h.authorizeMember(c, key.UserID, sessionID, scope) {
+		return
+	}
+	
+	c.Next()
+}
+
+// authorizeMember checks that a user's role in the session a request touches
+// allows the route, aborting the request if not. Users may create and list
+// sessions, but their other requests about sessions, agents and messages
+// must name a session they are a member of.
+func (h *AuthHandler) authorizeMember(c *gin.Context, userID, sessionID string, scope models.Scope) bool {
+	route := c.Request.Method + " " + c.FullPath()
+	if sessionID == "" {
+		switch route {
+		case "POST /api/sessions", "GET /api/sessions", "GET /api/sessions/active":
+			return true
+		}
+		resource, _, _ := strings.Cut(string(scope), ":")
+		if resource != "sessions" && resource != "agents" && resource != "messages" {
+			return true
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Requests for a user must name a session they are a member of"})
+		return false
+	}
+	
+	role, err := scoped(c, h.service).SessionRole(sessionID, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "User is not a member of this session"})
+		return false
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	
+	required, ok := routeRoles[route]
+	if !ok {
+		required = models.RoleOwner
+		if strings.HasSuffix(string(scope), ":read") {
+			required = models.RoleViewer
+		}
+	}
+	if !role.Includes(required) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This needs the " + string(required) + " role in the session"})
+		return false
+	}
+	return true
+}
+
+// requestKey returns the API key a request was authenticated with, or nil
+// when routes are open
+func requestKey(c *gin.Context) *models.APIKey {
+	if key, ok := c.Get(apiKeyContextKey); ok {
+		return key.(*models.APIKey)
+	}
+	return nil
+}
+
+// keyUser returns the user a request's API key acts for, or "" when it acts
+// for no one in particular
+func keyUser(c *gin.Context) string {
+	if key := requestKey(c); key != nil {
+		return key.UserID
+	}
+	return ""
+}
+
+// tokenAgent returns the agent a request made with an agent's token speaks
+// as, or "" for any other request
+func tokenAgent(c *gin.Context) string {
+	if key := requestKey(c); key != nil {
+		return key.AgentID
+	}
+	return ""
+}
+
+// requestWorkspace returns the workspace of the API key a request was
+// authenticated with, or "" when routes are open
+func requestWorkspace(c *gin.Context) string {
+	if key := requestKey(c); key != nil {
+		return key.WorkspaceID
+	}
+	return ""
+}
+
+// scoped returns a service that only sees the workspace of the request's
+// API key
+func scoped[S interface{ InWorkspace(string) S }](c *gin.Context, service S) S {
+	return service.InWorkspace(requestWorkspace(c))
+}
+
+// credentials returns the API key a request was sent with: as a bearer token
+// or X-API-Key header, or for event streams and WebSockets, which browsers
+// open without custom headers, as the api_key query parameter
+func credentials(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if strings.HasSuffix(c.FullPath(), "/stream") || strings.HasSuffix(c.FullPath(), "/ws") {
+		return c.Query("api_key")
+	}
+	return ""
+}
+
+// requiredScope returns the scope a route needs: reading for GET requests
+// and writing otherwise, on the resource the route is about
+func requiredScope(method, route string) models.Scope {
+	if strings.HasPrefix(route, "/api/keys") {
+		return models.ScopeAdmin
+	}
+	
+	resource := ""
+	for _, segment := range strings.Split(route, "/") {
+		if name, ok := routeResources[segment]; ok {
+			resource = name
+		}
+	}
+	if resource == "" {
+		return models.ScopeAdmin
+	}
+	
+	access, ok := routeAccess[route]
+	if !ok {
+		access = "write"
+		if method == http.MethodGet || method == http.MethodHead {
+			access = "read"
+		}
+	}
+	return models.Scope(resource + ":" + access)
+}
+
+// requestSession works out which session a request touches: the one in its
+// path, the one owning the agent or message in its path, or the sessionId
+// named in its query or JSON body. It returns "" for requests about no
+// session in particular.
+func (h *AuthHandler) requestSession(c *gin.Context) (string, error) {
+	route := c.FullPath()
+	switch {
+	case strings.HasPrefix(route, "/api/sessions/:id"):
+		return c.Param("id"), nil
+	case strings.HasPrefix(route, "/api/agents/:id"):
+		return scoped(c, h.service).AgentSession(c.Param("id"))
+	case strings.HasPrefix(route, "/api/messages/:id"):
+		return scoped(c, h.service).MessageSession(c.Param("id"))
+	}
+	
+	if sessionID := c.Query("sessionId"); sessionID != "" {
+		return sessionID, nil
+	}
+	if c.Request.Body == nil || c.Request.ContentLength == 0 {
+		return "", nil
+	}
+	
+	// Read the body and put it back for the handler
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	var input struct {
+		SessionID string `json:"sessionId"`
+	}
+	_ = json.Unmarshal(body, &input)
+	return input.SessionID, nil
+}
+
+// keyService returns the AuthService for the keys of the workspace a request
+// names, or of the request's own workspace when it names none. Only keys of
+// the default workspace may name another, otherwise the request is refused.
+func (h *AuthHandler) keyService(c *gin.Context, workspaceID string) (*services.AuthService, bool) {
+	own := requestWorkspace(c)
+	if workspaceID == "" || workspaceID == own {
+		return scoped(c, h.service), true
+	}
+	if own != "" && own != models.DefaultWorkspaceID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only keys of the default workspace can manage other workspaces' keys"})
+		return nil, false
+	}
+	return h.service.InWorkspace(workspaceID), true
+}
+
+// CreateKey mints a new API key, which acts for the user named by userId
+// if given and belongs to the workspace named by workspaceId, or else the
+// caller's. The secret is in the response and cannot be retrieved again.
+func (h *AuthHandler) CreateKey(c *gin.Context) {
+	var input struct {
+		Name        string         `json:"name" binding:"required"`
+		Scopes      []models.Scope `json:"scopes" binding:"required"`
+		SessionID   string         `json:"sessionId"`
+		UserID      string         `json:"userId"`
+		WorkspaceID string         `json:"workspaceId"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	service, ok := h.keyService(c, input.WorkspaceID)
+	if !ok {
+		return
+	}
+	key, secret, err := service.CreateKey(input.Name, input.Scopes, input.SessionID, input.UserID)
+	if errors.Is(err, services.ErrInvalidScope) || errors.Is(err, services.ErrRestrictedAdmin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrUnknownSession) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Session not found"})
+		return
+	}
+	if errors.Is(err, services.ErrUnknownUser) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "User not found"})
+		return
+	}
+	if errors.Is(err, services.ErrUnknownWorkspace) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Workspace not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, gin.H{"key": secret, "apiKey": key})
+}
+
+// ListKeys lists one page of the API keys of the workspace named by the
+// workspaceId query parameter, or else the caller's, without their secrets
+func (h *AuthHandler) ListKeys(c *gin.Context) {
+	service, ok := h.keyService(c, c.Query("workspaceId"))
+	if !ok {
+		return
+	}
+	
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	keys, err := service.PageKeys(page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, keys)
+}
+
+// GetKey retrieves an API key by ID, without its secret. Keys of other
+// workspaces are found with the workspaceId query parameter.
+func (h *AuthHandler) GetKey(c *gin.Context) {
+	service, ok := h.keyService(c, c.Query("workspaceId"))
+	if !ok {
+		return
+	}
+	
+	key, err := service.GetKey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, key)
+}
+
+// RevokeKey stops an API key from being accepted. Revoked keys stay listed.
+// Keys of other workspaces are found with the workspaceId query parameter.
+func (h *AuthHandler) RevokeKey(c *gin.Context) {
+	service, ok := h.keyService(c, c.Query("workspaceId"))
+	if !ok {
+		return
+	}
+	
+	err := service.RevokeKey(c.Param("id"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Status(http.StatusNoContent)
+}
+
+// RegisterRoutes registers routes for the auth handler
+func (h *AuthHandler) RegisterRoutes(router *gin.Engine) {
+	keys := router.Group("/api/keys")
+	{
+		keys.POST("", h.CreateKey)
+		keys.GET("", h.ListKeys)
+		keys.GET("/:id", h.GetKey)
+		keys.DELETE("/:id", h.RevokeKey)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// etag formats a record's version as a strong entity tag. State that changes
+// without a new version, such as presence, follows the version so caches
+// notice it; If-Match still compares the version alone.
+func etag(version int, state string) string {
+	if state == "" {
+		return `"` + strconv.Itoa(version) + `"`
+	}
+	return `"` + strconv.Itoa(version) + "-" + state + `"`
+}
+
+// sessionETag tags a session with its version and last heartbeat
+func sessionETag(session *models.Session) string {
+	return etag(session.Version, strconv.FormatInt(session.LastHeartbeat.UnixMicro(), 36))
+}
+
+// agentETag tags an agent with its version and presence
+func agentETag(agent *models.Agent) string {
+	if agent.IsOnline {
+		return etag(agent.Version, "online")
+	}
+	return etag(agent.Version, "offline")
+}
+
+// matchesETag reports whether a comma-separated If-Match or If-None-Match
+// header names want. Weak tags only match when weak is set. When want is a
+// bare version, tags carrying state match on their version.
+func matchesETag(header, want string, weak bool) bool {
+	bare := !strings.Contains(want, "-")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if bare {
+			tag = versionTag(tag)
+		}
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// versionTag drops the state from a tag made by etag, leaving its version
+func versionTag(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 && strings.HasPrefix(tag, `"`) {
+		return tag[:i] + `"`
+	}
+	return tag
+}
+
+// cached tags the response and answers 304 Not Modified when If-None-Match
+// already names the tag, reporting whether it did
+func cached(c *gin.Context, tag string) bool {
+	c.Header("ETag", tag)
+	if header := c.GetHeader("If-None-Match"); header != "" && matchesETag(header, tag, true) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// preconditionFailed answers 412 Precondition Failed unless If-Match is
+// absent or names the record's current version, reporting whether it did
+func preconditionFailed(c *gin.Context, version int) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || matchesETag(header, etag(version, ""), false) {
+		return false
+	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match the current version " + etag(version, "")})
+	return true
+}
+
+// conditional returns the version a write must still find, which is only
+// checked when the client sent If-Match
+func conditional(c *gin.Context, version int) int {
+	if c.GetHeader("If-Match") == "" {
+		return 0
+	}
+	return version
+}
+
+// conflict answers a write that lost a race with another: 412 when the client
+// made it conditional with If-Match, 409 otherwise
+func conflict(c *gin.Context, message string) {
+	if c.GetHeader("If-Match") != "" {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": message})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": message})
+}
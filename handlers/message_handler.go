@@ -1,39 +1,96 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
 	"github.com/chatcollab/chatcollab/services"
 )
 
+// streamKeepAlive is how often an idle event stream sends a comment to keep proxies from closing it
+const streamKeepAlive = 15 * time.Second
+
 // MessageHandler handles HTTP requests for messages
 type MessageHandler struct {
 	service *services.MessageService
 }
 
 // NewMessageHandler creates a new MessageHandler
-func NewMessageHandler() *MessageHandler {
+func NewMessageHandler(service *services.MessageService) *MessageHandler {
 	return &MessageHandler{
-		service: services.NewMessageService(),
+		service: service,
 	}
 }
 
-// Create creates a new message
+// Create creates a new message written by either an agent (agentId) or a
+// user (userId). A user posting to a session joins it once the message is
+// stored. Requests made with an agent's token are written by that agent, and
+// those made with a key acting for a user by that user.
 func (h *MessageHandler) Create(c *gin.Context) {
 	var input struct {
 		Content   string `json:"content" binding:"required"`
-		AgentID   string `json:"agentId" binding:"required"`
+		AgentID   string `json:"agentId"`
+		UserID    string `json:"userId"`
 		SessionID string `json:"sessionId" binding:"required"`
+		ReplyTo   string `json:"replyTo"`
 	}
 	
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if agentID := tokenAgent(c); agentID != "" {
+		if input.UserID != "" || (input.AgentID != "" && input.AgentID != agentID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Agent tokens can only post as their own agent"})
+			return
+		}
+		input.AgentID = agentID
+	}
+	if userID := keyUser(c); userID != "" {
+		if input.AgentID != "" || (input.UserID != "" && input.UserID != userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User keys can only post as their own user"})
+			return
+		}
+		input.UserID = userID
+	}
+	if (input.AgentID == "") == (input.UserID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of agentId and userId is required"})
+		return
+	}
 	
-	message, err := h.service.CreateMessage(input.Content, input.AgentID, input.SessionID)
+	service := scoped(c, h.service)
+	var message *models.Message
+	var err error
+	if input.UserID != "" {
+		message, err = service.CreateUserReply(input.Content, input.UserID, input.SessionID, input.ReplyTo)
+	} else {
+		message, err = service.CreateReply(input.Content, input.AgentID, input.SessionID, input.ReplyTo)
+	}
+	if errors.Is(err, services.ErrParentNotFound) || errors.Is(err, services.ErrReplyAcrossSessions) ||
+		errors.Is(err, services.ErrUnknownSession) || errors.Is(err, services.ErrUnknownAgent) ||
+		errors.Is(err, services.ErrAgentNotInSession) || errors.Is(err, repositories.ErrInvalidReference) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrSessionNotRunning) || errors.Is(err, services.ErrMessageLimit) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if rateLimited(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -46,21 +103,49 @@ func (h *MessageHandler) Create(c *gin.Context) {
 func (h *MessageHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 	
-	message, err := h.service.GetMessage(id)
+	message, err := scoped(c, h.service).GetMessage(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
+	if cached(c, etag(message.Revision, "")) {
+		return
+	}
 	
 	c.JSON(http.StatusOK, message)
 }
 
-// Update updates a message's content
+// GetThread retrieves the thread containing a message
+func (h *MessageHandler) GetThread(c *gin.Context) {
+	id := c.Param("id")
+	
+	root, replies, err := scoped(c, h.service).GetThread(id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if replies == nil {
+		replies = []*models.Message{}
+	}
+	
+	c.JSON(http.StatusOK, gin.H{"root": root, "replies": replies})
+}
+
+// Update stores new content for a message as its next revision.
+// editorId names the agent making the edit and defaults to the author.
+// With If-Match the message must still be at that revision. Agent tokens
+// and keys acting for a user can only edit their own messages.
 func (h *MessageHandler) Update(c *gin.Context) {
+	service := scoped(c, h.service)
 	id := c.Param("id")
 	
 	var input struct {
-		Content string `json:"content" binding:"required"`
+		Content  string `json:"content" binding:"required"`
+		EditorID string `json:"editorId"`
 	}
 	
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -68,20 +153,129 @@ func (h *MessageHandler) Update(c *gin.Context) {
 		return
 	}
 	
-	err := h.service.UpdateMessage(id, input.Content)
+	message, err := service.GetMessage(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
 		return
 	}
+	if preconditionFailed(c, message.Revision) {
+		return
+	}
+	if agentID := tokenAgent(c); agentID != "" {
+		if message.AgentID != agentID || (input.EditorID != "" && input.EditorID != agentID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Agent tokens can only edit their own agent's messages"})
+			return
+		}
+		input.EditorID = agentID
+	}
+	if userID := keyUser(c); userID != "" {
+		if message.UserID != userID || (input.EditorID != "" && input.EditorID != userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User keys can only edit their own messages"})
+			return
+		}
+		input.EditorID = userID
+	}
 	
+	message, err = service.EditMessage(id, conditional(c, message.Revision), input.Content, input.EditorID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrConflict) {
+		conflict(c, "Message was edited concurrently; retry")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Header("ETag", etag(message.Revision, ""))
 	c.Status(http.StatusNoContent)
 }
 
-// Delete deletes a message
+// GetRevisions lists every revision of a message, oldest first
+func (h *MessageHandler) GetRevisions(c *gin.Context) {
+	id := c.Param("id")
+	
+	revisions, err := scoped(c, h.service).GetRevisions(id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, revisions)
+}
+
+// DiffRevisions returns a unified diff between the from and to revisions.
+// By default it compares the latest revision with the one before it.
+func (h *MessageHandler) DiffRevisions(c *gin.Context) {
+	id := c.Param("id")
+	
+	var from, to int
+	for param, target := range map[string]*int{"from": &from, "to": &to} {
+		if value := c.Query(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a revision number"})
+				return
+			}
+			*target = n
+		}
+	}
+	
+	diff, err := scoped(c, h.service).DiffRevisions(id, from, to)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if errors.Is(err, services.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, diff)
+}
+
+// Delete deletes a message. With If-Match the message must still be at that revision.
 func (h *MessageHandler) Delete(c *gin.Context) {
+	service := scoped(c, h.service)
 	id := c.Param("id")
 	
-	err := h.service.DeleteMessage(id)
+	message, err := service.GetMessage(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if preconditionFailed(c, message.Revision) {
+		return
+	}
+	if agentID := tokenAgent(c); agentID != "" && message.AgentID != agentID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Agent tokens can only delete their own agent's messages"})
+		return
+	}
+	
+	err = service.DeleteMessage(id, conditional(c, message.Revision))
+	if errors.Is(err, repositories.ErrConflict) {
+		conflict(c, "Message was edited concurrently; retry")
+		return
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrReferenced) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Message has replies"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -90,11 +284,29 @@ func (h *MessageHandler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// GetSessionMessages retrieves all messages for a session
+// GetSessionMessages retrieves one page of a session's messages.
+// With threads=collapsed only top-level messages are listed, each with its reply count.
 func (h *MessageHandler) GetSessionMessages(c *gin.Context) {
+	service := scoped(c, h.service)
 	sessionID := c.Param("id")
 	
-	messages, err := h.service.GetSessionMessages(sessionID)
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	list := service.PageSessionMessages
+	switch c.Query("threads") {
+	case "", "expanded":
+	case "collapsed":
+		list = service.PageSessionThreads
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threads must be expanded or collapsed"})
+		return
+	}
+	
+	messages, err := list(sessionID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -103,11 +315,17 @@ func (h *MessageHandler) GetSessionMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, messages)
 }
 
-// GetAgentMessages retrieves all messages for an agent
+// GetAgentMessages retrieves one page of an agent's messages
 func (h *MessageHandler) GetAgentMessages(c *gin.Context) {
 	agentID := c.Param("id")
 	
-	messages, err := h.service.GetAgentMessages(agentID)
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	messages, err := scoped(c, h.service).PageAgentMessages(agentID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -129,7 +347,7 @@ func (h *MessageHandler) GetNewMessages(c *gin.Context) {
 		return
 	}
 	
-	messages, err := h.service.GetNewMessages(sessionID, input.After)
+	messages, err := scoped(c, h.service).GetNewMessages(sessionID, input.After)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -138,17 +356,131 @@ func (h *MessageHandler) GetNewMessages(c *gin.Context) {
 	c.JSON(http.StatusOK, messages)
 }
 
+// Search finds messages matching the q parameter across sessions.
+// Results can be narrowed by sessionId, agentId and a since/until time range.
+func (h *MessageHandler) Search(c *gin.Context) {
+	query := repositories.SearchQuery{
+		Query:     c.Query("q"),
+		SessionID: c.Query("sessionId"),
+		AgentID:   c.Query("agentId"),
+	}
+	
+	if err := timeParams(c, map[string]*time.Time{"since": &query.Since, "until": &query.Until}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for param, target := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+		if value := c.Query(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be a non-negative integer"})
+				return
+			}
+			*target = n
+		}
+	}
+	
+	if err := query.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	hits, err := scoped(c, h.service).SearchMessages(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	response := gin.H{"items": hits}
+	if len(hits) == query.Limit {
+		response["nextOffset"] = query.Offset + len(hits)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Stream pushes message events for a session as Server-Sent Events.
+// Clients resume after a disconnect by sending the Last-Event-ID header
+// (or the lastEventId query parameter for clients that cannot set headers).
+// When events after that ID are no longer buffered, the replay opens with a
+// stream.reset event so the client knows to refetch the session's messages.
+func (h *MessageHandler) Stream(c *gin.Context) {
+	sessionID := c.Param("id")
+	
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	
+	var after uint64
+	if lastEventID != "" {
+		var err error
+		after, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+	}
+	
+	sub, missed := scoped(c, h.service).Subscribe(sessionID, after)
+	defer sub.Close()
+	
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	
+	for _, event := range missed {
+		writeEvent(c, event)
+	}
+	c.Writer.Flush()
+	
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				// The subscriber fell behind; the client reconnects with its Last-Event-ID
+				return false
+			}
+			writeEvent(c, event)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// writeEvent renders a single event in the Server-Sent Events wire format
+func writeEvent(c *gin.Context, event events.Event) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(event.ID, 10),
+		Event: event.Type,
+		Data:  event,
+	})
+}
+
 // RegisterRoutes registers routes for the message handler
 func (h *MessageHandler) RegisterRoutes(router *gin.Engine) {
 	messages := router.Group("/api/messages")
 	{
 		messages.POST("", h.Create)
 		messages.GET("/:id", h.Get)
+		messages.GET("/:id/thread", h.GetThread)
+		messages.GET("/:id/revisions", h.GetRevisions)
+		messages.GET("/:id/revisions/diff", h.DiffRevisions)
 		messages.PUT("/:id", h.Update)
 		messages.DELETE("/:id", h.Delete)
 	}
 	
 	router.GET("/api/sessions/:id/messages", h.GetSessionMessages)
 	router.POST("/api/sessions/:id/messages/new", h.GetNewMessages)
+	router.GET("/api/sessions/:id/stream", h.Stream)
 	router.GET("/api/agents/:id/messages", h.GetAgentMessages)
+	router.GET("/api/search/messages", h.Search)
 }
\ No newline at end of file
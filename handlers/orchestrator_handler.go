@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/orchestrator"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// OrchestratorHandler handles HTTP requests controlling session orchestration
+type OrchestratorHandler struct {
+	manager *orchestrator.Manager
+}
+
+// NewOrchestratorHandler creates a new OrchestratorHandler
+func NewOrchestratorHandler(manager *orchestrator.Manager) *OrchestratorHandler {
+	return &OrchestratorHandler{
+		manager: manager,
+	}
+}
+
+// Status returns the orchestration status of a session
+func (h *OrchestratorHandler) Status(c *gin.Context) {
+	status, ok := h.manager.Status(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session is not orchestrated"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Start starts orchestrating a session, or resumes a paused one
+func (h *OrchestratorHandler) Start(c *gin.Context) {
+	var config orchestrator.Config
+	if err := c.ShouldBindJSON(&config); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.manager.Start(c.Param("id"), config)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		case errors.Is(err, orchestrator.ErrAlreadyRunning), errors.Is(err, services.ErrSessionNotRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Pause pauses a running session after the current turn
+func (h *OrchestratorHandler) Pause(c *gin.Context) {
+	status, err := h.manager.Pause(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Stop stops orchestrating a session
+func (h *OrchestratorHandler) Stop(c *gin.Context) {
+	status, err := h.manager.Stop(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// RegisterRoutes registers routes for the orchestrator handler
+func (h *OrchestratorHandler) RegisterRoutes(router *gin.Engine) {
+	orchestration := router.Group("/api/sessions/:id/orchestrator")
+	{
+		orchestration.GET("", h.Status)
+		orchestration.POST("/start", h.Start)
+		orchestration.POST("/pause", h.Pause)
+		orchestration.POST("/stop", h.Stop)
+	}
+}
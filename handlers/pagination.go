@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+// pageRequest reads the limit, order, before and after query parameters
+func pageRequest(c *gin.Context) (repositories.PageRequest, error) {
+	var page repositories.PageRequest
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = n
+	}
+
+	page.Order = repositories.Order(c.Query("order"))
+
+	for param, target := range map[string]**repositories.Cursor{"after": &page.After, "before": &page.Before} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		cursor, err := repositories.DecodeCursor(value)
+		if err != nil {
+			return page, errors.New("invalid " + param + " cursor")
+		}
+		*target = &cursor
+	}
+
+	return page, page.Validate()
+}
+
+// timeParams reads RFC 3339 query parameters into the mapped targets,
+// leaving targets of absent parameters untouched
+func timeParams(c *gin.Context, targets map[string]*time.Time) error {
+	for param, target := range targets {
+		if value := c.Query(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return errors.New(param + " must be an RFC 3339 time")
+			}
+			*target = t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// ParticipantHandler handles HTTP requests for users and session participants
+type ParticipantHandler struct {
+	service *services.ParticipantService
+}
+
+// NewParticipantHandler creates a new ParticipantHandler
+func NewParticipantHandler(service *services.ParticipantService) *ParticipantHandler {
+	return &ParticipantHandler{
+		service: service,
+	}
+}
+
+// CreateUser creates a new user
+func (h *ParticipantHandler) CreateUser(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	user, err := scoped(c, h.service).CreateUser(input.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, user)
+}
+
+// GetUser retrieves a user by ID
+func (h *ParticipantHandler) GetUser(c *gin.Context) {
+	user, err := scoped(c, h.service).GetUser(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser renames a user
+func (h *ParticipantHandler) UpdateUser(c *gin.Context) {
+	service := scoped(c, h.service)
+	user, err := service.GetUser(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	user.Name = input.Name
+	if err := service.UpdateUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser deletes a user
+func (h *ParticipantHandler) DeleteUser(c *gin.Context) {
+	err := scoped(c, h.service).DeleteUser(c.Param("id"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrReferenced) {
+		c.JSON(http.StatusConflict, gin.H{"error": "User has written messages"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Status(http.StatusNoContent)
+}
+
+// ListUsers lists one page of users
+func (h *ParticipantHandler) ListUsers(c *gin.Context) {
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	users, err := scoped(c, h.service).PageUsers(page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, users)
+}
+
+// ListParticipants lists the agents and users in a session with their presence
+func (h *ParticipantHandler) ListParticipants(c *gin.Context) {
+	participants, err := scoped(c, h.service).ListParticipants(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, participants)
+}
+
+// Join adds a user to a session
+func (h *ParticipantHandler) Join(c *gin.Context) {
+	var input struct {
+		UserID string `json:"userId" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	member, joined, err := scoped(c, h.service).JoinSession(c.Param("id"), input.UserID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "User not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrInvalidReference) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if joined {
+		c.JSON(http.StatusCreated, member)
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// UpdateOnlineStatus updates a user's presence in a session. Keys acting for
+// a user can only update their own.
+func (h *ParticipantHandler) UpdateOnlineStatus(c *gin.Context) {
+	if userID := keyUser(c); userID != "" && userID != c.Param("userId") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User keys can only update their own presence"})
+		return
+	}
+	
+	var input struct {
+		IsOnline *bool `json:"isOnline" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	err := scoped(c, h.service).SetUserOnlineStatus(c.Param("id"), c.Param("userId"), *input.IsOnline)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not in this session"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Status(http.StatusNoContent)
+}
+
+// ListMembers lists the users who are members of a session with their roles
+func (h *ParticipantHandler) ListMembers(c *gin.Context) {
+	members, err := scoped(c, h.service).ListMembers(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if members == nil {
+		members = []*models.Participant{}
+	}
+	
+	c.JSON(http.StatusOK, members)
+}
+
+// SetMemberRole makes a user an owner, member or viewer of a session,
+// adding them to it if needed
+func (h *ParticipantHandler) SetMemberRole(c *gin.Context) {
+	var input struct {
+		Role models.SessionRole `json:"role" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	member, added, err := scoped(c, h.service).SetMemberRole(c.Param("id"), c.Param("userId"), input.Role)
+	if errors.Is(err, services.ErrInvalidRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrUnknownUser) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "User not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrInvalidReference) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if errors.Is(err, services.ErrLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if added {
+		c.JSON(http.StatusCreated, member)
+		return
+	}
+	c.JSON(http.StatusOK, member)
+}
+
+// RemoveMember takes a user out of a session
+func (h *ParticipantHandler) RemoveMember(c *gin.Context) {
+	err := scoped(c, h.service).RemoveMember(c.Param("id"), c.Param("userId"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not in this session"})
+		return
+	}
+	if errors.Is(err, services.ErrLastOwner) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Status(http.StatusNoContent)
+}
+
+// RegisterRoutes registers routes for the participant handler
+func (h *ParticipantHandler) RegisterRoutes(router *gin.Engine) {
+	users := router.Group("/api/users")
+	{
+		users.POST("", h.CreateUser)
+		users.GET("", h.ListUsers)
+		users.GET("/:id", h.GetUser)
+		users.PUT("/:id", h.UpdateUser)
+		users.DELETE("/:id", h.DeleteUser)
+	}
+	
+	sessions := router.Group("/api/sessions/:id")
+	{
+		sessions.GET("/participants", h.ListParticipants)
+		sessions.POST("/participants", h.Join)
+		sessions.PUT("/participants/:userId/online", h.UpdateOnlineStatus)
+		sessions.GET("/members", h.ListMembers)
+		sessions.PUT("/members/:userId", h.SetMemberRole)
+		sessions.DELETE("/members/:userId", h.RemoveMember)
+		
+		// Agents were the only participants once; the old path lists everyone
+		sessions.GET("/agents", h.ListParticipants)
+	}
+}
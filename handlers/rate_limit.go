@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/ratelimit"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// RateLimitHandler limits how many requests each API key may make
+type RateLimitHandler struct {
+	keys *ratelimit.Limiter
+}
+
+// NewRateLimitHandler creates a new RateLimitHandler
+func NewRateLimitHandler(keys *ratelimit.Limiter) *RateLimitHandler {
+	return &RateLimitHandler{
+		keys: keys,
+	}
+}
+
+// Limit is middleware that refuses API requests with 429 once their key has
+// used up its rate limit. It must run after Authenticate; requests without
+// a key are left alone.
+func (h *RateLimitHandler) Limit(c *gin.Context) {
+	key := requestKey(c)
+	if key == nil || !strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		c.Next()
+		return
+	}
+	
+	if ok, wait := h.keys.Allow(key.ID); !ok {
+		tooManyRequests(c, wait, "Too many requests for this API key")
+		c.Abort()
+		return
+	}
+	
+	c.Next()
+}
+
+// rateLimited answers with 429 when err is a services.RateLimitError,
+// reporting whether it did
+func rateLimited(c *gin.Context, err error) bool {
+	var limited *services.RateLimitError
+	if !errors.As(err, &limited) {
+		return false
+	}
+	tooManyRequests(c, limited.RetryAfter, err.Error())
+	return true
+}
+
+// tooManyRequests answers with 429, telling the client in Retry-After how
+// many whole seconds to wait
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// ReasoningHandler handles HTTP requests for agents' reasoning entries
+type ReasoningHandler struct {
+	service *services.ReasoningService
+}
+
+// NewReasoningHandler creates a new ReasoningHandler
+func NewReasoningHandler(service *services.ReasoningService) *ReasoningHandler {
+	return &ReasoningHandler{
+		service: service,
+	}
+}
+
+// Record adds a reasoning entry for an agent. A body with only the legacy
+// log field is recorded as a thought.
+func (h *ReasoningHandler) Record(c *gin.Context) {
+	service := scoped(c, h.service)
+	id := c.Param("id")
+	
+	var input struct {
+		Type      models.ReasoningStep `json:"type"`
+		Content   string               `json:"content"`
+		MessageID string               `json:"messageId"`
+		Payload   json.RawMessage      `json:"payload"`
+		Log       string               `json:"log"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	if input.Log != "" && input.Type == "" && input.Content == "" {
+		if err := service.AppendReasoningLog(id, input.Log); err != nil {
+			h.writeError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+		return
+	}
+	
+	if input.Type == "" {
+		input.Type = models.StepThought
+	}
+	if bytes.Equal(input.Payload, []byte("null")) {
+		input.Payload = nil
+	}
+	
+	entry, err := service.RecordReasoning(id, input.Type, input.Content, input.MessageID, input.Payload)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	
+	c.JSON(http.StatusCreated, entry)
+}
+
+// List lists one page of an agent's reasoning entries, narrowed by type,
+// sessionId, messageId and a since/until time range. With format=text the
+// page is rendered as the legacy newline-separated log and the cursor for
+// the next page is sent in the X-Next-Cursor header.
+func (h *ReasoningHandler) List(c *gin.Context) {
+	id := c.Param("id")
+	
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	filter := repositories.ReasoningFilter{
+		Step:      models.ReasoningStep(c.Query("type")),
+		SessionID: c.Query("sessionId"),
+		MessageID: c.Query("messageId"),
+	}
+	if filter.Step != "" && !filter.Step.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidStep.Error()})
+		return
+	}
+	if err := timeParams(c, map[string]*time.Time{"since": &filter.Since, "until": &filter.Until}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	entries, err := scoped(c, h.service).PageReasoning(id, filter, page)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	
+	switch c.Query("format") {
+	case "", "json":
+		c.JSON(http.StatusOK, entries)
+	case "text":
+		if entries.NextCursor != "" {
+			c.Header("X-Next-Cursor", entries.NextCursor)
+		}
+		c.String(http.StatusOK, models.ReasoningLog(entries.Items))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be \"json\" or \"text\""})
+	}
+}
+
+// writeError maps reasoning service errors to responses
+func (h *ReasoningHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+	case errors.Is(err, services.ErrInvalidStep), errors.Is(err, services.ErrEmptyReasoning), errors.Is(err, services.ErrInvalidPayload):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrInvalidReference):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Message not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// RegisterRoutes registers routes for the reasoning handler
+func (h *ReasoningHandler) RegisterRoutes(router *gin.Engine) {
+	router.POST("/api/agents/:id/reasoning", h.Record)
+	router.GET("/api/agents/:id/reasoning", h.List)
+}
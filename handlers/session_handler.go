@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
 	"github.com/chatcollab/chatcollab/services"
 )
 
@@ -14,15 +17,49 @@ type SessionHandler struct {
 }
 
 // NewSessionHandler creates a new SessionHandler
-func NewSessionHandler() *SessionHandler {
+func NewSessionHandler(service *services.SessionService) *SessionHandler {
 	return &SessionHandler{
-		service: services.NewSessionService(),
+		service: service,
 	}
 }
 
-// Create creates a new session
+// Create creates a new session. The body is optional; sessions start
+// running unless created as a draft. The user an API key acts for becomes
+// the session's owner.
 func (h *SessionHandler) Create(c *gin.Context) {
-	session, err := h.service.CreateSession()
+	var input struct {
+		Title  string               `json:"title"`
+		Goal   string               `json:"goal"`
+		Tags   []string             `json:"tags"`
+		Status models.SessionStatus `json:"status"`
+	}
+	
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if input.Status == "" {
+		input.Status = models.SessionRunning
+	}
+	
+	service := scoped(c, h.service)
+	var session *models.Session
+	var err error
+	if userID := keyUser(c); userID != "" {
+		session, err = service.CreateOwnedSession(userID, input.Title, input.Goal, input.Tags, input.Status)
+	} else {
+		session, err = service.CreateSessionWithDetails(input.Title, input.Goal, input.Tags, input.Status)
+	}
+	if errors.Is(err, services.ErrInvalidStatus) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a new session must be draft or running"})
+		return
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -35,20 +72,110 @@ func (h *SessionHandler) Create(c *gin.Context) {
 func (h *SessionHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 	
-	session, err := h.service.GetSession(id)
+	session, err := scoped(c, h.service).GetSession(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
 	}
+	if cached(c, sessionETag(session)) {
+		return
+	}
 	
 	c.JSON(http.StatusOK, session)
 }
 
+// Update changes a session's title, goal, tags or message cap. With If-Match
+// the session must still be at that version.
+func (h *SessionHandler) Update(c *gin.Context) {
+	service := scoped(c, h.service)
+	session, err := service.GetSession(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if preconditionFailed(c, session.Version) {
+		return
+	}
+	
+	var input struct {
+		Title       *string  `json:"title"`
+		Goal        *string  `json:"goal"`
+		Tags        []string `json:"tags"`
+		MaxMessages *int     `json:"maxMessages"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	title, goal, tags, maxMessages := session.Title, session.Goal, session.Tags, session.MaxMessages
+	if input.Title != nil {
+		title = *input.Title
+	}
+	if input.Goal != nil {
+		goal = *input.Goal
+	}
+	if input.Tags != nil {
+		tags = input.Tags
+	}
+	if input.MaxMessages != nil {
+		maxMessages = *input.MaxMessages
+	}
+	
+	session, err = service.UpdateDetails(session.ID, session.Version, title, goal, tags, maxMessages)
+	if errors.Is(err, services.ErrInvalidMessageLimit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrConflict) {
+		conflict(c, "Session was modified concurrently; retry")
+		return
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Header("ETag", sessionETag(session))
+	c.JSON(http.StatusOK, session)
+}
+
+// Transition moves a session to another status in its lifecycle
+func (h *SessionHandler) Transition(c *gin.Context) {
+	var input struct {
+		Status models.SessionStatus `json:"status" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	session, err := scoped(c, h.service).TransitionSession(c.Param("id"), input.Status)
+	switch {
+	case errors.Is(err, services.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+	case errors.Is(err, services.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, session)
+	}
+}
+
 // UpdateHeartbeat updates a session's heartbeat
 func (h *SessionHandler) UpdateHeartbeat(c *gin.Context) {
 	id := c.Param("id")
 	
-	err := h.service.UpdateHeartbeat(id)
+	err := scoped(c, h.service).UpdateHeartbeat(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
@@ -57,11 +184,33 @@ func (h *SessionHandler) UpdateHeartbeat(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// Delete deletes a session
+// Delete deletes a session. With If-Match the session must still be at that version.
 func (h *SessionHandler) Delete(c *gin.Context) {
+	service := scoped(c, h.service)
 	id := c.Param("id")
 	
-	err := h.service.DeleteSession(id)
+	session, err := service.GetSession(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if preconditionFailed(c, session.Version) {
+		return
+	}
+	
+	err = service.DeleteSession(id, conditional(c, session.Version))
+	if errors.Is(err, repositories.ErrConflict) {
+		conflict(c, "Session was modified concurrently; retry")
+		return
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if errors.Is(err, repositories.ErrReferenced) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session's agents have written messages in other sessions"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -70,9 +219,22 @@ func (h *SessionHandler) Delete(c *gin.Context) {
 	c.Status(http.StatusNoContent)
 }
 
-// List lists all sessions
+// List lists one page of sessions, or for an API key acting for a user,
+// of the sessions the user is a member of
 func (h *SessionHandler) List(c *gin.Context) {
-	sessions, err := h.service.ListSessions()
+	service := scoped(c, h.service)
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	var sessions *repositories.Page[*models.Session]
+	if userID := keyUser(c); userID != "" {
+		sessions, err = service.PageMemberSessions(userID, page)
+	} else {
+		sessions, err = service.PageSessions(page)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -81,12 +243,17 @@ func (h *SessionHandler) List(c *gin.Context) {
 	c.JSON(http.StatusOK, sessions)
 }
 
-// ListActive lists all active sessions
+// ListActive lists the sessions that had a heartbeat within the session
+// timeout, only those the user is a member of for an API key acting for one
 func (h *SessionHandler) ListActive(c *gin.Context) {
-	// Default timeout of 5 minutes
-	timeout := 5 * time.Minute
-	
-	sessions, err := h.service.ListActiveSessions(timeout)
+	service := scoped(c, h.service)
+	var sessions []*models.Session
+	var err error
+	if userID := keyUser(c); userID != "" {
+		sessions, err = service.ListActiveMemberSessions(userID, h.service.Timeout())
+	} else {
+		sessions, err = service.ListActiveSessions(h.service.Timeout())
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -103,7 +270,9 @@ func (h *SessionHandler) RegisterRoutes(router *gin.Engine) {
 		sessions.GET("", h.List)
 		sessions.GET("/active", h.ListActive)
 		sessions.GET("/:id", h.Get)
+		sessions.PUT("/:id", h.Update)
 		sessions.PUT("/:id/heartbeat", h.UpdateHeartbeat)
+		sessions.POST("/:id/transition", h.Transition)
 		sessions.DELETE("/:id", h.Delete)
 	}
 }
\ No newline at end of file
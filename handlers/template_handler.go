@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// TemplateHandler handles HTTP requests for agent templates
+type TemplateHandler struct {
+	service *services.TemplateService
+}
+
+// NewTemplateHandler creates a new TemplateHandler
+func NewTemplateHandler(service *services.TemplateService) *TemplateHandler {
+	return &TemplateHandler{
+		service: service,
+	}
+}
+
+// Create creates a new agent template
+func (h *TemplateHandler) Create(c *gin.Context) {
+	var input struct {
+		Name   string `json:"name" binding:"required"`
+		Role   string `json:"role" binding:"required"`
+		Prompt string `json:"prompt" binding:"required"`
+		Model  string `json:"model" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	template, err := scoped(c, h.service).CreateTemplate(input.Name, input.Role, input.Prompt, input.Model)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, template)
+}
+
+// Get retrieves a template by ID
+func (h *TemplateHandler) Get(c *gin.Context) {
+	template, err := scoped(c, h.service).GetTemplate(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent template not found"})
+		return
+	}
+	
+	c.JSON(http.StatusOK, template)
+}
+
+// List lists one page of templates
+func (h *TemplateHandler) List(c *gin.Context) {
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	templates, err := scoped(c, h.service).PageTemplates(page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, templates)
+}
+
+// Update stores a new version of a template, which unpinned agents made from it follow
+func (h *TemplateHandler) Update(c *gin.Context) {
+	service := scoped(c, h.service)
+	template, err := service.GetTemplate(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent template not found"})
+		return
+	}
+	
+	var input struct {
+		Name   *string `json:"name"`
+		Role   *string `json:"role"`
+		Prompt *string `json:"prompt"`
+		Model  *string `json:"model"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	name, role, prompt, model := template.Name, template.Role, template.Prompt, template.Model
+	if input.Name != nil {
+		name = *input.Name
+	}
+	if input.Role != nil {
+		role = *input.Role
+	}
+	if input.Prompt != nil {
+		prompt = *input.Prompt
+	}
+	if input.Model != nil {
+		model = *input.Model
+	}
+	
+	template, err = service.UpdateTemplate(template.ID, name, role, prompt, model)
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent template not found"})
+	case errors.Is(err, repositories.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+// Delete deletes a template
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	err := scoped(c, h.service).DeleteTemplate(c.Param("id"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.Status(http.StatusNoContent)
+}
+
+// Instantiate creates agents in a session from one or more templates
+func (h *TemplateHandler) Instantiate(c *gin.Context) {
+	var input struct {
+		TemplateID  string   `json:"templateId"`
+		TemplateIDs []string `json:"templateIds"`
+		Pinned      bool     `json:"pinned"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	ids := input.TemplateIDs
+	if input.TemplateID != "" {
+		ids = append([]string{input.TemplateID}, ids...)
+	}
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "templateId or templateIds is required"})
+		return
+	}
+	
+	agents, err := scoped(c, h.service).InstantiateTemplates(c.Param("id"), ids, input.Pinned)
+	if errors.Is(err, services.ErrTemplateNotFound) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrUnknownSession) || errors.Is(err, repositories.ErrInvalidReference) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, agents)
+}
+
+// UpdatePinned pins an agent to its template version or lets it follow the template again
+func (h *TemplateHandler) UpdatePinned(c *gin.Context) {
+	var input struct {
+		Pinned *bool `json:"pinned" binding:"required"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	agent, err := scoped(c, h.service).SetAgentPinned(c.Param("id"), *input.Pinned)
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+	case errors.Is(err, services.ErrNoTemplate):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, agent)
+	}
+}
+
+// RegisterRoutes registers routes for the template handler
+func (h *TemplateHandler) RegisterRoutes(router *gin.Engine) {
+	templates := router.Group("/api/agent-templates")
+	{
+		templates.POST("", h.Create)
+		templates.GET("", h.List)
+		templates.GET("/:id", h.Get)
+		templates.PUT("/:id", h.Update)
+		templates.DELETE("/:id", h.Delete)
+	}
+	
+	router.POST("/api/sessions/:id/agents", h.Instantiate)
+	router.PUT("/api/agents/:id/pinned", h.UpdatePinned)
+}
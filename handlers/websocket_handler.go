@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/chatcollab/chatcollab/realtime"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// WebSocketHandler handles websocket connections to sessions
+type WebSocketHandler struct {
+	sessions *services.SessionService
+	agents   *services.AgentService
+	manager  *realtime.Manager
+	upgrader websocket.Upgrader
+}
+
+// NewWebSocketHandler creates a new WebSocketHandler
+func NewWebSocketHandler(manager *realtime.Manager, sessions *services.SessionService, agents *services.AgentService) *WebSocketHandler {
+	return &WebSocketHandler{
+		sessions: sessions,
+		agents:   agents,
+		manager:  manager,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+	}
+}
+
+// Connect upgrades the request to a websocket joined to the session.
+// Passing agentId lets the connection send messages as that agent and
+// keeps the agent online for as long as it is connected. Connections made
+// with an agent's token are that agent's, and those made with a key acting
+// for a user only listen.
+func (h *WebSocketHandler) Connect(c *gin.Context) {
+	sessionID := c.Param("id")
+	agentID := c.Query("agentId")
+	if tokenAgentID := tokenAgent(c); tokenAgentID != "" {
+		if agentID != "" && agentID != tokenAgentID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Agent tokens can only connect as their own agent"})
+			return
+		}
+		agentID = tokenAgentID
+	}
+	if agentID != "" && keyUser(c) != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User keys cannot connect as an agent"})
+		return
+	}
+	
+	if _, err := scoped(c, h.sessions).GetSession(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	
+	if agentID != "" {
+		agent, err := scoped(c, h.agents).GetAgent(agentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Agent not found"})
+			return
+		}
+		if agent.SessionID != sessionID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Agent does not belong to this session"})
+			return
+		}
+	}
+	
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		return
+	}
+	
+	h.manager.Serve(conn, sessionID, agentID)
+}
+
+// RegisterRoutes registers routes for the websocket handler
+func (h *WebSocketHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/api/sessions/:id/ws", h.Connect)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// WorkspaceHandler handles HTTP requests for workspaces
+type WorkspaceHandler struct {
+	service *services.WorkspaceService
+}
+
+// NewWorkspaceHandler creates a new WorkspaceHandler
+func NewWorkspaceHandler(service *services.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		service: service,
+	}
+}
+
+// Create creates a new workspace. Quotas left out are unlimited.
+func (h *WorkspaceHandler) Create(c *gin.Context) {
+	var input struct {
+		Name   string        `json:"name" binding:"required"`
+		Quotas models.Quotas `json:"quotas"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	workspace, err := h.service.CreateWorkspace(input.Name, input.Quotas)
+	if errors.Is(err, services.ErrInvalidQuotas) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusCreated, workspace)
+}
+
+// Get retrieves a workspace by ID with how much of its quotas it uses
+func (h *WorkspaceHandler) Get(c *gin.Context) {
+	id := c.Param("id")
+	
+	workspace, err := h.service.GetWorkspace(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+	usage, err := h.service.Usage(id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, gin.H{"workspace": workspace, "usage": usage})
+}
+
+// List lists one page of workspaces
+func (h *WorkspaceHandler) List(c *gin.Context) {
+	page, err := pageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	workspaces, err := h.service.PageWorkspaces(page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// Update renames a workspace or changes its quotas. Quotas given replace
+// all of the old ones.
+func (h *WorkspaceHandler) Update(c *gin.Context) {
+	workspace, err := h.service.GetWorkspace(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+	
+	var input struct {
+		Name   *string        `json:"name"`
+		Quotas *models.Quotas `json:"quotas"`
+	}
+	
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	
+	name, quotas := workspace.Name, workspace.Quotas
+	if input.Name != nil {
+		name = *input.Name
+	}
+	if input.Quotas != nil {
+		quotas = *input.Quotas
+	}
+	
+	workspace, err = h.service.UpdateWorkspace(workspace.ID, name, quotas)
+	switch {
+	case errors.Is(err, services.ErrInvalidQuotas):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, workspace)
+	}
+}
+
+// Delete deletes an empty workspace with its users and API keys
+func (h *WorkspaceHandler) Delete(c *gin.Context) {
+	err := h.service.DeleteWorkspace(c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrDefaultWorkspace):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrReferenced):
+		c.JSON(http.StatusConflict, gin.H{"error": "Workspace still has sessions or agent templates"})
+	case errors.Is(err, repositories.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// RegisterRoutes registers routes for the workspace handler
+func (h *WorkspaceHandler) RegisterRoutes(router *gin.Engine) {
+	workspaces := router.Group("/api/workspaces")
+	{
+		workspaces.POST("", h.Create)
+		workspaces.GET("", h.List)
+		workspaces.GET("/:id", h.Get)
+		workspaces.PUT("/:id", h.Update)
+		workspaces.DELETE("/:id", h.Delete)
+	}
+}
@@ -1,22 +1,52 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/events"
 	"github.com/chatcollab/chatcollab/handlers"
+	"github.com/chatcollab/chatcollab/orchestrator"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/ratelimit"
+	"github.com/chatcollab/chatcollab/reaper"
+	"github.com/chatcollab/chatcollab/realtime"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
 )
 
 func main() {
 	// Initialize database
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "chatcollab.db"
+	driver, dsn, err := databaseConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 	
-	if err := db.Initialize(dbPath); err != nil {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(driver, dsn, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	
+	reaperConfig, err := reaper.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	limits, err := ratelimit.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	
+	if err := db.InitializeDriver(driver, dsn); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
@@ -38,24 +68,128 @@ func main() {
 		})
 	})
 	
-	// Register API routes
-	sessionHandler := handlers.NewSessionHandler()
+	// Wire storage, services and background workers
+	store := repositories.NewSQLStore(db.DB, db.Driver)
+	
+	sessionService := services.NewSessionService(store.Sessions, store)
+	sessionService.SetTimeout(reaperConfig.Timeout)
+	sessionService.SetMaxMessages(limits.SessionMessages)
+	agentService := services.NewAgentService(store.Agents, store)
+	participantService := services.NewParticipantService(store.Users, store.Agents, store)
+	templateService := services.NewTemplateService(store.Templates, store)
+	messageService := services.NewMessageService(store.Messages, store)
+	messageService.SetRateLimits(ratelimit.NewLimiter(limits.Agent), ratelimit.NewLimiter(limits.Session))
+	reasoningService := services.NewReasoningService(store.Reasoning, store.Agents, store)
+	archiveService := services.NewArchiveService(store)
+	workspaceService := services.NewWorkspaceService(store.Workspaces, store)
+	authService := services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store)
+	
+	// A fresh install gets one admin key to mint the others with
+	bootstrapKey, created, err := authService.Bootstrap(os.Getenv("BOOTSTRAP_API_KEY"))
+	if err != nil {
+		log.Fatalf("Failed to create the bootstrap API key: %v", err)
+	}
+	if created && os.Getenv("BOOTSTRAP_API_KEY") == "" {
+		log.Printf("Created admin API key %s; store it now, it will not be shown again", bootstrapKey)
+	} else if created {
+		log.Printf("Created admin API key from BOOTSTRAP_API_KEY")
+	}
+	
+	runner := services.NewAgentRunner(sessionService, agentService, participantService, messageService, providers.NewRegistryFromEnv())
+	orchestrators := orchestrator.NewManager(runner, agentService, messageService, sessionService)
+	defer orchestrators.Shutdown()
+	hubs := realtime.NewManager(events.Default, messageService, agentService, sessionService)
+	sessionReaper := reaper.NewReaper(reaperConfig, sessionService, agentService)
+	sessionReaper.Start()
+	defer sessionReaper.Shutdown()
+	
+	// Register API routes, all of which need an API key and are rate limited per key
+	authHandler := handlers.NewAuthHandler(authService)
+	rateLimitHandler := handlers.NewRateLimitHandler(ratelimit.NewLimiter(limits.Key))
+	router.Use(authHandler.Authenticate, rateLimitHandler.Limit)
+	authHandler.RegisterRoutes(router)
+	
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService)
+	workspaceHandler.RegisterRoutes(router)
+	
+	sessionHandler := handlers.NewSessionHandler(sessionService)
 	sessionHandler.RegisterRoutes(router)
 	
-	agentHandler := handlers.NewAgentHandler()
+	agentHandler := handlers.NewAgentHandler(agentService, runner)
 	agentHandler.RegisterRoutes(router)
 	
-	messageHandler := handlers.NewMessageHandler()
+	templateHandler := handlers.NewTemplateHandler(templateService)
+	templateHandler.RegisterRoutes(router)
+	
+	participantHandler := handlers.NewParticipantHandler(participantService)
+	participantHandler.RegisterRoutes(router)
+	
+	messageHandler := handlers.NewMessageHandler(messageService)
 	messageHandler.RegisterRoutes(router)
 	
+	reasoningHandler := handlers.NewReasoningHandler(reasoningService)
+	reasoningHandler.RegisterRoutes(router)
+	
+	archiveHandler := handlers.NewArchiveHandler(archiveService)
+	archiveHandler.RegisterRoutes(router)
+	
+	websocketHandler := handlers.NewWebSocketHandler(hubs, sessionService, agentService)
+	websocketHandler.RegisterRoutes(router)
+	
+	orchestratorHandler := handlers.NewOrchestratorHandler(orchestrators)
+	orchestratorHandler.RegisterRoutes(router)
+	
 	// Run the server
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 	
-	log.Printf("Server starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		serverErr <- server.ListenAndServe()
+	}()
+	
+	// Stop on SIGINT/SIGTERM, letting in-flight requests and background
+	// workers finish before the database is closed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	
+	select {
+	case err := <-serverErr:
+		log.Printf("Failed to start server: %v", err)
+		return
+	case <-ctx.Done():
+	}
+	
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
+}
+
+// databaseConfig reads DB_DRIVER and DB_DSN from the environment.
+// SQLite falls back to DB_PATH so existing deployments keep working.
+func databaseConfig() (db.Dialect, string, error) {
+	driver, err := db.ParseDialect(os.Getenv("DB_DRIVER"))
+	if err != nil {
+		return "", "", err
 	}
+	
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		if driver == db.Postgres {
+			return "", "", errors.New("DB_DSN is required when DB_DRIVER is postgres")
+		}
+		dsn = os.Getenv("DB_PATH")
+		if dsn == "" {
+			dsn = "chatcollab.db"
+		}
+	}
+	
+	return driver, dsn, nil
 }
\ No newline at end of file
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/chatcollab/chatcollab/db"
+)
+
+const migrateUsage = `usage: chatcollab migrate <command>
+
+commands:
+  up [version]   apply pending migrations, optionally stopping at version
+  down [steps]   revert the last applied migration, or the last steps migrations
+  status         list migrations and whether they have been applied`
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(driver db.Dialect, dsn string, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	var n int
+	if len(args) > 1 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number %q\n\n%s", args[1], migrateUsage)
+		}
+	}
+
+	if err := db.OpenDriver(driver, dsn); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := db.MigrateUp(db.DB, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		reverted, err := db.MigrateDown(db.DB, n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", reverted)
+	case "status":
+		statuses, err := db.Status(db.DB)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, s := range statuses {
+			state := "pending"
+			switch {
+			case s.Unknown:
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05") + " (unknown to this binary)"
+			case s.Modified:
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05") + " (checksum mismatch)"
+			case s.Applied:
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, state)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
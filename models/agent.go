@@ -1,32 +1,49 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
 // Agent represents a chat agent/participant
 type Agent struct {
-	ID           string `json:"id"`
-	IsOnline     bool   `json:"isOnline"`
-	Name         string `json:"name"`
-	Role         string `json:"role"`
-	Prompt       string `json:"prompt"`
-	Model        string `json:"model"`
-	ReasoningLog string `json:"reasoningLog"`
-	SessionID    string `json:"sessionId"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	IsOnline  bool      `json:"isOnline"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Prompt    string    `json:"prompt"`
+	Model     string    `json:"model"`
+	SessionID string    `json:"sessionId"`
+
+	// Agents made from a template track the version they run. Pinned agents
+	// keep that version when the template is updated.
+	TemplateID      string `json:"templateId,omitempty"`
+	TemplateVersion int    `json:"templateVersion,omitempty"`
+	Pinned          bool   `json:"pinned"`
+
+	// Version counts changes, starting at 1. Going online or offline does
+	// not count.
+	Version int `json:"version"`
+
+	// Token is the agent's credential for speaking as itself. It is never
+	// stored, so it is only set on the agent returned when it is issued.
+	Token string `json:"token,omitempty"`
 }
 
 // NewAgent creates a new Agent with a generated UUID
 func NewAgent(name, role, prompt, model, sessionID string) *Agent {
 	return &Agent{
-		ID:           uuid.New().String(),
-		IsOnline:     true,
-		Name:         name,
-		Role:         role,
-		Prompt:       prompt,
-		Model:        model,
-		ReasoningLog: "",
-		SessionID:    sessionID,
+		ID:        uuid.New().String(),
+		CreatedAt: timestamp(),
+		IsOnline:  true,
+		Name:      name,
+		Role:      role,
+		Prompt:    prompt,
+		Model:     model,
+		SessionID: sessionID,
+		Version:   1,
 	}
 }
 
@@ -35,11 +52,15 @@ func (a *Agent) SetOnline(isOnline bool) {
 	a.IsOnline = isOnline
 }
 
-// AppendReasoningLog adds to the agent's reasoning log
-func (a *Agent) AppendReasoningLog(log string) {
-	if a.ReasoningLog == "" {
-		a.ReasoningLog = log
-	} else {
-		a.ReasoningLog += "\n" + log
+// SyncTemplate updates the agent to the template's current version unless
+// it is pinned, reporting whether anything changed. The agent keeps its name.
+func (a *Agent) SyncTemplate(t *AgentTemplate) bool {
+	if a.Pinned || a.TemplateID != t.ID || a.TemplateVersion == t.Version {
+		return false
 	}
-}
\ No newline at end of file
+	a.Role = t.Role
+	a.Prompt = t.Prompt
+	a.Model = t.Model
+	a.TemplateVersion = t.Version
+	return true
+}
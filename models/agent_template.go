@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AgentTemplate is a reusable agent definition that can be instantiated
+// into any number of sessions
+type AgentTemplate struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	Prompt    string    `json:"prompt"`
+	Model     string    `json:"model"`
+
+	// WorkspaceID names the workspace owning the template
+	WorkspaceID string `json:"workspaceId"`
+
+	// Version counts updates, starting at 1
+	Version int `json:"version"`
+}
+
+// NewAgentTemplate creates a new AgentTemplate with a generated UUID
+func NewAgentTemplate(name, role, prompt, model string) *AgentTemplate {
+	now := timestamp()
+	return &AgentTemplate{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+		Role:      role,
+		Prompt:    prompt,
+		Model:     model,
+		Version:   1,
+	}
+}
+
+// Revise replaces the template's definition as its next version
+func (t *AgentTemplate) Revise(name, role, prompt, model string) {
+	t.Name = name
+	t.Role = role
+	t.Prompt = prompt
+	t.Model = model
+	t.Version++
+	t.UpdatedAt = timestamp()
+}
+
+// Instantiate creates an agent in a session from the template's current version
+func (t *AgentTemplate) Instantiate(sessionID string) *Agent {
+	agent := NewAgent(t.Name, t.Role, t.Prompt, t.Model, sessionID)
+	agent.TemplateID = t.ID
+	agent.TemplateVersion = t.Version
+	return agent
+}
@@ -22,7 +22,6 @@ func TestNewAgent(t *testing.T) {
 	assert.Equal(t, model, agent.Model, "Agent model should match input")
 	assert.Equal(t, sessionID, agent.SessionID, "Agent sessionID should match input")
 	assert.True(t, agent.IsOnline, "New agent should be online by default")
-	assert.Empty(t, agent.ReasoningLog, "New agent should have empty reasoning log")
 }
 
 func TestSetOnline(t *testing.T) {
@@ -40,19 +39,26 @@ func TestSetOnline(t *testing.T) {
 	assert.True(t, agent.IsOnline, "Agent should be online after SetOnline(true)")
 }
 
-func TestAppendReasoningLog(t *testing.T) {
-	agent := NewAgent("Test", "assistant", "prompt", "model", "session123")
+func TestAgentTemplateSync(t *testing.T) {
+	template := NewAgentTemplate("Reviewer", "critic", "Review carefully", "gpt-4")
+	assert.Equal(t, 1, template.Version, "New templates start at version 1")
 	
-	// Initial log should be empty
-	assert.Empty(t, agent.ReasoningLog, "New agent should have empty reasoning log")
+	agent := template.Instantiate("session123")
+	assert.Equal(t, template.ID, agent.TemplateID, "Agent should remember its template")
+	assert.Equal(t, 1, agent.TemplateVersion, "Agent should run the template's current version")
 	
-	// Append first log entry
-	firstLog := "First reasoning entry"
-	agent.AppendReasoningLog(firstLog)
-	assert.Equal(t, firstLog, agent.ReasoningLog, "Reasoning log should contain first entry")
+	// A session may rename its agent without losing the template link
+	agent.Name = "Second Reviewer"
+	template.Revise("Reviewer", "critic", "Review very carefully", "gpt-4o")
+	assert.Equal(t, 2, template.Version, "Revising bumps the version")
+	assert.True(t, agent.SyncTemplate(template), "Unpinned agent should follow the template")
+	assert.Equal(t, "Review very carefully", agent.Prompt)
+	assert.Equal(t, "gpt-4o", agent.Model)
+	assert.Equal(t, "Second Reviewer", agent.Name, "Syncing keeps the agent's name")
+	assert.False(t, agent.SyncTemplate(template), "Agent already on the current version")
 	
-	// Append second log entry
-	secondLog := "Second reasoning entry"
-	agent.AppendReasoningLog(secondLog)
-	assert.Equal(t, firstLog+"\n"+secondLog, agent.ReasoningLog, "Reasoning log should contain both entries")
-}
\ No newline at end of file
+	agent.Pinned = true
+	template.Revise("Reviewer", "critic", "Skim", "gpt-4o")
+	assert.False(t, agent.SyncTemplate(template), "Pinned agent should stay on its version")
+	assert.Equal(t, 2, agent.TemplateVersion)
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scope is a permission granted to an API key, written resource:access
+type Scope string
+
+const (
+	ScopeSessionsRead   Scope = "sessions:read"
+	ScopeSessionsWrite  Scope = "sessions:write"
+	ScopeAgentsRead     Scope = "agents:read"
+	ScopeAgentsWrite    Scope = "agents:write"
+	ScopeMessagesRead   Scope = "messages:read"
+	ScopeMessagesWrite  Scope = "messages:write"
+	ScopeTemplatesRead  Scope = "templates:read"
+	ScopeTemplatesWrite Scope = "templates:write"
+	ScopeUsersRead      Scope = "users:read"
+	ScopeUsersWrite     Scope = "users:write"
+
+	// ScopeAdmin grants every other scope and manages API keys
+	ScopeAdmin Scope = "admin"
+)
+
+// Scopes lists every scope a key can be granted
+var Scopes = []Scope{
+	ScopeSessionsRead, ScopeSessionsWrite,
+	ScopeAgentsRead, ScopeAgentsWrite,
+	ScopeMessagesRead, ScopeMessagesWrite,
+	ScopeTemplatesRead, ScopeTemplatesWrite,
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopeAdmin,
+}
+
+// Valid reports whether s is a known scope
+func (s Scope) Valid() bool {
+	for _, scope := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyPrefix starts every key so they are easy to spot, in logs or in code
+const apiKeyPrefix = "cck_"
+
+// APIKey lets a client call the API with the scopes it was granted. Only a
+// hash of the key itself is kept; Prefix holds its first characters so
+// people can tell keys apart.
+type APIKey struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	Scopes    []Scope   `json:"scopes"`
+
+	// SessionID optionally restricts the key to one session's records
+	SessionID string `json:"sessionId,omitempty"`
+
+	// AgentID makes the key an agent's token, which can only speak as that agent
+	AgentID string `json:"agentId,omitempty"`
+
+	// UserID makes the key act for a user, who is held to their session roles
+	UserID string `json:"userId,omitempty"`
+
+	// WorkspaceID names the workspace the key belongs to and is confined to
+	WorkspaceID string `json:"workspaceId"`
+
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// NewAPIKey creates a new APIKey with a generated UUID and a random secret,
+// returning the secret too since it cannot be recovered from the key
+func NewAPIKey(name string, scopes []Scope, sessionID string) (*APIKey, string) {
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(random)
+
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		CreatedAt: timestamp(),
+		Name:      name,
+		Scopes:    scopes,
+		SessionID: sessionID,
+	}
+	key.SetSecret(secret)
+	return key, secret
+}
+
+// AgentTokenScopes are the scopes an agent's token is granted: enough to
+// follow its session and speak in it
+var AgentTokenScopes = []Scope{ScopeSessionsRead, ScopeAgentsWrite, ScopeMessagesWrite}
+
+// NewAgentToken creates an API key for the agent, restricted to its session
+// and to speaking as the agent, returning the secret too
+func NewAgentToken(agent *Agent) (*APIKey, string) {
+	scopes := append([]Scope(nil), AgentTokenScopes...)
+	key, secret := NewAPIKey("agent "+agent.Name, scopes, agent.SessionID)
+	key.AgentID = agent.ID
+	return key, secret
+}
+
+// SetSecret makes secret the key's secret
+func (k *APIKey) SetSecret(secret string) {
+	k.Hash = HashAPIKey(secret)
+	k.Prefix = secret
+	if len(secret) > len(apiKeyPrefix)+8 {
+		k.Prefix = secret[:len(apiKeyPrefix)+8]
+	}
+}
+
+// HashAPIKey returns the hash a key's secret is stored and looked up by
+func HashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Active reports whether the key has not been revoked
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil
+}
+
+// Allows reports whether the key grants scope. Admin keys grant everything,
+// and write access to a resource includes reading it.
+func (k *APIKey) Allows(scope Scope) bool {
+	resource, access, _ := strings.Cut(string(scope), ":")
+	for _, granted := range k.Scopes {
+		if granted == ScopeAdmin || granted == scope {
+			return true
+		}
+		if access == "read" && granted == Scope(resource+":write") {
+			return true
+		}
+	}
+	return false
+}
+
+// Revoke stops the key from being accepted, as of now
+func (k *APIKey) Revoke() {
+	if k.RevokedAt == nil {
+		now := timestamp()
+		k.RevokedAt = &now
+	}
+}
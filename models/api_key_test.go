@@ -0,0 +1,52 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, secret := NewAPIKey("ci", []Scope{ScopeMessagesWrite}, "session1")
+	assert.NotEmpty(t, key.ID, "Key ID should not be empty")
+	assert.True(t, strings.HasPrefix(secret, "cck_"))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	assert.Less(t, len(key.Prefix), len(secret))
+	assert.Equal(t, HashAPIKey(secret), key.Hash)
+	assert.NotContains(t, key.Hash, secret)
+
+	_, other := NewAPIKey("ci", nil, "")
+	assert.NotEqual(t, secret, other, "Secrets should be random")
+
+	assert.True(t, key.Active())
+	key.Revoke()
+	assert.False(t, key.Active())
+}
+
+func TestAPIKeyAllows(t *testing.T) {
+	key := &APIKey{Scopes: []Scope{ScopeMessagesWrite, ScopeSessionsRead}}
+	assert.True(t, key.Allows(ScopeMessagesWrite))
+	assert.True(t, key.Allows(ScopeMessagesRead), "Writing should include reading")
+	assert.True(t, key.Allows(ScopeSessionsRead))
+	assert.False(t, key.Allows(ScopeSessionsWrite))
+	assert.False(t, key.Allows(ScopeAgentsRead))
+	assert.False(t, key.Allows(ScopeAdmin))
+
+	admin := &APIKey{Scopes: []Scope{ScopeAdmin}}
+	for _, scope := range Scopes {
+		assert.True(t, admin.Allows(scope), "Admin keys should allow %s", scope)
+	}
+	assert.False(t, Scope("sessions:delete").Valid())
+}
+
+func TestNewAgentToken(t *testing.T) {
+	agent := NewAgent("Writer", "author", "prompt", "gpt-4", "session1")
+	key, secret := NewAgentToken(agent)
+	assert.Equal(t, agent.ID, key.AgentID)
+	assert.Equal(t, "session1", key.SessionID)
+	assert.Equal(t, HashAPIKey(secret), key.Hash)
+	assert.True(t, key.Allows(ScopeMessagesWrite))
+	assert.True(t, key.Allows(ScopeMessagesRead))
+	assert.False(t, key.Allows(ScopeSessionsWrite))
+}
@@ -8,20 +8,107 @@ import (
 
 // Message represents a chat message
 type Message struct {
-	ID        string    `json:"id"`
-	CreatedAt time.Time `json:"createdAt"`
-	Content   string    `json:"content"`
-	AgentID   string    `json:"agentId"`
-	SessionID string    `json:"sessionId"`
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Content      string    `json:"content"`
+	AgentID      string    `json:"agentId"`
+	SessionID    string    `json:"sessionId"`
+	ParentID     string    `json:"parentId,omitempty"`
+	ThreadRootID string    `json:"threadRootId,omitempty"`
+
+	// A message is written by an agent or by a user. AuthorType says which;
+	// AgentID is empty for messages from users.
+	AuthorType ParticipantKind `json:"authorType"`
+	UserID     string          `json:"userId,omitempty"`
+
+	// Revision counts edits, starting at 1 for the original content
+	Revision int        `json:"revision"`
+	EditedAt *time.Time `json:"editedAt,omitempty"`
+	EditedBy string     `json:"editedBy,omitempty"`
+
+	// ReplyCount is only filled in when listing threads collapsed
+	ReplyCount int `json:"replyCount,omitempty"`
 }
 
 // NewMessage creates a new Message with a generated UUID
 func NewMessage(content, agentID, sessionID string) *Message {
 	return &Message{
-		ID:        uuid.New().String(),
-		CreatedAt: time.Now(),
-		Content:   content,
-		AgentID:   agentID,
-		SessionID: sessionID,
+		ID:         uuid.New().String(),
+		CreatedAt:  timestamp(),
+		Content:    content,
+		AgentID:    agentID,
+		SessionID:  sessionID,
+		AuthorType: ParticipantAgent,
+		Revision:   1,
+	}
+}
+
+// NewUserMessage creates a new Message written by a user
+func NewUserMessage(content, userID, sessionID string) *Message {
+	message := NewMessage(content, "", sessionID)
+	message.AuthorType = ParticipantHuman
+	message.UserID = userID
+	return message
+}
+
+// AuthorID returns the ID of the agent or user who wrote the message
+func (m *Message) AuthorID() string {
+	if m.AuthorType == ParticipantHuman {
+		return m.UserID
 	}
+	return m.AgentID
+}
+
+// MessageRevision is one version of a message's content
+type MessageRevision struct {
+	MessageID string    `json:"messageId"`
+	Revision  int       `json:"revision"`
+	Content   string    `json:"content"`
+	EditorID  string    `json:"editorId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Edit replaces the message's content as a new revision made by editorID
+func (m *Message) Edit(content, editorID string) {
+	now := timestamp()
+	m.Content = content
+	m.Revision++
+	m.EditedAt = &now
+	m.EditedBy = editorID
+}
+
+// CurrentRevision returns the revision record for the message's current content
+func (m *Message) CurrentRevision() *MessageRevision {
+	revision := &MessageRevision{
+		MessageID: m.ID,
+		Revision:  m.Revision,
+		Content:   m.Content,
+		EditorID:  m.AuthorID(),
+		CreatedAt: m.CreatedAt,
+	}
+	if m.EditedAt != nil {
+		revision.EditorID = m.EditedBy
+		revision.CreatedAt = *m.EditedAt
+	}
+	return revision
+}
+
+// ReplyTo makes the message a reply to parent, joining parent's thread
+func (m *Message) ReplyTo(parent *Message) {
+	m.ParentID = parent.ID
+	m.ThreadRootID = parent.ThreadRoot()
+}
+
+// ThreadRootRef returns the ID of the message at the top of this message's thread
+func (m *Message) ThreadRoot() string {
+	if m.ThreadRootID != "" {
+		return m.ThreadRootID
+	}
+	return m.ID
+}
+
+// timestamp returns the current time in UTC, truncated to the microsecond
+// precision every storage backend keeps, so stored values round-trip exactly
+func timestamp() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
 }
\ No newline at end of file
@@ -19,4 +19,38 @@ func TestNewMessage(t *testing.T) {
 	assert.Equal(t, agentID, message.AgentID, "Message agentID should match input")
 	assert.Equal(t, sessionID, message.SessionID, "Message sessionID should match input")
 	assert.WithinDuration(t, time.Now(), message.CreatedAt, 2*time.Second, "CreatedAt should be close to current time")
-}
\ No newline at end of file
+}
+func TestMessageReplyTo(t *testing.T) {
+	root := NewMessage("root", "agent1", "session1")
+	assert.Equal(t, root.ID, root.ThreadRoot(), "A top-level message is the root of its own thread")
+	
+	reply := NewMessage("reply", "agent2", "session1")
+	reply.ReplyTo(root)
+	assert.Equal(t, root.ID, reply.ParentID)
+	assert.Equal(t, root.ID, reply.ThreadRootID)
+	
+	nested := NewMessage("nested", "agent1", "session1")
+	nested.ReplyTo(reply)
+	assert.Equal(t, reply.ID, nested.ParentID)
+	assert.Equal(t, root.ID, nested.ThreadRootID, "Nested replies stay in the root's thread")
+}
+
+func TestMessageEdit(t *testing.T) {
+	message := NewMessage("first draft", "agent1", "session1")
+	assert.Equal(t, 1, message.Revision)
+	assert.Nil(t, message.EditedAt)
+	
+	original := message.CurrentRevision()
+	assert.Equal(t, "agent1", original.EditorID, "The author made the first revision")
+	assert.Equal(t, message.CreatedAt, original.CreatedAt)
+	
+	message.Edit("second draft", "agent2")
+	assert.Equal(t, 2, message.Revision)
+	assert.Equal(t, "second draft", message.Content)
+	assert.NotNil(t, message.EditedAt)
+	
+	revision := message.CurrentRevision()
+	assert.Equal(t, 2, revision.Revision)
+	assert.Equal(t, "agent2", revision.EditorID)
+	assert.Equal(t, *message.EditedAt, revision.CreatedAt)
+}
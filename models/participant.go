@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ParticipantKind tells the people in a session apart from its agents
+type ParticipantKind string
+
+const (
+	ParticipantHuman ParticipantKind = "human"
+	ParticipantAgent ParticipantKind = "agent"
+)
+
+// SessionRole is what a user may do in a session they are a member of. Each
+// role can do everything the roles below it can.
+type SessionRole string
+
+const (
+	// RoleViewer can read the session
+	RoleViewer SessionRole = "viewer"
+
+	// RoleMember can also post to it
+	RoleMember SessionRole = "member"
+
+	// RoleOwner can also manage its agents and members and delete things
+	RoleOwner SessionRole = "owner"
+)
+
+// sessionRoleRanks orders the roles from least to most trusted
+var sessionRoleRanks = map[SessionRole]int{RoleViewer: 1, RoleMember: 2, RoleOwner: 3}
+
+// Valid reports whether r is a known role
+func (r SessionRole) Valid() bool {
+	_, ok := sessionRoleRanks[r]
+	return ok
+}
+
+// Includes reports whether r can do everything required can
+func (r SessionRole) Includes(required SessionRole) bool {
+	return r.Valid() && sessionRoleRanks[r] >= sessionRoleRanks[required]
+}
+
+// User represents a person who can join sessions and write messages
+type User struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Name      string    `json:"name"`
+
+	// WorkspaceID names the workspace the user belongs to
+	WorkspaceID string `json:"workspaceId"`
+}
+
+// NewUser creates a new User with a generated UUID
+func NewUser(name string) *User {
+	return &User{
+		ID:        uuid.New().String(),
+		CreatedAt: timestamp(),
+		Name:      name,
+	}
+}
+
+// Participant is a member of a session along with their presence: either a
+// user who joined it or an agent created in it
+type Participant struct {
+	ID        string          `json:"id"`
+	Kind      ParticipantKind `json:"kind"`
+	Name      string          `json:"name"`
+	Role      string          `json:"role,omitempty"`
+	Model     string          `json:"model,omitempty"`
+	IsOnline  bool            `json:"isOnline"`
+	SessionID string          `json:"sessionId"`
+	JoinedAt  time.Time       `json:"joinedAt"`
+
+	// SessionRole is a user's role in the session; agents have none
+	SessionRole SessionRole `json:"sessionRole,omitempty"`
+}
+
+// JoinSession returns the user's membership of a session as a member,
+// starting now and online
+func (u *User) JoinSession(sessionID string) *Participant {
+	return &Participant{
+		ID:          u.ID,
+		Kind:        ParticipantHuman,
+		Name:        u.Name,
+		IsOnline:    true,
+		SessionID:   sessionID,
+		JoinedAt:    timestamp(),
+		SessionRole: RoleMember,
+	}
+}
+
+// Participant returns the agent as a member of its session
+func (a *Agent) Participant() *Participant {
+	return &Participant{
+		ID:        a.ID,
+		Kind:      ParticipantAgent,
+		Name:      a.Name,
+		Role:      a.Role,
+		Model:     a.Model,
+		IsOnline:  a.IsOnline,
+		SessionID: a.SessionID,
+		JoinedAt:  a.CreatedAt,
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinSession(t *testing.T) {
+	user := NewUser("Ada")
+	member := user.JoinSession("session1")
+	assert.Equal(t, user.ID, member.ID)
+	assert.Equal(t, ParticipantHuman, member.Kind)
+	assert.Equal(t, RoleMember, member.SessionRole, "Joining should make the user a member")
+	assert.True(t, member.IsOnline)
+}
+
+func TestSessionRoleIncludes(t *testing.T) {
+	assert.True(t, RoleOwner.Includes(RoleMember))
+	assert.True(t, RoleOwner.Includes(RoleViewer))
+	assert.True(t, RoleMember.Includes(RoleMember))
+	assert.True(t, RoleMember.Includes(RoleViewer))
+	assert.False(t, RoleMember.Includes(RoleOwner))
+	assert.False(t, RoleViewer.Includes(RoleMember))
+
+	assert.False(t, SessionRole("admin").Valid())
+	assert.False(t, SessionRole("").Includes(RoleViewer), "Unknown roles should include nothing")
+}
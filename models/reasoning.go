@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReasoningStep is the kind of step a reasoning entry records
+type ReasoningStep string
+
+const (
+	StepThought     ReasoningStep = "thought"
+	StepPlan        ReasoningStep = "plan"
+	StepToolCall    ReasoningStep = "tool-call"
+	StepObservation ReasoningStep = "observation"
+)
+
+// Valid reports whether s is one of the known step types
+func (s ReasoningStep) Valid() bool {
+	switch s {
+	case StepThought, StepPlan, StepToolCall, StepObservation:
+		return true
+	}
+	return false
+}
+
+// ReasoningEntry is one step of an agent's reasoning
+type ReasoningEntry struct {
+	ID        string        `json:"id"`
+	AgentID   string        `json:"agentId"`
+	SessionID string        `json:"sessionId,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Step      ReasoningStep `json:"type"`
+	Content   string        `json:"content"`
+
+	// MessageID optionally links the step to the message it led to or reacted to
+	MessageID string `json:"messageId,omitempty"`
+
+	// Payload holds structured step data such as tool arguments or results
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// NewReasoningEntry creates a new ReasoningEntry with a generated UUID
+func NewReasoningEntry(agentID, sessionID string, step ReasoningStep, content string) *ReasoningEntry {
+	return &ReasoningEntry{
+		ID:        uuid.New().String(),
+		AgentID:   agentID,
+		SessionID: sessionID,
+		CreatedAt: timestamp(),
+		Step:      step,
+		Content:   content,
+	}
+}
+
+// Text returns the line the entry contributes to the legacy text log,
+// falling back to the payload for entries without content
+func (e *ReasoningEntry) Text() string {
+	if e.Content != "" || len(e.Payload) == 0 {
+		return e.Content
+	}
+	return string(e.Payload)
+}
+
+// ReasoningLog joins entries into the legacy newline-separated text log
+func ReasoningLog(entries []*ReasoningEntry) string {
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.Text()
+	}
+	return strings.Join(lines, "\n")
+}
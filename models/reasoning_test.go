@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReasoningStepValid(t *testing.T) {
+	for _, step := range []ReasoningStep{StepThought, StepPlan, StepToolCall, StepObservation} {
+		assert.True(t, step.Valid(), "%s should be a valid step", step)
+	}
+	assert.False(t, ReasoningStep("").Valid())
+	assert.False(t, ReasoningStep("daydream").Valid())
+}
+
+func TestReasoningLog(t *testing.T) {
+	first := NewReasoningEntry("agent1", "session1", StepThought, "First reasoning entry")
+	assert.NotEmpty(t, first.ID, "Entry ID should not be empty")
+	assert.Equal(t, StepThought, first.Step)
+	
+	// Entries without content show their payload in the text view
+	second := NewReasoningEntry("agent1", "session1", StepToolCall, "")
+	second.Payload = json.RawMessage(`{"tool":"search"}`)
+	
+	assert.Empty(t, ReasoningLog(nil), "No entries should give an empty log")
+	assert.Equal(t, "First reasoning entry", ReasoningLog([]*ReasoningEntry{first}))
+	assert.Equal(t, "First reasoning entry\n{\"tool\":\"search\"}", ReasoningLog([]*ReasoningEntry{first, second}))
+}
@@ -6,17 +6,78 @@ import (
 	"github.com/google/uuid"
 )
 
+// SessionStatus is a step in a session's lifecycle
+type SessionStatus string
+
+const (
+	SessionDraft     SessionStatus = "draft"
+	SessionRunning   SessionStatus = "running"
+	SessionPaused    SessionStatus = "paused"
+	SessionIdle      SessionStatus = "idle"
+	SessionCompleted SessionStatus = "completed"
+	SessionArchived  SessionStatus = "archived"
+)
+
+// sessionTransitions lists the statuses each status may move to
+var sessionTransitions = map[SessionStatus][]SessionStatus{
+	SessionDraft:     {SessionRunning, SessionArchived},
+	SessionRunning:   {SessionPaused, SessionIdle, SessionCompleted},
+	SessionPaused:    {SessionRunning, SessionCompleted},
+	SessionIdle:      {SessionRunning, SessionCompleted},
+	SessionCompleted: {SessionArchived},
+}
+
+// Valid reports whether s is one of the known statuses
+func (s SessionStatus) Valid() bool {
+	switch s {
+	case SessionDraft, SessionRunning, SessionPaused, SessionIdle, SessionCompleted, SessionArchived:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a session may move from s to next
+func (s SessionStatus) CanTransitionTo(next SessionStatus) bool {
+	for _, allowed := range sessionTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 // Session represents a chat session
 type Session struct {
-	ID            string    `json:"id"`
-	LastHeartbeat time.Time `json:"lastHeartbeat"`
+	ID            string        `json:"id"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	LastHeartbeat time.Time     `json:"lastHeartbeat"`
+	Title         string        `json:"title"`
+	Goal          string        `json:"goal"`
+	Tags          []string      `json:"tags"`
+	Status        SessionStatus `json:"status"`
+	ClosedAt      *time.Time    `json:"closedAt,omitempty"`
+
+	// MaxMessages caps how many messages the session may hold; it pauses
+	// when it reaches them. Zero means no cap.
+	MaxMessages int `json:"maxMessages"`
+
+	// WorkspaceID names the workspace owning the session
+	WorkspaceID string `json:"workspaceId"`
+
+	// Version counts changes, starting at 1. Heartbeats do not count.
+	Version int `json:"version"`
 }
 
-// NewSession creates a new Session with a generated UUID
+// NewSession creates a new running Session with a generated UUID
 func NewSession() *Session {
+	now := timestamp()
 	return &Session{
 		ID:            uuid.New().String(),
-		LastHeartbeat: time.Now(),
+		CreatedAt:     now,
+		LastHeartbeat: now,
+		Tags:          []string{},
+		Status:        SessionRunning,
+		Version:       1,
 	}
 }
 
@@ -28,4 +89,23 @@ func (s *Session) UpdateHeartbeat() {
 // IsActive checks if the session is active based on a timeout duration
 func (s *Session) IsActive(timeout time.Duration) bool {
 	return time.Since(s.LastHeartbeat) < timeout
-}
\ No newline at end of file
+}
+
+// AcceptsMessages reports whether messages may be posted to the session
+func (s *Session) AcceptsMessages() bool {
+	return s.Status == SessionRunning
+}
+
+// Transition moves the session to the next status, reporting false when
+// the lifecycle does not allow it. Completing a session records when it closed.
+func (s *Session) Transition(next SessionStatus) bool {
+	if !s.Status.CanTransitionTo(next) {
+		return false
+	}
+	s.Status = next
+	if next == SessionCompleted {
+		closedAt := timestamp()
+		s.ClosedAt = &closedAt
+	}
+	return true
+}
@@ -37,4 +37,31 @@ func TestIsActive(t *testing.T) {
 	
 	// Check if the session is now inactive
 	assert.False(t, session.IsActive(5*time.Minute), "Session with old heartbeat should be inactive")
-}
\ No newline at end of file
+}
+func TestSessionTransitions(t *testing.T) {
+	session := NewSession()
+	assert.Equal(t, SessionRunning, session.Status, "New sessions should be running")
+	assert.True(t, session.AcceptsMessages())
+	
+	assert.False(t, session.Transition(SessionArchived), "Running sessions must complete before archiving")
+	assert.True(t, session.Transition(SessionPaused))
+	assert.False(t, session.AcceptsMessages(), "Paused sessions should not accept messages")
+	assert.True(t, session.Transition(SessionRunning))
+	assert.Nil(t, session.ClosedAt)
+	assert.True(t, session.Transition(SessionIdle), "Running sessions go idle when they stop sending heartbeats")
+	assert.False(t, session.Transition(SessionPaused))
+	assert.True(t, session.Transition(SessionRunning))
+	
+	assert.True(t, session.Transition(SessionCompleted))
+	assert.NotNil(t, session.ClosedAt, "Completing a session should record when it closed")
+	assert.False(t, session.Transition(SessionRunning), "Completed sessions cannot be reopened")
+	assert.True(t, session.Transition(SessionArchived))
+	
+	draft := NewSession()
+	draft.Status = SessionDraft
+	assert.False(t, draft.AcceptsMessages())
+	assert.False(t, draft.Transition(SessionPaused))
+	assert.True(t, draft.Transition(SessionRunning))
+	
+	assert.False(t, SessionStatus("closed").Valid())
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultWorkspaceID names the workspace that records created without one belong to
+const DefaultWorkspaceID = "default"
+
+// Quotas caps how much a workspace may hold. A limit of 0 means unlimited.
+type Quotas struct {
+	Sessions int `json:"sessions"`
+	Agents   int `json:"agents"`
+	Messages int `json:"messages"`
+}
+
+// Valid reports whether no limit is negative
+func (q Quotas) Valid() bool {
+	return q.Sessions >= 0 && q.Agents >= 0 && q.Messages >= 0
+}
+
+// Workspace is a tenant owning sessions, agent templates and API keys,
+// which are invisible to every other workspace
+type Workspace struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Name      string    `json:"name"`
+	Quotas    Quotas    `json:"quotas"`
+}
+
+// NewWorkspace creates a new Workspace with a generated UUID
+func NewWorkspace(name string, quotas Quotas) *Workspace {
+	return &Workspace{
+		ID:        uuid.New().String(),
+		CreatedAt: timestamp(),
+		Name:      name,
+		Quotas:    quotas,
+	}
+}
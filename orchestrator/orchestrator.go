@@ -0,0 +1,447 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// Run states
+const (
+	StateRunning  = "running"
+	StatePaused   = "paused"
+	StateStopped  = "stopped"
+	StateFinished = "finished"
+	StateFailed   = "failed"
+)
+
+const (
+	defaultMaxTurns = 20
+	defaultInterval = 2 * time.Second
+
+	// maxConsecutiveFailures stops a run whose agents keep failing
+	maxConsecutiveFailures = 3
+)
+
+var (
+	// ErrAlreadyRunning is returned when starting a session that is already running
+	ErrAlreadyRunning = errors.New("orchestrator already running for this session")
+
+	// ErrNotRunning is returned when pausing or stopping a session without an active run
+	ErrNotRunning = errors.New("orchestrator is not running for this session")
+)
+
+// Runner runs a single agent turn
+type Runner interface {
+	RunAgent(ctx context.Context, agentID string) (*services.AgentTurn, error)
+}
+
+// Config controls how a session is orchestrated
+type Config struct {
+	Strategy    string `json:"strategy"`
+	ModeratorID string `json:"moderatorId,omitempty"`
+	MaxTurns    int    `json:"maxTurns"`
+	MaxTokens   int    `json:"maxTokens,omitempty"`
+	IntervalMs  int    `json:"intervalMs"`
+}
+
+// Status reports the progress of an orchestrated session
+type Status struct {
+	SessionID     string    `json:"sessionId"`
+	State         string    `json:"state"`
+	Config        Config    `json:"config"`
+	Turns         int       `json:"turns"`
+	TokensUsed    int       `json:"tokensUsed"`
+	LastSpeakerID string    `json:"lastSpeakerId,omitempty"`
+	StopReason    string    `json:"stopReason,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	StartedAt     time.Time `json:"startedAt"`
+}
+
+// Manager runs one orchestrator goroutine per session
+type Manager struct {
+	mu       sync.Mutex
+	runs     map[string]*run
+	runner   Runner
+	agents   *services.AgentService
+	messages *services.MessageService
+	sessions *services.SessionService
+}
+
+type run struct {
+	mu     sync.Mutex
+	status Status
+	cancel context.CancelFunc
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// NewManager creates a new Manager
+func NewManager(runner Runner, agents *services.AgentService, messages *services.MessageService, sessions *services.SessionService) *Manager {
+	return &Manager{
+		runs:     make(map[string]*run),
+		runner:   runner,
+		agents:   agents,
+		messages: messages,
+		sessions: sessions,
+	}
+}
+
+// Validate fills in defaults and checks the configuration against the
+// agents of the session it is meant for
+func (c *Config) Validate(agents []*models.Agent) error {
+	if c.Strategy == "" {
+		c.Strategy = StrategyRoundRobin
+	}
+	switch c.Strategy {
+	case StrategyRoundRobin, StrategyMention:
+	case StrategyModerator:
+		if c.ModeratorID == "" {
+			return errors.New("moderatorId is required for the moderator strategy")
+		}
+		if find(agents, c.ModeratorID) == nil {
+			return errors.New("moderatorId must name an agent of the session")
+		}
+	default:
+		return fmt.Errorf("unknown strategy %q", c.Strategy)
+	}
+
+	if c.MaxTurns < 0 || c.MaxTokens < 0 || c.IntervalMs < 0 {
+		return errors.New("maxTurns, maxTokens and intervalMs must not be negative")
+	}
+	if c.MaxTurns == 0 {
+		c.MaxTurns = defaultMaxTurns
+	}
+	if c.IntervalMs == 0 {
+		c.IntervalMs = int(defaultInterval / time.Millisecond)
+	}
+	return nil
+}
+
+// Start begins orchestrating a session, or resumes it if it is paused.
+// A paused run keeps its configuration unless a new one is given.
+func (m *Manager) Start(sessionID string, config Config) (*Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.runs[sessionID]
+	if ok {
+		switch r.snapshot().State {
+		case StateRunning:
+			return nil, ErrAlreadyRunning
+		case StatePaused:
+		default:
+			r = nil
+		}
+	}
+	if r != nil && config == (Config{}) {
+		return r.resume(nil), nil
+	}
+
+	session, err := m.sessions.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !session.AcceptsMessages() {
+		return nil, services.ErrSessionNotRunning
+	}
+	agents, err := m.agents.ListSessionAgents(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(agents); err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return r.resume(&config), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r = &run{
+		status: Status{
+			SessionID: sessionID,
+			State:     StateRunning,
+			Config:    config,
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	m.runs[sessionID] = r
+
+	go m.loop(ctx, r)
+
+	return r.snapshot(), nil
+}
+
+// Pause suspends a running session after the current turn
+func (m *Manager) Pause(sessionID string) (*Status, error) {
+	r := m.get(sessionID)
+	if r == nil {
+		return nil, ErrNotRunning
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status.State != StateRunning {
+		return nil, ErrNotRunning
+	}
+	r.status.State = StatePaused
+	return r.copyLocked(), nil
+}
+
+// Stop ends the orchestration of a session, cancelling any turn in progress
+func (m *Manager) Stop(sessionID string) (*Status, error) {
+	r := m.get(sessionID)
+	if r == nil {
+		return nil, ErrNotRunning
+	}
+
+	r.mu.Lock()
+	active := r.status.State == StateRunning || r.status.State == StatePaused
+	r.mu.Unlock()
+	if !active {
+		return nil, ErrNotRunning
+	}
+
+	r.finish(StateStopped, "stopped by request")
+	r.cancel()
+	<-r.done
+
+	return r.snapshot(), nil
+}
+
+// Status returns the status of the most recent run of a session
+func (m *Manager) Status(sessionID string) (*Status, bool) {
+	r := m.get(sessionID)
+	if r == nil {
+		return nil, false
+	}
+	return r.snapshot(), true
+}
+
+// Shutdown stops every active run
+func (m *Manager) Shutdown() {
+	m.mu.Lock()
+	runs := make([]*run, 0, len(m.runs))
+	for _, r := range m.runs {
+		runs = append(runs, r)
+	}
+	m.mu.Unlock()
+
+	for _, r := range runs {
+		r.finish(StateStopped, "server shutting down")
+		r.cancel()
+		<-r.done
+	}
+}
+
+func (m *Manager) get(sessionID string) *run {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runs[sessionID]
+}
+
+// loop lets agents take turns until a stop condition is reached
+func (m *Manager) loop(ctx context.Context, r *run) {
+	defer close(r.done)
+	defer r.cancel()
+
+	sessionID := r.status.SessionID
+	failures := 0
+
+	for {
+		if !r.waitWhilePaused(ctx) {
+			return
+		}
+		// The configuration may change while the run is paused
+		config := r.snapshot().Config
+		interval := time.Duration(config.IntervalMs) * time.Millisecond
+
+		if reason := r.limitReached(); reason != "" {
+			r.finish(StateFinished, reason)
+			return
+		}
+
+		session, err := m.sessions.GetSession(sessionID)
+		if err != nil {
+			r.finish(StateFailed, "session not found")
+			return
+		}
+		if !session.AcceptsMessages() {
+			r.finish(StateFinished, "session is "+string(session.Status))
+			return
+		}
+
+		agents, err := m.agents.ListSessionAgents(sessionID)
+		if err != nil {
+			r.recordError(err)
+			if !sleep(ctx, interval) {
+				return
+			}
+			continue
+		}
+		// Turn-taking only looks at the last message
+		history, err := m.messages.RecentSessionMessages(sessionID, 1)
+		if err != nil {
+			r.recordError(err)
+			if !sleep(ctx, interval) {
+				return
+			}
+			continue
+		}
+
+		next := selectNext(config, agents, history)
+		if next == nil {
+			// Nobody is online; wait for an agent to come back
+			if !sleep(ctx, interval) {
+				return
+			}
+			continue
+		}
+
+		turn, err := m.runner.RunAgent(ctx, next.ID)
+		if ctx.Err() != nil {
+			return
+		}
+		// Rate limits are not failures; wait them out
+		var limited *services.RateLimitError
+		if errors.As(err, &limited) {
+			if !sleep(ctx, limited.RetryAfter) {
+				return
+			}
+			continue
+		}
+		if errors.Is(err, services.ErrMessageLimit) {
+			r.finish(StateFinished, "session holds as many messages as it allows")
+			return
+		}
+		if err != nil {
+			log.Printf("Orchestrator for session %s: agent %s failed: %v", sessionID, next.ID, err)
+			r.recordError(err)
+			failures++
+			if failures >= maxConsecutiveFailures {
+				r.finish(StateFailed, "too many consecutive agent failures")
+				return
+			}
+		} else {
+			failures = 0
+			r.recordTurn(next.ID, turn)
+		}
+
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+// waitWhilePaused blocks while the run is paused; it returns false once the run is cancelled
+func (r *run) waitWhilePaused(ctx context.Context) bool {
+	for {
+		r.mu.Lock()
+		state := r.status.State
+		r.mu.Unlock()
+
+		if state != StatePaused {
+			return ctx.Err() == nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-r.wake:
+		}
+	}
+}
+
+// resume sets a paused run going again, switching to config if it is given
+func (r *run) resume(config *Config) *Status {
+	r.mu.Lock()
+	if config != nil {
+		r.status.Config = *config
+	}
+	r.status.State = StateRunning
+	status := r.copyLocked()
+	r.mu.Unlock()
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return status
+}
+
+// limitReached returns why the run should finish, if it should
+func (r *run) limitReached() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := r.status.Config
+	if r.status.Turns >= config.MaxTurns {
+		return "maximum number of turns reached"
+	}
+	if config.MaxTokens > 0 && r.status.TokensUsed >= config.MaxTokens {
+		return "token budget exhausted"
+	}
+	return ""
+}
+
+func (r *run) recordTurn(agentID string, turn *services.AgentTurn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.status.Turns++
+	r.status.TokensUsed += turn.Usage.InputTokens + turn.Usage.OutputTokens
+	r.status.LastSpeakerID = agentID
+	r.status.LastError = ""
+}
+
+func (r *run) recordError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.LastError = err.Error()
+}
+
+// finish moves an active run to a terminal state
+func (r *run) finish(state, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status.State != StateRunning && r.status.State != StatePaused {
+		return
+	}
+	r.status.State = state
+	r.status.StopReason = reason
+}
+
+func (r *run) snapshot() *Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.copyLocked()
+}
+
+func (r *run) copyLocked() *Status {
+	status := r.status
+	return &status
+}
+
+// sleep waits for d; it returns false if the context is cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,126 @@
+package orchestrator
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// Turn-taking strategies
+const (
+	// StrategyRoundRobin lets online agents speak in order
+	StrategyRoundRobin = "round_robin"
+
+	// StrategyMention lets the agent @mentioned in the last message speak next,
+	// falling back to round-robin when nobody is mentioned
+	StrategyMention = "mention"
+
+	// StrategyModerator alternates between a moderator agent and the agent
+	// the moderator @mentions in its message
+	StrategyModerator = "moderator"
+)
+
+// selectNext picks the agent that speaks next, or nil if no agent can speak
+func selectNext(config Config, agents []*models.Agent, history []*models.Message) *models.Agent {
+	var last *models.Message
+	if len(history) > 0 {
+		last = history[len(history)-1]
+	}
+
+	switch config.Strategy {
+	case StrategyMention:
+		if next := mentioned(agents, last); next != nil {
+			return next
+		}
+		return roundRobin(agents, last, "")
+	case StrategyModerator:
+		moderator := find(agents, config.ModeratorID)
+		if last == nil || last.AgentID != config.ModeratorID {
+			if moderator != nil && moderator.IsOnline {
+				return moderator
+			}
+		}
+		if next := mentioned(agents, last); next != nil && next.ID != config.ModeratorID {
+			return next
+		}
+		return roundRobin(agents, last, config.ModeratorID)
+	default:
+		return roundRobin(agents, last, "")
+	}
+}
+
+// roundRobin returns the first online agent after the author of the last message
+func roundRobin(agents []*models.Agent, last *models.Message, exclude string) *models.Agent {
+	start := 0
+	if last != nil {
+		for i, agent := range agents {
+			if agent.ID == last.AgentID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	for i := 0; i < len(agents); i++ {
+		agent := agents[(start+i)%len(agents)]
+		if agent.IsOnline && agent.ID != exclude {
+			return agent
+		}
+	}
+	return nil
+}
+
+// mentioned returns the first online agent @mentioned in a message, other than its author
+func mentioned(agents []*models.Agent, message *models.Message) *models.Agent {
+	if message == nil {
+		return nil
+	}
+
+	content := strings.ToLower(message.Content)
+	best, bestAt := (*models.Agent)(nil), -1
+	for _, agent := range agents {
+		if !agent.IsOnline || agent.ID == message.AgentID {
+			continue
+		}
+		at := mentionAt(content, "@"+strings.ToLower(agent.Name))
+		if at >= 0 && (bestAt < 0 || at < bestAt) {
+			best, bestAt = agent, at
+		}
+	}
+	return best
+}
+
+// mentionAt returns the offset of the first mention in content that stands
+// on its own, so "@Al" is not found inside "@Alice" or "al@example.com"
+func mentionAt(content, mention string) int {
+	for offset := 0; offset < len(content); {
+		at := strings.Index(content[offset:], mention)
+		if at < 0 {
+			return -1
+		}
+		at += offset
+		end := at + len(mention)
+		before, _ := utf8.DecodeLastRuneInString(content[:at])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if (at == 0 || !isWordRune(before)) && (end == len(content) || !isWordRune(after)) {
+			return at
+		}
+		offset = at + 1
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func find(agents []*models.Agent, id string) *models.Agent {
+	for _, agent := range agents {
+		if agent.ID == id {
+			return agent
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+func testAgents() []*models.Agent {
+	alice := models.NewAgent("Alice", "writer", "prompt", "fake/a", "session")
+	bob := models.NewAgent("Bob", "critic", "prompt", "fake/b", "session")
+	carol := models.NewAgent("Carol", "moderator", "prompt", "fake/c", "session")
+	return []*models.Agent{alice, bob, carol}
+}
+
+func TestRoundRobin(t *testing.T) {
+	agents := testAgents()
+	config := Config{Strategy: StrategyRoundRobin}
+
+	assert.Equal(t, agents[0], selectNext(config, agents, nil), "First agent should start")
+
+	history := []*models.Message{models.NewMessage("hi", agents[0].ID, "session")}
+	assert.Equal(t, agents[1], selectNext(config, agents, history))
+
+	// Offline agents are skipped
+	agents[1].SetOnline(false)
+	assert.Equal(t, agents[2], selectNext(config, agents, history))
+
+	history = append(history, models.NewMessage("hi", agents[2].ID, "session"))
+	assert.Equal(t, agents[0], selectNext(config, agents, history), "Order should wrap around")
+
+	for _, agent := range agents {
+		agent.SetOnline(false)
+	}
+	assert.Nil(t, selectNext(config, agents, history))
+}
+
+func TestMentionRouting(t *testing.T) {
+	agents := testAgents()
+	config := Config{Strategy: StrategyMention}
+
+	history := []*models.Message{models.NewMessage("What do you think, @carol? And @Bob?", agents[0].ID, "session")}
+	assert.Equal(t, agents[2], selectNext(config, agents, history), "First mention should win")
+
+	// A mention must match the whole name
+	al := models.NewAgent("Al", "editor", "prompt", "fake/d", "session")
+	agents = append(agents, al)
+	history = []*models.Message{models.NewMessage("Over to you, @Alice", agents[1].ID, "session")}
+	assert.Equal(t, agents[0], selectNext(config, agents, history), "@Al must not select Alice")
+	history = []*models.Message{models.NewMessage("Mail al@example.com, then @Al.", agents[1].ID, "session")}
+	assert.Equal(t, al, selectNext(config, agents, history))
+	history = []*models.Message{models.NewMessage("@Alfred, @Bobby and @carol_2 are not here", agents[0].ID, "session")}
+	assert.Equal(t, agents[1], selectNext(config, agents, history), "Partial names should fall back to round-robin")
+	agents = agents[:3]
+
+	// Falls back to round-robin without a mention
+	history = []*models.Message{models.NewMessage("No mentions here", agents[0].ID, "session")}
+	assert.Equal(t, agents[1], selectNext(config, agents, history))
+}
+
+func TestModerator(t *testing.T) {
+	agents := testAgents()
+	moderator := agents[2]
+	config := Config{Strategy: StrategyModerator, ModeratorID: moderator.ID}
+
+	assert.Equal(t, moderator, selectNext(config, agents, nil), "Moderator should open")
+
+	history := []*models.Message{models.NewMessage("@Bob, please start", moderator.ID, "session")}
+	assert.Equal(t, agents[1], selectNext(config, agents, history))
+
+	history = append(history, models.NewMessage("Done", agents[1].ID, "session"))
+	assert.Equal(t, moderator, selectNext(config, agents, history), "Moderator should speak after every agent")
+
+	// Without a mention the moderator hands over in round-robin order, skipping itself
+	history = append(history, models.NewMessage("Next please", moderator.ID, "session"))
+	assert.Equal(t, agents[0], selectNext(config, agents, history))
+}
+
+func TestConfigValidate(t *testing.T) {
+	agents := testAgents()
+
+	config := Config{}
+	assert.NoError(t, config.Validate(agents))
+	assert.Equal(t, StrategyRoundRobin, config.Strategy)
+	assert.Equal(t, defaultMaxTurns, config.MaxTurns)
+
+	config = Config{Strategy: StrategyModerator}
+	assert.Error(t, config.Validate(agents), "Moderator strategy requires a moderator")
+
+	config = Config{Strategy: StrategyModerator, ModeratorID: agents[2].ID}
+	assert.NoError(t, config.Validate(agents))
+	outsider := models.NewAgent("Dave", "moderator", "prompt", "fake/d", "other")
+	config = Config{Strategy: StrategyModerator, ModeratorID: outsider.ID}
+	assert.Error(t, config.Validate(agents), "The moderator must belong to the session")
+
+	config = Config{Strategy: "chaos"}
+	assert.Error(t, config.Validate(agents))
+}
@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"strings"
+)
+
+// anthropicVersion is the Messages API version sent with every request
+const anthropicVersion = "2023-06-01"
+
+// Anthropic talks to an Anthropic-style Messages API
+type Anthropic struct {
+	BaseURL string
+	APIKey  string
+}
+
+// NewAnthropic creates an Anthropic provider; an empty baseURL uses the public API
+func NewAnthropic(baseURL, apiKey string) *Anthropic {
+	if baseURL == "" {
+		baseURL = "https://api.anthropic.com"
+	}
+	return &Anthropic{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+	}
+}
+
+// Name returns the provider name used in model prefixes
+func (p *Anthropic) Name() string {
+	return "anthropic"
+}
+
+// Chat requests the next message
+func (p *Anthropic) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultMaxTokens
+	}
+
+	body := struct {
+		Model       string        `json:"model"`
+		System      string        `json:"system,omitempty"`
+		Messages    []ChatMessage `json:"messages"`
+		MaxTokens   int           `json:"max_tokens"`
+		Temperature *float64      `json:"temperature,omitempty"`
+	}{
+		Model:       req.Model,
+		System:      req.System,
+		Messages:    alternateRoles(req.Messages),
+		MaxTokens:   maxTokens,
+		Temperature: req.Temperature,
+	}
+
+	var out struct {
+		Model   string `json:"model"`
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+
+	headers := map[string]string{
+		"x-api-key":         p.APIKey,
+		"anthropic-version": anthropicVersion,
+	}
+	if err := postJSON(ctx, p.Name(), p.BaseURL+"/v1/messages", headers, body, &out); err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+	for _, block := range out.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	return &ChatResponse{
+		Content: text.String(),
+		Model:   out.Model,
+		Usage: Usage{
+			InputTokens:  out.Usage.InputTokens,
+			OutputTokens: out.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// alternateRoles merges consecutive messages with the same role, since
+// the Messages API requires user and assistant turns to alternate, starting
+// with a user turn. A transcript opening with the assistant, because the
+// agent spoke first or earlier turns were cut, gets a placeholder user turn.
+func alternateRoles(messages []ChatMessage) []ChatMessage {
+	merged := make([]ChatMessage, 0, len(messages)+1)
+	if len(messages) > 0 && messages[0].Role != RoleUser {
+		merged = append(merged, ChatMessage{Role: RoleUser, Content: "(The conversation begins.)"})
+	}
+	for _, message := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == message.Role {
+			merged[n-1].Content += "\n\n" + message.Content
+			continue
+		}
+		merged = append(merged, message)
+	}
+	return merged
+}
@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Fake is a deterministic provider for tests and local development.
+// It replies with its scripted replies in order, cycling when they run out,
+// or echoes the last message of the transcript when it has none.
+type Fake struct {
+	mu       sync.Mutex
+	replies  []string
+	calls    int
+	requests []ChatRequest
+}
+
+// NewFake creates a Fake provider with optional scripted replies
+func NewFake(replies ...string) *Fake {
+	return &Fake{replies: replies}
+}
+
+// Name returns the provider name used in model prefixes
+func (p *Fake) Name() string {
+	return "fake"
+}
+
+// Chat returns the next scripted reply
+func (p *Fake) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, req)
+
+	var content string
+	if len(p.replies) > 0 {
+		content = p.replies[p.calls%len(p.replies)]
+	} else {
+		last := ""
+		if n := len(req.Messages); n > 0 {
+			last = req.Messages[n-1].Content
+		}
+		content = fmt.Sprintf("[%s] %s", req.Model, last)
+	}
+	p.calls++
+
+	input := len(strings.Fields(req.System))
+	for _, message := range req.Messages {
+		input += len(strings.Fields(message.Content))
+	}
+
+	return &ChatResponse{
+		Content: content,
+		Model:   req.Model,
+		Usage: Usage{
+			InputTokens:  input,
+			OutputTokens: len(strings.Fields(content)),
+		},
+	}, nil
+}
+
+// Requests returns the requests received so far
+func (p *Fake) Requests() []ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ChatRequest(nil), p.requests...)
+}
@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"context"
+	"strings"
+)
+
+// Ollama talks to an Ollama-style local model server
+type Ollama struct {
+	Host string
+}
+
+// NewOllama creates an Ollama provider; an empty host uses the default local server
+func NewOllama(host string) *Ollama {
+	if host == "" {
+		host = "http://localhost:11434"
+	}
+	return &Ollama{
+		Host: strings.TrimSuffix(host, "/"),
+	}
+}
+
+// Name returns the provider name used in model prefixes
+func (p *Ollama) Name() string {
+	return "ollama"
+}
+
+// Chat requests the next message without streaming
+func (p *Ollama) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	messages := make([]ChatMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: req.System})
+	}
+	messages = append(messages, req.Messages...)
+
+	options := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+
+	body := struct {
+		Model    string                 `json:"model"`
+		Messages []ChatMessage          `json:"messages"`
+		Stream   bool                   `json:"stream"`
+		Options  map[string]interface{} `json:"options,omitempty"`
+	}{
+		Model:    req.Model,
+		Messages: messages,
+		Options:  options,
+	}
+
+	var out struct {
+		Model           string      `json:"model"`
+		Message         ChatMessage `json:"message"`
+		PromptEvalCount int         `json:"prompt_eval_count"`
+		EvalCount       int         `json:"eval_count"`
+	}
+
+	if err := postJSON(ctx, p.Name(), p.Host+"/api/chat", nil, body, &out); err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		Content: out.Message.Content,
+		Model:   out.Model,
+		Usage: Usage{
+			InputTokens:  out.PromptEvalCount,
+			OutputTokens: out.EvalCount,
+		},
+	}, nil
+}
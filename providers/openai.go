@@ -0,0 +1,78 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// OpenAI talks to any OpenAI-compatible chat completions API
+type OpenAI struct {
+	BaseURL string
+	APIKey  string
+}
+
+// NewOpenAI creates an OpenAI provider; an empty baseURL uses the public API
+func NewOpenAI(baseURL, apiKey string) *OpenAI {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	return &OpenAI{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+	}
+}
+
+// Name returns the provider name used in model prefixes
+func (p *OpenAI) Name() string {
+	return "openai"
+}
+
+// Chat requests a chat completion
+func (p *OpenAI) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	messages := make([]ChatMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: req.System})
+	}
+	messages = append(messages, req.Messages...)
+
+	body := struct {
+		Model       string        `json:"model"`
+		Messages    []ChatMessage `json:"messages"`
+		MaxTokens   int           `json:"max_tokens,omitempty"`
+		Temperature *float64      `json:"temperature,omitempty"`
+	}{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+
+	var out struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message ChatMessage `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+
+	headers := map[string]string{"Authorization": "Bearer " + p.APIKey}
+	if err := postJSON(ctx, p.Name(), p.BaseURL+"/chat/completions", headers, body, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, errors.New("openai: response contained no choices")
+	}
+
+	return &ChatResponse{
+		Content: out.Choices[0].Message.Content,
+		Model:   out.Model,
+		Usage: Usage{
+			InputTokens:  out.Usage.PromptTokens,
+			OutputTokens: out.Usage.CompletionTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,186 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles used in a chat transcript
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// defaultMaxTokens is used when a request does not set MaxTokens
+const defaultMaxTokens = 1024
+
+var (
+	// ErrUnknownModel is returned when no provider is registered for a model
+	ErrUnknownModel = errors.New("no provider registered for model")
+
+	// ErrUnavailable is returned when a provider cannot be reached
+	ErrUnavailable = errors.New("provider unavailable")
+)
+
+// ChatMessage is a single turn of a chat transcript
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest is a provider-neutral chat completion request
+type ChatRequest struct {
+	Model       string
+	System      string
+	Messages    []ChatMessage
+	MaxTokens   int
+	Temperature *float64
+}
+
+// Usage reports the tokens consumed by a completion
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+}
+
+// ChatResponse is a provider-neutral chat completion response
+type ChatResponse struct {
+	Content string `json:"content"`
+	Model   string `json:"model"`
+	Usage   Usage  `json:"usage"`
+}
+
+// ChatProvider generates the next assistant message for a transcript
+type ChatProvider interface {
+	Name() string
+	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+}
+
+// APIError is returned when a provider responds with a non-2xx status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: unexpected status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Registry selects a provider for a model name. A model may name its
+// provider explicitly ("ollama/llama3") or be matched by prefix ("gpt-4o").
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]ChatProvider
+	prefixes  map[string]string
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: make(map[string]ChatProvider),
+		prefixes:  make(map[string]string),
+	}
+}
+
+// NewRegistryFromEnv creates a Registry with the providers configured in the environment:
+// OPENAI_API_KEY/OPENAI_BASE_URL, ANTHROPIC_API_KEY/ANTHROPIC_BASE_URL and OLLAMA_HOST.
+// The fake provider is always available under the "fake/" prefix.
+func NewRegistryFromEnv() *Registry {
+	r := NewRegistry()
+
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		r.Register(NewOpenAI(os.Getenv("OPENAI_BASE_URL"), key), "gpt-", "o1", "o3", "o4")
+	}
+	if key := os.Getenv("ANTHROPIC_API_KEY"); key != "" {
+		r.Register(NewAnthropic(os.Getenv("ANTHROPIC_BASE_URL"), key), "claude")
+	}
+	r.Register(NewOllama(os.Getenv("OLLAMA_HOST")))
+	r.Register(NewFake())
+
+	return r
+}
+
+// Register adds a provider, optionally routing bare model names with the given prefixes to it
+func (r *Registry) Register(provider ChatProvider, modelPrefixes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[provider.Name()] = provider
+	for _, prefix := range modelPrefixes {
+		r.prefixes[prefix] = provider.Name()
+	}
+}
+
+// Resolve returns the provider for a model and the model name to send to it
+func (r *Registry) Resolve(model string) (ChatProvider, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name, rest, ok := strings.Cut(model, "/"); ok {
+		if provider, ok := r.providers[name]; ok {
+			return provider, rest, nil
+		}
+	}
+
+	// Prefer the longest matching prefix
+	var match string
+	for prefix := range r.prefixes {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match != "" {
+		return r.providers[r.prefixes[match]], model, nil
+	}
+
+	return nil, "", fmt.Errorf("%w: %s", ErrUnknownModel, model)
+}
+
+// httpClient is shared by the HTTP adapters
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+// postJSON sends a JSON request and decodes a JSON response
+func postJSON(ctx context.Context, provider, url string, headers map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", provider, ctx.Err())
+		}
+		return fmt.Errorf("%s: %w: %v", provider, ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{Provider: provider, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", provider, err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureServer responds with body and records the decoded request
+func captureServer(t *testing.T, path, body string, got *map[string]interface{}, header *http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, path, r.URL.Path)
+		*header = r.Header.Clone()
+		require.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+}
+
+func testRequest() ChatRequest {
+	return ChatRequest{
+		Model:  "test-model",
+		System: "Be brief",
+		Messages: []ChatMessage{
+			{Role: RoleUser, Content: "Alice: hi"},
+			{Role: RoleUser, Content: "Bob: hello"},
+		},
+	}
+}
+
+func TestOpenAI(t *testing.T) {
+	var got map[string]interface{}
+	var header http.Header
+	server := captureServer(t, "/v1/chat/completions",
+		`{"model":"test-model","choices":[{"message":{"role":"assistant","content":"Hi there"}}],"usage":{"prompt_tokens":12,"completion_tokens":3}}`,
+		&got, &header)
+	defer server.Close()
+
+	resp, err := NewOpenAI(server.URL+"/v1", "secret").Chat(context.Background(), testRequest())
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hi there", resp.Content)
+	assert.Equal(t, Usage{InputTokens: 12, OutputTokens: 3}, resp.Usage)
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+	assert.Len(t, got["messages"], 3, "System prompt should be sent as the first message")
+}
+
+func TestAnthropic(t *testing.T) {
+	var got map[string]interface{}
+	var header http.Header
+	server := captureServer(t, "/v1/messages",
+		`{"model":"test-model","content":[{"type":"text","text":"Hi "},{"type":"text","text":"there"}],"usage":{"input_tokens":10,"output_tokens":2}}`,
+		&got, &header)
+	defer server.Close()
+
+	resp, err := NewAnthropic(server.URL, "secret").Chat(context.Background(), testRequest())
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hi there", resp.Content)
+	assert.Equal(t, Usage{InputTokens: 10, OutputTokens: 2}, resp.Usage)
+	assert.Equal(t, "secret", header.Get("x-api-key"))
+	assert.Equal(t, "Be brief", got["system"])
+	assert.Equal(t, float64(defaultMaxTokens), got["max_tokens"])
+	assert.Len(t, got["messages"], 1, "Consecutive user turns should be merged")
+}
+
+func TestAlternateRoles(t *testing.T) {
+	merged := alternateRoles([]ChatMessage{
+		{Role: RoleAssistant, Content: "I'll start"},
+		{Role: RoleAssistant, Content: "and go on"},
+		{Role: RoleUser, Content: "Bob: ok"},
+	})
+	require.Len(t, merged, 3)
+	assert.Equal(t, RoleUser, merged[0].Role, "The Messages API needs a user turn first")
+	assert.Equal(t, ChatMessage{Role: RoleAssistant, Content: "I'll start\n\nand go on"}, merged[1])
+	assert.Equal(t, ChatMessage{Role: RoleUser, Content: "Bob: ok"}, merged[2])
+
+	assert.Empty(t, alternateRoles(nil))
+}
+
+func TestOllama(t *testing.T) {
+	var got map[string]interface{}
+	var header http.Header
+	server := captureServer(t, "/api/chat",
+		`{"model":"test-model","message":{"role":"assistant","content":"Hi there"},"prompt_eval_count":8,"eval_count":2}`,
+		&got, &header)
+	defer server.Close()
+
+	resp, err := NewOllama(server.URL).Chat(context.Background(), testRequest())
+	require.NoError(t, err)
+
+	assert.Equal(t, "Hi there", resp.Content)
+	assert.Equal(t, Usage{InputTokens: 8, OutputTokens: 2}, resp.Usage)
+	assert.Equal(t, false, got["stream"])
+}
+
+func TestAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAI(server.URL, "secret").Chat(context.Background(), testRequest())
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "rate limited", apiErr.Body)
+}
+
+func TestFake(t *testing.T) {
+	fake := NewFake("first", "second")
+
+	for _, want := range []string{"first", "second", "first"} {
+		resp, err := fake.Chat(context.Background(), testRequest())
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.Content)
+	}
+	assert.Len(t, fake.Requests(), 3)
+
+	resp, err := NewFake().Chat(context.Background(), testRequest())
+	require.NoError(t, err)
+	assert.Equal(t, "[test-model] Bob: hello", resp.Content)
+}
+
+func TestRegistryResolve(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(NewOpenAI("", "key"), "gpt-", "o1")
+	registry.Register(NewOllama(""))
+	registry.Register(NewFake())
+
+	provider, model, err := registry.Resolve("gpt-4o")
+	require.NoError(t, err)
+	assert.Equal(t, "openai", provider.Name())
+	assert.Equal(t, "gpt-4o", model)
+
+	provider, model, err = registry.Resolve("ollama/llama3:8b")
+	require.NoError(t, err)
+	assert.Equal(t, "ollama", provider.Name())
+	assert.Equal(t, "llama3:8b", model)
+
+	_, _, err = registry.Resolve("claude-3-5-sonnet")
+	assert.True(t, errors.Is(err, ErrUnknownModel))
+}
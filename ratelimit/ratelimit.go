@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Count events per Per, in bursts of up to Count. The zero
+// Limit allows everything.
+type Limit struct {
+	Count int
+	Per   time.Duration
+}
+
+// ParseLimit reads a limit such as "30/m": a count, then the second, minute
+// or hour it is allowed per. An empty string is no limit.
+func ParseLimit(raw string) (Limit, error) {
+	if raw == "" {
+		return Limit{}, nil
+	}
+	count, unit, ok := strings.Cut(raw, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must look like 30/m", raw)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive count", raw)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	per, ok := periods[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must be per s, m or h", raw)
+	}
+	return Limit{Count: n, Per: per}, nil
+}
+
+// Unlimited reports whether the limit allows everything
+func (l Limit) Unlimited() bool {
+	return l.Count == 0
+}
+
+// Config sets the limits on requests and messages
+type Config struct {
+	// Key limits the requests of each API key
+	Key Limit
+
+	// Agent limits the messages each agent posts
+	Agent Limit
+
+	// Session limits the messages posted in each session
+	Session Limit
+
+	// SessionMessages caps how many messages new sessions may hold. Zero
+	// means no cap.
+	SessionMessages int
+}
+
+// ConfigFromEnv reads RATE_LIMIT_KEY, RATE_LIMIT_AGENT and RATE_LIMIT_SESSION,
+// each a limit such as "120/m", and SESSION_MAX_MESSAGES. Unset limits allow
+// everything.
+func ConfigFromEnv() (Config, error) {
+	var config Config
+	settings := []struct {
+		name  string
+		value *Limit
+	}{
+		{"RATE_LIMIT_KEY", &config.Key},
+		{"RATE_LIMIT_AGENT", &config.Agent},
+		{"RATE_LIMIT_SESSION", &config.Session},
+	}
+	for _, setting := range settings {
+		limit, err := ParseLimit(os.Getenv(setting.name))
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", setting.name, err)
+		}
+		*setting.value = limit
+	}
+	if raw := os.Getenv("SESSION_MAX_MESSAGES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return Config{}, errors.New("SESSION_MAX_MESSAGES must be a non-negative integer")
+		}
+		config.SessionMessages = n
+	}
+	return config, nil
+}
+
+// bucket holds the tokens left for one key as of when it was last filled
+type bucket struct {
+	tokens float64
+	filled time.Time
+}
+
+// Limiter hands out tokens from a bucket per key. Each bucket holds up to
+// the limit's count and refills at its rate. Buckets live in memory, so
+// every server enforces the limit on its own.
+type Limiter struct {
+	limit   Limit
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewLimiter creates a new Limiter enforcing limit
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// SetClock replaces the clock the limiter refills by, for tests
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+// Allow takes a token for key, reporting false and how long until the next
+// one when there is none left. A nil Limiter allows everything.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.limit.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Count), filled: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.fill(b, now)
+	b.filled = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration(math.Ceil((1 - b.tokens) / l.rate()))
+	return false, wait
+}
+
+// rate returns how many tokens a bucket gains per nanosecond
+func (l *Limiter) rate() float64 {
+	return float64(l.limit.Count) / float64(l.limit.Per)
+}
+
+// fill returns the tokens a bucket holds at now
+func (l *Limiter) fill(b *bucket, now time.Time) float64 {
+	return math.Min(float64(l.limit.Count), b.tokens+float64(now.Sub(b.filled))*l.rate())
+}
+
+// sweep forgets buckets that have filled up again, at most once per period,
+// so keys that stop sending do not pile up
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.limit.Per {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if l.fill(b, now) >= float64(l.limit.Count) {
+			delete(l.buckets, key)
+		}
+	}
+}
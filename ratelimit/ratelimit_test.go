@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(Limit{Count: 2, Per: time.Minute})
+	limiter.SetClock(func() time.Time { return now })
+
+	// A full bucket allows a burst, then makes callers wait for a refill
+	ok, _ := limiter.Allow("a")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+	ok, wait := limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, wait)
+
+	// Keys have buckets of their own
+	ok, _ = limiter.Allow("b")
+	assert.True(t, ok)
+
+	now = now.Add(15 * time.Second)
+	ok, wait = limiter.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 15*time.Second, wait)
+	now = now.Add(15 * time.Second)
+	ok, _ = limiter.Allow("a")
+	assert.True(t, ok)
+
+	// Buckets that filled up again are forgotten
+	now = now.Add(2 * time.Minute)
+	ok, _ = limiter.Allow("c")
+	assert.True(t, ok)
+	assert.Len(t, limiter.buckets, 1)
+
+	var unlimited *Limiter
+	ok, _ = unlimited.Allow("a")
+	assert.True(t, ok)
+	ok, _ = NewLimiter(Limit{}).Allow("a")
+	assert.True(t, ok)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	config, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Config{}, config)
+
+	t.Setenv("RATE_LIMIT_KEY", "120/m")
+	t.Setenv("RATE_LIMIT_AGENT", "5/s")
+	t.Setenv("SESSION_MAX_MESSAGES", "1000")
+	config, err = ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Limit{Count: 120, Per: time.Minute}, config.Key)
+	assert.Equal(t, Limit{Count: 5, Per: time.Second}, config.Agent)
+	assert.True(t, config.Session.Unlimited())
+	assert.Equal(t, 1000, config.SessionMessages)
+
+	for _, raw := range []string{"120", "0/m", "x/m", "5/d"} {
+		t.Setenv("RATE_LIMIT_SESSION", raw)
+		_, err = ConfigFromEnv()
+		assert.Error(t, err, raw)
+	}
+	t.Setenv("RATE_LIMIT_SESSION", "")
+	t.Setenv("SESSION_MAX_MESSAGES", "-1")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/chatcollab/chatcollab/events"
+)
+
+const (
+	// writeWait is the time allowed to write a frame to the peer
+	writeWait = 10 * time.Second
+
+	// pongWait is the time allowed to read the next pong from the peer
+	pongWait = 60 * time.Second
+
+	// pingPeriod must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+
+	// maxFrameSize is the largest frame accepted from the peer
+	maxFrameSize = 64 * 1024
+
+	// sendBuffer is the number of outgoing frames queued before the client is considered slow
+	sendBuffer = 64
+)
+
+// Frame types sent by clients
+const (
+	FrameMessage   = "message"
+	FrameHeartbeat = "heartbeat"
+)
+
+// errorEvent is the event type used to report a rejected frame back to its sender
+const errorEvent = "error"
+
+var (
+	errAnonymous    = errors.New("connect with an agentId to send messages")
+	errEmptyMessage = errors.New("content is required")
+	errUnknownFrame = errors.New("unknown frame type")
+)
+
+// Frame is a request sent by a client over the socket
+type Frame struct {
+	Type    string `json:"type"`
+	Content string `json:"content,omitempty"`
+	ReplyTo string `json:"replyTo,omitempty"`
+}
+
+// Client is a single websocket connection participating in a session
+type Client struct {
+	manager   *Manager
+	hub       *Hub
+	conn      *websocket.Conn
+	sessionID string
+	agentID   string
+	send      chan []byte
+	closeOnce sync.Once
+
+	// dropped is set by the hub, under its lock, once the client fell behind
+	dropped bool
+}
+
+func newClient(manager *Manager, conn *websocket.Conn, sessionID, agentID string) *Client {
+	return &Client{
+		manager:   manager,
+		conn:      conn,
+		sessionID: sessionID,
+		agentID:   agentID,
+		send:      make(chan []byte, sendBuffer),
+	}
+}
+
+// close stops the write pump, which hangs up the connection
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.send)
+	})
+}
+
+// readPump handles frames sent by the peer until the connection fails
+func (c *Client) readPump() {
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(maxFrameSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var frame Frame
+		if err := c.conn.ReadJSON(&frame); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Websocket read error in session %s: %v", c.sessionID, err)
+			}
+			return
+		}
+
+		if err := c.handle(frame); err != nil {
+			c.reject(err)
+		}
+	}
+}
+
+// handle performs the action requested by a frame. Results are not echoed
+// back directly; they reach every client through the session's event stream.
+func (c *Client) handle(frame Frame) error {
+	switch frame.Type {
+	case FrameMessage:
+		if c.agentID == "" {
+			return errAnonymous
+		}
+		if frame.Content == "" {
+			return errEmptyMessage
+		}
+		_, err := c.manager.messages.CreateReply(frame.Content, c.agentID, c.sessionID, frame.ReplyTo)
+		return err
+	case FrameHeartbeat:
+		return c.manager.sessions.UpdateHeartbeat(c.sessionID)
+	default:
+		return errUnknownFrame
+	}
+}
+
+// reject reports an error to this client only
+func (c *Client) reject(err error) {
+	payload, _ := json.Marshal(events.Event{
+		Type:      errorEvent,
+		SessionID: c.sessionID,
+		CreatedAt: time.Now(),
+		Data:      map[string]string{"error": err.Error()},
+	})
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	if c.dropped {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+	}
+}
+
+// writePump writes queued frames and keep-alive pings to the peer
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				if c.dropped {
+					closeMessage = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "send buffer full")
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+// Manager keeps one Hub per session with connected clients
+type Manager struct {
+	mu       sync.Mutex
+	hubs     map[string]*Hub
+	broker   *events.Broker
+	messages *services.MessageService
+	agents   *services.AgentService
+	sessions *services.SessionService
+}
+
+// Hub fans out the events of a single session to its connected clients
+type Hub struct {
+	sessionID string
+	sub       *events.Subscription
+	stop      chan struct{}
+
+	mu      sync.Mutex
+	clients map[*Client]struct{}
+	agents  map[string]int
+}
+
+// NewManager creates a new Manager
+func NewManager(broker *events.Broker, messages *services.MessageService, agents *services.AgentService, sessions *services.SessionService) *Manager {
+	return &Manager{
+		hubs:     make(map[string]*Hub),
+		broker:   broker,
+		messages: messages,
+		agents:   agents,
+		sessions: sessions,
+	}
+}
+
+// Serve attaches a websocket connection to the hub of a session and blocks
+// until the client disconnects. When agentID is set the agent is marked
+// online while at least one of its connections is open.
+func (m *Manager) Serve(conn *websocket.Conn, sessionID, agentID string) {
+	client := newClient(m, conn, sessionID, agentID)
+
+	if m.join(client) && agentID != "" {
+		if err := m.agents.SetAgentOnlineStatus(agentID, true); err != nil {
+			log.Printf("Failed to mark agent %s online: %v", agentID, err)
+		}
+	}
+
+	go client.writePump()
+	client.readPump()
+
+	if m.leave(client) && agentID != "" {
+		if err := m.agents.SetAgentOnlineStatus(agentID, false); err != nil {
+			log.Printf("Failed to mark agent %s offline: %v", agentID, err)
+		}
+	}
+}
+
+// join registers a client, starting the session hub if needed. It reports
+// whether this is the first open connection of the client's agent.
+func (m *Manager) join(client *Client) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hub, ok := m.hubs[client.sessionID]
+	if !ok {
+		sub, _ := m.broker.Subscribe(client.sessionID, 0)
+		hub = &Hub{
+			sessionID: client.sessionID,
+			sub:       sub,
+			stop:      make(chan struct{}),
+			clients:   make(map[*Client]struct{}),
+			agents:    make(map[string]int),
+		}
+		m.hubs[client.sessionID] = hub
+		go hub.run(m.broker)
+	}
+	client.hub = hub
+
+	return hub.add(client)
+}
+
+// leave unregisters a client, stopping the session hub once it is empty.
+// It reports whether this was the last open connection of the client's agent.
+func (m *Manager) leave(client *Client) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hub := client.hub
+	last := hub.remove(client)
+
+	if hub.empty() && m.hubs[hub.sessionID] == hub {
+		delete(m.hubs, hub.sessionID)
+		close(hub.stop)
+	}
+
+	return last
+}
+
+// run delivers session events to the clients until the hub is stopped
+func (h *Hub) run(broker *events.Broker) {
+	defer func() { h.sub.Close() }()
+
+	var lastID uint64
+	for {
+		select {
+		case event, ok := <-h.sub.Events():
+			if !ok {
+				// The broker dropped us for falling behind; resume where we left off
+				var missed []events.Event
+				h.sub, missed = broker.Subscribe(h.sessionID, lastID)
+				for _, event := range missed {
+					lastID = event.ID
+					h.broadcast(event)
+				}
+				continue
+			}
+			lastID = event.ID
+			h.broadcast(event)
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// broadcast sends an event to every client, disconnecting clients whose
+// send buffer is full instead of blocking the whole session
+func (h *Hub) broadcast(event events.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode event %d: %v", event.ID, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if client.dropped {
+			continue
+		}
+		select {
+		case client.send <- payload:
+		default:
+			// Closing the send channel makes the write pump hang up; the client
+			// is unregistered once its read pump notices the closed connection
+			log.Printf("Disconnecting slow client in session %s", h.sessionID)
+			client.dropped = true
+			client.close()
+		}
+	}
+}
+
+// add registers a client and reports whether it is the first connection of its agent
+func (h *Hub) add(client *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.clients[client] = struct{}{}
+	if client.agentID == "" {
+		return false
+	}
+	h.agents[client.agentID]++
+	return h.agents[client.agentID] == 1
+}
+
+// remove unregisters a client and reports whether it was the last connection of its agent
+func (h *Hub) remove(client *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; !ok {
+		return false
+	}
+	delete(h.clients, client)
+	client.close()
+
+	if client.agentID == "" {
+		return false
+	}
+	h.agents[client.agentID]--
+	if h.agents[client.agentID] > 0 {
+		return false
+	}
+	delete(h.agents, client.agentID)
+	return true
+}
+
+func (h *Hub) empty() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients) == 0
+}
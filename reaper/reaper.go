@@ -0,0 +1,216 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+const defaultInterval = time.Minute
+
+// Config controls when sessions count as stale and how often the reaper looks
+type Config struct {
+	// Timeout is how long a session may go without a heartbeat before its
+	// agents are marked offline and a running session goes idle
+	Timeout time.Duration
+
+	// Interval is the time between sweeps
+	Interval time.Duration
+
+	// Retention is how long a session may go without a heartbeat before it
+	// is deleted. Zero keeps sessions forever.
+	Retention time.Duration
+}
+
+// ConfigFromEnv reads SESSION_TIMEOUT, REAPER_INTERVAL and SESSION_RETENTION,
+// each a duration such as "10m" or "720h"
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Timeout:  services.DefaultSessionTimeout,
+		Interval: defaultInterval,
+	}
+	settings := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"SESSION_TIMEOUT", &config.Timeout},
+		{"REAPER_INTERVAL", &config.Interval},
+		{"SESSION_RETENTION", &config.Retention},
+	}
+	for _, setting := range settings {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%s: %w", setting.name, err)
+		}
+		*setting.value = parsed
+	}
+	return config, config.Validate()
+}
+
+// Validate checks the configuration
+func (c Config) Validate() error {
+	if c.Timeout <= 0 || c.Interval <= 0 {
+		return errors.New("session timeout and reaper interval must be positive")
+	}
+	if c.Retention != 0 && c.Retention < c.Timeout {
+		return errors.New("session retention must not be shorter than the session timeout")
+	}
+	return nil
+}
+
+// Report lists what one sweep did
+type Report struct {
+	Expired       []string `json:"expired"`
+	AgentsOffline []string `json:"agentsOffline"`
+	Purged        []string `json:"purged"`
+}
+
+// Reaper periodically expires sessions that stopped sending heartbeats and
+// deletes those past the retention window. Every change goes through the
+// services, so each one is published as an event.
+type Reaper struct {
+	config   Config
+	sessions *services.SessionService
+	agents   *services.AgentService
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReaper creates a new Reaper
+func NewReaper(config Config, sessions *services.SessionService, agents *services.AgentService) *Reaper {
+	return &Reaper{
+		config:   config,
+		sessions: sessions,
+		agents:   agents,
+	}
+}
+
+// Start sweeps in the background every interval until Shutdown is called
+func (r *Reaper) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	go r.loop(ctx, r.done)
+}
+
+// Shutdown stops the background sweeps and waits for the current one to finish
+func (r *Reaper) Shutdown() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel = nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (r *Reaper) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.Sweep()
+		if err != nil {
+			log.Printf("Reaper: %v", err)
+		}
+		if len(report.Expired)+len(report.AgentsOffline)+len(report.Purged) > 0 {
+			log.Printf("Reaper: %d sessions went idle, %d agents went offline, %d sessions purged",
+				len(report.Expired), len(report.AgentsOffline), len(report.Purged))
+		}
+	}
+}
+
+// Sweep expires stale sessions and purges old ones once. A failure on one
+// session does not stop the others from being handled; the first error is returned.
+func (r *Reaper) Sweep() (*Report, error) {
+	report := &Report{}
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	stale, err := r.sessions.ListInactiveSessions(r.config.Timeout)
+	if err != nil {
+		return report, err
+	}
+	for _, session := range stale {
+		record(r.expire(session, report))
+	}
+
+	if r.config.Retention > 0 {
+		expired, err := r.sessions.ListInactiveSessions(r.config.Retention)
+		if err != nil {
+			record(err)
+			return report, firstErr
+		}
+		for _, session := range expired {
+			purged, err := r.sessions.PurgeSession(session.ID, r.config.Retention)
+			if err != nil {
+				record(err)
+				continue
+			}
+			if purged {
+				report.Purged = append(report.Purged, session.ID)
+			}
+		}
+	}
+	return report, firstErr
+}
+
+// expire marks a stale session's agents offline and idles it if it was running
+func (r *Reaper) expire(session *models.Session, report *Report) error {
+	agents, err := r.agents.ListSessionAgents(session.ID)
+	if err != nil {
+		return err
+	}
+	for _, agent := range agents {
+		if !agent.IsOnline {
+			continue
+		}
+		if err := r.agents.SetAgentOnlineStatus(agent.ID, false); err != nil {
+			return err
+		}
+		report.AgentsOffline = append(report.AgentsOffline, agent.ID)
+	}
+
+	expired, err := r.sessions.ExpireSession(session.ID, r.config.Timeout)
+	if err != nil {
+		return err
+	}
+	if expired {
+		report.Expired = append(report.Expired, session.ID)
+	}
+	return nil
+}
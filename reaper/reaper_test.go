@@ -0,0 +1,109 @@
+package reaper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+func TestSweep(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := services.NewSessionService(store.Sessions, store)
+	agents := services.NewAgentService(store.Agents, store)
+
+	// One session each: fresh, stale, and past retention
+	create := func(age time.Duration) *models.Session {
+		session := models.NewSession()
+		session.LastHeartbeat = time.Now().Add(-age)
+		require.NoError(t, store.Sessions.Create(session))
+		return session
+	}
+	fresh := create(0)
+	stale := create(10 * time.Minute)
+	ancient := create(48 * time.Hour)
+
+	freshAgent, err := agents.CreateAgent("Fresh", "assistant", "prompt", "fake/a", fresh.ID)
+	require.NoError(t, err)
+	staleAgent, err := agents.CreateAgent("Stale", "assistant", "prompt", "fake/a", stale.ID)
+	require.NoError(t, err)
+
+	sub, _ := events.Default.Subscribe(stale.ID, 0)
+	defer sub.Close()
+
+	reaper := NewReaper(Config{Timeout: 5 * time.Minute, Interval: time.Minute, Retention: 24 * time.Hour}, sessions, agents)
+	report, err := reaper.Sweep()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{stale.ID, ancient.ID}, report.Expired)
+	assert.Equal(t, []string{staleAgent.ID}, report.AgentsOffline)
+	assert.Equal(t, []string{ancient.ID}, report.Purged)
+
+	// Both changes to the stale session were announced
+	assert.Equal(t, events.AgentPresence, (<-sub.Events()).Type)
+	assert.Equal(t, events.SessionUpdated, (<-sub.Events()).Type)
+
+	session, err := sessions.GetSession(stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.SessionIdle, session.Status)
+	agent, err := agents.GetAgent(staleAgent.ID)
+	require.NoError(t, err)
+	assert.False(t, agent.IsOnline)
+	agent, err = agents.GetAgent(freshAgent.ID)
+	require.NoError(t, err)
+	assert.True(t, agent.IsOnline)
+	_, err = sessions.GetSession(ancient.ID)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	// A heartbeat wakes the idle session; sweeping again changes nothing
+	require.NoError(t, sessions.UpdateHeartbeat(stale.ID))
+	session, err = sessions.GetSession(stale.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.SessionRunning, session.Status)
+	report, err = reaper.Sweep()
+	require.NoError(t, err)
+	assert.Empty(t, report.Expired)
+	assert.Empty(t, report.Purged)
+}
+
+func TestReaperRunsInBackground(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := services.NewSessionService(store.Sessions, store)
+	session := models.NewSession()
+	session.LastHeartbeat = time.Now().Add(-time.Hour)
+	require.NoError(t, store.Sessions.Create(session))
+
+	reaper := NewReaper(Config{Timeout: time.Minute, Interval: time.Millisecond}, sessions, services.NewAgentService(store.Agents, store))
+	reaper.Start()
+	require.Eventually(t, func() bool {
+		current, err := sessions.GetSession(session.ID)
+		return err == nil && current.Status == models.SessionIdle
+	}, time.Second, 5*time.Millisecond)
+	reaper.Shutdown()
+	reaper.Shutdown()
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	config, err := ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, services.DefaultSessionTimeout, config.Timeout)
+	assert.Zero(t, config.Retention)
+
+	t.Setenv("SESSION_TIMEOUT", "10m")
+	t.Setenv("SESSION_RETENTION", "720h")
+	config, err = ConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, config.Timeout)
+	assert.Equal(t, 720*time.Hour, config.Retention)
+
+	t.Setenv("SESSION_RETENTION", "1m")
+	_, err = ConfigFromEnv()
+	assert.Error(t, err)
+	t.Setenv("REAPER_INTERVAL", "soon")
+	_, err = ConfigFromEnv()
+	assert.ErrorContains(t, err, "REAPER_INTERVAL")
+}
@@ -1,76 +1,144 @@
 package repositories
 
 import (
+	"database/sql"
+
 	"github.com/chatcollab/chatcollab/db"
 	"github.com/chatcollab/chatcollab/models"
 )
 
 // AgentRepository handles database operations for agents
-type AgentRepository struct{}
+type AgentRepository struct {
+	db sqlConn
+}
+
+// NewAgentRepository creates a new AgentRepository
+func NewAgentRepository(conn *sql.DB, dialect db.Dialect) *AgentRepository {
+	return &AgentRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
 
 // Create inserts a new agent into the database
 func (r *AgentRepository) Create(agent *models.Agent) error {
-	_, err := db.DB.Exec(
-		"INSERT INTO agents (id, is_online, name, role, prompt, model, reasoning_log, session_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		agent.ID, agent.IsOnline, agent.Name, agent.Role, agent.Prompt, agent.Model, agent.ReasoningLog, agent.SessionID,
-	)
-	return err
+	return invalidReference(r.db.inTx(func(tx sqlConn) error {
+		if err := reachableAgentRefs(tx, agent); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO agents (id, created_at, is_online, name, role, prompt, model, session_id, template_id, template_version, pinned, version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			agent.ID, agent.CreatedAt.UTC(), agent.IsOnline, agent.Name, agent.Role, agent.Prompt, agent.Model, nullString(agent.SessionID),
+			nullString(agent.TemplateID), nullInt(agent.TemplateVersion), agent.Pinned, agent.Version,
+		)
+		return err
+	}))
+}
+
+// reachableAgentRefs checks that an agent's session and template are in the
+// connection's workspace
+func reachableAgentRefs(tx sqlConn, agent *models.Agent) error {
+	if err := tx.reachable("sessions", inWorkspace, agent.SessionID); err != nil {
+		return err
+	}
+	return tx.reachable("agent_templates", inWorkspace, agent.TemplateID)
 }
 
 // GetByID retrieves an agent by its ID
 func (r *AgentRepository) GetByID(id string) (*models.Agent, error) {
-	var agent models.Agent
-	err := db.DB.QueryRow(
-		"SELECT id, is_online, name, role, prompt, model, reasoning_log, session_id FROM agents WHERE id = ?",
-		id,
-	).Scan(&agent.ID, &agent.IsOnline, &agent.Name, &agent.Role, &agent.Prompt, &agent.Model, &agent.ReasoningLog, &agent.SessionID)
+	scope, args := r.db.scope(sessionInWorkspace)
+	agent, err := scanAgent(r.db.QueryRow("SELECT "+agentColumns+" FROM agents WHERE id = ?"+scope+r.db.forUpdate(), append([]interface{}{id}, args...)...))
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
-	return &agent, nil
+	return agent, nil
 }
 
-// Update updates an existing agent
+// Update stores a changed agent as its next version. The stored agent must
+// still be at the agent's version, otherwise ErrConflict is returned.
 func (r *AgentRepository) Update(agent *models.Agent) error {
-	_, err := db.DB.Exec(
-		"UPDATE agents SET is_online = ?, name = ?, role = ?, prompt = ?, model = ?, reasoning_log = ?, session_id = ? WHERE id = ?",
-		agent.IsOnline, agent.Name, agent.Role, agent.Prompt, agent.Model, agent.ReasoningLog, agent.SessionID, agent.ID,
-	)
-	return err
+	scope, args := r.db.scope(sessionInWorkspace)
+	err := r.db.inTx(func(tx sqlConn) error {
+		if err := reachableAgentRefs(tx, agent); err != nil {
+			return err
+		}
+		err := expectRow(tx.Exec(
+			"UPDATE agents SET is_online = ?, name = ?, role = ?, prompt = ?, model = ?, session_id = ?, template_id = ?, template_version = ?, pinned = ?, version = ? WHERE id = ? AND version = ?"+scope,
+			append([]interface{}{
+				agent.IsOnline, agent.Name, agent.Role, agent.Prompt, agent.Model, nullString(agent.SessionID),
+				nullString(agent.TemplateID), nullInt(agent.TemplateVersion), agent.Pinned, agent.Version + 1, agent.ID, agent.Version,
+			}, args...)...,
+		))
+		if err == ErrNotFound {
+			return versionConflict(tx, "agents", agent.ID, sessionInWorkspace)
+		}
+		return err
+	})
+	if err != nil {
+		return invalidReference(err)
+	}
+	agent.Version++
+	return nil
 }
 
-// Delete removes an agent from the database
+// Delete removes an agent and its reasoning from the database. Agents that
+// wrote messages cannot be deleted.
 func (r *AgentRepository) Delete(id string) error {
-	_, err := db.DB.Exec("DELETE FROM agents WHERE id = ?", id)
-	return err
+	scope, args := r.db.scope(sessionInWorkspace)
+	return referenced(expectRow(r.db.Exec("DELETE FROM agents WHERE id = ?"+scope, append([]interface{}{id}, args...)...)))
 }
 
-// ListAll retrieves all agents
-func (r *AgentRepository) ListAll() ([]*models.Agent, error) {
-	rows, err := db.DB.Query("SELECT id, is_online, name, role, prompt, model, reasoning_log, session_id FROM agents")
+// SetOnline changes only an agent's online status and returns the agent as stored
+func (r *AgentRepository) SetOnline(id string, isOnline bool) (*models.Agent, error) {
+	var agent *models.Agent
+	scope, args := r.db.scope(sessionInWorkspace)
+	err := r.db.inTx(func(tx sqlConn) error {
+		if err := expectRow(tx.Exec("UPDATE agents SET is_online = ? WHERE id = ?"+scope, append([]interface{}{isOnline, id}, args...)...)); err != nil {
+			return err
+		}
+		var err error
+		agent, err = scanAgent(tx.QueryRow("SELECT "+agentColumns+" FROM agents WHERE id = ?", id))
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return agent, nil
+}
 
-	var agents []*models.Agent
-	for rows.Next() {
-		var agent models.Agent
-		if err := rows.Scan(&agent.ID, &agent.IsOnline, &agent.Name, &agent.Role, &agent.Prompt, &agent.Model, &agent.ReasoningLog, &agent.SessionID); err != nil {
-			return nil, err
-		}
-		agents = append(agents, &agent)
+// ListAll retrieves all agents in creation order
+func (r *AgentRepository) ListAll() ([]*models.Agent, error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query("SELECT "+agentColumns+" FROM agents WHERE 1 = 1"+scope+" ORDER BY created_at, id", args...)
+}
+
+// List retrieves one page of agents
+func (r *AgentRepository) List(page PageRequest) (*Page[*models.Agent], error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	agents, err := r.query("SELECT "+agentColumns+" FROM agents WHERE 1 = 1"+scope+where+orderBy, append(args, keysetArgs...)...)
+	if err != nil {
+		return nil, err
 	}
+	return newPage(agents, page, agentCursor), nil
+}
 
-	return agents, nil
+// GetByTemplateID retrieves all agents made from a template in creation order
+func (r *AgentRepository) GetByTemplateID(templateID string) ([]*models.Agent, error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query("SELECT "+agentColumns+" FROM agents WHERE template_id = ?"+scope+" ORDER BY created_at, id", append([]interface{}{templateID}, args...)...)
 }
 
-// GetBySessionID retrieves all agents for a specific session
+// GetBySessionID retrieves all agents for a specific session in creation order
 func (r *AgentRepository) GetBySessionID(sessionID string) ([]*models.Agent, error) {
-	rows, err := db.DB.Query(
-		"SELECT id, is_online, name, role, prompt, model, reasoning_log, session_id FROM agents WHERE session_id = ?",
-		sessionID,
-	)
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query("SELECT "+agentColumns+" FROM agents WHERE session_id = ?"+scope+" ORDER BY created_at, id", append([]interface{}{sessionID}, args...)...)
+}
+
+// Count returns how many agents exist
+func (r *AgentRepository) Count() (int, error) {
+	return r.db.count("agents", sessionInWorkspace)
+}
+
+func (r *AgentRepository) query(query string, args ...interface{}) ([]*models.Agent, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -78,12 +146,36 @@ func (r *AgentRepository) GetBySessionID(sessionID string) ([]*models.Agent, err
 
 	var agents []*models.Agent
 	for rows.Next() {
-		var agent models.Agent
-		if err := rows.Scan(&agent.ID, &agent.IsOnline, &agent.Name, &agent.Role, &agent.Prompt, &agent.Model, &agent.ReasoningLog, &agent.SessionID); err != nil {
+		agent, err := scanAgent(rows)
+		if err != nil {
 			return nil, err
 		}
-		agents = append(agents, &agent)
+		agents = append(agents, agent)
 	}
 
-	return agents, nil
-}
\ No newline at end of file
+	return agents, rows.Err()
+}
+
+// agentColumns lists the columns read by scanAgent
+const agentColumns = "id, created_at, is_online, name, role, prompt, model, session_id, template_id, template_version, pinned, version"
+
+func scanAgent(row interface{ Scan(...interface{}) error }) (*models.Agent, error) {
+	var agent models.Agent
+	var sessionID, templateID sql.NullString
+	var templateVersion sql.NullInt64
+	err := row.Scan(
+		&agent.ID, &agent.CreatedAt, &agent.IsOnline, &agent.Name, &agent.Role, &agent.Prompt, &agent.Model,
+		&sessionID, &templateID, &templateVersion, &agent.Pinned, &agent.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	agent.SessionID = sessionID.String
+	agent.TemplateID = templateID.String
+	agent.TemplateVersion = int(templateVersion.Int64)
+	return &agent, nil
+}
+
+func agentCursor(agent *models.Agent) Cursor {
+	return Cursor{CreatedAt: agent.CreatedAt, ID: agent.ID}
+}
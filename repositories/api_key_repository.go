@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db sqlConn
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository
+func NewAPIKeyRepository(conn *sql.DB, dialect db.Dialect) *APIKeyRepository {
+	return &APIKeyRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
+
+// Create inserts a new API key into the database
+func (r *APIKeyRepository) Create(key *models.APIKey) error {
+	scopes, err := json.Marshal(keyScopes(key))
+	if err != nil {
+		return err
+	}
+	r.db.stamp(&key.WorkspaceID)
+	return r.db.inTx(func(tx sqlConn) error {
+		if err := tx.reachable("sessions", inWorkspace, key.SessionID); err != nil {
+			return err
+		}
+		if err := tx.reachable("agents", sessionInWorkspace, key.AgentID); err != nil {
+			return err
+		}
+		if err := tx.reachable("users", inWorkspace, key.UserID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO api_keys (id, created_at, name, prefix, key_hash, scopes, session_id, agent_id, user_id, revoked_at, workspace_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			key.ID, key.CreatedAt.UTC(), key.Name, key.Prefix, key.Hash, string(scopes), nullString(key.SessionID), nullString(key.AgentID), nullString(key.UserID), key.RevokedAt,
+			key.WorkspaceID,
+		)
+		if db.IsUniqueViolation(err) {
+			return ErrConflict
+		}
+		return invalidReference(err)
+	})
+}
+
+// GetByID retrieves an API key by its ID
+func (r *APIKeyRepository) GetByID(id string) (*models.APIKey, error) {
+	scope, args := r.db.scope(inWorkspace)
+	key, err := scanAPIKey(r.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?"+scope+r.db.forUpdate(), append([]interface{}{id}, args...)...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return key, nil
+}
+
+// GetByHash retrieves the API key whose secret has the given hash
+func (r *APIKeyRepository) GetByHash(hash string) (*models.APIKey, error) {
+	scope, args := r.db.scope(inWorkspace)
+	key, err := scanAPIKey(r.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?"+scope, append([]interface{}{hash}, args...)...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return key, nil
+}
+
+// Revoke marks an API key revoked at the given time. Revoking a key again
+// keeps the time it was first revoked.
+func (r *APIKeyRepository) Revoke(id string, at time.Time) error {
+	scope, args := r.db.scope(inWorkspace)
+	return expectRow(r.db.Exec("UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?"+scope, append([]interface{}{at.UTC(), id}, args...)...))
+}
+
+// RevokeByAgentID revokes every active token of an agent at the given time
+func (r *APIKeyRepository) RevokeByAgentID(agentID string, at time.Time) error {
+	scope, args := r.db.scope(inWorkspace)
+	_, err := r.db.Exec("UPDATE api_keys SET revoked_at = ? WHERE agent_id = ? AND revoked_at IS NULL"+scope, append([]interface{}{at.UTC(), agentID}, args...)...)
+	return err
+}
+
+// Count returns how many API keys exist, revoked or not
+func (r *APIKeyRepository) Count() (int, error) {
+	return r.db.count("api_keys", inWorkspace)
+}
+
+// List retrieves one page of API keys
+func (r *APIKeyRepository) List(page PageRequest) (*Page[*models.APIKey], error) {
+	scope, args := r.db.scope(inWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	rows, err := r.db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE 1 = 1"+scope+where+orderBy, append(args, keysetArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPage(keys, page, apiKeyCursor), nil
+}
+
+// apiKeyColumns lists the columns read by scanAPIKey
+const apiKeyColumns = "id, created_at, name, prefix, key_hash, scopes, session_id, agent_id, user_id, revoked_at, workspace_id"
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes []byte
+	var sessionID, agentID, userID sql.NullString
+	var revokedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.CreatedAt, &key.Name, &key.Prefix, &key.Hash, &scopes, &sessionID, &agentID, &userID, &revokedAt, &key.WorkspaceID); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return nil, err
+	}
+	key.SessionID = sessionID.String
+	key.AgentID = agentID.String
+	key.UserID = userID.String
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+// keyScopes stores a key without scopes as an empty list
+func keyScopes(key *models.APIKey) []models.Scope {
+	if key.Scopes == nil {
+		return []models.Scope{}
+	}
+	return key.Scopes
+}
+
+func apiKeyCursor(key *models.APIKey) Cursor {
+	return Cursor{CreatedAt: key.CreatedAt, ID: key.ID}
+}
@@ -0,0 +1,1244 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// MemoryAgentStore keeps agents in memory
+type MemoryAgentStore struct {
+	mu     sync.RWMutex
+	agents map[string]*models.Agent
+	order  []string
+	refs   *memoryRelations
+}
+
+// NewMemoryAgentStore creates an empty MemoryAgentStore
+func NewMemoryAgentStore() *MemoryAgentStore {
+	return &MemoryAgentStore{agents: make(map[string]*models.Agent)}
+}
+
+// Create stores a new agent, refusing duplicate IDs
+func (s *MemoryAgentStore) Create(agent *models.Agent) error {
+	if err := s.refs.checkAgent(agent); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.agents[agent.ID]; ok {
+		return ErrConflict
+	}
+	copied := *agent
+	s.agents[agent.ID] = &copied
+	s.order = append(s.order, agent.ID)
+	return nil
+}
+
+// GetByID retrieves an agent by its ID
+func (s *MemoryAgentStore) GetByID(id string) (*models.Agent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	agent, ok := s.agents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *agent
+	return &copied, nil
+}
+
+// Update stores a changed agent as its next version, provided the stored
+// agent is still at the agent's version
+func (s *MemoryAgentStore) Update(agent *models.Agent) error {
+	if err := s.refs.checkAgent(agent); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.agents[agent.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != agent.Version {
+		return ErrConflict
+	}
+	agent.Version++
+	copied := *agent
+	s.agents[agent.ID] = &copied
+	return nil
+}
+
+// Delete removes an agent and its reasoning. Agents that wrote messages
+// cannot be deleted.
+func (s *MemoryAgentStore) Delete(id string) error {
+	if !s.has(id) {
+		return ErrNotFound
+	}
+	if err := s.refs.deletingAgent(id); err != nil {
+		return err
+	}
+
+	s.removeWhere(func(agent *models.Agent) bool { return agent.ID == id })
+	s.refs.agentDeleted(id)
+	return nil
+}
+
+// SetOnline changes only an agent's online status
+func (s *MemoryAgentStore) SetOnline(id string, isOnline bool) (*models.Agent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agent, ok := s.agents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	agent.SetOnline(isOnline)
+	copied := *agent
+	return &copied, nil
+}
+
+// ListAll retrieves all agents in creation order
+func (s *MemoryAgentStore) ListAll() ([]*models.Agent, error) {
+	return s.filter(func(*models.Agent) bool { return true }), nil
+}
+
+// List retrieves one page of agents
+func (s *MemoryAgentStore) List(page PageRequest) (*Page[*models.Agent], error) {
+	agents := s.filter(func(*models.Agent) bool { return true })
+	sortByCursor(agents, agentCursor)
+	return paginate(agents, page, agentCursor), nil
+}
+
+// GetBySessionID retrieves all agents for a specific session
+func (s *MemoryAgentStore) GetBySessionID(sessionID string) ([]*models.Agent, error) {
+	return s.filter(func(agent *models.Agent) bool { return agent.SessionID == sessionID }), nil
+}
+
+// GetByTemplateID retrieves all agents made from a template
+func (s *MemoryAgentStore) GetByTemplateID(templateID string) ([]*models.Agent, error) {
+	return s.filter(func(agent *models.Agent) bool { return agent.TemplateID == templateID }), nil
+}
+
+// Count returns how many agents exist
+func (s *MemoryAgentStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.agents), nil
+}
+
+func (s *MemoryAgentStore) filter(keep func(*models.Agent) bool) []*models.Agent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var agents []*models.Agent
+	for _, id := range s.order {
+		if agent := s.agents[id]; keep(agent) {
+			copied := *agent
+			agents = append(agents, &copied)
+		}
+	}
+	return agents
+}
+
+func (s *MemoryAgentStore) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.agents[id]
+	return ok
+}
+
+// ids returns the IDs of the matching agents
+func (s *MemoryAgentStore) ids(match func(*models.Agent) bool) []string {
+	var ids []string
+	for _, agent := range s.filter(match) {
+		ids = append(ids, agent.ID)
+	}
+	return ids
+}
+
+// removeWhere deletes the matching agents and returns their IDs
+func (s *MemoryAgentStore) removeWhere(match func(*models.Agent) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []string
+	for _, id := range s.order {
+		if match(s.agents[id]) {
+			removed = append(removed, id)
+		}
+	}
+	for _, id := range removed {
+		delete(s.agents, id)
+		s.order = without(s.order, id)
+	}
+	return removed
+}
+
+// detach applies fn to every agent to clear references to a deleted record
+func (s *MemoryAgentStore) detach(fn func(*models.Agent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, agent := range s.agents {
+		fn(agent)
+	}
+}
+
+// MemoryTemplateStore keeps agent templates in memory
+type MemoryTemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]*models.AgentTemplate
+	refs      *memoryRelations
+}
+
+// NewMemoryTemplateStore creates an empty MemoryTemplateStore
+func NewMemoryTemplateStore() *MemoryTemplateStore {
+	return &MemoryTemplateStore{templates: make(map[string]*models.AgentTemplate)}
+}
+
+// Create stores a new template, refusing duplicate IDs
+func (s *MemoryTemplateStore) Create(template *models.AgentTemplate) error {
+	defaultWorkspace(&template.WorkspaceID)
+	if err := s.refs.checkWorkspace(template.WorkspaceID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[template.ID]; ok {
+		return ErrConflict
+	}
+	copied := *template
+	s.templates[template.ID] = &copied
+	return nil
+}
+
+// GetByID retrieves a template by its ID
+func (s *MemoryTemplateStore) GetByID(id string) (*models.AgentTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *template
+	return &copied, nil
+}
+
+// Update stores a revised template, which must be the stored version's successor
+func (s *MemoryTemplateStore) Update(template *models.AgentTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.templates[template.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != template.Version-1 {
+		return ErrConflict
+	}
+	copied := *template
+	copied.WorkspaceID = stored.WorkspaceID
+	s.templates[template.ID] = &copied
+	return nil
+}
+
+// Delete removes a template. Agents made from it no longer reference it.
+func (s *MemoryTemplateStore) Delete(id string) error {
+	s.mu.Lock()
+	_, ok := s.templates[id]
+	delete(s.templates, id)
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+	s.refs.templateDeleted(id)
+	return nil
+}
+
+func (s *MemoryTemplateStore) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.templates[id]
+	return ok
+}
+
+// List retrieves one page of templates
+func (s *MemoryTemplateStore) List(page PageRequest) (*Page[*models.AgentTemplate], error) {
+	templates := s.filter(func(*models.AgentTemplate) bool { return true })
+	return paginate(templates, page, templateCursor), nil
+}
+
+// filter returns copies of the matching templates ordered by creation time
+func (s *MemoryTemplateStore) filter(keep func(*models.AgentTemplate) bool) []*models.AgentTemplate {
+	s.mu.RLock()
+	templates := make([]*models.AgentTemplate, 0, len(s.templates))
+	for _, template := range s.templates {
+		if keep(template) {
+			copied := *template
+			templates = append(templates, &copied)
+		}
+	}
+	s.mu.RUnlock()
+
+	sortByCursor(templates, templateCursor)
+	return templates
+}
+
+// MemoryUserStore keeps users and their session memberships in memory
+type MemoryUserStore struct {
+	mu      sync.RWMutex
+	users   map[string]*models.User
+	members map[string][]*models.Participant
+	refs    *memoryRelations
+}
+
+// NewMemoryUserStore creates an empty MemoryUserStore
+func NewMemoryUserStore() *MemoryUserStore {
+	return &MemoryUserStore{
+		users:   make(map[string]*models.User),
+		members: make(map[string][]*models.Participant),
+	}
+}
+
+// Create stores a new user
+func (s *MemoryUserStore) Create(user *models.User) error {
+	defaultWorkspace(&user.WorkspaceID)
+	if err := s.refs.checkWorkspace(user.WorkspaceID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *user
+	s.users[user.ID] = &copied
+	return nil
+}
+
+// GetByID retrieves a user by its ID
+func (s *MemoryUserStore) GetByID(id string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// Update replaces an existing user
+func (s *MemoryUserStore) Update(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	copied := *user
+	copied.WorkspaceID = stored.WorkspaceID
+	s.users[user.ID] = &copied
+	return nil
+}
+
+// Delete removes a user and their session memberships. Users who wrote
+// messages cannot be deleted.
+func (s *MemoryUserStore) Delete(id string) error {
+	if !s.has(id) {
+		return ErrNotFound
+	}
+	if err := s.refs.deletingUser(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.users, id)
+	s.mu.Unlock()
+	s.removeMembers(func(member *models.Participant) bool { return member.ID == id })
+	s.refs.userDeleted(id)
+	return nil
+}
+
+func (s *MemoryUserStore) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.users[id]
+	return ok
+}
+
+// removeMembers deletes the matching session memberships
+func (s *MemoryUserStore) removeMembers(match func(*models.Participant) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID, members := range s.members {
+		kept := members[:0]
+		for _, member := range members {
+			if !match(member) {
+				kept = append(kept, member)
+			}
+		}
+		s.members[sessionID] = kept
+	}
+}
+
+// List retrieves one page of users
+func (s *MemoryUserStore) List(page PageRequest) (*Page[*models.User], error) {
+	return paginate(s.filter(func(*models.User) bool { return true }), page, userCursor), nil
+}
+
+// filter returns copies of the matching users ordered by creation time
+func (s *MemoryUserStore) filter(keep func(*models.User) bool) []*models.User {
+	s.mu.RLock()
+	users := make([]*models.User, 0, len(s.users))
+	for _, user := range s.users {
+		if keep(user) {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	s.mu.RUnlock()
+
+	sortByCursor(users, userCursor)
+	return users
+}
+
+// AddMember records a user joining a session
+func (s *MemoryUserStore) AddMember(member *models.Participant) error {
+	if err := s.refs.checkMember(member); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *member
+	s.members[member.SessionID] = append(s.members[member.SessionID], &copied)
+	return nil
+}
+
+// GetMember retrieves a user's membership of a session
+func (s *MemoryUserStore) GetMember(sessionID, userID string) (*models.Participant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, member := range s.members[sessionID] {
+		if member.ID == userID {
+			return s.withName(member), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// SetMemberOnline updates a user's presence in a session
+func (s *MemoryUserStore) SetMemberOnline(sessionID, userID string, isOnline bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, member := range s.members[sessionID] {
+		if member.ID == userID {
+			member.IsOnline = isOnline
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// SetMemberRole changes a user's role in a session
+func (s *MemoryUserStore) SetMemberRole(sessionID, userID string, role models.SessionRole) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, member := range s.members[sessionID] {
+		if member.ID == userID {
+			member.SessionRole = role
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// RemoveMember takes a user out of a session
+func (s *MemoryUserStore) RemoveMember(sessionID, userID string) error {
+	if _, err := s.GetMember(sessionID, userID); err != nil {
+		return err
+	}
+	s.removeMembers(func(member *models.Participant) bool {
+		return member.SessionID == sessionID && member.ID == userID
+	})
+	return nil
+}
+
+// sessionIDs returns the IDs of the sessions a user is a member of
+func (s *MemoryUserStore) sessionIDs(userID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for sessionID, members := range s.members {
+		for _, member := range members {
+			if member.ID == userID {
+				ids = append(ids, sessionID)
+			}
+		}
+	}
+	return ids
+}
+
+// GetBySessionID retrieves the users who joined a session, in the order they joined
+func (s *MemoryUserStore) GetBySessionID(sessionID string) ([]*models.Participant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []*models.Participant
+	for _, member := range s.members[sessionID] {
+		members = append(members, s.withName(member))
+	}
+	sortByCursor(members, memberCursor)
+	return members, nil
+}
+
+// withName copies a membership with the user's current name
+func (s *MemoryUserStore) withName(member *models.Participant) *models.Participant {
+	copied := *member
+	if user, ok := s.users[member.ID]; ok {
+		copied.Name = user.Name
+	}
+	return &copied
+}
+
+// MemorySessionStore keeps sessions in memory
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*models.Session
+	order    []string
+	refs     *memoryRelations
+}
+
+// NewMemorySessionStore creates an empty MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*models.Session)}
+}
+
+// Create stores a new session, refusing duplicate IDs
+func (s *MemorySessionStore) Create(session *models.Session) error {
+	defaultWorkspace(&session.WorkspaceID)
+	if err := s.refs.checkWorkspace(session.WorkspaceID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[session.ID]; ok {
+		return ErrConflict
+	}
+	copied := *session
+	s.sessions[session.ID] = &copied
+	s.order = append(s.order, session.ID)
+	return nil
+}
+
+// GetByID retrieves a session by its ID
+func (s *MemorySessionStore) GetByID(id string) (*models.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// Update stores a changed session as its next version, provided the stored
+// session is still at the session's version
+func (s *MemorySessionStore) Update(session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.sessions[session.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != session.Version {
+		return ErrConflict
+	}
+	session.Version++
+	copied := *session
+	copied.WorkspaceID = stored.WorkspaceID
+	s.sessions[session.ID] = &copied
+	return nil
+}
+
+// Touch records a heartbeat at the given time, waking the session if it went idle
+func (s *MemorySessionStore) Touch(id string, at time.Time) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	session.LastHeartbeat = at
+	if session.Status == models.SessionIdle {
+		session.Transition(models.SessionRunning)
+		session.Version++
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// Delete removes a session along with its agents, messages and members
+func (s *MemorySessionStore) Delete(id string) error {
+	if !s.has(id) {
+		return ErrNotFound
+	}
+	if err := s.refs.deletingSession(id); err != nil {
+		return err
+	}
+
+	s.refs.sessionDeleted(id)
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.order = without(s.order, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemorySessionStore) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.sessions[id]
+	return ok
+}
+
+// ListAll retrieves all sessions in creation order
+func (s *MemorySessionStore) ListAll() ([]*models.Session, error) {
+	return s.filter(func(*models.Session) bool { return true }), nil
+}
+
+// List retrieves one page of sessions
+func (s *MemorySessionStore) List(page PageRequest) (*Page[*models.Session], error) {
+	sessions := s.filter(func(*models.Session) bool { return true })
+	sortByCursor(sessions, sessionCursor)
+	return paginate(sessions, page, sessionCursor), nil
+}
+
+// ListByMember retrieves one page of the sessions a user is a member of.
+// A store created on its own knows of no members.
+func (s *MemorySessionStore) ListByMember(userID string, page PageRequest) (*Page[*models.Session], error) {
+	joined := map[string]bool{}
+	if s.refs != nil {
+		joined = idSet(s.refs.users.sessionIDs(userID))
+	}
+	sessions := s.filter(func(session *models.Session) bool { return joined[session.ID] })
+	sortByCursor(sessions, sessionCursor)
+	return paginate(sessions, page, sessionCursor), nil
+}
+
+// GetActiveSessions retrieves all active sessions based on the heartbeat timeout
+func (s *MemorySessionStore) GetActiveSessions(timeout time.Duration) ([]*models.Session, error) {
+	cutoffTime := time.Now().Add(-timeout)
+	return s.filter(func(session *models.Session) bool { return session.LastHeartbeat.After(cutoffTime) }), nil
+}
+
+// GetInactiveSessions retrieves the sessions whose last heartbeat is older than the timeout
+func (s *MemorySessionStore) GetInactiveSessions(timeout time.Duration) ([]*models.Session, error) {
+	cutoffTime := time.Now().Add(-timeout)
+	return s.filter(func(session *models.Session) bool { return !session.LastHeartbeat.After(cutoffTime) }), nil
+}
+
+// Count returns how many sessions exist
+func (s *MemorySessionStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.sessions), nil
+}
+
+func (s *MemorySessionStore) filter(keep func(*models.Session) bool) []*models.Session {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []*models.Session
+	for _, id := range s.order {
+		if session := s.sessions[id]; keep(session) {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions
+}
+
+// MemoryMessageStore keeps messages in memory
+type MemoryMessageStore struct {
+	mu        sync.RWMutex
+	messages  map[string]*models.Message
+	revisions map[string][]*models.MessageRevision
+	refs      *memoryRelations
+}
+
+// NewMemoryMessageStore creates an empty MemoryMessageStore
+func NewMemoryMessageStore() *MemoryMessageStore {
+	return &MemoryMessageStore{
+		messages:  make(map[string]*models.Message),
+		revisions: make(map[string][]*models.MessageRevision),
+	}
+}
+
+// Create stores a new message along with its first revision, refusing duplicate IDs
+func (s *MemoryMessageStore) Create(message *models.Message) error {
+	if err := s.refs.checkMessage(message); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.messages[message.ID]; ok {
+		return ErrConflict
+	}
+	copied := *message
+	s.messages[message.ID] = &copied
+	s.revisions[message.ID] = []*models.MessageRevision{message.CurrentRevision()}
+	return nil
+}
+
+// GetByID retrieves a message by its ID
+func (s *MemoryMessageStore) GetByID(id string) (*models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, ok := s.messages[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *message
+	return &copied, nil
+}
+
+// Update stores an edited message and records its new revision
+func (s *MemoryMessageStore) Update(message *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.messages[message.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Revision != message.Revision-1 {
+		return ErrConflict
+	}
+	stored.Content = message.Content
+	stored.Revision = message.Revision
+	stored.EditedAt = message.EditedAt
+	stored.EditedBy = message.EditedBy
+	s.revisions[message.ID] = append(s.revisions[message.ID], message.CurrentRevision())
+	return nil
+}
+
+// Delete removes a message and its revisions. Messages with replies cannot be deleted.
+func (s *MemoryMessageStore) Delete(id string) error {
+	if !s.has(id) {
+		return ErrNotFound
+	}
+	if err := s.refs.deletingMessage(id); err != nil {
+		return err
+	}
+
+	s.removeWhere(func(message *models.Message) bool { return message.ID == id })
+	s.refs.messageDeleted(id)
+	return nil
+}
+
+// GetRevisions retrieves every revision of a message, oldest first
+func (s *MemoryMessageStore) GetRevisions(messageID string) ([]*models.MessageRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var revisions []*models.MessageRevision
+	for _, revision := range s.revisions[messageID] {
+		copied := *revision
+		revisions = append(revisions, &copied)
+	}
+	return revisions, nil
+}
+
+// GetBySessionID retrieves all messages for a specific session
+func (s *MemoryMessageStore) GetBySessionID(sessionID string) ([]*models.Message, error) {
+	return s.filter(func(message *models.Message) bool { return message.SessionID == sessionID }), nil
+}
+
+// GetByAgentID retrieves all messages for a specific agent
+func (s *MemoryMessageStore) GetByAgentID(agentID string) ([]*models.Message, error) {
+	return s.filter(func(message *models.Message) bool { return message.AgentID == agentID }), nil
+}
+
+// ListBySessionID retrieves one page of a session's messages
+func (s *MemoryMessageStore) ListBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error) {
+	messages, _ := s.GetBySessionID(sessionID)
+	return paginate(messages, page, messageCursor), nil
+}
+
+// ListByAgentID retrieves one page of an agent's messages
+func (s *MemoryMessageStore) ListByAgentID(agentID string, page PageRequest) (*Page[*models.Message], error) {
+	messages, _ := s.GetByAgentID(agentID)
+	return paginate(messages, page, messageCursor), nil
+}
+
+// GetThread retrieves the replies in a thread, oldest first
+func (s *MemoryMessageStore) GetThread(rootID string) ([]*models.Message, error) {
+	return s.filter(func(message *models.Message) bool { return message.ThreadRootID == rootID }), nil
+}
+
+// ListThreadsBySessionID retrieves one page of a session's top-level
+// messages, each with the number of replies in its thread
+func (s *MemoryMessageStore) ListThreadsBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error) {
+	replies := make(map[string]int)
+	roots := s.filter(func(message *models.Message) bool {
+		if message.ThreadRootID != "" {
+			replies[message.ThreadRootID]++
+			return false
+		}
+		return message.SessionID == sessionID
+	})
+	for _, root := range roots {
+		root.ReplyCount = replies[root.ID]
+	}
+	return paginate(roots, page, messageCursor), nil
+}
+
+// Search finds messages containing every term of the query
+func (s *MemoryMessageStore) Search(query SearchQuery) ([]*SearchHit, error) {
+	return s.search(query, func(*models.Message) bool { return true }), nil
+}
+
+// search finds the messages passing keep that contain every term of the query
+func (s *MemoryMessageStore) search(query SearchQuery, keep func(*models.Message) bool) []*SearchHit {
+	terms := searchTerms(query.Query)
+	var hits []*SearchHit
+	for _, message := range s.filter(func(message *models.Message) bool { return keep(message) && query.matches(message) }) {
+		if n := matchTerms(message.Content, terms); n > 0 {
+			hits = append(hits, &SearchHit{Message: message, Snippet: highlight(message.Content, terms), Rank: float64(n)})
+		}
+	}
+	return rankHits(hits, query)
+}
+
+// GetMessagesAfter retrieves all messages created after a specific time
+func (s *MemoryMessageStore) GetMessagesAfter(sessionID string, after time.Time) ([]*models.Message, error) {
+	return s.filter(func(message *models.Message) bool {
+		return message.SessionID == sessionID && message.CreatedAt.After(after)
+	}), nil
+}
+
+// Count returns how many messages exist
+func (s *MemoryMessageStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.messages), nil
+}
+
+// CountBySessionID counts the messages posted in a session
+func (s *MemoryMessageStore) CountBySessionID(sessionID string) (int, error) {
+	return len(s.filter(func(message *models.Message) bool { return message.SessionID == sessionID })), nil
+}
+
+// filter returns copies of the matching messages ordered by creation time
+func (s *MemoryMessageStore) filter(keep func(*models.Message) bool) []*models.Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []*models.Message
+	for _, message := range s.messages {
+		if keep(message) {
+			copied := *message
+			messages = append(messages, &copied)
+		}
+	}
+	sortByCursor(messages, messageCursor)
+	return messages
+}
+
+func (s *MemoryMessageStore) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.messages[id]
+	return ok
+}
+
+// ids returns the IDs of the matching messages
+func (s *MemoryMessageStore) ids(match func(*models.Message) bool) []string {
+	var ids []string
+	for _, message := range s.filter(match) {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+// removeWhere deletes the matching messages with their revisions and returns their IDs
+func (s *MemoryMessageStore) removeWhere(match func(*models.Message) bool) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed []string
+	for id, message := range s.messages {
+		if match(message) {
+			removed = append(removed, id)
+		}
+	}
+	for _, id := range removed {
+		delete(s.messages, id)
+		delete(s.revisions, id)
+	}
+	return removed
+}
+
+// MemoryReasoningStore keeps reasoning entries in memory
+type MemoryReasoningStore struct {
+	mu      sync.RWMutex
+	entries []*models.ReasoningEntry
+	refs    *memoryRelations
+}
+
+// NewMemoryReasoningStore creates an empty MemoryReasoningStore
+func NewMemoryReasoningStore() *MemoryReasoningStore {
+	return &MemoryReasoningStore{}
+}
+
+// Create stores a new reasoning entry
+func (s *MemoryReasoningStore) Create(entry *models.ReasoningEntry) error {
+	if err := s.refs.checkReasoning(entry); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *entry
+	s.entries = append(s.entries, &copied)
+	return nil
+}
+
+// ListByAgentID retrieves one page of an agent's reasoning entries matching the filter
+func (s *MemoryReasoningStore) ListByAgentID(agentID string, filter ReasoningFilter, page PageRequest) (*Page[*models.ReasoningEntry], error) {
+	s.mu.RLock()
+	var entries []*models.ReasoningEntry
+	for _, entry := range s.entries {
+		if entry.AgentID == agentID && filter.matches(entry) {
+			copied := *entry
+			entries = append(entries, &copied)
+		}
+	}
+	s.mu.RUnlock()
+
+	sortByCursor(entries, reasoningCursor)
+	return paginate(entries, page, reasoningCursor), nil
+}
+
+// removeWhere deletes the matching entries
+func (s *MemoryReasoningStore) removeWhere(match func(*models.ReasoningEntry) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.entries[:0]
+	for _, entry := range s.entries {
+		if !match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	s.entries = kept
+}
+
+// detach applies fn to every entry to clear references to a deleted record
+func (s *MemoryReasoningStore) detach(fn func(*models.ReasoningEntry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, entry := range s.entries {
+		fn(entry)
+	}
+}
+
+// MemoryAPIKeyStore keeps API keys in memory
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]*models.APIKey
+	refs *memoryRelations
+}
+
+// NewMemoryAPIKeyStore creates an empty MemoryAPIKeyStore
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[string]*models.APIKey)}
+}
+
+// Create stores a new API key, refusing duplicate IDs and secrets
+func (s *MemoryAPIKeyStore) Create(key *models.APIKey) error {
+	defaultWorkspace(&key.WorkspaceID)
+	if err := s.refs.checkAPIKey(key); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, stored := range s.keys {
+		if stored.ID == key.ID || stored.Hash == key.Hash {
+			return ErrConflict
+		}
+	}
+	s.keys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+// GetByID retrieves an API key by its ID
+func (s *MemoryAPIKeyStore) GetByID(id string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+// GetByHash retrieves the API key whose secret has the given hash
+func (s *MemoryAPIKeyStore) GetByHash(hash string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Revoke marks an API key revoked at the given time, unless it already is
+func (s *MemoryAPIKeyStore) Revoke(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		revokedAt := at.UTC()
+		key.RevokedAt = &revokedAt
+	}
+	return nil
+}
+
+// RevokeByAgentID revokes every active token of an agent at the given time
+func (s *MemoryAPIKeyStore) RevokeByAgentID(agentID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.AgentID == agentID && key.RevokedAt == nil {
+			revokedAt := at.UTC()
+			key.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// Count returns how many API keys exist, revoked or not
+func (s *MemoryAPIKeyStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.keys), nil
+}
+
+// List retrieves one page of API keys
+func (s *MemoryAPIKeyStore) List(page PageRequest) (*Page[*models.APIKey], error) {
+	keys := s.filter(func(*models.APIKey) bool { return true })
+	return paginate(keys, page, apiKeyCursor), nil
+}
+
+// filter returns copies of the matching keys ordered by creation time
+func (s *MemoryAPIKeyStore) filter(keep func(*models.APIKey) bool) []*models.APIKey {
+	s.mu.RLock()
+	keys := make([]*models.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		if keep(key) {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	s.mu.RUnlock()
+
+	sortByCursor(keys, apiKeyCursor)
+	return keys
+}
+
+// removeWhere deletes the matching keys
+func (s *MemoryAPIKeyStore) removeWhere(match func(*models.APIKey) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, key := range s.keys {
+		if match(key) {
+			delete(s.keys, id)
+		}
+	}
+}
+
+// MemoryWorkspaceStore keeps workspaces in memory
+type MemoryWorkspaceStore struct {
+	mu         sync.RWMutex
+	workspaces map[string]*models.Workspace
+	refs       *memoryRelations
+}
+
+// NewMemoryWorkspaceStore creates an empty MemoryWorkspaceStore
+func NewMemoryWorkspaceStore() *MemoryWorkspaceStore {
+	return &MemoryWorkspaceStore{workspaces: make(map[string]*models.Workspace)}
+}
+
+// Create stores a new workspace, refusing duplicate IDs
+func (s *MemoryWorkspaceStore) Create(workspace *models.Workspace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[workspace.ID]; ok {
+		return ErrConflict
+	}
+	copied := *workspace
+	s.workspaces[workspace.ID] = &copied
+	return nil
+}
+
+// GetByID retrieves a workspace by its ID
+func (s *MemoryWorkspaceStore) GetByID(id string) (*models.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *workspace
+	return &copied, nil
+}
+
+// GetQuotas retrieves a workspace's quotas
+func (s *MemoryWorkspaceStore) GetQuotas(id string) (models.Quotas, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, ok := s.workspaces[id]
+	if !ok {
+		return models.Quotas{}, ErrNotFound
+	}
+	return workspace.Quotas, nil
+}
+
+// Update replaces an existing workspace's name and quotas
+func (s *MemoryWorkspaceStore) Update(workspace *models.Workspace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.workspaces[workspace.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Name = workspace.Name
+	stored.Quotas = workspace.Quotas
+	return nil
+}
+
+// Delete removes a workspace with its users and API keys. Workspaces that
+// still have sessions or templates cannot be deleted.
+func (s *MemoryWorkspaceStore) Delete(id string) error {
+	if !s.has(id) {
+		return ErrNotFound
+	}
+	if err := s.refs.deletingWorkspace(id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.workspaces, id)
+	s.mu.Unlock()
+	s.refs.workspaceDeleted(id)
+	return nil
+}
+
+// List retrieves one page of workspaces
+func (s *MemoryWorkspaceStore) List(page PageRequest) (*Page[*models.Workspace], error) {
+	s.mu.RLock()
+	workspaces := make([]*models.Workspace, 0, len(s.workspaces))
+	for _, workspace := range s.workspaces {
+		copied := *workspace
+		workspaces = append(workspaces, &copied)
+	}
+	s.mu.RUnlock()
+
+	sortByCursor(workspaces, workspaceCursor)
+	return paginate(workspaces, page, workspaceCursor), nil
+}
+
+func (s *MemoryWorkspaceStore) has(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.workspaces[id]
+	return ok
+}
+
+// defaultWorkspace puts a record naming no workspace in the default one
+func defaultWorkspace(workspaceID *string) {
+	if *workspaceID == "" {
+		*workspaceID = models.DefaultWorkspaceID
+	}
+}
+
+// copyAPIKey copies a key along with its scopes
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	copied := *key
+	copied.Scopes = append([]models.Scope(nil), key.Scopes...)
+	return &copied
+}
+
+// sortByCursor orders items by creation time, then ID
+func sortByCursor[T any](items []T, cursorOf func(T) Cursor) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return compareCursors(cursorOf(items[i]), cursorOf(items[j])) < 0
+	})
+}
+
+// without returns ids with id removed
+func without(ids []string, id string) []string {
+	for i, existing := range ids {
+		if existing == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,242 @@
+package repositories
+
+import (
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// memoryRelations enforces between the stores of one memory Store the same
+// foreign keys and delete policies as the SQL schema. Stores created on
+// their own have no relations and accept any reference.
+type memoryRelations struct {
+	agents     *MemoryAgentStore
+	templates  *MemoryTemplateStore
+	users      *MemoryUserStore
+	sessions   *MemorySessionStore
+	messages   *MemoryMessageStore
+	reasoning  *MemoryReasoningStore
+	apiKeys    *MemoryAPIKeyStore
+	workspaces *MemoryWorkspaceStore
+}
+
+// reference is an optional link from one record to another
+type reference struct {
+	id    string
+	store interface{ has(id string) bool }
+}
+
+// requireAll returns ErrInvalidReference unless every reference is empty or
+// names a stored record
+func requireAll(refs ...reference) error {
+	for _, ref := range refs {
+		if ref.id != "" && !ref.store.has(ref.id) {
+			return ErrInvalidReference
+		}
+	}
+	return nil
+}
+
+func (r *memoryRelations) checkWorkspace(id string) error {
+	if r == nil {
+		return nil
+	}
+	return requireAll(reference{id, r.workspaces})
+}
+
+func (r *memoryRelations) checkAgent(agent *models.Agent) error {
+	if r == nil {
+		return nil
+	}
+	return requireAll(reference{agent.SessionID, r.sessions}, reference{agent.TemplateID, r.templates})
+}
+
+func (r *memoryRelations) checkMessage(message *models.Message) error {
+	if r == nil {
+		return nil
+	}
+	if !r.sessions.has(message.SessionID) {
+		return ErrInvalidReference
+	}
+	return requireAll(
+		reference{message.AgentID, r.agents},
+		reference{message.UserID, r.users},
+		reference{message.ParentID, r.messages},
+	)
+}
+
+func (r *memoryRelations) checkMember(member *models.Participant) error {
+	if r == nil {
+		return nil
+	}
+	if !r.sessions.has(member.SessionID) || !r.users.has(member.ID) {
+		return ErrInvalidReference
+	}
+	return nil
+}
+
+func (r *memoryRelations) checkReasoning(entry *models.ReasoningEntry) error {
+	if r == nil {
+		return nil
+	}
+	if !r.agents.has(entry.AgentID) {
+		return ErrInvalidReference
+	}
+	return requireAll(reference{entry.SessionID, r.sessions}, reference{entry.MessageID, r.messages})
+}
+
+func (r *memoryRelations) checkAPIKey(key *models.APIKey) error {
+	if r == nil {
+		return nil
+	}
+	return requireAll(
+		reference{key.SessionID, r.sessions},
+		reference{key.AgentID, r.agents},
+		reference{key.UserID, r.users},
+		reference{key.WorkspaceID, r.workspaces},
+	)
+}
+
+// deletingSession refuses to delete a session whose agents wrote messages
+// or whose messages have replies in other sessions
+func (r *memoryRelations) deletingSession(id string) error {
+	if r == nil {
+		return nil
+	}
+	agents := idSet(r.agents.ids(func(agent *models.Agent) bool { return agent.SessionID == id }))
+	inSession := idSet(r.messages.ids(func(message *models.Message) bool { return message.SessionID == id }))
+	outside := r.messages.filter(func(message *models.Message) bool {
+		return message.SessionID != id && (agents[message.AgentID] || inSession[message.ParentID])
+	})
+	if len(outside) > 0 {
+		return ErrReferenced
+	}
+	return nil
+}
+
+// sessionDeleted removes a deleted session's messages, members, agents and
+// the API keys restricted to it
+func (r *memoryRelations) sessionDeleted(id string) {
+	if r == nil {
+		return
+	}
+	r.apiKeys.removeWhere(func(key *models.APIKey) bool { return key.SessionID == id })
+	messages := idSet(r.messages.removeWhere(func(message *models.Message) bool { return message.SessionID == id }))
+	r.users.removeMembers(func(member *models.Participant) bool { return member.SessionID == id })
+	agents := idSet(r.agents.removeWhere(func(agent *models.Agent) bool { return agent.SessionID == id }))
+	r.reasoning.removeWhere(func(entry *models.ReasoningEntry) bool { return agents[entry.AgentID] })
+	r.reasoning.detach(func(entry *models.ReasoningEntry) {
+		if entry.SessionID == id {
+			entry.SessionID = ""
+		}
+		if messages[entry.MessageID] {
+			entry.MessageID = ""
+		}
+	})
+}
+
+// deletingAgent refuses to delete an agent that wrote messages
+func (r *memoryRelations) deletingAgent(id string) error {
+	if r == nil {
+		return nil
+	}
+	if len(r.messages.ids(func(message *models.Message) bool { return message.AgentID == id })) > 0 {
+		return ErrReferenced
+	}
+	return nil
+}
+
+// agentDeleted removes a deleted agent's reasoning and tokens
+func (r *memoryRelations) agentDeleted(id string) {
+	if r == nil {
+		return
+	}
+	r.apiKeys.removeWhere(func(key *models.APIKey) bool { return key.AgentID == id })
+	r.reasoning.removeWhere(func(entry *models.ReasoningEntry) bool { return entry.AgentID == id })
+}
+
+// deletingUser refuses to delete a user who wrote messages
+func (r *memoryRelations) deletingUser(id string) error {
+	if r == nil {
+		return nil
+	}
+	if len(r.messages.ids(func(message *models.Message) bool { return message.UserID == id })) > 0 {
+		return ErrReferenced
+	}
+	return nil
+}
+
+// userDeleted removes the API keys acting for a deleted user
+func (r *memoryRelations) userDeleted(id string) {
+	if r == nil {
+		return
+	}
+	r.apiKeys.removeWhere(func(key *models.APIKey) bool { return key.UserID == id })
+}
+
+// deletingMessage refuses to delete a message that has replies
+func (r *memoryRelations) deletingMessage(id string) error {
+	if r == nil {
+		return nil
+	}
+	if len(r.messages.ids(func(message *models.Message) bool { return message.ParentID == id })) > 0 {
+		return ErrReferenced
+	}
+	return nil
+}
+
+// messageDeleted clears reasoning entries' references to a deleted message
+func (r *memoryRelations) messageDeleted(id string) {
+	if r == nil {
+		return
+	}
+	r.reasoning.detach(func(entry *models.ReasoningEntry) {
+		if entry.MessageID == id {
+			entry.MessageID = ""
+		}
+	})
+}
+
+// templateDeleted clears agents' references to a deleted template
+func (r *memoryRelations) templateDeleted(id string) {
+	if r == nil {
+		return
+	}
+	r.agents.detach(func(agent *models.Agent) {
+		if agent.TemplateID == id {
+			agent.TemplateID = ""
+		}
+	})
+}
+
+// deletingWorkspace refuses to delete a workspace that still has sessions
+// or templates
+func (r *memoryRelations) deletingWorkspace(id string) error {
+	if r == nil {
+		return nil
+	}
+	sessions := r.sessions.filter(func(session *models.Session) bool { return session.WorkspaceID == id })
+	templates := r.templates.filter(func(template *models.AgentTemplate) bool { return template.WorkspaceID == id })
+	if len(sessions) > 0 || len(templates) > 0 {
+		return ErrReferenced
+	}
+	return nil
+}
+
+// workspaceDeleted removes a deleted workspace's API keys and users
+func (r *memoryRelations) workspaceDeleted(id string) {
+	if r == nil {
+		return
+	}
+	r.apiKeys.removeWhere(func(key *models.APIKey) bool { return key.WorkspaceID == id })
+	for _, user := range r.users.filter(func(user *models.User) bool { return user.WorkspaceID == id }) {
+		r.users.Delete(user.ID)
+	}
+}
+
+// idSet indexes ids for lookups
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
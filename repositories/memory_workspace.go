@@ -0,0 +1,597 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// memoryWorkspace tells which records of a memory Store belong to one
+// workspace. Sessions, templates, keys and users name their workspace;
+// other records belong to the workspace of their session or agent.
+type memoryWorkspace struct {
+	id   string
+	refs *memoryRelations
+}
+
+// sessionIDs returns the IDs of the workspace's sessions
+func (w memoryWorkspace) sessionIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, session := range w.refs.sessions.filter(w.ownsSession) {
+		ids[session.ID] = true
+	}
+	return ids
+}
+
+func (w memoryWorkspace) ownsSession(session *models.Session) bool {
+	return session.WorkspaceID == w.id
+}
+
+func (w memoryWorkspace) hasSession(id string) bool {
+	session, err := w.refs.sessions.GetByID(id)
+	return err == nil && w.ownsSession(session)
+}
+
+func (w memoryWorkspace) hasTemplate(id string) bool {
+	template, err := w.refs.templates.GetByID(id)
+	return err == nil && template.WorkspaceID == w.id
+}
+
+func (w memoryWorkspace) hasUser(id string) bool {
+	user, err := w.refs.users.GetByID(id)
+	return err == nil && user.WorkspaceID == w.id
+}
+
+func (w memoryWorkspace) hasAgent(id string) bool {
+	agent, err := w.refs.agents.GetByID(id)
+	return err == nil && w.hasSession(agent.SessionID)
+}
+
+func (w memoryWorkspace) hasMessage(id string) bool {
+	message, err := w.refs.messages.GetByID(id)
+	return err == nil && w.hasSession(message.SessionID)
+}
+
+// requireIn returns ErrInvalidReference when id names a record that in
+// does not find in the workspace
+func requireIn(id string, in func(id string) bool) error {
+	if id != "" && !in(id) {
+		return ErrInvalidReference
+	}
+	return nil
+}
+
+// workspaceSessions limits a MemorySessionStore to one workspace
+type workspaceSessions struct {
+	store *MemorySessionStore
+	w     memoryWorkspace
+}
+
+// Create stores a new session in the workspace
+func (s workspaceSessions) Create(session *models.Session) error {
+	session.WorkspaceID = s.w.id
+	return s.store.Create(session)
+}
+
+// GetByID retrieves one of the workspace's sessions by its ID
+func (s workspaceSessions) GetByID(id string) (*models.Session, error) {
+	if !s.w.hasSession(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.GetByID(id)
+}
+
+// Update stores a changed session of the workspace as its next version
+func (s workspaceSessions) Update(session *models.Session) error {
+	if !s.w.hasSession(session.ID) {
+		return ErrNotFound
+	}
+	return s.store.Update(session)
+}
+
+// Touch records a heartbeat for one of the workspace's sessions
+func (s workspaceSessions) Touch(id string, at time.Time) (*models.Session, error) {
+	if !s.w.hasSession(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.Touch(id, at)
+}
+
+// Delete removes one of the workspace's sessions
+func (s workspaceSessions) Delete(id string) error {
+	if !s.w.hasSession(id) {
+		return ErrNotFound
+	}
+	return s.store.Delete(id)
+}
+
+// ListAll retrieves the workspace's sessions in creation order
+func (s workspaceSessions) ListAll() ([]*models.Session, error) {
+	return s.store.filter(s.w.ownsSession), nil
+}
+
+// List retrieves one page of the workspace's sessions
+func (s workspaceSessions) List(page PageRequest) (*Page[*models.Session], error) {
+	sessions := s.store.filter(s.w.ownsSession)
+	sortByCursor(sessions, sessionCursor)
+	return paginate(sessions, page, sessionCursor), nil
+}
+
+// ListByMember retrieves one page of the workspace's sessions a user is a member of
+func (s workspaceSessions) ListByMember(userID string, page PageRequest) (*Page[*models.Session], error) {
+	joined := idSet(s.w.refs.users.sessionIDs(userID))
+	sessions := s.store.filter(func(session *models.Session) bool { return joined[session.ID] && s.w.ownsSession(session) })
+	sortByCursor(sessions, sessionCursor)
+	return paginate(sessions, page, sessionCursor), nil
+}
+
+// GetActiveSessions retrieves the workspace's active sessions
+func (s workspaceSessions) GetActiveSessions(timeout time.Duration) ([]*models.Session, error) {
+	cutoffTime := time.Now().Add(-timeout)
+	return s.store.filter(func(session *models.Session) bool {
+		return s.w.ownsSession(session) && session.LastHeartbeat.After(cutoffTime)
+	}), nil
+}
+
+// GetInactiveSessions retrieves the workspace's sessions whose last heartbeat is older than the timeout
+func (s workspaceSessions) GetInactiveSessions(timeout time.Duration) ([]*models.Session, error) {
+	cutoffTime := time.Now().Add(-timeout)
+	return s.store.filter(func(session *models.Session) bool {
+		return s.w.ownsSession(session) && !session.LastHeartbeat.After(cutoffTime)
+	}), nil
+}
+
+// Count returns how many sessions the workspace has
+func (s workspaceSessions) Count() (int, error) {
+	return len(s.store.filter(s.w.ownsSession)), nil
+}
+
+// workspaceTemplates limits a MemoryTemplateStore to one workspace
+type workspaceTemplates struct {
+	store *MemoryTemplateStore
+	w     memoryWorkspace
+}
+
+// Create stores a new template in the workspace
+func (s workspaceTemplates) Create(template *models.AgentTemplate) error {
+	template.WorkspaceID = s.w.id
+	return s.store.Create(template)
+}
+
+// GetByID retrieves one of the workspace's templates by its ID
+func (s workspaceTemplates) GetByID(id string) (*models.AgentTemplate, error) {
+	if !s.w.hasTemplate(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.GetByID(id)
+}
+
+// Update stores a revised template of the workspace
+func (s workspaceTemplates) Update(template *models.AgentTemplate) error {
+	if !s.w.hasTemplate(template.ID) {
+		return ErrNotFound
+	}
+	return s.store.Update(template)
+}
+
+// Delete removes one of the workspace's templates
+func (s workspaceTemplates) Delete(id string) error {
+	if !s.w.hasTemplate(id) {
+		return ErrNotFound
+	}
+	return s.store.Delete(id)
+}
+
+// List retrieves one page of the workspace's templates
+func (s workspaceTemplates) List(page PageRequest) (*Page[*models.AgentTemplate], error) {
+	templates := s.store.filter(func(template *models.AgentTemplate) bool { return template.WorkspaceID == s.w.id })
+	return paginate(templates, page, templateCursor), nil
+}
+
+// workspaceAgents limits a MemoryAgentStore to the agents of one workspace's sessions
+type workspaceAgents struct {
+	store *MemoryAgentStore
+	w     memoryWorkspace
+}
+
+// Create stores a new agent in one of the workspace's sessions
+func (s workspaceAgents) Create(agent *models.Agent) error {
+	if err := s.check(agent); err != nil {
+		return err
+	}
+	return s.store.Create(agent)
+}
+
+// GetByID retrieves one of the workspace's agents by its ID
+func (s workspaceAgents) GetByID(id string) (*models.Agent, error) {
+	if !s.w.hasAgent(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.GetByID(id)
+}
+
+// Update stores a changed agent of the workspace as its next version
+func (s workspaceAgents) Update(agent *models.Agent) error {
+	if !s.w.hasAgent(agent.ID) {
+		return ErrNotFound
+	}
+	if err := s.check(agent); err != nil {
+		return err
+	}
+	return s.store.Update(agent)
+}
+
+// Delete removes one of the workspace's agents
+func (s workspaceAgents) Delete(id string) error {
+	if !s.w.hasAgent(id) {
+		return ErrNotFound
+	}
+	return s.store.Delete(id)
+}
+
+// SetOnline changes only the online status of one of the workspace's agents
+func (s workspaceAgents) SetOnline(id string, isOnline bool) (*models.Agent, error) {
+	if !s.w.hasAgent(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.SetOnline(id, isOnline)
+}
+
+// ListAll retrieves the workspace's agents in creation order
+func (s workspaceAgents) ListAll() ([]*models.Agent, error) {
+	return s.filter(func(*models.Agent) bool { return true }), nil
+}
+
+// List retrieves one page of the workspace's agents
+func (s workspaceAgents) List(page PageRequest) (*Page[*models.Agent], error) {
+	agents := s.filter(func(*models.Agent) bool { return true })
+	sortByCursor(agents, agentCursor)
+	return paginate(agents, page, agentCursor), nil
+}
+
+// GetBySessionID retrieves the agents of one of the workspace's sessions
+func (s workspaceAgents) GetBySessionID(sessionID string) ([]*models.Agent, error) {
+	return s.filter(func(agent *models.Agent) bool { return agent.SessionID == sessionID }), nil
+}
+
+// GetByTemplateID retrieves the workspace's agents made from a template
+func (s workspaceAgents) GetByTemplateID(templateID string) ([]*models.Agent, error) {
+	return s.filter(func(agent *models.Agent) bool { return agent.TemplateID == templateID }), nil
+}
+
+// Count returns how many agents the workspace has
+func (s workspaceAgents) Count() (int, error) {
+	return len(s.filter(func(*models.Agent) bool { return true })), nil
+}
+
+// check refuses an agent whose session or template is outside the workspace
+func (s workspaceAgents) check(agent *models.Agent) error {
+	if err := requireIn(agent.SessionID, s.w.hasSession); err != nil {
+		return err
+	}
+	return requireIn(agent.TemplateID, s.w.hasTemplate)
+}
+
+// filter returns the workspace's agents that keep matches
+func (s workspaceAgents) filter(keep func(*models.Agent) bool) []*models.Agent {
+	sessions := s.w.sessionIDs()
+	return s.store.filter(func(agent *models.Agent) bool { return sessions[agent.SessionID] && keep(agent) })
+}
+
+// workspaceUsers limits a MemoryUserStore to one workspace's users and
+// the memberships of its sessions
+type workspaceUsers struct {
+	store *MemoryUserStore
+	w     memoryWorkspace
+}
+
+// Create stores a new user in the workspace
+func (s workspaceUsers) Create(user *models.User) error {
+	user.WorkspaceID = s.w.id
+	return s.store.Create(user)
+}
+
+// GetByID retrieves one of the workspace's users by its ID
+func (s workspaceUsers) GetByID(id string) (*models.User, error) {
+	if !s.w.hasUser(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.GetByID(id)
+}
+
+// Update replaces one of the workspace's users
+func (s workspaceUsers) Update(user *models.User) error {
+	if !s.w.hasUser(user.ID) {
+		return ErrNotFound
+	}
+	return s.store.Update(user)
+}
+
+// Delete removes one of the workspace's users and their session memberships
+func (s workspaceUsers) Delete(id string) error {
+	if !s.w.hasUser(id) {
+		return ErrNotFound
+	}
+	return s.store.Delete(id)
+}
+
+// List retrieves one page of the workspace's users
+func (s workspaceUsers) List(page PageRequest) (*Page[*models.User], error) {
+	users := s.store.filter(func(user *models.User) bool { return user.WorkspaceID == s.w.id })
+	return paginate(users, page, userCursor), nil
+}
+
+// AddMember records a user joining one of the workspace's sessions
+func (s workspaceUsers) AddMember(member *models.Participant) error {
+	if err := requireIn(member.SessionID, s.w.hasSession); err != nil {
+		return err
+	}
+	if err := requireIn(member.ID, s.w.hasUser); err != nil {
+		return err
+	}
+	return s.store.AddMember(member)
+}
+
+// GetMember retrieves a user's membership of one of the workspace's sessions
+func (s workspaceUsers) GetMember(sessionID, userID string) (*models.Participant, error) {
+	if !s.w.hasSession(sessionID) {
+		return nil, ErrNotFound
+	}
+	return s.store.GetMember(sessionID, userID)
+}
+
+// SetMemberOnline updates a user's presence in one of the workspace's sessions
+func (s workspaceUsers) SetMemberOnline(sessionID, userID string, isOnline bool) error {
+	if !s.w.hasSession(sessionID) {
+		return ErrNotFound
+	}
+	return s.store.SetMemberOnline(sessionID, userID, isOnline)
+}
+
+// SetMemberRole changes a user's role in one of the workspace's sessions
+func (s workspaceUsers) SetMemberRole(sessionID, userID string, role models.SessionRole) error {
+	if !s.w.hasSession(sessionID) {
+		return ErrNotFound
+	}
+	return s.store.SetMemberRole(sessionID, userID, role)
+}
+
+// RemoveMember takes a user out of one of the workspace's sessions
+func (s workspaceUsers) RemoveMember(sessionID, userID string) error {
+	if !s.w.hasSession(sessionID) {
+		return ErrNotFound
+	}
+	return s.store.RemoveMember(sessionID, userID)
+}
+
+// GetBySessionID retrieves the users who joined one of the workspace's sessions
+func (s workspaceUsers) GetBySessionID(sessionID string) ([]*models.Participant, error) {
+	if !s.w.hasSession(sessionID) {
+		return nil, nil
+	}
+	return s.store.GetBySessionID(sessionID)
+}
+
+// workspaceMessages limits a MemoryMessageStore to the messages of one
+// workspace's sessions
+type workspaceMessages struct {
+	store *MemoryMessageStore
+	w     memoryWorkspace
+}
+
+// Create stores a new message in one of the workspace's sessions
+func (s workspaceMessages) Create(message *models.Message) error {
+	if err := requireIn(message.SessionID, s.w.hasSession); err != nil {
+		return err
+	}
+	if err := requireIn(message.AgentID, s.w.hasAgent); err != nil {
+		return err
+	}
+	if err := requireIn(message.UserID, s.w.hasUser); err != nil {
+		return err
+	}
+	if err := requireIn(message.ParentID, s.w.hasMessage); err != nil {
+		return err
+	}
+	return s.store.Create(message)
+}
+
+// GetByID retrieves one of the workspace's messages by its ID
+func (s workspaceMessages) GetByID(id string) (*models.Message, error) {
+	if !s.w.hasMessage(id) {
+		return nil, ErrNotFound
+	}
+	return s.store.GetByID(id)
+}
+
+// Update stores an edited message of the workspace
+func (s workspaceMessages) Update(message *models.Message) error {
+	if !s.w.hasMessage(message.ID) {
+		return ErrNotFound
+	}
+	return s.store.Update(message)
+}
+
+// Delete removes one of the workspace's messages
+func (s workspaceMessages) Delete(id string) error {
+	if !s.w.hasMessage(id) {
+		return ErrNotFound
+	}
+	return s.store.Delete(id)
+}
+
+// GetRevisions retrieves every revision of one of the workspace's messages
+func (s workspaceMessages) GetRevisions(messageID string) ([]*models.MessageRevision, error) {
+	if !s.w.hasMessage(messageID) {
+		return nil, nil
+	}
+	return s.store.GetRevisions(messageID)
+}
+
+// GetBySessionID retrieves the messages of one of the workspace's sessions
+func (s workspaceMessages) GetBySessionID(sessionID string) ([]*models.Message, error) {
+	if !s.w.hasSession(sessionID) {
+		return nil, nil
+	}
+	return s.store.GetBySessionID(sessionID)
+}
+
+// GetByAgentID retrieves an agent's messages in the workspace
+func (s workspaceMessages) GetByAgentID(agentID string) ([]*models.Message, error) {
+	return s.filter(func(message *models.Message) bool { return message.AgentID == agentID }), nil
+}
+
+// ListBySessionID retrieves one page of the messages of one of the workspace's sessions
+func (s workspaceMessages) ListBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error) {
+	messages, _ := s.GetBySessionID(sessionID)
+	return paginate(messages, page, messageCursor), nil
+}
+
+// ListByAgentID retrieves one page of an agent's messages in the workspace
+func (s workspaceMessages) ListByAgentID(agentID string, page PageRequest) (*Page[*models.Message], error) {
+	messages, _ := s.GetByAgentID(agentID)
+	return paginate(messages, page, messageCursor), nil
+}
+
+// ListThreadsBySessionID retrieves one page of the top-level messages of
+// one of the workspace's sessions
+func (s workspaceMessages) ListThreadsBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error) {
+	if !s.w.hasSession(sessionID) {
+		return paginate([]*models.Message(nil), page, messageCursor), nil
+	}
+	return s.store.ListThreadsBySessionID(sessionID, page)
+}
+
+// GetThread retrieves the replies in a thread of the workspace, oldest first
+func (s workspaceMessages) GetThread(rootID string) ([]*models.Message, error) {
+	return s.filter(func(message *models.Message) bool { return message.ThreadRootID == rootID }), nil
+}
+
+// GetMessagesAfter retrieves the messages of one of the workspace's
+// sessions created after a specific time
+func (s workspaceMessages) GetMessagesAfter(sessionID string, after time.Time) ([]*models.Message, error) {
+	if !s.w.hasSession(sessionID) {
+		return nil, nil
+	}
+	return s.store.GetMessagesAfter(sessionID, after)
+}
+
+// Search finds the workspace's messages containing every term of the query
+func (s workspaceMessages) Search(query SearchQuery) ([]*SearchHit, error) {
+	sessions := s.w.sessionIDs()
+	return s.store.search(query, func(message *models.Message) bool { return sessions[message.SessionID] }), nil
+}
+
+// Count returns how many messages the workspace has
+func (s workspaceMessages) Count() (int, error) {
+	return len(s.filter(func(*models.Message) bool { return true })), nil
+}
+
+// CountBySessionID counts the messages posted in one of the workspace's sessions
+func (s workspaceMessages) CountBySessionID(sessionID string) (int, error) {
+	if !s.w.hasSession(sessionID) {
+		return 0, nil
+	}
+	return s.store.CountBySessionID(sessionID)
+}
+
+// filter returns the workspace's messages that keep matches
+func (s workspaceMessages) filter(keep func(*models.Message) bool) []*models.Message {
+	sessions := s.w.sessionIDs()
+	return s.store.filter(func(message *models.Message) bool { return sessions[message.SessionID] && keep(message) })
+}
+
+// workspaceReasoning limits a MemoryReasoningStore to the reasoning of one
+// workspace's agents
+type workspaceReasoning struct {
+	store *MemoryReasoningStore
+	w     memoryWorkspace
+}
+
+// Create stores a new reasoning entry for one of the workspace's agents
+func (s workspaceReasoning) Create(entry *models.ReasoningEntry) error {
+	if err := requireIn(entry.AgentID, s.w.hasAgent); err != nil {
+		return err
+	}
+	return s.store.Create(entry)
+}
+
+// ListByAgentID retrieves one page of the reasoning of one of the workspace's agents
+func (s workspaceReasoning) ListByAgentID(agentID string, filter ReasoningFilter, page PageRequest) (*Page[*models.ReasoningEntry], error) {
+	if !s.w.hasAgent(agentID) {
+		return paginate([]*models.ReasoningEntry(nil), page, reasoningCursor), nil
+	}
+	return s.store.ListByAgentID(agentID, filter, page)
+}
+
+// workspaceAPIKeys limits a MemoryAPIKeyStore to one workspace
+type workspaceAPIKeys struct {
+	store *MemoryAPIKeyStore
+	w     memoryWorkspace
+}
+
+// Create stores a new API key in the workspace, restricted to its records
+func (s workspaceAPIKeys) Create(key *models.APIKey) error {
+	key.WorkspaceID = s.w.id
+	if err := requireIn(key.SessionID, s.w.hasSession); err != nil {
+		return err
+	}
+	if err := requireIn(key.AgentID, s.w.hasAgent); err != nil {
+		return err
+	}
+	if err := requireIn(key.UserID, s.w.hasUser); err != nil {
+		return err
+	}
+	return s.store.Create(key)
+}
+
+// GetByID retrieves one of the workspace's keys by its ID
+func (s workspaceAPIKeys) GetByID(id string) (*models.APIKey, error) {
+	return s.owned(s.store.GetByID(id))
+}
+
+// GetByHash retrieves the workspace's key whose secret has the given hash
+func (s workspaceAPIKeys) GetByHash(hash string) (*models.APIKey, error) {
+	return s.owned(s.store.GetByHash(hash))
+}
+
+// Revoke marks one of the workspace's keys revoked at the given time
+func (s workspaceAPIKeys) Revoke(id string, at time.Time) error {
+	if _, err := s.GetByID(id); err != nil {
+		return err
+	}
+	return s.store.Revoke(id, at)
+}
+
+// RevokeByAgentID revokes every active token of one of the workspace's agents
+func (s workspaceAPIKeys) RevokeByAgentID(agentID string, at time.Time) error {
+	if !s.w.hasAgent(agentID) {
+		return nil
+	}
+	return s.store.RevokeByAgentID(agentID, at)
+}
+
+// Count returns how many keys the workspace has, revoked or not
+func (s workspaceAPIKeys) Count() (int, error) {
+	return len(s.store.filter(s.ownsKey)), nil
+}
+
+// List retrieves one page of the workspace's keys
+func (s workspaceAPIKeys) List(page PageRequest) (*Page[*models.APIKey], error) {
+	return paginate(s.store.filter(s.ownsKey), page, apiKeyCursor), nil
+}
+
+func (s workspaceAPIKeys) ownsKey(key *models.APIKey) bool {
+	return key.WorkspaceID == s.w.id
+}
+
+// owned hides a key of another workspace
+func (s workspaceAPIKeys) owned(key *models.APIKey, err error) (*models.APIKey, error) {
+	if err != nil {
+		return nil, err
+	}
+	if !s.ownsKey(key) {
+		return nil, ErrNotFound
+	}
+	return key, nil
+}
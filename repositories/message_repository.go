@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/chatcollab/chatcollab/db"
@@ -8,73 +10,276 @@ import (
 )
 
 // MessageRepository handles database operations for messages
-type MessageRepository struct{}
+type MessageRepository struct {
+	db sqlConn
+}
+
+// NewMessageRepository creates a new MessageRepository
+func NewMessageRepository(conn *sql.DB, dialect db.Dialect) *MessageRepository {
+	return &MessageRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
 
-// Create inserts a new message into the database
+// Create inserts a new message into the database along with its first revision
 func (r *MessageRepository) Create(message *models.Message) error {
-	_, err := db.DB.Exec(
-		"INSERT INTO messages (id, created_at, content, agent_id, session_id) VALUES (?, ?, ?, ?, ?)",
-		message.ID, message.CreatedAt, message.Content, message.AgentID, message.SessionID,
-	)
-	return err
+	return invalidReference(r.db.inTx(func(tx sqlConn) error {
+		if err := tx.reachable("sessions", inWorkspace, message.SessionID); err != nil {
+			return err
+		}
+		if err := tx.reachable("agents", sessionInWorkspace, message.AgentID); err != nil {
+			return err
+		}
+		if err := tx.reachable("users", inWorkspace, message.UserID); err != nil {
+			return err
+		}
+		if err := tx.reachable("messages", sessionInWorkspace, message.ParentID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO messages (id, created_at, content, agent_id, user_id, session_id, parent_id, thread_root_id, revision) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			message.ID, message.CreatedAt.UTC(), message.Content, nullString(message.AgentID), nullString(message.UserID), message.SessionID,
+			nullString(message.ParentID), nullString(message.ThreadRootID), message.Revision,
+		)
+		if err != nil {
+			return err
+		}
+		return insertRevision(tx, message.CurrentRevision())
+	}))
 }
 
 // GetByID retrieves a message by its ID
 func (r *MessageRepository) GetByID(id string) (*models.Message, error) {
-	var message models.Message
-	err := db.DB.QueryRow(
-		"SELECT id, created_at, content, agent_id, session_id FROM messages WHERE id = ?",
-		id,
-	).Scan(&message.ID, &message.CreatedAt, &message.Content, &message.AgentID, &message.SessionID)
+	scope, args := r.db.scope(sessionInWorkspace)
+	message, err := scanMessage(r.db.QueryRow("SELECT "+messageColumns+" FROM messages WHERE id = ?"+scope+r.db.forUpdate(), append([]interface{}{id}, args...)...))
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
-	return &message, nil
+	return message, nil
 }
 
-// Update updates an existing message
+// Update stores an edited message and records its new revision. The stored
+// message must still be at the previous revision, otherwise ErrConflict is returned.
 func (r *MessageRepository) Update(message *models.Message) error {
-	_, err := db.DB.Exec(
-		"UPDATE messages SET content = ? WHERE id = ?",
-		message.Content, message.ID,
-	)
-	return err
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.db.inTx(func(tx sqlConn) error {
+		var editedAt interface{}
+		if message.EditedAt != nil {
+			editedAt = message.EditedAt.UTC()
+		}
+		err := expectRow(tx.Exec(
+			"UPDATE messages SET content = ?, revision = ?, edited_at = ?, edited_by = ? WHERE id = ? AND revision = ?"+scope,
+			append([]interface{}{message.Content, message.Revision, editedAt, nullString(message.EditedBy), message.ID, message.Revision - 1}, args...)...,
+		))
+		if err == ErrNotFound {
+			err = versionConflict(tx, "messages", message.ID, sessionInWorkspace)
+		}
+		if err != nil {
+			return err
+		}
+		return insertRevision(tx, message.CurrentRevision())
+	})
 }
 
-// Delete removes a message from the database
+// Delete removes a message and its revisions from the database. Messages
+// with replies cannot be deleted.
 func (r *MessageRepository) Delete(id string) error {
-	_, err := db.DB.Exec("DELETE FROM messages WHERE id = ?", id)
+	scope, args := r.db.scope(sessionInWorkspace)
+	return referenced(expectRow(r.db.Exec("DELETE FROM messages WHERE id = ?"+scope, append([]interface{}{id}, args...)...)))
+}
+
+// GetRevisions retrieves every revision of a message, oldest first
+func (r *MessageRepository) GetRevisions(messageID string) ([]*models.MessageRevision, error) {
+	scope, args := r.db.scope("message_id IN (SELECT id FROM messages WHERE " + sessionInWorkspace + ")")
+	rows, err := r.db.Query(
+		"SELECT message_id, revision, content, editor_id, created_at FROM message_revisions WHERE message_id = ?"+scope+" ORDER BY revision",
+		append([]interface{}{messageID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*models.MessageRevision
+	for rows.Next() {
+		var revision models.MessageRevision
+		if err := rows.Scan(&revision.MessageID, &revision.Revision, &revision.Content, &revision.EditorID, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func insertRevision(tx sqlConn, revision *models.MessageRevision) error {
+	_, err := tx.Exec(
+		"INSERT INTO message_revisions (message_id, revision, content, editor_id, created_at) VALUES (?, ?, ?, ?, ?)",
+		revision.MessageID, revision.Revision, revision.Content, revision.EditorID, revision.CreatedAt.UTC(),
+	)
 	return err
 }
 
 // GetBySessionID retrieves all messages for a specific session
 func (r *MessageRepository) GetBySessionID(sessionID string) ([]*models.Message, error) {
-	rows, err := db.DB.Query(
-		"SELECT id, created_at, content, agent_id, session_id FROM messages WHERE session_id = ? ORDER BY created_at",
-		sessionID,
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query("SELECT "+messageColumns+" FROM messages WHERE session_id = ?"+scope+" ORDER BY created_at, id", append([]interface{}{sessionID}, args...)...)
+}
+
+// ListBySessionID retrieves one page of a session's messages
+func (r *MessageRepository) ListBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error) {
+	return r.list("session_id", sessionID, page)
+}
+
+// GetByAgentID retrieves all messages for a specific agent
+func (r *MessageRepository) GetByAgentID(agentID string) ([]*models.Message, error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query("SELECT "+messageColumns+" FROM messages WHERE agent_id = ?"+scope+" ORDER BY created_at, id", append([]interface{}{agentID}, args...)...)
+}
+
+// ListByAgentID retrieves one page of an agent's messages
+func (r *MessageRepository) ListByAgentID(agentID string, page PageRequest) (*Page[*models.Message], error) {
+	return r.list("agent_id", agentID, page)
+}
+
+// GetMessagesAfter retrieves all messages created after a specific time
+func (r *MessageRepository) GetMessagesAfter(sessionID string, after time.Time) ([]*models.Message, error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query(
+		"SELECT "+messageColumns+" FROM messages WHERE session_id = ? AND created_at > ?"+scope+" ORDER BY created_at, id",
+		append([]interface{}{sessionID, after.UTC()}, args...)...,
+	)
+}
+
+// Count returns how many messages exist
+func (r *MessageRepository) Count() (int, error) {
+	return r.db.count("messages", sessionInWorkspace)
+}
+
+// CountBySessionID counts the messages posted in a session
+func (r *MessageRepository) CountBySessionID(sessionID string) (int, error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	var count int
+	err := r.db.QueryRow("SELECT count(*) FROM messages WHERE session_id = ?"+scope, append([]interface{}{sessionID}, args...)...).Scan(&count)
+	return count, err
+}
+
+// Search finds messages containing every term of the query. It uses the
+// FTS5 index when SQLite was built with it, Postgres text search on
+// Postgres, and substring matching otherwise.
+func (r *MessageRepository) Search(query SearchQuery) ([]*SearchHit, error) {
+	if r.db.dialect == db.Postgres {
+		return r.searchPostgres(query)
+	}
+
+	var indexed int
+	err := r.db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", db.SearchTable).Scan(&indexed)
+	if err != nil {
+		return nil, err
+	}
+	if indexed == 0 {
+		return r.searchSubstring(query)
+	}
+
+	where, args := query.filterClause("m.")
+	scope, scopeArgs := r.db.scope("m." + sessionInWorkspace)
+	where, args = where+scope, append(args, scopeArgs...)
+	rows, err := r.db.Query(
+		`SELECT m.id, m.created_at, m.content, m.agent_id, m.user_id, m.session_id, m.parent_id, m.thread_root_id, m.revision, m.edited_at, m.edited_by,
+			snippet(messages_fts, 0, '`+highlightStart+`', '`+highlightEnd+`', '…', 16), -bm25(messages_fts)
+		FROM messages_fts JOIN messages m ON m.id = messages_fts.message_id
+		WHERE messages_fts MATCH ?`+where+`
+		ORDER BY bm25(messages_fts), m.created_at DESC LIMIT ? OFFSET ?`,
+		append(append([]interface{}{ftsQuery(query.Query)}, args...), query.Limit, query.Offset)...,
 	)
 	if err != nil {
 		return nil, err
 	}
+	return scanHits(rows)
+}
+
+func (r *MessageRepository) searchPostgres(query SearchQuery) ([]*SearchHit, error) {
+	where, args := query.filterClause("")
+	scope, scopeArgs := r.db.scope(sessionInWorkspace)
+	where, args = where+scope, append(args, scopeArgs...)
+	rows, err := r.db.Query(
+		`SELECT `+messageColumns+`,
+			ts_headline('simple', content, q, 'StartSel=`+highlightStart+`, StopSel=`+highlightEnd+`, MaxWords=24, MinWords=8'),
+			ts_rank(to_tsvector('simple', content), q) AS rank
+		FROM messages, plainto_tsquery('simple', ?) q
+		WHERE to_tsvector('simple', content) @@ q`+where+`
+		ORDER BY rank DESC, created_at DESC LIMIT ? OFFSET ?`,
+		append(append([]interface{}{strings.ReplaceAll(query.Query, "*", "")}, args...), query.Limit, query.Offset)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanHits(rows)
+}
+
+// searchSubstring narrows candidates with LIKE and ranks them by how often
+// the terms occur
+func (r *MessageRepository) searchSubstring(query SearchQuery) ([]*SearchHit, error) {
+	terms := searchTerms(query.Query)
+	where, args := query.filterClause("")
+	scope, scopeArgs := r.db.scope(sessionInWorkspace)
+	where, args = where+scope, append(args, scopeArgs...)
+	var like strings.Builder
+	var likeArgs []interface{}
+	for _, term := range terms {
+		like.WriteString(` AND content LIKE ? ESCAPE '\'`)
+		likeArgs = append(likeArgs, "%"+likeEscaper.Replace(strings.TrimRight(term, "*"))+"%")
+	}
+
+	messages, err := r.query(
+		"SELECT "+messageColumns+" FROM messages WHERE 1 = 1"+like.String()+where,
+		append(likeArgs, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []*SearchHit
+	for _, message := range messages {
+		// LIKE only folds ASCII case, so recount to rank and to drop near misses
+		if n := matchTerms(message.Content, terms); n > 0 {
+			hits = append(hits, &SearchHit{Message: message, Snippet: highlight(message.Content, terms), Rank: float64(n)})
+		}
+	}
+	return rankHits(hits, query), nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func scanHits(rows *sql.Rows) ([]*SearchHit, error) {
 	defer rows.Close()
 
-	var messages []*models.Message
+	hits := []*SearchHit{}
 	for rows.Next() {
-		var message models.Message
-		if err := rows.Scan(&message.ID, &message.CreatedAt, &message.Content, &message.AgentID, &message.SessionID); err != nil {
+		var hit SearchHit
+		message, err := scanMessage(rows, &hit.Snippet, &hit.Rank)
+		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, &message)
+		hit.Message = message
+		hits = append(hits, &hit)
 	}
+	return hits, rows.Err()
+}
 
-	return messages, nil
+// GetThread retrieves the replies in a thread, oldest first
+func (r *MessageRepository) GetThread(rootID string) ([]*models.Message, error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return r.query("SELECT "+messageColumns+" FROM messages WHERE thread_root_id = ?"+scope+" ORDER BY created_at, id", append([]interface{}{rootID}, args...)...)
 }
 
-// GetByAgentID retrieves all messages for a specific agent
-func (r *MessageRepository) GetByAgentID(agentID string) ([]*models.Message, error) {
-	rows, err := db.DB.Query(
-		"SELECT id, created_at, content, agent_id, session_id FROM messages WHERE agent_id = ? ORDER BY created_at",
-		agentID,
+// ListThreadsBySessionID retrieves one page of a session's top-level
+// messages, each with the number of replies in its thread
+func (r *MessageRepository) ListThreadsBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	rows, err := r.db.Query(
+		"SELECT "+messageColumns+", (SELECT count(*) FROM messages replies WHERE replies.thread_root_id = messages.id)"+
+			" FROM messages WHERE session_id = ? AND thread_root_id IS NULL"+scope+where+orderBy,
+		append(append([]interface{}{sessionID}, args...), keysetArgs...)...,
 	)
 	if err != nil {
 		return nil, err
@@ -83,35 +288,83 @@ func (r *MessageRepository) GetByAgentID(agentID string) ([]*models.Message, err
 
 	var messages []*models.Message
 	for rows.Next() {
-		var message models.Message
-		if err := rows.Scan(&message.ID, &message.CreatedAt, &message.Content, &message.AgentID, &message.SessionID); err != nil {
+		var replies int
+		message, err := scanMessage(rows, &replies)
+		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, &message)
+		message.ReplyCount = replies
+		messages = append(messages, message)
 	}
-
-	return messages, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPage(messages, page, messageCursor), nil
 }
 
-// GetMessagesAfter retrieves all messages created after a specific time
-func (r *MessageRepository) GetMessagesAfter(sessionID string, after time.Time) ([]*models.Message, error) {
-	rows, err := db.DB.Query(
-		"SELECT id, created_at, content, agent_id, session_id FROM messages WHERE session_id = ? AND created_at > ? ORDER BY created_at",
-		sessionID, after,
+// list reads a page of messages whose column equals value
+func (r *MessageRepository) list(column, value string, page PageRequest) (*Page[*models.Message], error) {
+	scope, args := r.db.scope(sessionInWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	messages, err := r.query(
+		"SELECT "+messageColumns+" FROM messages WHERE "+column+" = ?"+scope+where+orderBy,
+		append(append([]interface{}{value}, args...), keysetArgs...)...,
 	)
 	if err != nil {
 		return nil, err
 	}
+	return newPage(messages, page, messageCursor), nil
+}
+
+func (r *MessageRepository) query(query string, args ...interface{}) ([]*models.Message, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var messages []*models.Message
 	for rows.Next() {
-		var message models.Message
-		if err := rows.Scan(&message.ID, &message.CreatedAt, &message.Content, &message.AgentID, &message.SessionID); err != nil {
+		message, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, &message)
+		messages = append(messages, message)
 	}
 
-	return messages, nil
-}
\ No newline at end of file
+	return messages, rows.Err()
+}
+
+// messageColumns lists the columns read by scanMessage
+const messageColumns = "id, created_at, content, agent_id, user_id, session_id, parent_id, thread_root_id, revision, edited_at, edited_by"
+
+// scanMessage reads messageColumns, followed by any extra columns into extra
+func scanMessage(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.Message, error) {
+	var message models.Message
+	var agentID, userID, parentID, threadRootID, editedBy sql.NullString
+	var editedAt sql.NullTime
+	dest := append([]interface{}{
+		&message.ID, &message.CreatedAt, &message.Content, &agentID, &userID, &message.SessionID,
+		&parentID, &threadRootID, &message.Revision, &editedAt, &editedBy,
+	}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	message.AgentID = agentID.String
+	message.UserID = userID.String
+	message.AuthorType = models.ParticipantAgent
+	if userID.Valid {
+		message.AuthorType = models.ParticipantHuman
+	}
+	message.ParentID = parentID.String
+	message.ThreadRootID = threadRootID.String
+	message.EditedBy = editedBy.String
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Time
+	}
+	return &message, nil
+}
+
+func messageCursor(message *models.Message) Cursor {
+	return Cursor{CreatedAt: message.CreatedAt, ID: message.ID}
+}
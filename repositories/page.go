@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Order is the direction a listing is sorted in
+type Order string
+
+const (
+	// OrderAsc lists oldest first
+	OrderAsc Order = "asc"
+
+	// OrderDesc lists newest first
+	OrderDesc Order = "desc"
+)
+
+const (
+	// DefaultPageLimit is used when a request does not ask for a page size
+	DefaultPageLimit = 50
+
+	// MaxPageLimit caps the page size a request may ask for
+	MaxPageLimit = 200
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a listing ordered by creation time and ID
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque form handed to clients
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Encode
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	stamp, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, stamp)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// PageRequest selects one page of a listing. After continues past a cursor
+// in the listing's order and Before walks back from one; at most one is set.
+type PageRequest struct {
+	Limit  int
+	Order  Order
+	After  *Cursor
+	Before *Cursor
+}
+
+// Validate checks the request and fills in defaults
+func (p *PageRequest) Validate() error {
+	if p.Limit <= 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		p.Limit = MaxPageLimit
+	}
+	switch p.Order {
+	case "":
+		p.Order = OrderAsc
+	case OrderAsc, OrderDesc:
+	default:
+		return fmt.Errorf("order must be %q or %q", OrderAsc, OrderDesc)
+	}
+	if p.After != nil && p.Before != nil {
+		return errors.New("before and after cannot be combined")
+	}
+	return nil
+}
+
+// scan returns the cursor to seek from and the direction rows are read in.
+// Walking back with Before reads against the listing's order.
+func (p PageRequest) scan() (*Cursor, Order) {
+	if p.Before != nil {
+		if p.Order == OrderDesc {
+			return p.Before, OrderAsc
+		}
+		return p.Before, OrderDesc
+	}
+	return p.After, p.Order
+}
+
+// Page is one page of a listing. NextCursor continues in the direction the
+// page was requested: pass it as after, or as before when walking back.
+// It is empty on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// newPage trims rows read with one extra item of lookahead into a page,
+// restoring the listing's order when the rows were read backwards
+func newPage[T any](rows []T, p PageRequest, cursorOf func(T) Cursor) *Page[T] {
+	more := len(rows) > p.Limit
+	if more {
+		rows = rows[:p.Limit]
+	}
+
+	last := len(rows) - 1
+	if p.Before != nil {
+		for i, j := 0, last; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+		last = 0
+	}
+
+	page := &Page[T]{Items: rows}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if more {
+		page.NextCursor = cursorOf(rows[last]).Encode()
+	}
+	return page
+}
+
+// keysetClause returns the WHERE fragment, its arguments and the ORDER BY
+// clause for reading a page of rows keyed on created_at and id
+func keysetClause(p PageRequest) (string, []interface{}, string) {
+	cursor, order := p.scan()
+	direction, cmp := "ASC", ">"
+	if order == OrderDesc {
+		direction, cmp = "DESC", "<"
+	}
+
+	orderBy := fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT %d", direction, direction, p.Limit+1)
+	if cursor == nil {
+		return "", nil, orderBy
+	}
+	at := cursor.CreatedAt.UTC()
+	where := fmt.Sprintf(" AND (created_at %s ? OR (created_at = ? AND id %s ?))", cmp, cmp)
+	return where, []interface{}{at, at, cursor.ID}, orderBy
+}
+
+// paginate pages through items already sorted oldest first
+func paginate[T any](items []T, p PageRequest, cursorOf func(T) Cursor) *Page[T] {
+	cursor, order := p.scan()
+	if order == OrderDesc {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	var rows []T
+	for _, item := range items {
+		if cursor != nil {
+			c := compareCursors(cursorOf(item), *cursor)
+			if (order == OrderAsc && c <= 0) || (order == OrderDesc && c >= 0) {
+				continue
+			}
+		}
+		rows = append(rows, item)
+		if len(rows) > p.Limit {
+			break
+		}
+	}
+	return newPage(rows, p, cursorOf)
+}
+
+// compareCursors orders cursors by creation time, then ID
+func compareCursors(a, b Cursor) int {
+	switch {
+	case a.CreatedAt.Before(b.CreatedAt):
+		return -1
+	case a.CreatedAt.After(b.CreatedAt):
+		return 1
+	}
+	return strings.Compare(a.ID, b.ID)
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// ReasoningFilter narrows a listing of reasoning entries. The zero value of
+// each field means "any".
+type ReasoningFilter struct {
+	Step      models.ReasoningStep
+	SessionID string
+	MessageID string
+	Since     time.Time
+	Until     time.Time
+}
+
+// matches reports whether an entry passes the filter
+func (f ReasoningFilter) matches(entry *models.ReasoningEntry) bool {
+	return (f.Step == "" || entry.Step == f.Step) &&
+		(f.SessionID == "" || entry.SessionID == f.SessionID) &&
+		(f.MessageID == "" || entry.MessageID == f.MessageID) &&
+		(f.Since.IsZero() || !entry.CreatedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.CreatedAt.Before(f.Until))
+}
+
+// clause returns the SQL conditions for the filter on the reasoning_entries table
+func (f ReasoningFilter) clause() (string, []interface{}) {
+	var where strings.Builder
+	var args []interface{}
+	for _, eq := range [][2]string{{"step_type", string(f.Step)}, {"session_id", f.SessionID}, {"message_id", f.MessageID}} {
+		if eq[1] != "" {
+			where.WriteString(" AND " + eq[0] + " = ?")
+			args = append(args, eq[1])
+		}
+	}
+	if !f.Since.IsZero() {
+		where.WriteString(" AND created_at >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		where.WriteString(" AND created_at < ?")
+		args = append(args, f.Until.UTC())
+	}
+	return where.String(), args
+}
+
+// ReasoningRepository handles database operations for reasoning entries
+type ReasoningRepository struct {
+	db sqlConn
+}
+
+// NewReasoningRepository creates a new ReasoningRepository
+func NewReasoningRepository(conn *sql.DB, dialect db.Dialect) *ReasoningRepository {
+	return &ReasoningRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
+
+// Create inserts a new reasoning entry into the database
+func (r *ReasoningRepository) Create(entry *models.ReasoningEntry) error {
+	return invalidReference(r.db.inTx(func(tx sqlConn) error {
+		if err := tx.reachable("agents", sessionInWorkspace, entry.AgentID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO reasoning_entries (id, agent_id, session_id, created_at, step_type, message_id, content, payload) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			entry.ID, entry.AgentID, nullString(entry.SessionID), entry.CreatedAt.UTC(), string(entry.Step),
+			nullString(entry.MessageID), entry.Content, nullString(string(entry.Payload)),
+		)
+		return err
+	}))
+}
+
+// ListByAgentID retrieves one page of an agent's reasoning entries matching the filter
+func (r *ReasoningRepository) ListByAgentID(agentID string, filter ReasoningFilter, page PageRequest) (*Page[*models.ReasoningEntry], error) {
+	scope, scopeArgs := r.db.scope(agentInWorkspace)
+	where, args := filter.clause()
+	keyset, keysetArgs, orderBy := keysetClause(page)
+	args = append(append(append([]interface{}{agentID}, scopeArgs...), args...), keysetArgs...)
+
+	rows, err := r.db.Query("SELECT "+reasoningColumns+" FROM reasoning_entries WHERE agent_id = ?"+scope+where+keyset+orderBy, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*models.ReasoningEntry
+	for rows.Next() {
+		entry, err := scanReasoningEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPage(entries, page, reasoningCursor), nil
+}
+
+// reasoningColumns lists the columns read by scanReasoningEntry
+const reasoningColumns = "id, agent_id, session_id, created_at, step_type, message_id, content, payload"
+
+func scanReasoningEntry(row interface{ Scan(...interface{}) error }) (*models.ReasoningEntry, error) {
+	var entry models.ReasoningEntry
+	var sessionID, messageID sql.NullString
+	var payload []byte
+	if err := row.Scan(&entry.ID, &entry.AgentID, &sessionID, &entry.CreatedAt, &entry.Step, &messageID, &entry.Content, &payload); err != nil {
+		return nil, err
+	}
+	entry.SessionID = sessionID.String
+	entry.MessageID = messageID.String
+	if len(payload) > 0 {
+		entry.Payload = payload
+	}
+	return &entry, nil
+}
+
+func reasoningCursor(entry *models.ReasoningEntry) Cursor {
+	return Cursor{CreatedAt: entry.CreatedAt, ID: entry.ID}
+}
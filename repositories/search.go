@@ -0,0 +1,217 @@
+package repositories
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chatcollab/chatcollab/models"
+)
+
+const (
+	// DefaultSearchLimit is used when a search does not ask for a page size
+	DefaultSearchLimit = 20
+
+	// MaxSearchLimit caps the number of hits a search may ask for
+	MaxSearchLimit = 100
+
+	// Snippets wrap matched terms in these markers. Message content is not escaped.
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+
+	// snippetRunes is roughly how much context a substring-match snippet shows
+	snippetRunes = 80
+)
+
+// ErrEmptyQuery is returned when a search has no terms
+var ErrEmptyQuery = errors.New("search query is empty")
+
+// SearchQuery describes a message search. The zero value of each filter means "any".
+type SearchQuery struct {
+	Query     string
+	SessionID string
+	AgentID   string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+	Offset    int
+}
+
+// Validate checks the query and fills in defaults
+func (q *SearchQuery) Validate() error {
+	if len(searchTerms(q.Query)) == 0 {
+		return ErrEmptyQuery
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Limit > MaxSearchLimit {
+		q.Limit = MaxSearchLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return nil
+}
+
+// SearchHit is a message matching a search, best matches first
+type SearchHit struct {
+	Message *models.Message `json:"message"`
+	Snippet string          `json:"snippet"`
+	Rank    float64         `json:"rank"`
+}
+
+// searchTerms splits a query into the words every hit must contain.
+// A trailing * marks a prefix match.
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		field = strings.Trim(field, `"`)
+		if strings.Trim(field, "*") != "" {
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// ftsQuery quotes each term so user input cannot inject FTS5 query syntax
+func ftsQuery(query string) string {
+	terms := searchTerms(query)
+	for i, term := range terms {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.ReplaceAll(strings.TrimRight(term, "*"), `"`, `""`)
+		terms[i] = `"` + term + `"`
+		if prefix {
+			terms[i] += "*"
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// rankHits orders substring-matched hits, best first, then newest first,
+// and applies the query's offset and limit
+func rankHits(hits []*SearchHit, q SearchQuery) []*SearchHit {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].Message.CreatedAt.After(hits[j].Message.CreatedAt)
+	})
+	if q.Offset >= len(hits) {
+		return []*SearchHit{}
+	}
+	hits = hits[q.Offset:]
+	if len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits
+}
+
+// matches reports whether a message passes the query's filters
+func (q SearchQuery) matches(message *models.Message) bool {
+	return (q.SessionID == "" || message.SessionID == q.SessionID) &&
+		(q.AgentID == "" || message.AgentID == q.AgentID) &&
+		(q.Since.IsZero() || !message.CreatedAt.Before(q.Since)) &&
+		(q.Until.IsZero() || message.CreatedAt.Before(q.Until))
+}
+
+// filterClause returns the SQL conditions for the query's filters on the
+// messages table, whose columns are prefixed with alias
+func (q SearchQuery) filterClause(alias string) (string, []interface{}) {
+	var where strings.Builder
+	var args []interface{}
+	if q.SessionID != "" {
+		where.WriteString(" AND " + alias + "session_id = ?")
+		args = append(args, q.SessionID)
+	}
+	if q.AgentID != "" {
+		where.WriteString(" AND " + alias + "agent_id = ?")
+		args = append(args, q.AgentID)
+	}
+	if !q.Since.IsZero() {
+		where.WriteString(" AND " + alias + "created_at >= ?")
+		args = append(args, q.Since.UTC())
+	}
+	if !q.Until.IsZero() {
+		where.WriteString(" AND " + alias + "created_at < ?")
+		args = append(args, q.Until.UTC())
+	}
+	return where.String(), args
+}
+
+// matchTerms reports how many times the terms occur in content, or 0 unless
+// every term occurs at least once. Matching is case-insensitive.
+func matchTerms(content string, terms []string) int {
+	lower := strings.ToLower(content)
+	total := 0
+	for _, term := range terms {
+		n := strings.Count(lower, strings.ToLower(strings.TrimRight(term, "*")))
+		if n == 0 {
+			return 0
+		}
+		total += n
+	}
+	return total
+}
+
+// highlight builds a snippet around the first matched term, wrapping every
+// match inside it in highlight markers
+func highlight(content string, terms []string) string {
+	lower := strings.ToLower(content)
+	if len(lower) != len(content) {
+		// Case folding changed byte offsets; fall back to exact matching
+		lower = content
+	}
+	needles := make([]string, 0, len(terms))
+	first := -1
+	for _, term := range terms {
+		needle := strings.ToLower(strings.TrimRight(term, "*"))
+		needles = append(needles, needle)
+		if i := strings.Index(lower, needle); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	// Centre a window of about snippetRunes runes on the first match
+	start := first
+	for n := 0; start > 0 && n < snippetRunes/2; n++ {
+		_, size := utf8.DecodeLastRuneInString(content[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; end < len(content) && n < snippetRunes; n++ {
+		_, size := utf8.DecodeRuneInString(content[end:])
+		end += size
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		matched := ""
+		for _, needle := range needles {
+			if needle != "" && strings.HasPrefix(lower[i:], needle) && i+len(needle) <= end {
+				matched = content[i : i+len(needle)]
+				break
+			}
+		}
+		if matched != "" {
+			b.WriteString(highlightStart + matched + highlightEnd)
+			i += len(matched)
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(content[i:])
+		b.WriteString(content[i : i+size])
+		i += size
+	}
+	if end < len(content) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
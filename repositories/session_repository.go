@@ -1,6 +1,8 @@
 package repositories
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/chatcollab/chatcollab/db"
@@ -8,72 +10,151 @@ import (
 )
 
 // SessionRepository handles database operations for sessions
-type SessionRepository struct{}
+type SessionRepository struct {
+	db sqlConn
+}
+
+// NewSessionRepository creates a new SessionRepository
+func NewSessionRepository(conn *sql.DB, dialect db.Dialect) *SessionRepository {
+	return &SessionRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
 
 // Create inserts a new session into the database
 func (r *SessionRepository) Create(session *models.Session) error {
-	_, err := db.DB.Exec(
-		"INSERT INTO sessions (id, last_heartbeat) VALUES (?, ?)",
-		session.ID, session.LastHeartbeat,
+	tags, err := json.Marshal(sessionTags(session))
+	if err != nil {
+		return err
+	}
+	r.db.stamp(&session.WorkspaceID)
+	_, err = r.db.Exec(
+		"INSERT INTO sessions (id, created_at, last_heartbeat, title, goal, tags, status, closed_at, version, workspace_id, max_messages) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.CreatedAt.UTC(), session.LastHeartbeat, session.Title, session.Goal, string(tags), session.Status, session.ClosedAt, session.Version,
+		session.WorkspaceID, session.MaxMessages,
 	)
-	return err
+	return invalidReference(err)
 }
 
 // GetByID retrieves a session by its ID
 func (r *SessionRepository) GetByID(id string) (*models.Session, error) {
-	var session models.Session
-	err := db.DB.QueryRow(
-		"SELECT id, last_heartbeat FROM sessions WHERE id = ?",
-		id,
-	).Scan(&session.ID, &session.LastHeartbeat)
+	scope, args := r.db.scope(inWorkspace)
+	session, err := scanSession(r.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?"+scope+r.db.forUpdate(), append([]interface{}{id}, args...)...))
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
-	return &session, nil
+	return session, nil
 }
 
-// Update updates an existing session
+// Update stores a changed session as its next version. The stored session
+// must still be at the session's version, otherwise ErrConflict is returned.
 func (r *SessionRepository) Update(session *models.Session) error {
-	_, err := db.DB.Exec(
-		"UPDATE sessions SET last_heartbeat = ? WHERE id = ?",
-		session.LastHeartbeat, session.ID,
-	)
-	return err
+	tags, err := json.Marshal(sessionTags(session))
+	if err != nil {
+		return err
+	}
+	scope, args := r.db.scope(inWorkspace)
+	err = r.db.inTx(func(tx sqlConn) error {
+		err := expectRow(tx.Exec(
+			"UPDATE sessions SET last_heartbeat = ?, title = ?, goal = ?, tags = ?, status = ?, closed_at = ?, max_messages = ?, version = ? WHERE id = ? AND version = ?"+scope,
+			append([]interface{}{
+				session.LastHeartbeat, session.Title, session.Goal, string(tags), session.Status, session.ClosedAt, session.MaxMessages, session.Version + 1,
+				session.ID, session.Version,
+			}, args...)...,
+		))
+		if err == ErrNotFound {
+			return versionConflict(tx, "sessions", session.ID, inWorkspace)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	session.Version++
+	return nil
 }
 
-// Delete removes a session from the database
+// Touch records a heartbeat at the given time in a single statement, waking
+// the session if it went idle, and returns the session as stored. Only
+// waking the session counts as a new version.
+func (r *SessionRepository) Touch(id string, at time.Time) (*models.Session, error) {
+	var session *models.Session
+	scope, args := r.db.scope(inWorkspace)
+	err := r.db.inTx(func(tx sqlConn) error {
+		err := expectRow(tx.Exec(
+			"UPDATE sessions SET last_heartbeat = ?, status = CASE WHEN status = ? THEN ? ELSE status END, "+
+				"version = CASE WHEN status = ? THEN version + 1 ELSE version END WHERE id = ?"+scope,
+			append([]interface{}{at, models.SessionIdle, models.SessionRunning, models.SessionIdle, id}, args...)...,
+		))
+		if err != nil {
+			return err
+		}
+		session, err = scanSession(tx.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Delete removes a session from the database along with its agents,
+// messages and members
 func (r *SessionRepository) Delete(id string) error {
-	_, err := db.DB.Exec("DELETE FROM sessions WHERE id = ?", id)
-	return err
+	scope, args := r.db.scope(inWorkspace)
+	return referenced(expectRow(r.db.Exec("DELETE FROM sessions WHERE id = ?"+scope, append([]interface{}{id}, args...)...)))
 }
 
-// ListAll retrieves all sessions
+// ListAll retrieves all sessions in creation order
 func (r *SessionRepository) ListAll() ([]*models.Session, error) {
-	rows, err := db.DB.Query("SELECT id, last_heartbeat FROM sessions")
+	scope, args := r.db.scope(inWorkspace)
+	return r.query("SELECT "+sessionColumns+" FROM sessions WHERE 1 = 1"+scope+" ORDER BY created_at, id", args...)
+}
+
+// List retrieves one page of sessions
+func (r *SessionRepository) List(page PageRequest) (*Page[*models.Session], error) {
+	scope, args := r.db.scope(inWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	sessions, err := r.query("SELECT "+sessionColumns+" FROM sessions WHERE 1 = 1"+scope+where+orderBy, append(args, keysetArgs...)...)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return newPage(sessions, page, sessionCursor), nil
+}
 
-	var sessions []*models.Session
-	for rows.Next() {
-		var session models.Session
-		if err := rows.Scan(&session.ID, &session.LastHeartbeat); err != nil {
-			return nil, err
-		}
-		sessions = append(sessions, &session)
+// ListByMember retrieves one page of the sessions a user is a member of
+func (r *SessionRepository) ListByMember(userID string, page PageRequest) (*Page[*models.Session], error) {
+	scope, args := r.db.scope(inWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	sessions, err := r.query(
+		"SELECT "+sessionColumns+" FROM sessions WHERE id IN (SELECT session_id FROM session_members WHERE user_id = ?)"+scope+where+orderBy,
+		append(append([]interface{}{userID}, args...), keysetArgs...)...,
+	)
+	if err != nil {
+		return nil, err
 	}
-
-	return sessions, nil
+	return newPage(sessions, page, sessionCursor), nil
 }
 
 // GetActiveSessions retrieves all active sessions based on the heartbeat timeout
 func (r *SessionRepository) GetActiveSessions(timeout time.Duration) ([]*models.Session, error) {
 	cutoffTime := time.Now().Add(-timeout)
-	rows, err := db.DB.Query(
-		"SELECT id, last_heartbeat FROM sessions WHERE last_heartbeat > ?",
-		cutoffTime,
-	)
+	scope, args := r.db.scope(inWorkspace)
+	return r.query("SELECT "+sessionColumns+" FROM sessions WHERE last_heartbeat > ?"+scope, append([]interface{}{cutoffTime}, args...)...)
+}
+
+// GetInactiveSessions retrieves the sessions whose last heartbeat is older than the timeout
+func (r *SessionRepository) GetInactiveSessions(timeout time.Duration) ([]*models.Session, error) {
+	cutoffTime := time.Now().Add(-timeout)
+	scope, args := r.db.scope(inWorkspace)
+	return r.query("SELECT "+sessionColumns+" FROM sessions WHERE last_heartbeat <= ?"+scope+" ORDER BY created_at, id", append([]interface{}{cutoffTime}, args...)...)
+}
+
+// Count returns how many sessions exist
+func (r *SessionRepository) Count() (int, error) {
+	return r.db.count("sessions", inWorkspace)
+}
+
+func (r *SessionRepository) query(query string, args ...interface{}) ([]*models.Session, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,12 +162,43 @@ func (r *SessionRepository) GetActiveSessions(timeout time.Duration) ([]*models.
 
 	var sessions []*models.Session
 	for rows.Next() {
-		var session models.Session
-		if err := rows.Scan(&session.ID, &session.LastHeartbeat); err != nil {
+		session, err := scanSession(rows)
+		if err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, &session)
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// sessionColumns lists the columns read by scanSession
+const sessionColumns = "id, created_at, last_heartbeat, title, goal, tags, status, closed_at, version, workspace_id, max_messages"
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	var session models.Session
+	var tags []byte
+	var closedAt sql.NullTime
+	if err := row.Scan(&session.ID, &session.CreatedAt, &session.LastHeartbeat, &session.Title, &session.Goal, &tags, &session.Status, &closedAt, &session.Version, &session.WorkspaceID, &session.MaxMessages); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(tags, &session.Tags); err != nil {
+		return nil, err
 	}
+	if closedAt.Valid {
+		session.ClosedAt = &closedAt.Time
+	}
+	return &session, nil
+}
 
-	return sessions, nil
-}
\ No newline at end of file
+// sessionTags stores a session without tags as an empty list
+func sessionTags(session *models.Session) []string {
+	if session.Tags == nil {
+		return []string{}
+	}
+	return session.Tags
+}
+
+func sessionCursor(session *models.Session) Cursor {
+	return Cursor{CreatedAt: session.CreatedAt, ID: session.ID}
+}
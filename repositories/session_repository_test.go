@@ -34,7 +34,7 @@ func TestSessionRepository(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
 	
-	repo := SessionRepository{}
+	repo := NewSessionRepository(db.DB, db.Driver)
 	
 	// Test Create
 	session := models.NewSession()
@@ -0,0 +1,462 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist
+	ErrNotFound = errors.New("record not found")
+
+	// ErrConflict is returned when a record changed since it was read
+	ErrConflict = errors.New("record was modified concurrently")
+
+	// ErrInvalidReference is returned when a write names a related record that does not exist
+	ErrInvalidReference = errors.New("referenced record does not exist")
+
+	// ErrReferenced is returned when deleting a record that others still depend on
+	ErrReferenced = errors.New("record is still referenced")
+)
+
+// AgentStore persists agents
+type AgentStore interface {
+	Create(agent *models.Agent) error
+	GetByID(id string) (*models.Agent, error)
+	Update(agent *models.Agent) error
+	Delete(id string) error
+	SetOnline(id string, isOnline bool) (*models.Agent, error)
+	ListAll() ([]*models.Agent, error)
+	List(page PageRequest) (*Page[*models.Agent], error)
+	GetBySessionID(sessionID string) ([]*models.Agent, error)
+	GetByTemplateID(templateID string) ([]*models.Agent, error)
+	Count() (int, error)
+}
+
+// SessionStore persists sessions
+type SessionStore interface {
+	Create(session *models.Session) error
+	GetByID(id string) (*models.Session, error)
+	Update(session *models.Session) error
+	Touch(id string, at time.Time) (*models.Session, error)
+	Delete(id string) error
+	ListAll() ([]*models.Session, error)
+	List(page PageRequest) (*Page[*models.Session], error)
+	ListByMember(userID string, page PageRequest) (*Page[*models.Session], error)
+	GetActiveSessions(timeout time.Duration) ([]*models.Session, error)
+	GetInactiveSessions(timeout time.Duration) ([]*models.Session, error)
+	Count() (int, error)
+}
+
+// MessageStore persists messages
+type MessageStore interface {
+	Create(message *models.Message) error
+	GetByID(id string) (*models.Message, error)
+	Update(message *models.Message) error
+	Delete(id string) error
+	GetBySessionID(sessionID string) ([]*models.Message, error)
+	GetByAgentID(agentID string) ([]*models.Message, error)
+	ListBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error)
+	ListByAgentID(agentID string, page PageRequest) (*Page[*models.Message], error)
+	ListThreadsBySessionID(sessionID string, page PageRequest) (*Page[*models.Message], error)
+	GetThread(rootID string) ([]*models.Message, error)
+	GetRevisions(messageID string) ([]*models.MessageRevision, error)
+	GetMessagesAfter(sessionID string, after time.Time) ([]*models.Message, error)
+	Search(query SearchQuery) ([]*SearchHit, error)
+	Count() (int, error)
+	CountBySessionID(sessionID string) (int, error)
+}
+
+// TemplateStore persists agent templates
+type TemplateStore interface {
+	Create(template *models.AgentTemplate) error
+	GetByID(id string) (*models.AgentTemplate, error)
+	Update(template *models.AgentTemplate) error
+	Delete(id string) error
+	List(page PageRequest) (*Page[*models.AgentTemplate], error)
+}
+
+// UserStore persists users and the sessions they have joined
+type UserStore interface {
+	Create(user *models.User) error
+	GetByID(id string) (*models.User, error)
+	Update(user *models.User) error
+	Delete(id string) error
+	List(page PageRequest) (*Page[*models.User], error)
+	AddMember(member *models.Participant) error
+	GetMember(sessionID, userID string) (*models.Participant, error)
+	SetMemberOnline(sessionID, userID string, isOnline bool) error
+	SetMemberRole(sessionID, userID string, role models.SessionRole) error
+	RemoveMember(sessionID, userID string) error
+	GetBySessionID(sessionID string) ([]*models.Participant, error)
+}
+
+// ReasoningStore persists agents' reasoning entries
+type ReasoningStore interface {
+	Create(entry *models.ReasoningEntry) error
+	ListByAgentID(agentID string, filter ReasoningFilter, page PageRequest) (*Page[*models.ReasoningEntry], error)
+}
+
+// APIKeyStore persists API keys
+type APIKeyStore interface {
+	Create(key *models.APIKey) error
+	GetByID(id string) (*models.APIKey, error)
+	GetByHash(hash string) (*models.APIKey, error)
+	Revoke(id string, at time.Time) error
+	RevokeByAgentID(agentID string, at time.Time) error
+	Count() (int, error)
+	List(page PageRequest) (*Page[*models.APIKey], error)
+}
+
+// WorkspaceStore persists workspaces
+type WorkspaceStore interface {
+	Create(workspace *models.Workspace) error
+	GetByID(id string) (*models.Workspace, error)
+	Update(workspace *models.Workspace) error
+	Delete(id string) error
+	List(page PageRequest) (*Page[*models.Workspace], error)
+
+	// GetQuotas reads a workspace's quotas without locking it
+	GetQuotas(id string) (models.Quotas, error)
+}
+
+// UnitOfWork groups reads and writes across stores so they commit together
+type UnitOfWork interface {
+	// Do runs fn with a Store whose stores share one transaction, committing
+	// if fn returns nil and rolling back otherwise. Calling Do on the Store
+	// handed to fn joins the running unit of work.
+	Do(fn func(tx *Store) error) error
+
+	// InWorkspace returns the unit of work's stores limited to a workspace
+	InWorkspace(id string) *Store
+}
+
+// Store groups the stores of one storage backend
+type Store struct {
+	Agents     AgentStore
+	Templates  TemplateStore
+	Users      UserStore
+	Sessions   SessionStore
+	Messages   MessageStore
+	Reasoning  ReasoningStore
+	APIKeys    APIKeyStore
+	Workspaces WorkspaceStore
+
+	workspace string
+	work      func(fn func(tx *Store) error) error
+	scope     func(workspace string) *Store
+}
+
+// Do runs fn as one unit of work. A Store assembled by hand has no
+// transactions and runs fn directly.
+func (s *Store) Do(fn func(tx *Store) error) error {
+	if s.work == nil {
+		return fn(s)
+	}
+	return s.work(fn)
+}
+
+// InWorkspace returns a Store that only sees and writes the records of one
+// workspace: records of others are not found, and records it creates belong
+// to it. Workspaces themselves are shared. An empty ID, or a Store
+// assembled by hand, returns s itself.
+func (s *Store) InWorkspace(id string) *Store {
+	if id == "" || s.scope == nil {
+		return s
+	}
+	return s.scope(id)
+}
+
+// Workspace returns the workspace the Store is limited to, or "" when it
+// sees every workspace
+func (s *Store) Workspace() string {
+	return s.workspace
+}
+
+// NewSQLStore creates a Store backed by a SQL database of the given dialect
+func NewSQLStore(conn *sql.DB, dialect db.Dialect) *Store {
+	return newSQLStore(sqlConn{conn: conn, dialect: dialect})
+}
+
+// newSQLStore creates a Store whose repositories all run on conn. Units of
+// work begin a transaction, or join the one conn already is.
+func newSQLStore(conn sqlConn) *Store {
+	return &Store{
+		Agents:     &AgentRepository{db: conn},
+		Templates:  &TemplateRepository{db: conn},
+		Users:      &UserRepository{db: conn},
+		Sessions:   &SessionRepository{db: conn},
+		Messages:   &MessageRepository{db: conn},
+		Reasoning:  &ReasoningRepository{db: conn},
+		APIKeys:    &APIKeyRepository{db: conn},
+		Workspaces: &WorkspaceRepository{db: conn},
+		workspace:  conn.workspace,
+		work: func(fn func(tx *Store) error) error {
+			return conn.inTx(func(tx sqlConn) error {
+				return fn(newSQLStore(tx))
+			})
+		},
+		scope: func(workspace string) *Store {
+			scoped := conn
+			scoped.workspace = workspace
+			return newSQLStore(scoped)
+		},
+	}
+}
+
+// NewMemoryStore creates a Store that keeps everything in memory, enforcing
+// the same references between records as the SQL schema. Units of work run
+// one at a time but cannot be rolled back: writes made before fn fails stay.
+// The default workspace exists from the start, as it does in the schema.
+func NewMemoryStore() *Store {
+	refs := &memoryRelations{
+		agents:     NewMemoryAgentStore(),
+		templates:  NewMemoryTemplateStore(),
+		users:      NewMemoryUserStore(),
+		sessions:   NewMemorySessionStore(),
+		messages:   NewMemoryMessageStore(),
+		reasoning:  NewMemoryReasoningStore(),
+		apiKeys:    NewMemoryAPIKeyStore(),
+		workspaces: NewMemoryWorkspaceStore(),
+	}
+	refs.agents.refs = refs
+	refs.templates.refs = refs
+	refs.users.refs = refs
+	refs.sessions.refs = refs
+	refs.messages.refs = refs
+	refs.reasoning.refs = refs
+	refs.apiKeys.refs = refs
+	refs.workspaces.refs = refs
+	refs.workspaces.Create(&models.Workspace{ID: models.DefaultWorkspaceID, CreatedAt: time.Now().UTC(), Name: "Default"})
+
+	return newMemoryStore(refs, "", &sync.Mutex{})
+}
+
+// newMemoryStore creates a Store over refs limited to a workspace, or
+// seeing every workspace when it is empty. Units of work hold mu; the
+// Store handed to them has no mu, so nested units of work run directly.
+func newMemoryStore(refs *memoryRelations, workspace string, mu *sync.Mutex) *Store {
+	store := &Store{
+		Agents:     refs.agents,
+		Templates:  refs.templates,
+		Users:      refs.users,
+		Sessions:   refs.sessions,
+		Messages:   refs.messages,
+		Reasoning:  refs.reasoning,
+		APIKeys:    refs.apiKeys,
+		Workspaces: refs.workspaces,
+		workspace:  workspace,
+		scope: func(workspace string) *Store {
+			return newMemoryStore(refs, workspace, mu)
+		},
+	}
+	if workspace != "" {
+		scoped := memoryWorkspace{id: workspace, refs: refs}
+		store.Agents = workspaceAgents{refs.agents, scoped}
+		store.Templates = workspaceTemplates{refs.templates, scoped}
+		store.Users = workspaceUsers{refs.users, scoped}
+		store.Sessions = workspaceSessions{refs.sessions, scoped}
+		store.Messages = workspaceMessages{refs.messages, scoped}
+		store.Reasoning = workspaceReasoning{refs.reasoning, scoped}
+		store.APIKeys = workspaceAPIKeys{refs.apiKeys, scoped}
+	}
+	if mu != nil {
+		store.work = func(fn func(tx *Store) error) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return fn(newMemoryStore(refs, workspace, nil))
+		}
+	}
+	return store
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqlConn runs queries written with ? placeholders in the connection's
+// dialect. A connection with a workspace only reads and writes that
+// workspace's records.
+type sqlConn struct {
+	conn      querier
+	dialect   db.Dialect
+	workspace string
+}
+
+// inTx runs fn inside a transaction, committing if it returns nil.
+// When c is already a transaction fn joins it.
+func (c sqlConn) inTx(fn func(tx sqlConn) error) error {
+	conn, ok := c.conn.(*sql.DB)
+	if !ok {
+		return fn(c)
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(sqlConn{conn: tx, dialect: c.dialect, workspace: c.workspace}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// forUpdate locks the rows a query inside a transaction reads until the
+// transaction ends. SQLite transactions take the database's write lock as
+// they begin, so only Postgres needs the clause.
+func (c sqlConn) forUpdate() string {
+	if _, ok := c.conn.(*sql.Tx); ok && c.dialect == db.Postgres {
+		return " FOR UPDATE"
+	}
+	return ""
+}
+
+// Conditions placing a row in a workspace, each taking the workspace's ID.
+// Sessions, templates, keys and users name their workspace; other records
+// reach it through their session or agent. Prefix a table alias where needed.
+const (
+	inWorkspace        = "workspace_id = ?"
+	sessionInWorkspace = "session_id IN (SELECT id FROM sessions WHERE workspace_id = ?)"
+	agentInWorkspace   = "agent_id IN (SELECT a.id FROM agents a JOIN sessions s ON s.id = a.session_id WHERE s.workspace_id = ?)"
+)
+
+// scope returns condition joined with AND, and its argument, to limit a
+// query to the connection's workspace. A connection seeing every
+// workspace needs no condition.
+func (c sqlConn) scope(condition string) (string, []interface{}) {
+	if c.workspace == "" {
+		return "", nil
+	}
+	return " AND " + condition, []interface{}{c.workspace}
+}
+
+// stamp fills in the workspace a new record belongs to: the connection's,
+// or the default one when the record names none
+func (c sqlConn) stamp(workspaceID *string) {
+	if c.workspace != "" {
+		*workspaceID = c.workspace
+	} else if *workspaceID == "" {
+		*workspaceID = models.DefaultWorkspaceID
+	}
+}
+
+// reachable returns ErrInvalidReference unless the row of table with the
+// given ID is in the connection's workspace, where condition places table's
+// rows. An empty ID references nothing and passes.
+func (c sqlConn) reachable(table, condition, id string) error {
+	if c.workspace == "" || id == "" {
+		return nil
+	}
+	var count int
+	if err := c.QueryRow("SELECT count(*) FROM "+table+" WHERE id = ? AND "+condition, id, c.workspace).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidReference
+	}
+	return nil
+}
+
+// count returns how many rows of table are in the connection's workspace
+func (c sqlConn) count(table, condition string) (int, error) {
+	scope, args := c.scope(condition)
+	var count int
+	err := c.QueryRow("SELECT count(*) FROM "+table+" WHERE 1 = 1"+scope, args...).Scan(&count)
+	return count, err
+}
+
+func (c sqlConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.Exec(c.dialect.Rebind(query), args...)
+}
+
+func (c sqlConn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.Query(c.dialect.Rebind(query), args...)
+}
+
+func (c sqlConn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.conn.QueryRow(c.dialect.Rebind(query), args...)
+}
+
+// nullString stores empty optional references as NULL
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullInt stores unset optional numbers as NULL
+func nullInt(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// invalidReference converts a foreign key violation on insert or update
+// into ErrInvalidReference, and an insert reusing a record's ID into ErrConflict
+func invalidReference(err error) error {
+	if db.IsForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
+	if db.IsUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// referenced converts a foreign key violation on delete into ErrReferenced
+func referenced(err error) error {
+	if db.IsForeignKeyViolation(err) {
+		return ErrReferenced
+	}
+	return err
+}
+
+// versionConflict explains a versioned update that matched no rows: the
+// record either changed since it was read or does not exist, in the
+// workspace condition places table's rows in
+func versionConflict(tx sqlConn, table, id, condition string) error {
+	scope, args := tx.scope(condition)
+	var exists int
+	if err := tx.QueryRow("SELECT count(*) FROM "+table+" WHERE id = ?"+scope, append([]interface{}{id}, args...)...).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrConflict
+	}
+	return ErrNotFound
+}
+
+// notFound converts sql.ErrNoRows into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// expectRow returns ErrNotFound when a write matched no rows
+func expectRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
\ No newline at end of file
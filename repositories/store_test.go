@@ -0,0 +1,1200 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// testStores runs fn against every storage backend
+func testStores(t *testing.T, fn func(t *testing.T, store *Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		cleanup := setupTestDB(t)
+		defer cleanup()
+		fn(t, NewSQLStore(db.DB, db.Driver))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		cleanup := setupPostgresDB(t)
+		defer cleanup()
+		fn(t, NewSQLStore(db.DB, db.Driver))
+	})
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryStore())
+	})
+}
+
+// postgres is the server the Postgres tests share. It is started on first
+// use unless TEST_POSTGRES_DSN names one, and stopped by TestMain.
+var postgres struct {
+	once     sync.Once
+	dsn      string
+	err      error
+	embedded *embeddedpostgres.EmbeddedPostgres
+	dir      string
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if postgres.embedded != nil {
+		postgres.embedded.Stop()
+	}
+	if postgres.dir != "" {
+		os.RemoveAll(postgres.dir)
+	}
+	os.Exit(code)
+}
+
+// postgresDSN returns TEST_POSTGRES_DSN, or else starts an embedded Postgres
+// server on a free port and returns its address. CI must name a database,
+// so that the Postgres tests can never be skipped there.
+func postgresDSN() (string, error) {
+	postgres.once.Do(func() {
+		if postgres.dsn = os.Getenv("TEST_POSTGRES_DSN"); postgres.dsn != "" {
+			return
+		}
+		if os.Getenv("CI") != "" {
+			postgres.err = errPostgresRequired
+			return
+		}
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			postgres.err = err
+			return
+		}
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+		listener.Close()
+		if postgres.dir, err = os.MkdirTemp("", "chatcollab-postgres"); err != nil {
+			postgres.err = err
+			return
+		}
+
+		var logs bytes.Buffer
+		config := embeddedpostgres.DefaultConfig().
+			Port(port).
+			Database("chatcollab").
+			RuntimePath(filepath.Join(postgres.dir, "runtime")).
+			Logger(&logs)
+		server := embeddedpostgres.NewDatabase(config)
+		if err := server.Start(); err != nil {
+			postgres.err = fmt.Errorf("%w\n%s", err, logs.String())
+			return
+		}
+		postgres.embedded = server
+		postgres.dsn = config.GetConnectionURL() + "?sslmode=disable"
+	})
+	return postgres.dsn, postgres.err
+}
+
+// errPostgresRequired fails the Postgres tests in CI when no database is named
+var errPostgresRequired = errors.New("TEST_POSTGRES_DSN must be set in CI")
+
+// setupPostgresDB connects to the shared Postgres server and resets its
+// schema. Point TEST_POSTGRES_DSN at a disposable database, since every
+// table is dropped. Without it, local runs start an embedded server and skip
+// the tests if it cannot start, e.g. when its binaries cannot be downloaded;
+// in CI they fail instead.
+func setupPostgresDB(t *testing.T) func() {
+	dsn, err := postgresDSN()
+	if errors.Is(err, errPostgresRequired) {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Skipf("Postgres store not tested, no server could be started (set TEST_POSTGRES_DSN): %v", err)
+	}
+
+	require.NoError(t, db.OpenDriver(db.Postgres, dsn))
+	migrations, err := db.Migrations()
+	require.NoError(t, err)
+	_, err = db.MigrateDown(db.DB, len(migrations))
+	require.NoError(t, err)
+	_, err = db.MigrateUp(db.DB, 0)
+	require.NoError(t, err)
+
+	return func() {
+		db.Close()
+	}
+}
+
+func TestAgentStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+		other := models.NewAgent("Other", "assistant", "prompt", "gpt-4", "")
+		require.NoError(t, store.Agents.Create(other))
+
+		retrieved, err := store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent, retrieved)
+
+		agent.SetOnline(false)
+		require.NoError(t, store.Agents.Update(agent))
+		retrieved, err = store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+		assert.False(t, retrieved.IsOnline)
+
+		all, err := store.Agents.ListAll()
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+
+		inSession, err := store.Agents.GetBySessionID(session.ID)
+		require.NoError(t, err)
+		require.Len(t, inSession, 1)
+		assert.Equal(t, agent.ID, inSession[0].ID)
+
+		require.NoError(t, store.Agents.Delete(agent.ID))
+		_, err = store.Agents.GetByID(agent.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Agents.Update(agent), ErrNotFound)
+	})
+}
+
+func TestMessageStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+
+		first := models.NewMessage("first", agent.ID, session.ID)
+		first.CreatedAt = time.Now().Add(-time.Minute)
+		second := models.NewMessage("second", agent.ID, session.ID)
+		require.NoError(t, store.Messages.Create(second))
+		require.NoError(t, store.Messages.Create(first))
+
+		messages, err := store.Messages.GetBySessionID(session.ID)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, "first", messages[0].Content, "Messages should be ordered by creation time")
+
+		messages, err = store.Messages.GetByAgentID(agent.ID)
+		require.NoError(t, err)
+		assert.Len(t, messages, 2)
+
+		count, err := store.Messages.CountBySessionID(session.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+		count, err = store.Messages.CountBySessionID("missing")
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+
+		messages, err = store.Messages.GetMessagesAfter(session.ID, time.Now().Add(-30*time.Second))
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "second", messages[0].Content)
+
+		second.Edit("edited", agent.ID)
+		require.NoError(t, store.Messages.Update(second))
+		retrieved, err := store.Messages.GetByID(second.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "edited", retrieved.Content)
+		assert.Equal(t, 2, retrieved.Revision)
+		require.NotNil(t, retrieved.EditedAt)
+		assert.True(t, second.EditedAt.Equal(*retrieved.EditedAt))
+		assert.Equal(t, agent.ID, retrieved.EditedBy)
+
+		// An edit based on a stale copy is rejected
+		first.Edit("late edit", agent.ID)
+		first.Revision = 3
+		assert.ErrorIs(t, store.Messages.Update(first), ErrConflict)
+
+		revisions, err := store.Messages.GetRevisions(second.ID)
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, "second", revisions[0].Content)
+		assert.Equal(t, 1, revisions[0].Revision)
+		assert.Equal(t, "edited", revisions[1].Content)
+		assert.Equal(t, agent.ID, revisions[1].EditorID)
+
+		require.NoError(t, store.Messages.Delete(second.ID))
+		_, err = store.Messages.GetByID(second.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		revisions, err = store.Messages.GetRevisions(second.ID)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+
+		missing := models.NewMessage("missing", agent.ID, session.ID)
+		missing.Edit("still missing", agent.ID)
+		assert.ErrorIs(t, store.Messages.Update(missing), ErrNotFound)
+	})
+}
+
+func TestSessionStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		active := models.NewSession()
+		require.NoError(t, store.Sessions.Create(active))
+		stale := models.NewSession()
+		stale.LastHeartbeat = time.Now().Add(-time.Hour)
+		require.NoError(t, store.Sessions.Create(stale))
+
+		// Metadata and lifecycle round-trip
+		active.Title = "Launch plan"
+		active.Goal = "Agree on a launch date"
+		active.Tags = []string{"launch", "q3"}
+		active.MaxMessages = 100
+		require.True(t, active.Transition(models.SessionCompleted))
+		require.NoError(t, store.Sessions.Update(active))
+		retrieved, err := store.Sessions.GetByID(active.ID)
+		require.NoError(t, err)
+		assert.Equal(t, active, retrieved)
+
+		retrieved, err = store.Sessions.GetByID(stale.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, retrieved.Tags)
+		assert.Nil(t, retrieved.ClosedAt)
+
+		sessions, err := store.Sessions.ListAll()
+		require.NoError(t, err)
+		assert.Len(t, sessions, 2)
+
+		sessions, err = store.Sessions.GetActiveSessions(5 * time.Minute)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, active.ID, sessions[0].ID)
+
+		sessions, err = store.Sessions.GetInactiveSessions(5 * time.Minute)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, stale.ID, sessions[0].ID)
+
+		require.NoError(t, store.Sessions.Delete(stale.ID))
+		_, err = store.Sessions.GetByID(stale.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestMessagePagination(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		elsewhere := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		require.NoError(t, store.Sessions.Create(elsewhere))
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+
+		// Five messages, two of which share a timestamp and are told apart by ID
+		base := time.Now().UTC().Truncate(time.Microsecond).Add(-time.Hour)
+		var ids []string
+		for i, offset := range []int{0, 1, 1, 2, 3} {
+			message := models.NewMessage("m", agent.ID, session.ID)
+			message.ID = string(rune('a'+i)) + message.ID
+			message.CreatedAt = base.Add(time.Duration(offset) * time.Minute)
+			require.NoError(t, store.Messages.Create(message))
+			ids = append(ids, message.ID)
+		}
+		other := models.NewMessage("elsewhere", agent.ID, elsewhere.ID)
+		require.NoError(t, store.Messages.Create(other))
+
+		collect := func(page PageRequest) ([]string, []string) {
+			var seen, cursors []string
+			for {
+				require.NoError(t, page.Validate())
+				result, err := store.Messages.ListBySessionID(session.ID, page)
+				require.NoError(t, err)
+				for _, message := range result.Items {
+					seen = append(seen, message.ID)
+				}
+				if result.NextCursor == "" {
+					return seen, cursors
+				}
+				cursors = append(cursors, result.NextCursor)
+				cursor, err := DecodeCursor(result.NextCursor)
+				require.NoError(t, err)
+				if page.Before != nil {
+					page.Before = &cursor
+				} else {
+					page.After = &cursor
+				}
+			}
+		}
+
+		seen, cursors := collect(PageRequest{Limit: 2})
+		assert.Equal(t, ids, seen)
+		assert.Len(t, cursors, 2)
+
+		seen, _ = collect(PageRequest{Limit: 2, Order: OrderDesc})
+		assert.Equal(t, []string{ids[4], ids[3], ids[2], ids[1], ids[0]}, seen)
+
+		// Walking back from the last message returns pages in ascending order
+		last := Cursor{CreatedAt: base.Add(3 * time.Minute), ID: ids[4]}
+		page, err := store.Messages.ListBySessionID(session.ID, PageRequest{Limit: 2, Order: OrderAsc, Before: &last})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, ids[2], page.Items[0].ID)
+		assert.Equal(t, ids[3], page.Items[1].ID)
+		assert.NotEmpty(t, page.NextCursor)
+
+		page, err = store.Messages.ListByAgentID(agent.ID, PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 6)
+		assert.Empty(t, page.NextCursor)
+	})
+}
+
+func TestAgentAndSessionPagination(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		for i := 0; i < 3; i++ {
+			session := models.NewSession()
+			session.CreatedAt = session.CreatedAt.Add(time.Duration(i) * time.Second)
+			require.NoError(t, store.Sessions.Create(session))
+
+			agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+			agent.CreatedAt = session.CreatedAt
+			require.NoError(t, store.Agents.Create(agent))
+		}
+
+		sessions, err := store.Sessions.List(PageRequest{Limit: 2, Order: OrderDesc})
+		require.NoError(t, err)
+		require.Len(t, sessions.Items, 2)
+		assert.True(t, sessions.Items[0].CreatedAt.After(sessions.Items[1].CreatedAt))
+		cursor, err := DecodeCursor(sessions.NextCursor)
+		require.NoError(t, err)
+		sessions, err = store.Sessions.List(PageRequest{Limit: 2, Order: OrderDesc, After: &cursor})
+		require.NoError(t, err)
+		assert.Len(t, sessions.Items, 1)
+		assert.Empty(t, sessions.NextCursor)
+
+		agents, err := store.Agents.List(PageRequest{Limit: 5, Order: OrderAsc})
+		require.NoError(t, err)
+		assert.Len(t, agents.Items, 3)
+		assert.Empty(t, agents.NextCursor)
+	})
+}
+
+func TestCursorEncoding(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), ID: "abc"}
+	decoded, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, "abc", decoded.ID)
+
+	for _, bad := range []string{"", "!!!", "bm90LWEtY3Vyc29y"} {
+		_, err := DecodeCursor(bad)
+		assert.ErrorIs(t, err, ErrInvalidCursor, bad)
+	}
+
+	page := PageRequest{Order: "sideways"}
+	assert.Error(t, page.Validate())
+	page = PageRequest{After: &cursor, Before: &cursor}
+	assert.Error(t, page.Validate())
+	page = PageRequest{Limit: 10000}
+	require.NoError(t, page.Validate())
+	assert.Equal(t, MaxPageLimit, page.Limit)
+	assert.Equal(t, OrderAsc, page.Order)
+}
+
+func TestMessageSearch(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		otherSession := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		require.NoError(t, store.Sessions.Create(otherSession))
+		writer := models.NewAgent("Writer", "writer", "prompt", "gpt-4", session.ID)
+		critic := models.NewAgent("Critic", "critic", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(writer))
+		require.NoError(t, store.Agents.Create(critic))
+
+		old := models.NewMessage("The deployment pipeline is broken again", writer.ID, session.ID)
+		old.CreatedAt = old.CreatedAt.Add(-time.Hour)
+		repeated := models.NewMessage("Pipeline, pipeline, pipeline: the deployment needs love", critic.ID, session.ID)
+		unrelated := models.NewMessage("Lunch is ready", writer.ID, session.ID)
+		elsewhere := models.NewMessage("Another deployment pipeline", writer.ID, otherSession.ID)
+		for _, message := range []*models.Message{old, repeated, unrelated, elsewhere} {
+			require.NoError(t, store.Messages.Create(message))
+		}
+
+		search := func(query SearchQuery) []*SearchHit {
+			require.NoError(t, query.Validate())
+			hits, err := store.Messages.Search(query)
+			require.NoError(t, err)
+			return hits
+		}
+
+		hits := search(SearchQuery{Query: "deployment PIPELINE", SessionID: session.ID})
+		require.Len(t, hits, 2)
+		assert.Equal(t, repeated.ID, hits[0].Message.ID, "More occurrences should rank higher")
+		assert.Contains(t, hits[1].Snippet, "<mark>")
+		assert.GreaterOrEqual(t, hits[0].Rank, hits[1].Rank)
+
+		assert.Len(t, search(SearchQuery{Query: "pipeline"}), 3)
+		assert.Len(t, search(SearchQuery{Query: "pipeline", AgentID: critic.ID}), 1)
+		assert.Len(t, search(SearchQuery{Query: "pipeline", Since: time.Now().Add(-time.Minute)}), 2)
+		assert.Len(t, search(SearchQuery{Query: "pipeline", Until: time.Now().Add(-time.Minute)}), 1)
+		assert.Len(t, search(SearchQuery{Query: "pipeline", Limit: 1, Offset: 1}), 1)
+		assert.Empty(t, search(SearchQuery{Query: "pipeline lunch"}))
+
+		// Query syntax characters are treated as text
+		assert.Empty(t, search(SearchQuery{Query: `"unbalanced OR (`}))
+
+		// Edits and deletes are reflected in the results
+		unrelated.Edit("Lunch after the deployment", writer.ID)
+		require.NoError(t, store.Messages.Update(unrelated))
+		assert.Len(t, search(SearchQuery{Query: "deployment", SessionID: session.ID}), 3)
+		require.NoError(t, store.Messages.Delete(repeated.ID))
+		assert.Len(t, search(SearchQuery{Query: "deployment", SessionID: session.ID}), 2)
+	})
+}
+
+// TestMessageSearchUsesFullTextIndex checks that SQLite searches go through
+// FTS5. `make test` sets TEST_REQUIRE_FTS5 on its tagged run, so this fails
+// there if the index is missing instead of quietly testing the fallback.
+func TestMessageSearchUsesFullTextIndex(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var indexed int
+	require.NoError(t, db.DB.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", db.SearchTable).Scan(&indexed))
+	if indexed == 0 {
+		if os.Getenv("TEST_REQUIRE_FTS5") != "" {
+			t.Fatal("FTS5 index missing; build with -tags sqlite_fts5")
+		}
+		t.Skip("FTS5 unavailable without -tags sqlite_fts5; search uses substring matching")
+	}
+
+	store := NewSQLStore(db.DB, db.Driver)
+	session := models.NewSession()
+	require.NoError(t, store.Sessions.Create(session))
+	agent := models.NewAgent("Writer", "writer", "prompt", "gpt-4", session.ID)
+	require.NoError(t, store.Agents.Create(agent))
+	word := models.NewMessage("The cat sat down", agent.ID, session.ID)
+	require.NoError(t, store.Messages.Create(word))
+	require.NoError(t, store.Messages.Create(models.NewMessage("Concatenate the strings", agent.ID, session.ID)))
+
+	// The index matches whole tokens, where substring matching would find both
+	query := SearchQuery{Query: "cat"}
+	require.NoError(t, query.Validate())
+	hits, err := store.Messages.Search(query)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, word.ID, hits[0].Message.ID)
+}
+
+func TestSearchHelpers(t *testing.T) {
+	query := SearchQuery{Query: "  * "}
+	assert.ErrorIs(t, query.Validate(), ErrEmptyQuery)
+
+	assert.Equal(t, `"deploy"* "say""hi"`, ftsQuery(`deploy* say"hi`))
+
+	assert.Equal(t, "the <mark>Quick</mark> fox", highlight("the Quick fox", []string{"quick"}))
+
+	long := strings.Repeat("filler ", 20) + "needle" + strings.Repeat(" filler", 20)
+	snippet := highlight(long, []string{"needle"})
+	assert.True(t, strings.HasPrefix(snippet, "…") && strings.HasSuffix(snippet, "…"))
+	assert.Contains(t, snippet, "<mark>needle</mark>")
+	assert.Less(t, len(snippet), len(long))
+}
+
+func TestMessageThreads(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+
+		root := models.NewMessage("root", agent.ID, session.ID)
+		root.CreatedAt = root.CreatedAt.Add(-time.Minute)
+		reply := models.NewMessage("reply", agent.ID, session.ID)
+		reply.ReplyTo(root)
+		nested := models.NewMessage("nested", agent.ID, session.ID)
+		nested.ReplyTo(reply)
+		nested.CreatedAt = nested.CreatedAt.Add(time.Second)
+		lonely := models.NewMessage("lonely", agent.ID, session.ID)
+		for _, message := range []*models.Message{root, reply, nested, lonely} {
+			require.NoError(t, store.Messages.Create(message))
+		}
+
+		retrieved, err := store.Messages.GetByID(nested.ID)
+		require.NoError(t, err)
+		assert.Equal(t, reply.ID, retrieved.ParentID)
+		assert.Equal(t, root.ID, retrieved.ThreadRootID)
+
+		thread, err := store.Messages.GetThread(root.ID)
+		require.NoError(t, err)
+		require.Len(t, thread, 2)
+		assert.Equal(t, reply.ID, thread[0].ID)
+		assert.Equal(t, nested.ID, thread[1].ID)
+
+		page, err := store.Messages.ListThreadsBySessionID(session.ID, PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, root.ID, page.Items[0].ID)
+		assert.Equal(t, 2, page.Items[0].ReplyCount)
+		assert.Equal(t, lonely.ID, page.Items[1].ID)
+		assert.Equal(t, 0, page.Items[1].ReplyCount)
+	})
+}
+
+func TestReasoningStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		other := models.NewAgent("Other", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+		require.NoError(t, store.Agents.Create(other))
+		message := models.NewMessage("answer", agent.ID, session.ID)
+		require.NoError(t, store.Messages.Create(message))
+
+		base := time.Now().UTC().Truncate(time.Microsecond).Add(-time.Hour)
+		steps := []models.ReasoningStep{models.StepThought, models.StepPlan, models.StepToolCall, models.StepObservation}
+		var entries []*models.ReasoningEntry
+		for i, step := range steps {
+			entry := models.NewReasoningEntry(agent.ID, session.ID, step, string(step))
+			entry.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+			entries = append(entries, entry)
+		}
+		entries[2].Payload = json.RawMessage(`{"tool":"search","args":{"q":"go"}}`)
+		entries[3].MessageID = message.ID
+		for _, entry := range entries {
+			require.NoError(t, store.Reasoning.Create(entry))
+		}
+		require.NoError(t, store.Reasoning.Create(models.NewReasoningEntry(other.ID, "", models.StepThought, "elsewhere")))
+
+		list := func(filter ReasoningFilter, page PageRequest) *Page[*models.ReasoningEntry] {
+			require.NoError(t, page.Validate())
+			result, err := store.Reasoning.ListByAgentID(agent.ID, filter, page)
+			require.NoError(t, err)
+			return result
+		}
+
+		page := list(ReasoningFilter{}, PageRequest{Limit: 10, Order: OrderAsc})
+		require.Len(t, page.Items, 4)
+		assert.Equal(t, entries[0].ID, page.Items[0].ID)
+		assert.Equal(t, session.ID, page.Items[0].SessionID)
+		assert.JSONEq(t, string(entries[2].Payload), string(page.Items[2].Payload))
+		assert.Nil(t, page.Items[0].Payload)
+		assert.Equal(t, message.ID, page.Items[3].MessageID)
+
+		page = list(ReasoningFilter{Step: models.StepPlan}, PageRequest{})
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, entries[1].ID, page.Items[0].ID)
+
+		page = list(ReasoningFilter{MessageID: message.ID}, PageRequest{})
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, entries[3].ID, page.Items[0].ID)
+
+		page = list(ReasoningFilter{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, PageRequest{})
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, entries[1].ID, page.Items[0].ID)
+
+		// Newest first, two at a time
+		page = list(ReasoningFilter{SessionID: session.ID}, PageRequest{Limit: 2, Order: OrderDesc})
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, entries[3].ID, page.Items[0].ID)
+		require.NotEmpty(t, page.NextCursor)
+		cursor, err := DecodeCursor(page.NextCursor)
+		require.NoError(t, err)
+		page = list(ReasoningFilter{SessionID: session.ID}, PageRequest{Limit: 2, Order: OrderDesc, After: &cursor})
+		require.Len(t, page.Items, 2)
+		assert.Equal(t, entries[0].ID, page.Items[1].ID)
+		assert.Empty(t, page.NextCursor)
+	})
+}
+
+func TestUserStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+
+		alice := models.NewUser("Alice")
+		bob := models.NewUser("Bob")
+		bob.CreatedAt = bob.CreatedAt.Add(time.Second)
+		require.NoError(t, store.Users.Create(alice))
+		require.NoError(t, store.Users.Create(bob))
+
+		retrieved, err := store.Users.GetByID(alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, alice, retrieved)
+
+		page, err := store.Users.List(PageRequest{Limit: 1, Order: OrderAsc})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, alice.ID, page.Items[0].ID)
+		assert.NotEmpty(t, page.NextCursor)
+
+		// Members are listed in the order they joined, under their current name
+		aliceJoined := alice.JoinSession(session.ID)
+		bobJoined := bob.JoinSession(session.ID)
+		bobJoined.JoinedAt = bobJoined.JoinedAt.Add(time.Second)
+		require.NoError(t, store.Users.AddMember(aliceJoined))
+		require.NoError(t, store.Users.AddMember(bobJoined))
+		alice.Name = "Alice B."
+		require.NoError(t, store.Users.Update(alice))
+
+		require.NoError(t, store.Users.SetMemberOnline(session.ID, bob.ID, false))
+		assert.ErrorIs(t, store.Users.SetMemberOnline("other-session", bob.ID, false), ErrNotFound)
+
+		members, err := store.Users.GetBySessionID(session.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 2)
+		assert.Equal(t, alice.ID, members[0].ID)
+		assert.Equal(t, "Alice B.", members[0].Name)
+		assert.Equal(t, models.ParticipantHuman, members[0].Kind)
+		assert.True(t, members[0].IsOnline)
+		assert.False(t, members[1].IsOnline)
+
+		member, err := store.Users.GetMember(session.ID, bob.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Bob", member.Name)
+		_, err = store.Users.GetMember("other-session", bob.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Users can write messages
+		message := models.NewUserMessage("hello from a person", bob.ID, session.ID)
+		require.NoError(t, store.Messages.Create(message))
+		stored, err := store.Messages.GetByID(message.ID)
+		require.NoError(t, err)
+		assert.Equal(t, message, stored)
+		assert.Equal(t, bob.ID, stored.AuthorID())
+
+		// Authors cannot be deleted; deleting anyone else drops their memberships
+		assert.ErrorIs(t, store.Users.Delete(bob.ID), ErrReferenced)
+		require.NoError(t, store.Users.Delete(alice.ID))
+		_, err = store.Users.GetByID(alice.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Users.Delete(alice.ID), ErrNotFound)
+		members, err = store.Users.GetBySessionID(session.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		assert.Equal(t, bob.ID, members[0].ID)
+	})
+}
+
+func TestTemplateStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		template := models.NewAgentTemplate("Reviewer", "critic", "Review carefully", "gpt-4")
+		require.NoError(t, store.Templates.Create(template))
+
+		retrieved, err := store.Templates.GetByID(template.ID)
+		require.NoError(t, err)
+		assert.Equal(t, template, retrieved)
+
+		// Updates must build on the stored version
+		stale := *retrieved
+		template.Revise("Reviewer", "critic", "Review very carefully", "gpt-4")
+		require.NoError(t, store.Templates.Update(template))
+		stale.Revise("Reviewer", "critic", "Skim", "gpt-4")
+		assert.ErrorIs(t, store.Templates.Update(&stale), ErrConflict)
+
+		retrieved, err = store.Templates.GetByID(template.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, retrieved.Version)
+		assert.Equal(t, "Review very carefully", retrieved.Prompt)
+
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		agent := template.Instantiate(session.ID)
+		agent.Pinned = true
+		require.NoError(t, store.Agents.Create(agent))
+		require.NoError(t, store.Agents.Create(models.NewAgent("Other", "assistant", "prompt", "gpt-4", session.ID)))
+
+		agents, err := store.Agents.GetByTemplateID(template.ID)
+		require.NoError(t, err)
+		require.Len(t, agents, 1)
+		assert.Equal(t, agent.ID, agents[0].ID)
+		assert.Equal(t, 2, agents[0].TemplateVersion)
+		assert.True(t, agents[0].Pinned)
+
+		page, err := store.Templates.List(PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 1)
+
+		require.NoError(t, store.Templates.Delete(template.ID))
+		_, err = store.Templates.GetByID(template.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestReferentialIntegrity(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		other := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		require.NoError(t, store.Sessions.Create(other))
+		template := models.NewAgentTemplate("Reviewer", "critic", "Review carefully", "gpt-4")
+		require.NoError(t, store.Templates.Create(template))
+		agent := template.Instantiate(session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+		bystander := models.NewAgent("Bystander", "assistant", "prompt", "gpt-4", other.ID)
+		require.NoError(t, store.Agents.Create(bystander))
+		user := models.NewUser("Alice")
+		require.NoError(t, store.Users.Create(user))
+		require.NoError(t, store.Users.AddMember(user.JoinSession(session.ID)))
+
+		// Writes naming records that do not exist are refused
+		assert.ErrorIs(t, store.Agents.Create(models.NewAgent("Lost", "assistant", "prompt", "gpt-4", "missing")), ErrInvalidReference)
+		assert.ErrorIs(t, store.Messages.Create(models.NewMessage("hi", agent.ID, "missing")), ErrInvalidReference)
+		assert.ErrorIs(t, store.Messages.Create(models.NewMessage("hi", "missing", session.ID)), ErrInvalidReference)
+		assert.ErrorIs(t, store.Messages.Create(models.NewUserMessage("hi", "missing", session.ID)), ErrInvalidReference)
+		assert.ErrorIs(t, store.Users.AddMember(user.JoinSession("missing")), ErrInvalidReference)
+		assert.ErrorIs(t, store.Reasoning.Create(models.NewReasoningEntry("missing", "", models.StepThought, "hmm")), ErrInvalidReference)
+
+		root := models.NewMessage("root", agent.ID, session.ID)
+		require.NoError(t, store.Messages.Create(root))
+		reply := models.NewUserMessage("reply", user.ID, session.ID)
+		reply.ReplyTo(root)
+		require.NoError(t, store.Messages.Create(reply))
+		thought := models.NewReasoningEntry(agent.ID, session.ID, models.StepThought, "hmm")
+		thought.MessageID = root.ID
+		require.NoError(t, store.Reasoning.Create(thought))
+		aside := models.NewReasoningEntry(bystander.ID, session.ID, models.StepThought, "watching")
+		aside.MessageID = root.ID
+		require.NoError(t, store.Reasoning.Create(aside))
+
+		// Records other records depend on cannot be deleted on their own
+		assert.ErrorIs(t, store.Agents.Delete(agent.ID), ErrReferenced)
+		assert.ErrorIs(t, store.Users.Delete(user.ID), ErrReferenced)
+		assert.ErrorIs(t, store.Messages.Delete(root.ID), ErrReferenced)
+		assert.ErrorIs(t, store.Sessions.Delete("missing"), ErrNotFound)
+
+		// Deleting a template leaves its agents in place without it
+		require.NoError(t, store.Templates.Delete(template.ID))
+		retrieved, err := store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+		assert.Empty(t, retrieved.TemplateID)
+
+		// Deleting a session takes its agents, messages, members and reasoning with it
+		require.NoError(t, store.Sessions.Delete(session.ID))
+		_, err = store.Agents.GetByID(agent.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.Messages.GetByID(reply.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		revisions, err := store.Messages.GetRevisions(root.ID)
+		require.NoError(t, err)
+		assert.Empty(t, revisions)
+		members, err := store.Users.GetBySessionID(session.ID)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+		entries, err := store.Reasoning.ListByAgentID(agent.ID, ReasoningFilter{}, PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		assert.Empty(t, entries.Items)
+
+		// Records outside the session survive but no longer point into it
+		entries, err = store.Reasoning.ListByAgentID(bystander.ID, ReasoningFilter{}, PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		require.Len(t, entries.Items, 1)
+		assert.Empty(t, entries.Items[0].SessionID)
+		assert.Empty(t, entries.Items[0].MessageID)
+		_, err = store.Users.GetByID(user.ID)
+		require.NoError(t, err)
+		require.NoError(t, store.Users.Delete(user.ID))
+	})
+}
+
+func TestAtomicUpdates(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		session.LastHeartbeat = time.Now().Add(-time.Hour)
+		require.True(t, session.Transition(models.SessionIdle))
+		require.NoError(t, store.Sessions.Create(session))
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+
+		// A heartbeat wakes an idle session and leaves the rest alone
+		touched, err := store.Sessions.Touch(session.ID, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, models.SessionRunning, touched.Status)
+		assert.True(t, touched.IsActive(time.Minute))
+		require.True(t, touched.Transition(models.SessionPaused))
+		require.NoError(t, store.Sessions.Update(touched))
+		touched, err = store.Sessions.Touch(session.ID, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, models.SessionPaused, touched.Status)
+		_, err = store.Sessions.Touch("missing", time.Now())
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		offline, err := store.Agents.SetOnline(agent.ID, false)
+		require.NoError(t, err)
+		assert.False(t, offline.IsOnline)
+		assert.Equal(t, agent.Prompt, offline.Prompt)
+		_, err = store.Agents.SetOnline("missing", true)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestUnitOfWork(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+
+		// Concurrent read-modify-write units of work do not lose updates
+		const writers = 10
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs <- store.Do(func(tx *Store) error {
+					current, err := tx.Sessions.GetByID(session.ID)
+					if err != nil {
+						return err
+					}
+					current.Tags = append(current.Tags, fmt.Sprintf("tag-%d", i))
+					return tx.Sessions.Update(current)
+				})
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+		retrieved, err := store.Sessions.GetByID(session.ID)
+		require.NoError(t, err)
+		assert.Len(t, retrieved.Tags, writers)
+
+		// Nested units of work join the outer one
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Do(func(tx *Store) error {
+			return tx.Do(func(inner *Store) error {
+				return inner.Agents.Create(agent)
+			})
+		}))
+		_, err = store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+
+		if _, ok := store.Sessions.(*MemorySessionStore); ok {
+			return
+		}
+
+		// A failing unit of work leaves nothing behind
+		failed := errors.New("failed")
+		discarded := models.NewAgent("Discarded", "assistant", "prompt", "gpt-4", session.ID)
+		err = store.Do(func(tx *Store) error {
+			if err := tx.Agents.Create(discarded); err != nil {
+				return err
+			}
+			if _, err := tx.Agents.SetOnline(agent.ID, false); err != nil {
+				return err
+			}
+			return failed
+		})
+		assert.ErrorIs(t, err, failed)
+		_, err = store.Agents.GetByID(discarded.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		retrievedAgent, err := store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+		assert.True(t, retrievedAgent.IsOnline)
+	})
+}
+
+func TestVersionedUpdates(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+
+		// Each update moves the record to its next version
+		stale, err := store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+		agent.Prompt = "first"
+		require.NoError(t, store.Agents.Update(agent))
+		assert.Equal(t, 2, agent.Version)
+		retrieved, err := store.Agents.GetByID(agent.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent, retrieved)
+
+		// Writing a copy read before that update is refused
+		stale.Prompt = "second"
+		assert.ErrorIs(t, store.Agents.Update(stale), ErrConflict)
+		assert.Equal(t, 1, stale.Version)
+		missing := models.NewAgent("Missing", "assistant", "prompt", "gpt-4", session.ID)
+		assert.ErrorIs(t, store.Agents.Update(missing), ErrNotFound)
+
+		staleSession, err := store.Sessions.GetByID(session.ID)
+		require.NoError(t, err)
+		session.Title = "first"
+		require.NoError(t, store.Sessions.Update(session))
+		assert.Equal(t, 2, session.Version)
+		staleSession.Title = "second"
+		assert.ErrorIs(t, store.Sessions.Update(staleSession), ErrConflict)
+		assert.ErrorIs(t, store.Sessions.Update(models.NewSession()), ErrNotFound)
+
+		// Heartbeats only count as a change when they wake the session
+		touched, err := store.Sessions.Touch(session.ID, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 2, touched.Version)
+		require.True(t, touched.Transition(models.SessionIdle))
+		require.NoError(t, store.Sessions.Update(touched))
+		touched, err = store.Sessions.Touch(session.ID, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, models.SessionRunning, touched.Status)
+		assert.Equal(t, 4, touched.Version)
+	})
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		session := models.NewSession()
+		require.NoError(t, store.Sessions.Create(session))
+
+		count, err := store.APIKeys.Count()
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+
+		admin, secret := models.NewAPIKey("admin", []models.Scope{models.ScopeAdmin}, "")
+		require.NoError(t, store.APIKeys.Create(admin))
+		scoped, _ := models.NewAPIKey("bot", []models.Scope{models.ScopeMessagesWrite, models.ScopeSessionsRead}, session.ID)
+		require.NoError(t, store.APIKeys.Create(scoped))
+
+		stored, err := store.APIKeys.GetByHash(models.HashAPIKey(secret))
+		require.NoError(t, err)
+		assert.Equal(t, admin.ID, stored.ID)
+		assert.Equal(t, admin.Prefix, stored.Prefix)
+		assert.True(t, stored.Active())
+		_, err = store.APIKeys.GetByHash(models.HashAPIKey("cck_unknown"))
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		stored, err = store.APIKeys.GetByID(scoped.ID)
+		require.NoError(t, err)
+		assert.Equal(t, scoped.Scopes, stored.Scopes)
+		assert.Equal(t, session.ID, stored.SessionID)
+
+		// The same secret cannot be stored twice, nor a key for a missing session
+		duplicate, _ := models.NewAPIKey("copy", nil, "")
+		duplicate.Hash = admin.Hash
+		assert.ErrorIs(t, store.APIKeys.Create(duplicate), ErrConflict)
+		orphan, _ := models.NewAPIKey("orphan", nil, "missing")
+		assert.ErrorIs(t, store.APIKeys.Create(orphan), ErrInvalidReference)
+
+		revokedAt := time.Now().Add(-time.Minute)
+		require.NoError(t, store.APIKeys.Revoke(admin.ID, revokedAt))
+		require.NoError(t, store.APIKeys.Revoke(admin.ID, time.Now()))
+		stored, err = store.APIKeys.GetByID(admin.ID)
+		require.NoError(t, err)
+		require.NotNil(t, stored.RevokedAt)
+		assert.WithinDuration(t, revokedAt, *stored.RevokedAt, time.Millisecond)
+		assert.ErrorIs(t, store.APIKeys.Revoke("missing", time.Now()), ErrNotFound)
+
+		page, err := store.APIKeys.List(PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 2)
+		assert.ElementsMatch(t, []string{admin.ID, scoped.ID}, []string{page.Items[0].ID, page.Items[1].ID})
+
+		// Agent tokens are revoked together and go with their agent
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, store.Agents.Create(agent))
+		token, _ := models.NewAgentToken(agent)
+		require.NoError(t, store.APIKeys.Create(token))
+		stored, err = store.APIKeys.GetByID(token.ID)
+		require.NoError(t, err)
+		assert.Equal(t, agent.ID, stored.AgentID)
+		require.NoError(t, store.APIKeys.RevokeByAgentID(agent.ID, time.Now()))
+		stored, err = store.APIKeys.GetByID(token.ID)
+		require.NoError(t, err)
+		assert.False(t, stored.Active())
+		stored, err = store.APIKeys.GetByID(scoped.ID)
+		require.NoError(t, err)
+		assert.True(t, stored.Active())
+		require.NoError(t, store.Agents.Delete(agent.ID))
+		_, err = store.APIKeys.GetByID(token.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Keys restricted to a session go with it
+		require.NoError(t, store.Sessions.Delete(session.ID))
+		_, err = store.APIKeys.GetByID(scoped.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		count, err = store.APIKeys.Count()
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestSessionRoles(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		first := models.NewSession()
+		second := models.NewSession()
+		second.CreatedAt = second.CreatedAt.Add(time.Second)
+		other := models.NewSession()
+		for _, session := range []*models.Session{first, second, other} {
+			require.NoError(t, store.Sessions.Create(session))
+		}
+		alice := models.NewUser("Alice")
+		require.NoError(t, store.Users.Create(alice))
+
+		owner := alice.JoinSession(first.ID)
+		owner.SessionRole = models.RoleOwner
+		require.NoError(t, store.Users.AddMember(owner))
+		require.NoError(t, store.Users.AddMember(alice.JoinSession(second.ID)))
+
+		member, err := store.Users.GetMember(first.ID, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.RoleOwner, member.SessionRole)
+
+		require.NoError(t, store.Users.SetMemberRole(second.ID, alice.ID, models.RoleViewer))
+		members, err := store.Users.GetBySessionID(second.ID)
+		require.NoError(t, err)
+		require.Len(t, members, 1)
+		assert.Equal(t, models.RoleViewer, members[0].SessionRole)
+		assert.ErrorIs(t, store.Users.SetMemberRole(other.ID, alice.ID, models.RoleOwner), ErrNotFound)
+
+		// Users see only the sessions they are members of
+		page, err := store.Sessions.ListByMember(alice.ID, PageRequest{Limit: 1, Order: OrderAsc})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, first.ID, page.Items[0].ID)
+		cursor, err := DecodeCursor(page.NextCursor)
+		require.NoError(t, err)
+		page, err = store.Sessions.ListByMember(alice.ID, PageRequest{Limit: 1, Order: OrderAsc, After: &cursor})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, second.ID, page.Items[0].ID)
+		assert.Empty(t, page.NextCursor)
+
+		require.NoError(t, store.Users.RemoveMember(second.ID, alice.ID))
+		assert.ErrorIs(t, store.Users.RemoveMember(second.ID, alice.ID), ErrNotFound)
+		page, err = store.Sessions.ListByMember(alice.ID, PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		require.Len(t, page.Items, 1)
+		assert.Equal(t, first.ID, page.Items[0].ID)
+
+		// Keys acting for a user go with the user
+		key, _ := models.NewAPIKey("alice", []models.Scope{models.ScopeSessionsWrite}, "")
+		key.UserID = alice.ID
+		require.NoError(t, store.APIKeys.Create(key))
+		stored, err := store.APIKeys.GetByID(key.ID)
+		require.NoError(t, err)
+		assert.Equal(t, alice.ID, stored.UserID)
+		orphan, _ := models.NewAPIKey("orphan", nil, "")
+		orphan.UserID = "missing"
+		assert.ErrorIs(t, store.APIKeys.Create(orphan), ErrInvalidReference)
+		require.NoError(t, store.Users.Delete(alice.ID))
+		_, err = store.APIKeys.GetByID(key.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestWorkspaceStore(t *testing.T) {
+	testStores(t, func(t *testing.T, store *Store) {
+		// Records created without a workspace belong to the default one
+		fallback, err := store.Workspaces.GetByID(models.DefaultWorkspaceID)
+		require.NoError(t, err)
+		assert.Equal(t, models.Quotas{}, fallback.Quotas)
+		shared := models.NewSession()
+		require.NoError(t, store.Sessions.Create(shared))
+		assert.Equal(t, models.DefaultWorkspaceID, shared.WorkspaceID)
+
+		acme := models.NewWorkspace("Acme", models.Quotas{Sessions: 2})
+		require.NoError(t, store.Workspaces.Create(acme))
+		assert.ErrorIs(t, store.Workspaces.Create(acme), ErrConflict)
+		acme.Name = "Acme Corp"
+		acme.Quotas.Messages = 10
+		require.NoError(t, store.Workspaces.Update(acme))
+		stored, err := store.Workspaces.GetByID(acme.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme Corp", stored.Name)
+		assert.Equal(t, models.Quotas{Sessions: 2, Messages: 10}, stored.Quotas)
+		quotas, err := store.Workspaces.GetQuotas(acme.ID)
+		require.NoError(t, err)
+		assert.Equal(t, stored.Quotas, quotas)
+		_, err = store.Workspaces.GetQuotas("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Workspaces.Update(models.NewWorkspace("Missing", models.Quotas{})), ErrNotFound)
+		page, err := store.Workspaces.List(PageRequest{Limit: 10, Order: OrderAsc})
+		require.NoError(t, err)
+		assert.Len(t, page.Items, 2)
+
+		// A workspace's store stamps what it creates and sees nothing else
+		scoped := store.InWorkspace(acme.ID)
+		assert.Equal(t, acme.ID, scoped.Workspace())
+		session := models.NewSession()
+		require.NoError(t, scoped.Sessions.Create(session))
+		assert.Equal(t, acme.ID, session.WorkspaceID)
+		agent := models.NewAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+		require.NoError(t, scoped.Agents.Create(agent))
+		message := models.NewMessage("hello", agent.ID, session.ID)
+		require.NoError(t, scoped.Messages.Create(message))
+		template := models.NewAgentTemplate("Writer", "author", "prompt", "gpt-4")
+		require.NoError(t, scoped.Templates.Create(template))
+		assert.Equal(t, acme.ID, template.WorkspaceID)
+		key, _ := models.NewAPIKey("acme", []models.Scope{models.ScopeAdmin}, "")
+		require.NoError(t, scoped.APIKeys.Create(key))
+		assert.Equal(t, acme.ID, key.WorkspaceID)
+		user := models.NewUser("Ada")
+		require.NoError(t, scoped.Users.Create(user))
+		assert.Equal(t, acme.ID, user.WorkspaceID)
+		require.NoError(t, scoped.Users.AddMember(user.JoinSession(session.ID)))
+		outsider := models.NewUser("Bob")
+		require.NoError(t, store.Users.Create(outsider))
+
+		_, err = scoped.Sessions.GetByID(shared.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.InWorkspace(models.DefaultWorkspaceID).Sessions.GetByID(session.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.InWorkspace(models.DefaultWorkspaceID).Agents.GetByID(agent.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.InWorkspace(models.DefaultWorkspaceID).Templates.GetByID(template.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, scoped.Agents.Create(models.NewAgent("Spy", "assistant", "prompt", "gpt-4", shared.ID)), ErrInvalidReference)
+		assert.ErrorIs(t, scoped.Sessions.Delete(shared.ID), ErrNotFound)
+
+		// Users of other workspaces cannot be read, changed or brought in
+		defaults := store.InWorkspace(models.DefaultWorkspaceID)
+		_, err = defaults.Users.GetByID(user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, defaults.Users.Update(user), ErrNotFound)
+		assert.ErrorIs(t, defaults.Users.Delete(user.ID), ErrNotFound)
+		users, err := defaults.Users.List(PageRequest{Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, users.Items, 1)
+		assert.Equal(t, outsider.ID, users.Items[0].ID)
+		assert.ErrorIs(t, scoped.Users.AddMember(outsider.JoinSession(session.ID)), ErrInvalidReference)
+		assert.ErrorIs(t, scoped.Messages.Create(models.NewUserMessage("hi", outsider.ID, session.ID)), ErrInvalidReference)
+		outsiderKey, _ := models.NewAPIKey("outsider", []models.Scope{models.ScopeAdmin}, "")
+		outsiderKey.UserID = outsider.ID
+		assert.ErrorIs(t, scoped.APIKeys.Create(outsiderKey), ErrInvalidReference)
+
+		sessions, err := scoped.Sessions.List(PageRequest{Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, sessions.Items, 1)
+		assert.Equal(t, session.ID, sessions.Items[0].ID)
+		for name, count := range map[string]func() (int, error){
+			"sessions": scoped.Sessions.Count, "agents": scoped.Agents.Count, "messages": scoped.Messages.Count,
+		} {
+			n, err := count()
+			require.NoError(t, err)
+			assert.Equal(t, 1, n, name)
+		}
+		n, err := store.InWorkspace(models.DefaultWorkspaceID).Messages.Count()
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		// Units of work keep to the workspace they started in
+		require.NoError(t, scoped.Do(func(tx *Store) error {
+			assert.Equal(t, acme.ID, tx.Workspace())
+			_, err := tx.Sessions.GetByID(shared.ID)
+			assert.ErrorIs(t, err, ErrNotFound)
+			return nil
+		}))
+
+		// Workspaces go only once empty, taking their keys and users with them
+		assert.ErrorIs(t, store.Workspaces.Delete(acme.ID), ErrReferenced)
+		require.NoError(t, scoped.Sessions.Delete(session.ID))
+		require.NoError(t, scoped.Templates.Delete(template.ID))
+		require.NoError(t, store.Workspaces.Delete(acme.ID))
+		_, err = store.APIKeys.GetByID(key.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = store.Users.GetByID(user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, store.Workspaces.Delete(acme.ID), ErrNotFound)
+	})
+}
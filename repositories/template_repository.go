@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// TemplateRepository handles database operations for agent templates
+type TemplateRepository struct {
+	db sqlConn
+}
+
+// NewTemplateRepository creates a new TemplateRepository
+func NewTemplateRepository(conn *sql.DB, dialect db.Dialect) *TemplateRepository {
+	return &TemplateRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
+
+// Create inserts a new template into the database
+func (r *TemplateRepository) Create(template *models.AgentTemplate) error {
+	r.db.stamp(&template.WorkspaceID)
+	_, err := r.db.Exec(
+		"INSERT INTO agent_templates (id, created_at, updated_at, version, name, role, prompt, model, workspace_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		template.ID, template.CreatedAt.UTC(), template.UpdatedAt.UTC(), template.Version,
+		template.Name, template.Role, template.Prompt, template.Model, template.WorkspaceID,
+	)
+	return invalidReference(err)
+}
+
+// GetByID retrieves a template by its ID
+func (r *TemplateRepository) GetByID(id string) (*models.AgentTemplate, error) {
+	scope, args := r.db.scope(inWorkspace)
+	template, err := scanTemplate(r.db.QueryRow("SELECT "+templateColumns+" FROM agent_templates WHERE id = ?"+scope+r.db.forUpdate(), append([]interface{}{id}, args...)...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return template, nil
+}
+
+// Update stores a revised template. The stored template must still be at the
+// previous version, otherwise ErrConflict is returned.
+func (r *TemplateRepository) Update(template *models.AgentTemplate) error {
+	scope, args := r.db.scope(inWorkspace)
+	return r.db.inTx(func(tx sqlConn) error {
+		err := expectRow(tx.Exec(
+			"UPDATE agent_templates SET updated_at = ?, version = ?, name = ?, role = ?, prompt = ?, model = ? WHERE id = ? AND version = ?"+scope,
+			append([]interface{}{
+				template.UpdatedAt.UTC(), template.Version, template.Name, template.Role, template.Prompt, template.Model,
+				template.ID, template.Version - 1,
+			}, args...)...,
+		))
+		if err == ErrNotFound {
+			return versionConflict(tx, "agent_templates", template.ID, inWorkspace)
+		}
+		return err
+	})
+}
+
+// Delete removes a template from the database. Agents made from it no longer reference it.
+func (r *TemplateRepository) Delete(id string) error {
+	scope, args := r.db.scope(inWorkspace)
+	return expectRow(r.db.Exec("DELETE FROM agent_templates WHERE id = ?"+scope, append([]interface{}{id}, args...)...))
+}
+
+// List retrieves one page of templates
+func (r *TemplateRepository) List(page PageRequest) (*Page[*models.AgentTemplate], error) {
+	scope, args := r.db.scope(inWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	rows, err := r.db.Query("SELECT "+templateColumns+" FROM agent_templates WHERE 1 = 1"+scope+where+orderBy, append(args, keysetArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*models.AgentTemplate
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPage(templates, page, templateCursor), nil
+}
+
+// templateColumns lists the columns read by scanTemplate
+const templateColumns = "id, created_at, updated_at, version, name, role, prompt, model, workspace_id"
+
+func scanTemplate(row interface{ Scan(...interface{}) error }) (*models.AgentTemplate, error) {
+	var template models.AgentTemplate
+	err := row.Scan(
+		&template.ID, &template.CreatedAt, &template.UpdatedAt, &template.Version,
+		&template.Name, &template.Role, &template.Prompt, &template.Model, &template.WorkspaceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+func templateCursor(template *models.AgentTemplate) Cursor {
+	return Cursor{CreatedAt: template.CreatedAt, ID: template.ID}
+}
@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// UserRepository handles database operations for users and their session memberships
+type UserRepository struct {
+	db sqlConn
+}
+
+// NewUserRepository creates a new UserRepository
+func NewUserRepository(conn *sql.DB, dialect db.Dialect) *UserRepository {
+	return &UserRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
+
+// Create inserts a new user into the database
+func (r *UserRepository) Create(user *models.User) error {
+	r.db.stamp(&user.WorkspaceID)
+	_, err := r.db.Exec(
+		"INSERT INTO users (id, created_at, name, workspace_id) VALUES (?, ?, ?, ?)",
+		user.ID, user.CreatedAt.UTC(), user.Name, user.WorkspaceID,
+	)
+	return invalidReference(err)
+}
+
+// GetByID retrieves a user by its ID
+func (r *UserRepository) GetByID(id string) (*models.User, error) {
+	scope, args := r.db.scope(inWorkspace)
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?"+scope+r.db.forUpdate(), append([]interface{}{id}, args...)...))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return user, nil
+}
+
+// Update updates an existing user
+func (r *UserRepository) Update(user *models.User) error {
+	scope, args := r.db.scope(inWorkspace)
+	return expectRow(r.db.Exec("UPDATE users SET name = ? WHERE id = ?"+scope, append([]interface{}{user.Name, user.ID}, args...)...))
+}
+
+// Delete removes a user and their session memberships from the database.
+// Users who wrote messages cannot be deleted.
+func (r *UserRepository) Delete(id string) error {
+	scope, args := r.db.scope(inWorkspace)
+	return referenced(expectRow(r.db.Exec("DELETE FROM users WHERE id = ?"+scope, append([]interface{}{id}, args...)...)))
+}
+
+// List retrieves one page of users
+func (r *UserRepository) List(page PageRequest) (*Page[*models.User], error) {
+	scope, args := r.db.scope(inWorkspace)
+	where, keysetArgs, orderBy := keysetClause(page)
+	rows, err := r.db.Query("SELECT "+userColumns+" FROM users WHERE 1 = 1"+scope+where+orderBy, append(args, keysetArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPage(users, page, userCursor), nil
+}
+
+// AddMember records a user joining a session
+func (r *UserRepository) AddMember(member *models.Participant) error {
+	return invalidReference(r.db.inTx(func(tx sqlConn) error {
+		if err := tx.reachable("sessions", inWorkspace, member.SessionID); err != nil {
+			return err
+		}
+		if err := tx.reachable("users", inWorkspace, member.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(
+			"INSERT INTO session_members (session_id, user_id, joined_at, is_online, role) VALUES (?, ?, ?, ?, ?)",
+			member.SessionID, member.ID, member.JoinedAt.UTC(), member.IsOnline, member.SessionRole,
+		)
+		return err
+	}))
+}
+
+// GetMember retrieves a user's membership of a session
+func (r *UserRepository) GetMember(sessionID, userID string) (*models.Participant, error) {
+	scope, args := r.db.scope("sm." + sessionInWorkspace)
+	member, err := scanMember(r.db.QueryRow(
+		"SELECT "+memberColumns+" FROM session_members sm JOIN users u ON u.id = sm.user_id WHERE sm.session_id = ? AND sm.user_id = ?"+scope,
+		append([]interface{}{sessionID, userID}, args...)...,
+	))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return member, nil
+}
+
+// SetMemberOnline updates a user's presence in a session
+func (r *UserRepository) SetMemberOnline(sessionID, userID string, isOnline bool) error {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return expectRow(r.db.Exec(
+		"UPDATE session_members SET is_online = ? WHERE session_id = ? AND user_id = ?"+scope,
+		append([]interface{}{isOnline, sessionID, userID}, args...)...,
+	))
+}
+
+// SetMemberRole changes a user's role in a session
+func (r *UserRepository) SetMemberRole(sessionID, userID string, role models.SessionRole) error {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return expectRow(r.db.Exec(
+		"UPDATE session_members SET role = ? WHERE session_id = ? AND user_id = ?"+scope,
+		append([]interface{}{role, sessionID, userID}, args...)...,
+	))
+}
+
+// RemoveMember takes a user out of a session
+func (r *UserRepository) RemoveMember(sessionID, userID string) error {
+	scope, args := r.db.scope(sessionInWorkspace)
+	return expectRow(r.db.Exec("DELETE FROM session_members WHERE session_id = ? AND user_id = ?"+scope, append([]interface{}{sessionID, userID}, args...)...))
+}
+
+// GetBySessionID retrieves the users who joined a session, in the order they joined
+func (r *UserRepository) GetBySessionID(sessionID string) ([]*models.Participant, error) {
+	scope, args := r.db.scope("sm." + sessionInWorkspace)
+	rows, err := r.db.Query(
+		"SELECT "+memberColumns+" FROM session_members sm JOIN users u ON u.id = sm.user_id WHERE sm.session_id = ?"+scope+" ORDER BY sm.joined_at, sm.user_id",
+		append([]interface{}{sessionID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.Participant
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// userColumns lists the columns read by scanUser
+const userColumns = "id, created_at, name, workspace_id"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	if err := row.Scan(&user.ID, &user.CreatedAt, &user.Name, &user.WorkspaceID); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// memberColumns lists the columns read by scanMember
+const memberColumns = "sm.user_id, u.name, sm.is_online, sm.session_id, sm.joined_at, sm.role"
+
+func scanMember(row interface{ Scan(...interface{}) error }) (*models.Participant, error) {
+	member := models.Participant{Kind: models.ParticipantHuman}
+	if err := row.Scan(&member.ID, &member.Name, &member.IsOnline, &member.SessionID, &member.JoinedAt, &member.SessionRole); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func userCursor(user *models.User) Cursor {
+	return Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+}
+
+func memberCursor(member *models.Participant) Cursor {
+	return Cursor{CreatedAt: member.JoinedAt, ID: member.ID}
+}
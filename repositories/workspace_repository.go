@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+)
+
+// WorkspaceRepository handles database operations for workspaces
+type WorkspaceRepository struct {
+	db sqlConn
+}
+
+// NewWorkspaceRepository creates a new WorkspaceRepository
+func NewWorkspaceRepository(conn *sql.DB, dialect db.Dialect) *WorkspaceRepository {
+	return &WorkspaceRepository{db: sqlConn{conn: conn, dialect: dialect}}
+}
+
+// Create inserts a new workspace into the database
+func (r *WorkspaceRepository) Create(workspace *models.Workspace) error {
+	_, err := r.db.Exec(
+		"INSERT INTO workspaces (id, created_at, name, max_sessions, max_agents, max_messages) VALUES (?, ?, ?, ?, ?, ?)",
+		workspace.ID, workspace.CreatedAt.UTC(), workspace.Name,
+		workspace.Quotas.Sessions, workspace.Quotas.Agents, workspace.Quotas.Messages,
+	)
+	if db.IsUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// GetByID retrieves a workspace by its ID
+func (r *WorkspaceRepository) GetByID(id string) (*models.Workspace, error) {
+	workspace, err := scanWorkspace(r.db.QueryRow("SELECT "+workspaceColumns+" FROM workspaces WHERE id = ?"+r.db.forUpdate(), id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return workspace, nil
+}
+
+// GetQuotas retrieves a workspace's quotas. Unlike GetByID it does not lock
+// the workspace, so the many writes checking its quotas do not queue on it.
+func (r *WorkspaceRepository) GetQuotas(id string) (models.Quotas, error) {
+	var quotas models.Quotas
+	err := r.db.QueryRow("SELECT max_sessions, max_agents, max_messages FROM workspaces WHERE id = ?", id).
+		Scan(&quotas.Sessions, &quotas.Agents, &quotas.Messages)
+	if err != nil {
+		return models.Quotas{}, notFound(err)
+	}
+	return quotas, nil
+}
+
+// Update stores a workspace's new name and quotas
+func (r *WorkspaceRepository) Update(workspace *models.Workspace) error {
+	return expectRow(r.db.Exec(
+		"UPDATE workspaces SET name = ?, max_sessions = ?, max_agents = ?, max_messages = ? WHERE id = ?",
+		workspace.Name, workspace.Quotas.Sessions, workspace.Quotas.Agents, workspace.Quotas.Messages, workspace.ID,
+	))
+}
+
+// Delete removes a workspace with its users and API keys from the database.
+// Workspaces that still have sessions or templates cannot be deleted.
+func (r *WorkspaceRepository) Delete(id string) error {
+	return referenced(expectRow(r.db.Exec("DELETE FROM workspaces WHERE id = ?", id)))
+}
+
+// List retrieves one page of workspaces
+func (r *WorkspaceRepository) List(page PageRequest) (*Page[*models.Workspace], error) {
+	where, args, orderBy := keysetClause(page)
+	rows, err := r.db.Query("SELECT "+workspaceColumns+" FROM workspaces WHERE 1 = 1"+where+orderBy, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workspaces []*models.Workspace
+	for rows.Next() {
+		workspace, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, err
+		}
+		workspaces = append(workspaces, workspace)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return newPage(workspaces, page, workspaceCursor), nil
+}
+
+// workspaceColumns lists the columns read by scanWorkspace
+const workspaceColumns = "id, created_at, name, max_sessions, max_agents, max_messages"
+
+func scanWorkspace(row interface{ Scan(...interface{}) error }) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := row.Scan(
+		&workspace.ID, &workspace.CreatedAt, &workspace.Name,
+		&workspace.Quotas.Sessions, &workspace.Quotas.Agents, &workspace.Quotas.Messages,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+func workspaceCursor(workspace *models.Workspace) Cursor {
+	return Cursor{CreatedAt: workspace.CreatedAt, ID: workspace.ID}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+// maxTranscriptMessages caps how much session history is sent to a model
+const maxTranscriptMessages = 100
+
+// AgentTurn is the outcome of running an agent once
+type AgentTurn struct {
+	Message *models.Message `json:"message"`
+	Usage   providers.Usage `json:"usage"`
+}
+
+// AgentRunner drives agents by sending the session transcript to their model
+type AgentRunner struct {
+	sessions     *SessionService
+	agents       *AgentService
+	participants *ParticipantService
+	messages     *MessageService
+	providers    *providers.Registry
+}
+
+// NewAgentRunner creates a new AgentRunner
+func NewAgentRunner(sessions *SessionService, agents *AgentService, participants *ParticipantService, messages *MessageService, registry *providers.Registry) *AgentRunner {
+	return &AgentRunner{
+		sessions:     sessions,
+		agents:       agents,
+		participants: participants,
+		messages:     messages,
+		providers:    registry,
+	}
+}
+
+// InWorkspace returns an AgentRunner that only runs the agents of one
+// workspace. An empty ID returns r itself.
+func (r *AgentRunner) InWorkspace(id string) *AgentRunner {
+	if id == "" {
+		return r
+	}
+	return &AgentRunner{
+		sessions:     r.sessions.InWorkspace(id),
+		agents:       r.agents.InWorkspace(id),
+		participants: r.participants.InWorkspace(id),
+		messages:     r.messages.InWorkspace(id),
+		providers:    r.providers,
+	}
+}
+
+// RunAgent asks the agent's model for its next message in its session and
+// posts the reply as a message authored by the agent
+func (r *AgentRunner) RunAgent(ctx context.Context, agentID string) (*AgentTurn, error) {
+	agent, err := r.agents.GetAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't spend a model call on a reply the session would refuse
+	var goal string
+	session, err := r.sessions.GetSession(agent.SessionID)
+	switch {
+	case err == nil && !session.AcceptsMessages():
+		return nil, ErrSessionNotRunning
+	case err == nil:
+		goal = session.Goal
+	case !errors.Is(err, repositories.ErrNotFound):
+		return nil, err
+	}
+
+	provider, model, err := r.providers.Resolve(agent.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	participants, err := r.participants.ListParticipants(agent.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(participants))
+	for _, participant := range participants {
+		names[participant.ID] = participant.Name
+	}
+
+	history, err := r.messages.RecentSessionMessages(agent.SessionID, maxTranscriptMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	req := buildTranscript(agent, goal, names, history)
+	req.Model = model
+
+	resp, err := provider.Chat(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimSpace(resp.Content)
+	if content == "" {
+		return nil, fmt.Errorf("%s returned an empty reply", provider.Name())
+	}
+
+	message, err := r.messages.CreateMessage(content, agent.ID, agent.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AgentTurn{Message: message, Usage: resp.Usage}, nil
+}
+
+// buildTranscript converts the recent session history into a chat request
+// from the agent's point of view: its own messages are assistant turns and
+// everyone else's are user turns prefixed with the speaker's name. The
+// session's goal, when it has one, is part of every agent's instructions.
+func buildTranscript(agent *models.Agent, goal string, names map[string]string, history []*models.Message) providers.ChatRequest {
+	system := fmt.Sprintf("You are %s, participating as %s in a conversation with other participants. "+
+		"Messages from others are prefixed with the speaker's name. Reply with your next message only.", agent.Name, agent.Role)
+	if goal != "" {
+		system += "\n\nThe goal of this conversation: " + goal
+	}
+	if agent.Prompt != "" {
+		system = agent.Prompt + "\n\n" + system
+	}
+
+	messages := make([]providers.ChatMessage, 0, len(history)+1)
+	for _, message := range history {
+		if message.AgentID == agent.ID {
+			messages = append(messages, providers.ChatMessage{Role: providers.RoleAssistant, Content: message.Content})
+			continue
+		}
+
+		name := names[message.AuthorID()]
+		if name == "" {
+			name = "Unknown"
+		}
+		messages = append(messages, providers.ChatMessage{Role: providers.RoleUser, Content: name + ": " + message.Content})
+	}
+
+	// Models expect to answer a user turn
+	if len(messages) == 0 || messages[len(messages)-1].Role != providers.RoleUser {
+		messages = append(messages, providers.ChatMessage{Role: providers.RoleUser, Content: "(It is your turn to speak.)"})
+	}
+
+	return providers.ChatRequest{
+		System:   system,
+		Messages: messages,
+	}
+}
@@ -1,45 +1,133 @@
 package services
 
 import (
+	"errors"
+	"time"
+
+	"github.com/chatcollab/chatcollab/events"
 	"github.com/chatcollab/chatcollab/models"
 	"github.com/chatcollab/chatcollab/repositories"
 )
 
 // AgentService handles business logic for agents
 type AgentService struct {
-	repo repositories.AgentRepository
+	repo   repositories.AgentStore
+	work   repositories.UnitOfWork
+	events *events.Broker
 }
 
-// NewAgentService creates a new AgentService
-func NewAgentService() *AgentService {
+// NewAgentService creates a new AgentService backed by the given store,
+// running multi-step changes as units of work
+func NewAgentService(store repositories.AgentStore, work repositories.UnitOfWork) *AgentService {
 	return &AgentService{
-		repo: repositories.AgentRepository{},
+		repo:   store,
+		work:   work,
+		events: events.Default,
+	}
+}
+
+// InWorkspace returns an AgentService that only sees the agents of one
+// workspace's sessions. An empty ID returns s itself.
+func (s *AgentService) InWorkspace(id string) *AgentService {
+	if id == "" {
+		return s
 	}
+	store := s.work.InWorkspace(id)
+	scoped := *s
+	scoped.repo = store.Agents
+	scoped.work = store
+	return &scoped
 }
 
-// CreateAgent creates a new agent
+// CreateAgent creates a new agent in an existing session, along with the
+// token it speaks with, returned in the agent's Token
 func (s *AgentService) CreateAgent(name, role, prompt, model, sessionID string) (*models.Agent, error) {
 	agent := models.NewAgent(name, role, prompt, model, sessionID)
-	err := s.repo.Create(agent)
+	err := s.work.Do(func(tx *repositories.Store) error {
+		session, err := tx.Sessions.GetByID(sessionID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUnknownSession
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(tx, session.WorkspaceID, agentQuota, 1); err != nil {
+			return err
+		}
+		if err := tx.Agents.Create(agent); err != nil {
+			return err
+		}
+		return issueToken(tx, agent)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return agent, nil
 }
 
+// ReissueToken revokes an agent's tokens and issues a new one, returned in
+// the agent's Token
+func (s *AgentService) ReissueToken(id string) (*models.Agent, error) {
+	var agent *models.Agent
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		agent, err = tx.Agents.GetByID(id)
+		if err != nil {
+			return err
+		}
+		if err := tx.APIKeys.RevokeByAgentID(id, time.Now()); err != nil {
+			return err
+		}
+		return issueToken(tx, agent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
+
+// issueToken stores a new token for an agent, in the workspace of its
+// session, and hands its secret back in the agent's Token
+func issueToken(tx *repositories.Store, agent *models.Agent) error {
+	session, err := tx.Sessions.GetByID(agent.SessionID)
+	if err != nil {
+		return err
+	}
+	key, secret := models.NewAgentToken(agent)
+	key.WorkspaceID = session.WorkspaceID
+	if err := tx.APIKeys.Create(key); err != nil {
+		return err
+	}
+	agent.Token = secret
+	return nil
+}
+
 // GetAgent retrieves an agent by ID
 func (s *AgentService) GetAgent(id string) (*models.Agent, error) {
 	return s.repo.GetByID(id)
 }
 
-// UpdateAgent updates an agent
+// UpdateAgent stores a changed agent as its next version. An agent that
+// changed since it was read returns repositories.ErrConflict.
 func (s *AgentService) UpdateAgent(agent *models.Agent) error {
 	return s.repo.Update(agent)
 }
 
-// DeleteAgent deletes an agent
-func (s *AgentService) DeleteAgent(id string) error {
-	return s.repo.Delete(id)
+// DeleteAgent deletes an agent. A non-zero version must match the stored
+// agent's, otherwise repositories.ErrConflict is returned.
+func (s *AgentService) DeleteAgent(id string, version int) error {
+	return s.work.Do(func(tx *repositories.Store) error {
+		if version != 0 {
+			agent, err := tx.Agents.GetByID(id)
+			if err != nil {
+				return err
+			}
+			if agent.Version != version {
+				return repositories.ErrConflict
+			}
+		}
+		return tx.Agents.Delete(id)
+	})
 }
 
 // ListAgents lists all agents
@@ -47,6 +135,11 @@ func (s *AgentService) ListAgents() ([]*models.Agent, error) {
 	return s.repo.ListAll()
 }
 
+// PageAgents retrieves one page of agents
+func (s *AgentService) PageAgents(page repositories.PageRequest) (*repositories.Page[*models.Agent], error) {
+	return s.repo.List(page)
+}
+
 // ListSessionAgents lists all agents for a session
 func (s *AgentService) ListSessionAgents(sessionID string) ([]*models.Agent, error) {
 	return s.repo.GetBySessionID(sessionID)
@@ -54,22 +147,10 @@ func (s *AgentService) ListSessionAgents(sessionID string) ([]*models.Agent, err
 
 // SetAgentOnlineStatus updates an agent's online status
 func (s *AgentService) SetAgentOnlineStatus(id string, isOnline bool) error {
-	agent, err := s.repo.GetByID(id)
+	agent, err := s.repo.SetOnline(id, isOnline)
 	if err != nil {
 		return err
 	}
-	
-	agent.SetOnline(isOnline)
-	return s.repo.Update(agent)
+	s.events.Publish(events.AgentPresence, agent.SessionID, agent)
+	return nil
 }
-
-// AppendAgentReasoningLog adds to an agent's reasoning log
-func (s *AgentService) AppendAgentReasoningLog(id string, log string) error {
-	agent, err := s.repo.GetByID(id)
-	if err != nil {
-		return err
-	}
-	
-	agent.AppendReasoningLog(log)
-	return s.repo.Update(agent)
-}
\ No newline at end of file
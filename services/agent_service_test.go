@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestAgentServiceOnlineStatus(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	service := NewAgentService(store.Agents, store)
+	session, err := NewSessionService(store.Sessions, store).CreateSession()
+	require.NoError(t, err)
+
+	agent, err := service.CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, service.SetAgentOnlineStatus(agent.ID, false))
+
+	stored, err := service.GetAgent(agent.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.IsOnline)
+
+	assert.ErrorIs(t, service.SetAgentOnlineStatus("missing", true), repositories.ErrNotFound)
+}
+
+func TestAgentTokens(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	auth := NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store)
+	agents := NewAgentService(store.Agents, store)
+	session, err := NewSessionService(store.Sessions, store).CreateSession()
+	require.NoError(t, err)
+
+	agent, err := agents.CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	require.NotEmpty(t, agent.Token)
+	key, err := auth.Authenticate(agent.Token)
+	require.NoError(t, err)
+	assert.Equal(t, agent.ID, key.AgentID)
+	assert.Equal(t, session.ID, key.SessionID)
+	stored, err := agents.GetAgent(agent.ID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Token, "Tokens should not be stored with the agent")
+
+	// Reissuing replaces every earlier token
+	reissued, err := agents.ReissueToken(agent.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, agent.Token, reissued.Token)
+	_, err = auth.Authenticate(agent.Token)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = auth.Authenticate(reissued.Token)
+	assert.NoError(t, err)
+	_, err = agents.ReissueToken("missing")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+
+	template, err := NewTemplateService(store.Templates, store).CreateTemplate("Reviewer", "critic", "Review", "gpt-4")
+	require.NoError(t, err)
+	instances, err := NewTemplateService(store.Templates, store).InstantiateTemplates(session.ID, []string{template.ID}, false)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.NotEmpty(t, instances[0].Token)
+}
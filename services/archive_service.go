@@ -0,0 +1,532 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+// BundleFormat identifies session bundles and the version of their layout
+const BundleFormat = "chatcollab.session.v1"
+
+// ErrInvalidBundle is returned when importing a bundle that is malformed or
+// whose records do not reference each other consistently
+var ErrInvalidBundle = errors.New("invalid session bundle")
+
+// SessionBundle holds a session with everything in it, for archiving,
+// sharing and importing elsewhere. Messages are in the order they were
+// posted; their edit history is not included.
+type SessionBundle struct {
+	Format     string                `json:"format"`
+	ExportedAt time.Time             `json:"exportedAt"`
+	Session    *models.Session       `json:"session"`
+	Agents     []*BundledAgent       `json:"agents"`
+	Users      []*models.User        `json:"users"`
+	Members    []*models.Participant `json:"members"`
+	Messages   []*models.Message     `json:"messages"`
+}
+
+// BundledAgent is an agent along with its reasoning, oldest first
+type BundledAgent struct {
+	*models.Agent
+	Reasoning []*models.ReasoningEntry `json:"reasoning"`
+}
+
+// ImportedSession is a session recreated from a bundle, along with its
+// agents. Tokens are never bundled, so each agent carries a new one in its
+// Token.
+type ImportedSession struct {
+	*models.Session
+	Agents []*models.Agent `json:"agents"`
+}
+
+// ArchiveService exports sessions as bundles and imports them again
+type ArchiveService struct {
+	work repositories.UnitOfWork
+}
+
+// NewArchiveService creates a new ArchiveService reading and writing every
+// bundle as one unit of work
+func NewArchiveService(work repositories.UnitOfWork) *ArchiveService {
+	return &ArchiveService{
+		work: work,
+	}
+}
+
+// InWorkspace returns an ArchiveService that exports the sessions of one
+// workspace and imports bundles into it. An empty ID returns s itself.
+func (s *ArchiveService) InWorkspace(id string) *ArchiveService {
+	if id == "" {
+		return s
+	}
+	return &ArchiveService{
+		work: s.work.InWorkspace(id),
+	}
+}
+
+// ExportSession bundles a session with its agents, their reasoning, the
+// users taking part and its messages
+func (s *ArchiveService) ExportSession(id string) (*SessionBundle, error) {
+	bundle := &SessionBundle{Format: BundleFormat, ExportedAt: time.Now().UTC()}
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		if bundle.Session, err = tx.Sessions.GetByID(id); err != nil {
+			return err
+		}
+
+		agents, err := tx.Agents.GetBySessionID(id)
+		if err != nil {
+			return err
+		}
+		bundle.Agents = make([]*BundledAgent, 0, len(agents))
+		for _, agent := range agents {
+			reasoning, err := allReasoning(tx, agent.ID)
+			if err != nil {
+				return err
+			}
+			bundle.Agents = append(bundle.Agents, &BundledAgent{Agent: agent, Reasoning: reasoning})
+		}
+
+		if bundle.Members, err = tx.Users.GetBySessionID(id); err != nil {
+			return err
+		}
+		if bundle.Messages, err = tx.Messages.GetBySessionID(id); err != nil {
+			return err
+		}
+		bundle.Users, err = bundleUsers(tx, bundle)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Members == nil {
+		bundle.Members = []*models.Participant{}
+	}
+	if bundle.Messages == nil {
+		bundle.Messages = []*models.Message{}
+	}
+	return bundle, nil
+}
+
+// allReasoning reads every page of an agent's reasoning
+func allReasoning(tx *repositories.Store, agentID string) ([]*models.ReasoningEntry, error) {
+	entries := []*models.ReasoningEntry{}
+	page := repositories.PageRequest{Limit: repositories.MaxPageLimit, Order: repositories.OrderAsc}
+	for {
+		result, err := tx.Reasoning.ListByAgentID(agentID, repositories.ReasoningFilter{}, page)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, result.Items...)
+		if result.NextCursor == "" {
+			return entries, nil
+		}
+		cursor, err := repositories.DecodeCursor(result.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		page.After = &cursor
+	}
+}
+
+// bundleUsers reads the users who joined the session or wrote in it
+func bundleUsers(tx *repositories.Store, bundle *SessionBundle) ([]*models.User, error) {
+	users := []*models.User{}
+	seen := make(map[string]bool)
+	add := func(id string) error {
+		if id == "" || seen[id] {
+			return nil
+		}
+		seen[id] = true
+		user, err := tx.Users.GetByID(id)
+		if err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	}
+
+	for _, member := range bundle.Members {
+		if err := add(member.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, message := range bundle.Messages {
+		if err := add(message.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return users, nil
+}
+
+// ImportSession recreates a bundled session. Unless preserveIDs is set every
+// record gets a fresh ID, so a bundle can be imported more than once; with
+// it, IDs already in use return repositories.ErrConflict. Users are shared
+// between a workspace's sessions, so bundled users who already exist in the
+// workspace are reused as they are. Messages start again at revision 1, and
+// every agent is issued a token.
+func (s *ArchiveService) ImportSession(bundle *SessionBundle, preserveIDs bool) (*ImportedSession, error) {
+	if err := bundle.Validate(); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string)
+	newID := func(id string) string {
+		if id == "" {
+			return ""
+		}
+		if mapped, ok := ids[id]; ok {
+			return mapped
+		}
+		ids[id] = id
+		if !preserveIDs {
+			ids[id] = uuid.New().String()
+		}
+		return ids[id]
+	}
+
+	var session *models.Session
+	var agents []*models.Agent
+	err := s.work.Do(func(tx *repositories.Store) error {
+		if err := checkQuota(tx, tx.Workspace(), sessionQuota, 1); err != nil {
+			return err
+		}
+		if err := checkQuota(tx, tx.Workspace(), agentQuota, len(bundle.Agents)); err != nil {
+			return err
+		}
+		if err := checkQuota(tx, tx.Workspace(), messageQuota, len(bundle.Messages)); err != nil {
+			return err
+		}
+
+		for _, user := range bundle.Users {
+			if _, err := tx.Users.GetByID(user.ID); err == nil {
+				ids[user.ID] = user.ID
+				continue
+			} else if !errors.Is(err, repositories.ErrNotFound) {
+				return err
+			}
+			imported := *user
+			imported.ID = newID(user.ID)
+			imported.WorkspaceID = ""
+			if err := tx.Users.Create(&imported); err != nil {
+				return err
+			}
+		}
+
+		copied := *bundle.Session
+		session = &copied
+		session.ID = newID(session.ID)
+		session.WorkspaceID = ""
+		session.Version = 1
+		session.LastHeartbeat = time.Now()
+		if err := unused(tx.Sessions.GetByID(session.ID)); err != nil {
+			return err
+		}
+		if err := tx.Sessions.Create(session); err != nil {
+			return err
+		}
+
+		agents = make([]*models.Agent, 0, len(bundle.Agents))
+		for _, bundled := range bundle.Agents {
+			agent := *bundled.Agent
+			agent.ID = newID(agent.ID)
+			agent.SessionID = session.ID
+			agent.IsOnline = false
+			agent.Version = 1
+			if err := unused(tx.Agents.GetByID(agent.ID)); err != nil {
+				return err
+			}
+			if agent.TemplateID != "" {
+				if _, err := tx.Templates.GetByID(agent.TemplateID); errors.Is(err, repositories.ErrNotFound) {
+					agent.TemplateID, agent.TemplateVersion, agent.Pinned = "", 0, false
+				} else if err != nil {
+					return err
+				}
+			}
+			if err := tx.Agents.Create(&agent); err != nil {
+				return err
+			}
+			if err := issueToken(tx, &agent); err != nil {
+				return err
+			}
+			agents = append(agents, &agent)
+		}
+
+		for _, member := range bundle.Members {
+			joined := *member
+			joined.ID = ids[member.ID]
+			joined.SessionID = session.ID
+			joined.IsOnline = false
+			if !joined.SessionRole.Valid() {
+				joined.SessionRole = models.RoleMember
+			}
+			if err := tx.Users.AddMember(&joined); err != nil {
+				return err
+			}
+		}
+
+		parents := make(map[string]*models.Message, len(bundle.Messages))
+		for _, original := range bundle.Messages {
+			message := *original
+			message.ID = newID(message.ID)
+			message.SessionID = session.ID
+			message.AgentID = ids[message.AgentID]
+			message.UserID = ids[message.UserID]
+			// Edit history is not bundled, so the content becomes the first revision
+			message.Revision, message.EditedAt, message.EditedBy = 1, nil, ""
+			message.ParentID, message.ThreadRootID, message.ReplyCount = "", "", 0
+			if original.ParentID != "" {
+				message.ReplyTo(parents[original.ParentID])
+			}
+			if err := unused(tx.Messages.GetByID(message.ID)); err != nil {
+				return err
+			}
+			if err := tx.Messages.Create(&message); err != nil {
+				return err
+			}
+			parents[original.ID] = &message
+		}
+
+		for _, bundled := range bundle.Agents {
+			for _, original := range bundled.Reasoning {
+				entry := *original
+				entry.ID = newID(entry.ID)
+				entry.AgentID = ids[bundled.ID]
+				entry.SessionID = session.ID
+				entry.MessageID = ids[entry.MessageID]
+				if err := tx.Reasoning.Create(&entry); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ImportedSession{Session: session, Agents: agents}, nil
+}
+
+// unused turns the lookup of an ID about to be created into ErrConflict when
+// a record already has it
+func unused[T any](_ T, err error) error {
+	if err == nil {
+		return repositories.ErrConflict
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Validate checks that a bundle is complete and that its records only
+// reference each other. Replies must follow the message they reply to.
+func (b *SessionBundle) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidBundle, fmt.Sprintf(format, args...))
+	}
+
+	if b.Format != BundleFormat {
+		return invalid("format must be %q", BundleFormat)
+	}
+	if b.Session == nil || b.Session.ID == "" {
+		return invalid("session is missing")
+	}
+	if !b.Session.Status.Valid() {
+		return invalid("session has unknown status %q", b.Session.Status)
+	}
+
+	seen := map[string]bool{b.Session.ID: true}
+	unique := func(kind, id string) error {
+		if id == "" {
+			return invalid("%s without an id", kind)
+		}
+		if seen[id] {
+			return invalid("id %s is used more than once", id)
+		}
+		seen[id] = true
+		return nil
+	}
+
+	users := make(map[string]bool)
+	for _, user := range b.Users {
+		if user == nil {
+			return invalid("empty user")
+		}
+		if err := unique("user", user.ID); err != nil {
+			return err
+		}
+		users[user.ID] = true
+	}
+	for _, member := range b.Members {
+		if member == nil || !users[member.ID] {
+			return invalid("member is not one of the bundled users")
+		}
+	}
+
+	agents := make(map[string]bool)
+	for _, agent := range b.Agents {
+		if agent == nil || agent.Agent == nil {
+			return invalid("empty agent")
+		}
+		if err := unique("agent", agent.ID); err != nil {
+			return err
+		}
+		if agent.SessionID != b.Session.ID {
+			return invalid("agent %s belongs to another session", agent.ID)
+		}
+		agents[agent.ID] = true
+	}
+
+	messages := make(map[string]bool)
+	for _, message := range b.Messages {
+		if message == nil {
+			return invalid("empty message")
+		}
+		if err := unique("message", message.ID); err != nil {
+			return err
+		}
+		if message.SessionID != b.Session.ID {
+			return invalid("message %s belongs to another session", message.ID)
+		}
+		switch {
+		case message.AgentID != "" && message.UserID != "":
+			return invalid("message %s has two authors", message.ID)
+		case message.AgentID != "" && !agents[message.AgentID]:
+			return invalid("message %s was written by an agent that is not bundled", message.ID)
+		case message.UserID != "" && !users[message.UserID]:
+			return invalid("message %s was written by a user who is not bundled", message.ID)
+		case message.AgentID == "" && message.UserID == "":
+			return invalid("message %s has no author", message.ID)
+		}
+		if message.ParentID != "" && !messages[message.ParentID] {
+			return invalid("message %s replies to a message that does not come before it", message.ID)
+		}
+		if message.EditedBy != "" && !agents[message.EditedBy] && !users[message.EditedBy] {
+			return invalid("message %s was edited by someone who is not bundled", message.ID)
+		}
+		messages[message.ID] = true
+	}
+
+	for _, agent := range b.Agents {
+		for _, entry := range agent.Reasoning {
+			if entry == nil {
+				return invalid("empty reasoning entry")
+			}
+			if err := unique("reasoning entry", entry.ID); err != nil {
+				return err
+			}
+			if entry.AgentID != agent.ID {
+				return invalid("reasoning entry %s belongs to another agent", entry.ID)
+			}
+			if entry.MessageID != "" && !messages[entry.MessageID] {
+				return invalid("reasoning entry %s refers to a message that is not bundled", entry.ID)
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSONL writes the bundle as JSON lines, one {"type", "data"} record per
+// line: the session, then agents, reasoning, users, members and messages
+func (b *SessionBundle) WriteJSONL(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	write := func(kind string, data interface{}) error {
+		return encoder.Encode(map[string]interface{}{"type": kind, "data": data})
+	}
+
+	if err := write("session", b.Session); err != nil {
+		return err
+	}
+	for _, agent := range b.Agents {
+		if err := write("agent", agent.Agent); err != nil {
+			return err
+		}
+		for _, entry := range agent.Reasoning {
+			if err := write("reasoning", entry); err != nil {
+				return err
+			}
+		}
+	}
+	for _, user := range b.Users {
+		if err := write("user", user); err != nil {
+			return err
+		}
+	}
+	for _, member := range b.Members {
+		if err := write("member", member); err != nil {
+			return err
+		}
+	}
+	for _, message := range b.Messages {
+		if err := write("message", message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown writes the bundle as a readable transcript: the session's
+// details and participants, its messages in order and each agent's reasoning
+func (b *SessionBundle) WriteMarkdown(w io.Writer) error {
+	var out strings.Builder
+	names := make(map[string]string)
+	for _, agent := range b.Agents {
+		names[agent.ID] = agent.Name
+	}
+	for _, user := range b.Users {
+		names[user.ID] = user.Name
+	}
+
+	title := b.Session.Title
+	if title == "" {
+		title = "Session " + b.Session.ID
+	}
+	fmt.Fprintf(&out, "# %s\n\n", title)
+	if b.Session.Goal != "" {
+		fmt.Fprintf(&out, "**Goal:** %s\n\n", b.Session.Goal)
+	}
+	fmt.Fprintf(&out, "**Status:** %s\n\n", b.Session.Status)
+	if len(b.Session.Tags) > 0 {
+		fmt.Fprintf(&out, "**Tags:** %s\n\n", strings.Join(b.Session.Tags, ", "))
+	}
+	fmt.Fprintf(&out, "_Exported %s_\n\n", b.ExportedAt.Format(time.RFC3339))
+
+	out.WriteString("## Participants\n\n")
+	for _, agent := range b.Agents {
+		fmt.Fprintf(&out, "- **%s** (agent, %s, %s)\n", agent.Name, agent.Role, agent.Model)
+	}
+	for _, member := range b.Members {
+		fmt.Fprintf(&out, "- **%s** (user)\n", member.Name)
+	}
+
+	out.WriteString("\n## Messages\n")
+	for _, message := range b.Messages {
+		fmt.Fprintf(&out, "\n### %s · %s\n\n", names[message.AuthorID()], message.CreatedAt.Format(time.RFC3339))
+		if message.ParentID != "" {
+			fmt.Fprintf(&out, "_In reply to message %s_\n\n", message.ParentID)
+		}
+		fmt.Fprintf(&out, "%s\n", message.Content)
+	}
+
+	out.WriteString("\n## Reasoning\n")
+	for _, agent := range b.Agents {
+		if len(agent.Reasoning) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "\n### %s\n\n", agent.Name)
+		for _, entry := range agent.Reasoning {
+			fmt.Fprintf(&out, "- `%s` %s\n", entry.Step, entry.Text())
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+	return err
+}
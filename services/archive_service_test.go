@@ -0,0 +1,153 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+// testStores runs fn against the memory store and a SQLite one, whose units
+// of work roll back when they fail
+func testStores(t *testing.T, fn func(t *testing.T, store *repositories.Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, setupSQLiteStore(t))
+	})
+	t.Run("memory", func(t *testing.T) {
+		fn(t, repositories.NewMemoryStore())
+	})
+}
+
+// setupSQLiteStore opens a migrated SQLite database that is closed when the
+// test ends
+func setupSQLiteStore(t *testing.T) *repositories.Store {
+	require.NoError(t, db.Initialize(filepath.Join(t.TempDir(), "services_test.db")))
+	t.Cleanup(func() { db.Close() })
+	return repositories.NewSQLStore(db.DB, db.Driver)
+}
+
+func TestArchiveService(t *testing.T) {
+	testStores(t, testArchiveService)
+}
+
+func testArchiveService(t *testing.T, store *repositories.Store) {
+	service := NewArchiveService(store)
+	participants := NewParticipantService(store.Users, store.Agents, store)
+	messages := NewMessageService(store.Messages, store)
+
+	session, err := NewSessionService(store.Sessions, store).CreateSessionWithDetails("Launch", "Pick a date", []string{"launch"}, models.SessionRunning)
+	require.NoError(t, err)
+	agent, err := NewAgentService(store.Agents, store).CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	user, err := participants.CreateUser("Alice")
+	require.NoError(t, err)
+	_, _, err = participants.JoinSession(session.ID, user.ID)
+	require.NoError(t, err)
+	root, err := messages.CreateMessage("root", agent.ID, session.ID)
+	require.NoError(t, err)
+	_, err = messages.CreateUserReply("reply", user.ID, session.ID, root.ID)
+	require.NoError(t, err)
+	_, err = NewReasoningService(store.Reasoning, store.Agents, store).RecordReasoning(agent.ID, models.StepThought, "thinking", root.ID, nil)
+	require.NoError(t, err)
+	_, err = messages.EditMessage(root.ID, 0, "root, edited", "")
+	require.NoError(t, err)
+	_, err = messages.EditMessage(root.ID, 0, "root, edited twice", "")
+	require.NoError(t, err)
+
+	bundle, err := service.ExportSession(session.ID)
+	require.NoError(t, err)
+	require.Len(t, bundle.Agents, 1)
+	require.Len(t, bundle.Agents[0].Reasoning, 1)
+	require.Len(t, bundle.Messages, 2)
+	assert.Len(t, bundle.Users, 1)
+	assert.Len(t, bundle.Members, 1)
+
+	// Fresh IDs keep the thread and reasoning linked to the copies
+	imported, err := service.ImportSession(bundle, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, session.ID, imported.ID)
+	assert.Equal(t, "Launch", imported.Title)
+	copied, err := service.ExportSession(imported.ID)
+	require.NoError(t, err)
+	require.Len(t, copied.Messages, 2)
+	assert.NotEqual(t, root.ID, copied.Messages[0].ID)
+	assert.Equal(t, copied.Messages[0].ID, copied.Messages[1].ParentID)
+	assert.Equal(t, user.ID, copied.Messages[1].UserID)
+	assert.Equal(t, copied.Messages[0].ID, copied.Agents[0].Reasoning[0].MessageID)
+	assert.False(t, copied.Agents[0].IsOnline)
+
+	// Edits are not bundled, so the copy starts over at revision 1
+	edited := copied.Messages[0]
+	assert.Equal(t, "root, edited twice", edited.Content)
+	assert.Equal(t, 1, edited.Revision)
+	assert.Nil(t, edited.EditedAt)
+	revisions, err := messages.GetRevisions(edited.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	diff, err := messages.DiffRevisions(edited.ID, 0, 0)
+	require.NoError(t, err, "The latest revision of an imported message can be diffed")
+	assert.Equal(t, 1, diff.To)
+	assert.Empty(t, diff.Diff)
+
+	// Imported agents speak with tokens of their own
+	require.Len(t, imported.Agents, 1)
+	assert.Equal(t, copied.Agents[0].ID, imported.Agents[0].ID)
+	key, err := NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store).Authenticate(imported.Agents[0].Token)
+	require.NoError(t, err)
+	assert.Equal(t, imported.Agents[0].ID, key.AgentID)
+	assert.Equal(t, imported.ID, key.SessionID)
+
+	// Preserved IDs only import once
+	_, err = service.ImportSession(bundle, true)
+	assert.ErrorIs(t, err, repositories.ErrConflict)
+	elsewhere := repositories.NewMemoryStore()
+	preserved, err := NewArchiveService(elsewhere).ImportSession(bundle, true)
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, preserved.ID)
+	reply, err := elsewhere.Messages.GetByID(bundle.Messages[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, root.ID, reply.ThreadRootID)
+
+	// Bundles must only refer to what they contain
+	bundle.Messages[0], bundle.Messages[1] = bundle.Messages[1], bundle.Messages[0]
+	_, err = service.ImportSession(bundle, false)
+	assert.ErrorIs(t, err, ErrInvalidBundle)
+	bundle.Messages = bundle.Messages[1:]
+	bundle.Agents[0].Reasoning[0].MessageID = "missing"
+	_, err = service.ImportSession(bundle, false)
+	assert.ErrorIs(t, err, ErrInvalidBundle)
+	_, err = service.ExportSession("missing")
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func TestImportRollsBack(t *testing.T) {
+	// The memory store cannot roll back, so this only holds for SQL stores
+	store := setupSQLiteStore(t)
+	service := NewArchiveService(store)
+	session, err := NewSessionService(store.Sessions, store).CreateSessionWithDetails("Launch", "", nil, models.SessionRunning)
+	require.NoError(t, err)
+	agent, err := NewAgentService(store.Agents, store).CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	_, err = NewMessageService(store.Messages, store).CreateMessage("root", agent.ID, session.ID)
+	require.NoError(t, err)
+	bundle, err := service.ExportSession(session.ID)
+	require.NoError(t, err)
+
+	// The session and agent are new, but the message is already stored
+	bundle.Session.ID = "copy"
+	bundle.Agents[0].ID, bundle.Agents[0].SessionID = "copied-agent", "copy"
+	bundle.Messages[0].AgentID, bundle.Messages[0].SessionID = "copied-agent", "copy"
+	_, err = service.ImportSession(bundle, true)
+	assert.ErrorIs(t, err, repositories.ErrConflict)
+	_, err = store.Sessions.GetByID("copy")
+	assert.ErrorIs(t, err, repositories.ErrNotFound, "A failed import leaves no session behind")
+	_, err = store.Agents.GetByID("copied-agent")
+	assert.ErrorIs(t, err, repositories.ErrNotFound, "A failed import leaves no agents behind")
+	keys, err := store.APIKeys.Count()
+	require.NoError(t, err)
+	assert.Equal(t, 1, keys, "A failed import issues no tokens")
+}
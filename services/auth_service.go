@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when authenticating with a key that does not exist or was revoked
+	ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+
+	// ErrInvalidScope is returned when creating a key with an unknown scope
+	ErrInvalidScope = errors.New("unknown scope")
+
+	// ErrRestrictedAdmin is returned when creating an admin key restricted to a session or user
+	ErrRestrictedAdmin = errors.New("admin keys cannot be restricted to a session or user")
+)
+
+// AuthService handles business logic for API keys
+type AuthService struct {
+	keys     repositories.APIKeyStore
+	sessions repositories.SessionStore
+	agents   repositories.AgentStore
+	messages repositories.MessageStore
+	users    repositories.UserStore
+	work     repositories.UnitOfWork
+}
+
+// NewAuthService creates a new AuthService backed by the given store. Agents
+// and messages are read to find the session a request touches, sessions to
+// check it is in the key's workspace, and users for their roles in it.
+func NewAuthService(store repositories.APIKeyStore, sessions repositories.SessionStore, agents repositories.AgentStore, messages repositories.MessageStore, users repositories.UserStore, work repositories.UnitOfWork) *AuthService {
+	return &AuthService{
+		keys:     store,
+		sessions: sessions,
+		agents:   agents,
+		messages: messages,
+		users:    users,
+		work:     work,
+	}
+}
+
+// InWorkspace returns an AuthService that only sees and creates the keys of
+// one workspace, and only finds the sessions of its agents and messages.
+// An empty ID returns s itself.
+func (s *AuthService) InWorkspace(id string) *AuthService {
+	if id == "" {
+		return s
+	}
+	store := s.work.InWorkspace(id)
+	return &AuthService{
+		keys:     store.APIKeys,
+		sessions: store.Sessions,
+		agents:   store.Agents,
+		messages: store.Messages,
+		users:    store.Users,
+		work:     store,
+	}
+}
+
+// CreateKey mints a new API key with the given scopes, optionally restricted
+// to one session and acting for one user. The secret is returned only this once.
+func (s *AuthService) CreateKey(name string, scopes []models.Scope, sessionID, userID string) (*models.APIKey, string, error) {
+	for _, scope := range scopes {
+		if !scope.Valid() {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+		if scope == models.ScopeAdmin && (sessionID != "" || userID != "") {
+			return nil, "", ErrRestrictedAdmin
+		}
+	}
+	if userID != "" {
+		if _, err := s.users.GetByID(userID); errors.Is(err, repositories.ErrNotFound) {
+			return nil, "", ErrUnknownUser
+		} else if err != nil {
+			return nil, "", err
+		}
+	}
+
+	key, secret := models.NewAPIKey(name, scopes, sessionID)
+	key.UserID = userID
+	err := s.work.Do(func(tx *repositories.Store) error {
+		if workspace := tx.Workspace(); workspace != "" {
+			if _, err := tx.Workspaces.GetByID(workspace); errors.Is(err, repositories.ErrNotFound) {
+				return ErrUnknownWorkspace
+			} else if err != nil {
+				return err
+			}
+		}
+		err := tx.APIKeys.Create(key)
+		if errors.Is(err, repositories.ErrInvalidReference) {
+			return ErrUnknownSession
+		}
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// GetKey retrieves an API key by ID
+func (s *AuthService) GetKey(id string) (*models.APIKey, error) {
+	return s.keys.GetByID(id)
+}
+
+// PageKeys retrieves one page of API keys
+func (s *AuthService) PageKeys(page repositories.PageRequest) (*repositories.Page[*models.APIKey], error) {
+	return s.keys.List(page)
+}
+
+// RevokeKey stops an API key from being accepted
+func (s *AuthService) RevokeKey(id string) error {
+	return s.keys.Revoke(id, time.Now())
+}
+
+// Authenticate returns the active API key with the given secret
+func (s *AuthService) Authenticate(secret string) (*models.APIKey, error) {
+	if secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.keys.GetByHash(models.HashAPIKey(secret))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !key.Active() {
+		return nil, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// Bootstrap creates an admin key when there are no keys at all, so a fresh
+// install can mint the others. The key uses secret when given, otherwise a
+// random one that is returned. created reports whether a key was made.
+func (s *AuthService) Bootstrap(secret string) (key string, created bool, err error) {
+	err = s.work.Do(func(tx *repositories.Store) error {
+		count, err := tx.APIKeys.Count()
+		if err != nil || count > 0 {
+			return err
+		}
+
+		admin, generated := models.NewAPIKey("bootstrap", []models.Scope{models.ScopeAdmin}, "")
+		if secret != "" {
+			admin.SetSecret(secret)
+			generated = secret
+		}
+		if err := tx.APIKeys.Create(admin); err != nil {
+			return err
+		}
+		key, created = generated, true
+		return nil
+	})
+	return key, created, err
+}
+
+// AgentSession returns the ID of the session an agent belongs to
+func (s *AuthService) AgentSession(id string) (string, error) {
+	agent, err := s.agents.GetByID(id)
+	if err != nil {
+		return "", err
+	}
+	return agent.SessionID, nil
+}
+
+// MessageSession returns the ID of the session a message was posted in
+func (s *AuthService) MessageSession(id string) (string, error) {
+	message, err := s.messages.GetByID(id)
+	if err != nil {
+		return "", err
+	}
+	return message.SessionID, nil
+}
+
+// SessionRole returns a user's role in a session
+func (s *AuthService) SessionRole(sessionID, userID string) (models.SessionRole, error) {
+	member, err := s.users.GetMember(sessionID, userID)
+	if err != nil {
+		return "", err
+	}
+	return member.SessionRole, nil
+}
+
+// HasSession reports whether a session exists in the workspace s sees
+func (s *AuthService) HasSession(id string) (bool, error) {
+	_, err := s.sessions.GetByID(id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestAuthService(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	service := NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store)
+
+	secret, created, err := service.Bootstrap("cck_chosen")
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "cck_chosen", secret)
+	admin, err := service.Authenticate("cck_chosen")
+	require.NoError(t, err)
+	assert.True(t, admin.Allows(models.ScopeAdmin))
+
+	key, secret, err := service.CreateKey("bot", []models.Scope{models.ScopeMessagesRead}, "", "")
+	require.NoError(t, err)
+	authenticated, err := service.Authenticate(secret)
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, authenticated.ID)
+
+	require.NoError(t, service.RevokeKey(key.ID))
+	_, err = service.Authenticate(secret)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = service.Authenticate("")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	_, _, err = service.CreateKey("bot", []models.Scope{"everything"}, "", "")
+	assert.ErrorIs(t, err, ErrInvalidScope)
+	_, _, err = service.CreateKey("bot", []models.Scope{models.ScopeAdmin}, "session", "")
+	assert.ErrorIs(t, err, ErrRestrictedAdmin)
+	_, _, err = service.CreateKey("bot", []models.Scope{models.ScopeMessagesRead}, "missing", "")
+	assert.ErrorIs(t, err, ErrUnknownSession)
+}
@@ -1,53 +1,385 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/chatcollab/chatcollab/events"
 	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/ratelimit"
 	"github.com/chatcollab/chatcollab/repositories"
 )
 
+var (
+	// ErrParentNotFound is returned when replying to a message that does not exist
+	ErrParentNotFound = errors.New("message being replied to does not exist")
+
+	// ErrReplyAcrossSessions is returned when replying to a message in another session
+	ErrReplyAcrossSessions = errors.New("cannot reply to a message in another session")
+
+	// ErrRevisionNotFound is returned when diffing a revision a message does not have
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrUnknownSession is returned when posting to a session that does not exist
+	ErrUnknownSession = errors.New("session does not exist")
+
+	// ErrUnknownAgent is returned when a message names an agent that does not exist
+	ErrUnknownAgent = errors.New("agent does not exist")
+
+	// ErrUnknownUser is returned when a record names a user that does not exist
+	ErrUnknownUser = errors.New("user does not exist")
+
+	// ErrAgentNotInSession is returned when an agent posts to a session it is not part of
+	ErrAgentNotInSession = errors.New("agent does not belong to the session")
+
+	// ErrRateLimited is wrapped by RateLimitError when posting faster than allowed
+	ErrRateLimited = errors.New("rate limit exceeded")
+
+	// ErrMessageLimit is returned when posting to a session that holds as
+	// many messages as it allows
+	ErrMessageLimit = errors.New("session holds as many messages as it allows")
+)
+
+// RateLimitError is returned when an agent or session posts faster than its
+// rate limit allows
+type RateLimitError struct {
+	// Limit names what was limited: "agent" or "session"
+	Limit string
+
+	// RetryAfter is how long until the next message would be allowed
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: too many messages per %s, retry in %s", ErrRateLimited, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
 // MessageService handles business logic for messages
 type MessageService struct {
-	repo repositories.MessageRepository
+	repo          repositories.MessageStore
+	work          repositories.UnitOfWork
+	events        *events.Broker
+	agentLimits   *ratelimit.Limiter
+	sessionLimits *ratelimit.Limiter
 }
 
-// NewMessageService creates a new MessageService
-func NewMessageService() *MessageService {
+// NewMessageService creates a new MessageService backed by the given store,
+// checking new messages against their session and author in the same unit
+// of work that stores them
+func NewMessageService(store repositories.MessageStore, work repositories.UnitOfWork) *MessageService {
 	return &MessageService{
-		repo: repositories.MessageRepository{},
+		repo:   store,
+		work:   work,
+		events: events.Default,
 	}
 }
 
+// SetRateLimits limits how fast each agent, and everyone in each session,
+// may post. A nil Limiter leaves that unlimited.
+func (s *MessageService) SetRateLimits(agents, sessions *ratelimit.Limiter) {
+	s.agentLimits = agents
+	s.sessionLimits = sessions
+}
+
+// InWorkspace returns a MessageService that only sees the messages of one
+// workspace's sessions. An empty ID returns s itself.
+func (s *MessageService) InWorkspace(id string) *MessageService {
+	if id == "" {
+		return s
+	}
+	store := s.work.InWorkspace(id)
+	scoped := *s
+	scoped.repo = store.Messages
+	scoped.work = store
+	return &scoped
+}
+
 // CreateMessage creates a new message
 func (s *MessageService) CreateMessage(content, agentID, sessionID string) (*models.Message, error) {
-	message := models.NewMessage(content, agentID, sessionID)
-	err := s.repo.Create(message)
+	return s.CreateReply(content, agentID, sessionID, "")
+}
+
+// CreateReply creates a new message replying to replyTo, or a top-level
+// message when replyTo is empty
+func (s *MessageService) CreateReply(content, agentID, sessionID, replyTo string) (*models.Message, error) {
+	return s.post(models.NewMessage(content, agentID, sessionID), replyTo)
+}
+
+// CreateUserReply creates a new message written by a user, replying to
+// replyTo unless it is empty. A user who is not yet a participant joins the
+// session along with the message.
+func (s *MessageService) CreateUserReply(content, userID, sessionID, replyTo string) (*models.Message, error) {
+	return s.post(models.NewUserMessage(content, userID, sessionID), replyTo)
+}
+
+// post stores a new message, threading it under replyTo when set. The
+// message that fills its session up to its cap pauses the session.
+// A user author joins the session in the same unit of work.
+func (s *MessageService) post(message *models.Message, replyTo string) (*models.Message, error) {
+	if err := s.allow(message); err != nil {
+		return nil, err
+	}
+	
+	var paused *models.Session
+	var joined *models.Participant
+	err := s.work.Do(func(tx *repositories.Store) error {
+		session, err := checkSession(tx, message.SessionID)
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(tx, session.WorkspaceID, messageQuota, 1); err != nil {
+			return err
+		}
+		full, err := checkMessageLimit(tx, session)
+		if err != nil {
+			return err
+		}
+		if err := checkAgent(tx, message); err != nil {
+			return err
+		}
+		if replyTo != "" {
+			parent, err := tx.Messages.GetByID(replyTo)
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrParentNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if parent.SessionID != message.SessionID {
+				return ErrReplyAcrossSessions
+			}
+			message.ReplyTo(parent)
+		}
+		if err := tx.Messages.Create(message); err != nil {
+			return err
+		}
+		joined, err = joinAuthor(tx, message)
+		if err != nil {
+			return err
+		}
+		if !full {
+			return nil
+		}
+		session.Transition(models.SessionPaused)
+		paused = session
+		return tx.Sessions.Update(session)
+	})
 	if err != nil {
 		return nil, err
 	}
+	if joined != nil {
+		s.events.Publish(events.ParticipantPresence, message.SessionID, joined)
+	}
+	s.events.Publish(events.MessageCreated, message.SessionID, message)
+	if paused != nil {
+		s.events.Publish(events.SessionUpdated, paused.ID, paused)
+	}
 	return message, nil
 }
 
+// allow takes a token from the rate limits of the message's agent and
+// session, returning a RateLimitError when either has none left
+func (s *MessageService) allow(message *models.Message) error {
+	if message.AgentID != "" {
+		if ok, wait := s.agentLimits.Allow(message.AgentID); !ok {
+			return &RateLimitError{Limit: "agent", RetryAfter: wait}
+		}
+	}
+	if ok, wait := s.sessionLimits.Allow(message.SessionID); !ok {
+		return &RateLimitError{Limit: "session", RetryAfter: wait}
+	}
+	return nil
+}
+
+// checkMessageLimit refuses messages to a session already holding as many
+// as it allows, and reports whether one more message fills it
+func checkMessageLimit(tx *repositories.Store, session *models.Session) (bool, error) {
+	if session.MaxMessages == 0 {
+		return false, nil
+	}
+	count, err := tx.Messages.CountBySessionID(session.ID)
+	if err != nil {
+		return false, err
+	}
+	if count >= session.MaxMessages {
+		return false, ErrMessageLimit
+	}
+	return count+1 == session.MaxMessages, nil
+}
+
+// checkSession refuses messages to a session that does not exist or is not
+// running, and returns the session otherwise
+func checkSession(tx *repositories.Store, sessionID string) (*models.Session, error) {
+	session, err := tx.Sessions.GetByID(sessionID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrUnknownSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !session.AcceptsMessages() {
+		return nil, ErrSessionNotRunning
+	}
+	return session, nil
+}
+
+// checkAgent refuses agent messages unless the agent exists and is part of
+// the session. Messages written by users are left to the store.
+func checkAgent(tx *repositories.Store, message *models.Message) error {
+	if message.AgentID == "" {
+		return nil
+	}
+	agent, err := tx.Agents.GetByID(message.AgentID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrUnknownAgent
+	}
+	if err != nil {
+		return err
+	}
+	if agent.SessionID != message.SessionID {
+		return ErrAgentNotInSession
+	}
+	return nil
+}
+
+// joinAuthor makes the user who wrote a message a participant of its
+// session, returning the new participant or nil if they already were one
+func joinAuthor(tx *repositories.Store, message *models.Message) (*models.Participant, error) {
+	if message.UserID == "" {
+		return nil, nil
+	}
+	_, err := tx.Users.GetMember(message.SessionID, message.UserID)
+	if err == nil || !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+	user, err := tx.Users.GetByID(message.UserID)
+	if err != nil {
+		return nil, err
+	}
+	member := user.JoinSession(message.SessionID)
+	return member, tx.Users.AddMember(member)
+}
+
 // GetMessage retrieves a message by ID
 func (s *MessageService) GetMessage(id string) (*models.Message, error) {
 	return s.repo.GetByID(id)
 }
 
-// UpdateMessage updates a message's content
+// UpdateMessage updates a message's content on behalf of its author
 func (s *MessageService) UpdateMessage(id, content string) error {
+	_, err := s.EditMessage(id, 0, content, "")
+	return err
+}
+
+// EditMessage stores new content for a message as its next revision.
+// An empty editorID means the message's author made the edit. A non-zero
+// revision must match the stored message's, otherwise
+// repositories.ErrConflict is returned.
+func (s *MessageService) EditMessage(id string, revision int, content, editorID string) (*models.Message, error) {
 	message, err := s.repo.GetByID(id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if revision != 0 && message.Revision != revision {
+		return nil, repositories.ErrConflict
 	}
 	
-	message.Content = content
-	return s.repo.Update(message)
+	if editorID == "" {
+		editorID = message.AuthorID()
+	}
+	message.Edit(content, editorID)
+	if err := s.repo.Update(message); err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.MessageUpdated, message.SessionID, message)
+	return message, nil
+}
+
+// GetRevisions retrieves every revision of a message, oldest first
+func (s *MessageService) GetRevisions(id string) ([]*models.MessageRevision, error) {
+	if _, err := s.repo.GetByID(id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRevisions(id)
 }
 
-// DeleteMessage deletes a message
-func (s *MessageService) DeleteMessage(id string) error {
-	return s.repo.Delete(id)
+// RevisionDiff is a unified diff between two revisions of a message
+type RevisionDiff struct {
+	MessageID string `json:"messageId"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	Diff      string `json:"diff"`
+}
+
+// DiffRevisions compares two revisions of a message. A zero to means the
+// latest revision and a zero from means the one before to.
+func (s *MessageService) DiffRevisions(id string, from, to int) (*RevisionDiff, error) {
+	revisions, err := s.GetRevisions(id)
+	if err != nil {
+		return nil, err
+	}
+	
+	if to == 0 {
+		to = len(revisions)
+	}
+	if from == 0 {
+		from = max(to-1, 1)
+	}
+	
+	byNumber := make(map[int]*models.MessageRevision, len(revisions))
+	for _, revision := range revisions {
+		byNumber[revision.Revision] = revision
+	}
+	a, b := byNumber[from], byNumber[to]
+	if a == nil || b == nil {
+		return nil, ErrRevisionNotFound
+	}
+	
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a.Content + "\n"),
+		B:        difflib.SplitLines(b.Content + "\n"),
+		FromFile: fmt.Sprintf("revision %d", from),
+		ToFile:   fmt.Sprintf("revision %d", to),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RevisionDiff{MessageID: id, From: from, To: to, Diff: diff}, nil
+}
+
+// DeleteMessage deletes a message. A non-zero revision must match the
+// stored message's, otherwise repositories.ErrConflict is returned.
+func (s *MessageService) DeleteMessage(id string, revision int) error {
+	var message *models.Message
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		message, err = tx.Messages.GetByID(id)
+		if err != nil {
+			return err
+		}
+		if revision != 0 && message.Revision != revision {
+			return repositories.ErrConflict
+		}
+		return tx.Messages.Delete(id)
+	})
+	if err != nil {
+		return err
+	}
+	s.events.Publish(events.MessageDeleted, message.SessionID, message)
+	return nil
+}
+
+// Subscribe subscribes to the message events of a session, replaying
+// any buffered events published after lastEventID
+func (s *MessageService) Subscribe(sessionID string, lastEventID uint64) (*events.Subscription, []events.Event) {
+	return s.events.Subscribe(sessionID, lastEventID)
 }
 
 // GetSessionMessages retrieves all messages for a session
@@ -60,6 +392,74 @@ func (s *MessageService) GetAgentMessages(agentID string) ([]*models.Message, er
 	return s.repo.GetByAgentID(agentID)
 }
 
+// PageSessionMessages retrieves one page of a session's messages
+func (s *MessageService) PageSessionMessages(sessionID string, page repositories.PageRequest) (*repositories.Page[*models.Message], error) {
+	return s.repo.ListBySessionID(sessionID, page)
+}
+
+// RecentSessionMessages retrieves the last limit messages of a session,
+// oldest first, without reading the rest of its history
+func (s *MessageService) RecentSessionMessages(sessionID string, limit int) ([]*models.Message, error) {
+	page := repositories.PageRequest{Limit: limit, Order: repositories.OrderDesc}
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	recent, err := s.PageSessionMessages(sessionID, page)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := recent.Items
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// PageAgentMessages retrieves one page of an agent's messages
+func (s *MessageService) PageAgentMessages(agentID string, page repositories.PageRequest) (*repositories.Page[*models.Message], error) {
+	return s.repo.ListByAgentID(agentID, page)
+}
+
+// GetThread retrieves the thread a message belongs to: its root message
+// and every reply, oldest first. The root is nil if it has been deleted.
+func (s *MessageService) GetThread(id string) (*models.Message, []*models.Message, error) {
+	message, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	
+	rootID := message.ThreadRoot()
+	root := message
+	if rootID != message.ID {
+		root, err = s.repo.GetByID(rootID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			root = nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+	
+	replies, err := s.repo.GetThread(rootID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, replies, nil
+}
+
+// PageSessionThreads retrieves one page of a session's top-level messages with their reply counts
+func (s *MessageService) PageSessionThreads(sessionID string, page repositories.PageRequest) (*repositories.Page[*models.Message], error) {
+	return s.repo.ListThreadsBySessionID(sessionID, page)
+}
+
+// SearchMessages finds messages matching a full-text query, best matches first
+func (s *MessageService) SearchMessages(query repositories.SearchQuery) ([]*repositories.SearchHit, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return s.repo.Search(query)
+}
+
 // GetNewMessages retrieves all messages after a specific time
 func (s *MessageService) GetNewMessages(sessionID string, after time.Time) ([]*models.Message, error) {
 	return s.repo.GetMessagesAfter(sessionID, after)
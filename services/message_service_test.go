@@ -0,0 +1,176 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/ratelimit"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestMessageServicePublishesEvents(t *testing.T) {
+	testStores(t, testMessageServicePublishesEvents)
+}
+
+func testMessageServicePublishesEvents(t *testing.T, store *repositories.Store) {
+	service := NewMessageService(store.Messages, store)
+	session, err := NewSessionService(store.Sessions, store).CreateSession()
+	require.NoError(t, err)
+	agent, err := NewAgentService(store.Agents, store).CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+
+	sub, _ := service.Subscribe(session.ID, 0)
+	defer sub.Close()
+
+	message, err := service.CreateMessage("hello", agent.ID, session.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.UpdateMessage(message.ID, "edited"))
+	require.NoError(t, service.DeleteMessage(message.ID, 0))
+
+	for _, want := range []string{events.MessageCreated, events.MessageUpdated, events.MessageDeleted} {
+		event := <-sub.Events()
+		assert.Equal(t, want, event.Type)
+		assert.Equal(t, session.ID, event.SessionID)
+	}
+
+	assert.ErrorIs(t, service.DeleteMessage(message.ID, 0), repositories.ErrNotFound)
+
+	// A user's first message joins them to the session
+	user, err := NewParticipantService(store.Users, store.Agents, store).CreateUser("Alice")
+	require.NoError(t, err)
+	_, err = service.CreateUserReply("hi", user.ID, session.ID, "")
+	require.NoError(t, err)
+	_, err = service.CreateUserReply("again", user.ID, session.ID, "")
+	require.NoError(t, err)
+	for _, want := range []string{events.ParticipantPresence, events.MessageCreated, events.MessageCreated} {
+		assert.Equal(t, want, (<-sub.Events()).Type)
+	}
+	_, err = store.Users.GetMember(session.ID, user.ID)
+	assert.NoError(t, err)
+}
+
+func TestMessageServiceValidatesReferences(t *testing.T) {
+	testStores(t, testMessageServiceValidatesReferences)
+}
+
+func testMessageServiceValidatesReferences(t *testing.T, store *repositories.Store) {
+	sessions := NewSessionService(store.Sessions, store)
+	agents := NewAgentService(store.Agents, store)
+	service := NewMessageService(store.Messages, store)
+
+	session, err := sessions.CreateSession()
+	require.NoError(t, err)
+	other, err := sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := agents.CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+
+	_, err = service.CreateMessage("hello", agent.ID, "missing")
+	assert.ErrorIs(t, err, ErrUnknownSession)
+	_, err = service.CreateMessage("hello", "missing", session.ID)
+	assert.ErrorIs(t, err, ErrUnknownAgent)
+	_, err = service.CreateMessage("hello", agent.ID, other.ID)
+	assert.ErrorIs(t, err, ErrAgentNotInSession)
+	_, err = service.CreateUserReply("hello", "missing", session.ID, "")
+	assert.ErrorIs(t, err, repositories.ErrInvalidReference)
+
+	// A message with replies stays until its session goes, taking the thread with it
+	root, err := service.CreateMessage("root", agent.ID, session.ID)
+	require.NoError(t, err)
+	reply, err := service.CreateReply("reply", agent.ID, session.ID, root.ID)
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.DeleteMessage(root.ID, 0), repositories.ErrReferenced)
+	assert.ErrorIs(t, agents.DeleteAgent(agent.ID, 0), repositories.ErrReferenced)
+	require.NoError(t, sessions.DeleteSession(session.ID, 0))
+	_, err = service.GetMessage(reply.ID)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	_, err = agents.GetAgent(agent.ID)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	assert.ErrorIs(t, sessions.DeleteSession(session.ID, 0), repositories.ErrNotFound)
+}
+
+func TestMessageRateLimits(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := NewSessionService(store.Sessions, store)
+	agents := NewAgentService(store.Agents, store)
+	service := NewMessageService(store.Messages, store)
+	service.SetRateLimits(
+		ratelimit.NewLimiter(ratelimit.Limit{Count: 1, Per: time.Minute}),
+		ratelimit.NewLimiter(ratelimit.Limit{Count: 2, Per: time.Minute}),
+	)
+
+	session, err := sessions.CreateSession()
+	require.NoError(t, err)
+	writer, err := agents.CreateAgent("Writer", "author", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	editor, err := agents.CreateAgent("Editor", "editor", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+
+	// Each agent gets its own bucket, and the session one shared by all
+	_, err = service.CreateMessage("one", writer.ID, session.ID)
+	require.NoError(t, err)
+	_, err = service.CreateMessage("two", writer.ID, session.ID)
+	var limited *RateLimitError
+	require.ErrorAs(t, err, &limited)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, "agent", limited.Limit)
+	assert.Greater(t, limited.RetryAfter, time.Duration(0))
+
+	_, err = service.CreateMessage("three", editor.ID, session.ID)
+	require.NoError(t, err)
+	user, err := NewParticipantService(store.Users, store.Agents, store).CreateUser("Alice")
+	require.NoError(t, err)
+	_, err = service.CreateUserReply("four", user.ID, session.ID, "")
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, "session", limited.Limit)
+}
+
+func TestSessionMessageLimit(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := NewSessionService(store.Sessions, store)
+	sessions.SetMaxMessages(2)
+	service := NewMessageService(store.Messages, store)
+
+	session, err := sessions.CreateSession()
+	require.NoError(t, err)
+	assert.Equal(t, 2, session.MaxMessages)
+	agent, err := NewAgentService(store.Agents, store).CreateAgent("Writer", "author", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+
+	sub, _ := service.Subscribe(session.ID, 0)
+	defer sub.Close()
+
+	// The message reaching the cap pauses the session
+	_, err = service.CreateMessage("one", agent.ID, session.ID)
+	require.NoError(t, err)
+	_, err = service.CreateMessage("two", agent.ID, session.ID)
+	require.NoError(t, err)
+	stored, err := sessions.GetSession(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.SessionPaused, stored.Status)
+	_, err = service.CreateMessage("three", agent.ID, session.ID)
+	assert.ErrorIs(t, err, ErrSessionNotRunning)
+
+	var kinds []string
+	for len(kinds) < 3 {
+		kinds = append(kinds, (<-sub.Events()).Type)
+	}
+	assert.Equal(t, []string{events.MessageCreated, events.MessageCreated, events.SessionUpdated}, kinds)
+
+	// Resuming without raising the cap still refuses messages
+	_, err = sessions.TransitionSession(session.ID, models.SessionRunning)
+	require.NoError(t, err)
+	_, err = service.CreateMessage("three", agent.ID, session.ID)
+	assert.ErrorIs(t, err, ErrMessageLimit)
+
+	_, err = sessions.UpdateDetails(session.ID, 0, "", "", nil, -1)
+	assert.ErrorIs(t, err, ErrInvalidMessageLimit)
+	_, err = sessions.UpdateDetails(session.ID, 0, "", "", nil, 0)
+	require.NoError(t, err)
+	_, err = service.CreateMessage("three", agent.ID, session.ID)
+	require.NoError(t, err)
+}
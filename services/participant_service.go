@@ -0,0 +1,231 @@
+package services
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+var (
+	// ErrInvalidRole is returned when giving a user a role that does not exist
+	ErrInvalidRole = errors.New("role must be owner, member or viewer")
+
+	// ErrLastOwner is returned when a change would leave a session without an owner
+	ErrLastOwner = errors.New("a session must keep at least one owner")
+)
+
+// ParticipantService handles business logic for users and session membership
+type ParticipantService struct {
+	users  repositories.UserStore
+	agents repositories.AgentStore
+	work   repositories.UnitOfWork
+	events *events.Broker
+}
+
+// NewParticipantService creates a new ParticipantService backed by the given
+// stores, running multi-step changes as units of work
+func NewParticipantService(users repositories.UserStore, agents repositories.AgentStore, work repositories.UnitOfWork) *ParticipantService {
+	return &ParticipantService{
+		users:  users,
+		agents: agents,
+		work:   work,
+		events: events.Default,
+	}
+}
+
+// InWorkspace returns a ParticipantService that only sees one workspace's
+// users and the members and agents of its sessions. An empty ID returns s
+// itself.
+func (s *ParticipantService) InWorkspace(id string) *ParticipantService {
+	if id == "" {
+		return s
+	}
+	store := s.work.InWorkspace(id)
+	scoped := *s
+	scoped.users = store.Users
+	scoped.agents = store.Agents
+	scoped.work = store
+	return &scoped
+}
+
+// CreateUser creates a new user
+func (s *ParticipantService) CreateUser(name string) (*models.User, error) {
+	user := models.NewUser(name)
+	if err := s.users.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser retrieves a user by ID
+func (s *ParticipantService) GetUser(id string) (*models.User, error) {
+	return s.users.GetByID(id)
+}
+
+// UpdateUser updates a user
+func (s *ParticipantService) UpdateUser(user *models.User) error {
+	return s.users.Update(user)
+}
+
+// DeleteUser deletes a user and their session memberships
+func (s *ParticipantService) DeleteUser(id string) error {
+	return s.users.Delete(id)
+}
+
+// PageUsers retrieves one page of users
+func (s *ParticipantService) PageUsers(page repositories.PageRequest) (*repositories.Page[*models.User], error) {
+	return s.users.List(page)
+}
+
+// JoinSession adds a user to a session, online. Joining a session the user
+// is already in returns the existing membership and false.
+func (s *ParticipantService) JoinSession(sessionID, userID string) (*models.Participant, bool, error) {
+	var member *models.Participant
+	joined := false
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		member, err = tx.Users.GetMember(sessionID, userID)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+
+		user, err := tx.Users.GetByID(userID)
+		if err != nil {
+			return err
+		}
+		member = user.JoinSession(sessionID)
+		joined = true
+		return tx.Users.AddMember(member)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !joined {
+		return member, false, nil
+	}
+	s.events.Publish(events.ParticipantPresence, sessionID, member)
+	return member, true, nil
+}
+
+// SetUserOnlineStatus updates a user's presence in a session they have joined
+func (s *ParticipantService) SetUserOnlineStatus(sessionID, userID string, isOnline bool) error {
+	if err := s.users.SetMemberOnline(sessionID, userID, isOnline); err != nil {
+		return err
+	}
+	member, err := s.users.GetMember(sessionID, userID)
+	if err != nil {
+		return err
+	}
+	s.events.Publish(events.ParticipantPresence, sessionID, member)
+	return nil
+}
+
+// ListMembers lists the users who are members of a session with their
+// roles, in the order they joined
+func (s *ParticipantService) ListMembers(sessionID string) ([]*models.Participant, error) {
+	return s.users.GetBySessionID(sessionID)
+}
+
+// SetMemberRole gives a user a role in a session, adding them as an offline
+// member if they are not one yet. added reports whether they were added.
+func (s *ParticipantService) SetMemberRole(sessionID, userID string, role models.SessionRole) (*models.Participant, bool, error) {
+	if !role.Valid() {
+		return nil, false, ErrInvalidRole
+	}
+
+	var member *models.Participant
+	added := false
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		member, err = tx.Users.GetMember(sessionID, userID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			user, err := tx.Users.GetByID(userID)
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrUnknownUser
+			}
+			if err != nil {
+				return err
+			}
+			member = user.JoinSession(sessionID)
+			member.IsOnline = false
+			member.SessionRole = role
+			added = true
+			return tx.Users.AddMember(member)
+		}
+		if err != nil {
+			return err
+		}
+
+		if member.SessionRole == models.RoleOwner && role != models.RoleOwner {
+			if err := keepOwner(tx, sessionID, userID); err != nil {
+				return err
+			}
+		}
+		member.SessionRole = role
+		return tx.Users.SetMemberRole(sessionID, userID, role)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	s.events.Publish(events.ParticipantPresence, sessionID, member)
+	return member, added, nil
+}
+
+// RemoveMember takes a user out of a session
+func (s *ParticipantService) RemoveMember(sessionID, userID string) error {
+	return s.work.Do(func(tx *repositories.Store) error {
+		member, err := tx.Users.GetMember(sessionID, userID)
+		if err != nil {
+			return err
+		}
+		if member.SessionRole == models.RoleOwner {
+			if err := keepOwner(tx, sessionID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Users.RemoveMember(sessionID, userID)
+	})
+}
+
+// keepOwner returns ErrLastOwner unless the session has an owner other than userID
+func keepOwner(tx *repositories.Store, sessionID, userID string) error {
+	members, err := tx.Users.GetBySessionID(sessionID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.ID != userID && member.SessionRole == models.RoleOwner {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
+
+// ListParticipants lists a session's agents and the users who joined it,
+// with their presence, in the order they joined
+func (s *ParticipantService) ListParticipants(sessionID string) ([]*models.Participant, error) {
+	agents, err := s.agents.GetBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.users.GetBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	participants := make([]*models.Participant, 0, len(agents)+len(members))
+	for _, agent := range agents {
+		participants = append(participants, agent.Participant())
+	}
+	participants = append(participants, members...)
+	sort.SliceStable(participants, func(i, j int) bool {
+		return participants[i].JoinedAt.Before(participants[j].JoinedAt)
+	})
+	return participants, nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestSessionRoles(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := NewSessionService(store.Sessions, store)
+	participants := NewParticipantService(store.Users, store.Agents, store)
+	auth := NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store)
+
+	alice, err := participants.CreateUser("Alice")
+	require.NoError(t, err)
+	bob, err := participants.CreateUser("Bob")
+	require.NoError(t, err)
+
+	session, err := sessions.CreateOwnedSession(alice.ID, "Plan", "", nil, models.SessionRunning)
+	require.NoError(t, err)
+	role, err := auth.SessionRole(session.ID, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleOwner, role)
+	_, err = sessions.CreateOwnedSession("missing", "", "", nil, models.SessionRunning)
+	assert.ErrorIs(t, err, ErrUnknownUser)
+	_, err = sessions.CreateSession()
+	require.NoError(t, err)
+
+	owned, err := sessions.PageMemberSessions(alice.ID, repositories.PageRequest{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, owned.Items, 1)
+	assert.Equal(t, session.ID, owned.Items[0].ID)
+	active, err := sessions.ListActiveMemberSessions(alice.ID, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, active, 1)
+
+	// Setting a role adds the user, offline, or changes the role they have
+	member, added, err := participants.SetMemberRole(session.ID, bob.ID, models.RoleViewer)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.False(t, member.IsOnline)
+	member, added, err = participants.SetMemberRole(session.ID, bob.ID, models.RoleMember)
+	require.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, models.RoleMember, member.SessionRole)
+	_, _, err = participants.SetMemberRole(session.ID, bob.ID, "admin")
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	_, _, err = participants.SetMemberRole(session.ID, "missing", models.RoleViewer)
+	assert.ErrorIs(t, err, ErrUnknownUser)
+
+	// Sessions keep at least one owner
+	_, _, err = participants.SetMemberRole(session.ID, alice.ID, models.RoleMember)
+	assert.ErrorIs(t, err, ErrLastOwner)
+	assert.ErrorIs(t, participants.RemoveMember(session.ID, alice.ID), ErrLastOwner)
+	_, _, err = participants.SetMemberRole(session.ID, bob.ID, models.RoleOwner)
+	require.NoError(t, err)
+	require.NoError(t, participants.RemoveMember(session.ID, alice.ID))
+	_, err = auth.SessionRole(session.ID, alice.ID)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+	assert.ErrorIs(t, participants.RemoveMember(session.ID, alice.ID), repositories.ErrNotFound)
+
+	// Keys can act for a user, unless they are admin keys
+	key, _, err := auth.CreateKey("bob", []models.Scope{models.ScopeSessionsWrite}, "", bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, bob.ID, key.UserID)
+	_, _, err = auth.CreateKey("bob", []models.Scope{models.ScopeAdmin}, "", bob.ID)
+	assert.ErrorIs(t, err, ErrRestrictedAdmin)
+	_, _, err = auth.CreateKey("bob", []models.Scope{models.ScopeSessionsRead}, "", "missing")
+	assert.ErrorIs(t, err, ErrUnknownUser)
+}
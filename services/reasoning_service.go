@@ -0,0 +1,101 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+var (
+	// ErrInvalidStep is returned when recording a step type that is not known
+	ErrInvalidStep = fmt.Errorf("type must be one of %q, %q, %q or %q",
+		models.StepThought, models.StepPlan, models.StepToolCall, models.StepObservation)
+
+	// ErrEmptyReasoning is returned when recording an entry with neither content nor payload
+	ErrEmptyReasoning = errors.New("reasoning entry needs content or a payload")
+
+	// ErrInvalidPayload is returned when an entry's payload is not valid JSON
+	ErrInvalidPayload = errors.New("payload must be valid JSON")
+)
+
+// ReasoningService handles business logic for agents' reasoning entries
+type ReasoningService struct {
+	repo   repositories.ReasoningStore
+	agents repositories.AgentStore
+	work   repositories.UnitOfWork
+	events *events.Broker
+}
+
+// NewReasoningService creates a new ReasoningService backed by the given
+// stores, recording each entry in a unit of work with the agent it belongs to
+func NewReasoningService(store repositories.ReasoningStore, agents repositories.AgentStore, work repositories.UnitOfWork) *ReasoningService {
+	return &ReasoningService{
+		repo:   store,
+		agents: agents,
+		work:   work,
+		events: events.Default,
+	}
+}
+
+// InWorkspace returns a ReasoningService that only sees the reasoning of one
+// workspace's agents. An empty ID returns s itself.
+func (s *ReasoningService) InWorkspace(id string) *ReasoningService {
+	if id == "" {
+		return s
+	}
+	store := s.work.InWorkspace(id)
+	scoped := *s
+	scoped.repo = store.Reasoning
+	scoped.agents = store.Agents
+	scoped.work = store
+	return &scoped
+}
+
+// RecordReasoning adds a step to an agent's reasoning, in the agent's current session
+func (s *ReasoningService) RecordReasoning(agentID string, step models.ReasoningStep, content, messageID string, payload json.RawMessage) (*models.ReasoningEntry, error) {
+	if !step.Valid() {
+		return nil, ErrInvalidStep
+	}
+	if content == "" && len(payload) == 0 {
+		return nil, ErrEmptyReasoning
+	}
+	if len(payload) > 0 && !json.Valid(payload) {
+		return nil, ErrInvalidPayload
+	}
+
+	var entry *models.ReasoningEntry
+	err := s.work.Do(func(tx *repositories.Store) error {
+		agent, err := tx.Agents.GetByID(agentID)
+		if err != nil {
+			return err
+		}
+
+		entry = models.NewReasoningEntry(agent.ID, agent.SessionID, step, content)
+		entry.MessageID = messageID
+		entry.Payload = payload
+		return tx.Reasoning.Create(entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.AgentReasoning, entry.SessionID, entry)
+	return entry, nil
+}
+
+// AppendReasoningLog records a line of free-form reasoning as a thought
+func (s *ReasoningService) AppendReasoningLog(agentID, log string) error {
+	_, err := s.RecordReasoning(agentID, models.StepThought, log, "", nil)
+	return err
+}
+
+// PageReasoning retrieves one page of an agent's reasoning entries matching the filter
+func (s *ReasoningService) PageReasoning(agentID string, filter repositories.ReasoningFilter, page repositories.PageRequest) (*repositories.Page[*models.ReasoningEntry], error) {
+	if _, err := s.agents.GetByID(agentID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByAgentID(agentID, filter, page)
+}
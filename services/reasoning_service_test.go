@@ -0,0 +1,54 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestReasoningService(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	agents := NewAgentService(store.Agents, store)
+	service := NewReasoningService(store.Reasoning, store.Agents, store)
+	session, err := NewSessionService(store.Sessions, store).CreateSession()
+	require.NoError(t, err)
+
+	agent, err := agents.CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	message, err := NewMessageService(store.Messages, store).CreateMessage("answer", agent.ID, session.ID)
+	require.NoError(t, err)
+
+	sub, _ := events.Default.Subscribe(session.ID, 0)
+	defer sub.Close()
+
+	require.NoError(t, service.AppendReasoningLog(agent.ID, "thinking"))
+	entry, err := service.RecordReasoning(agent.ID, models.StepToolCall, "", message.ID, json.RawMessage(`{"tool":"search"}`))
+	require.NoError(t, err)
+	assert.Equal(t, session.ID, entry.SessionID)
+
+	for i := 0; i < 2; i++ {
+		event := <-sub.Events()
+		assert.Equal(t, events.AgentReasoning, event.Type)
+	}
+
+	page, err := service.PageReasoning(agent.ID, repositories.ReasoningFilter{}, repositories.PageRequest{Limit: 10, Order: repositories.OrderAsc})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, models.StepThought, page.Items[0].Step)
+	assert.Equal(t, "thinking", page.Items[0].Content)
+
+	_, err = service.RecordReasoning(agent.ID, "daydream", "content", "", nil)
+	assert.ErrorIs(t, err, ErrInvalidStep)
+	_, err = service.RecordReasoning(agent.ID, models.StepPlan, "", "", nil)
+	assert.ErrorIs(t, err, ErrEmptyReasoning)
+	_, err = service.RecordReasoning(agent.ID, models.StepPlan, "", "", json.RawMessage(`{broken`))
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+	assert.ErrorIs(t, service.AppendReasoningLog("missing", "thinking"), repositories.ErrNotFound)
+	_, err = service.PageReasoning("missing", repositories.ReasoningFilter{}, repositories.PageRequest{Limit: 10, Order: repositories.OrderAsc})
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
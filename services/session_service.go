@@ -1,53 +1,289 @@
 package services
 
 import (
+	"errors"
 	"time"
 
+	"github.com/chatcollab/chatcollab/events"
 	"github.com/chatcollab/chatcollab/models"
 	"github.com/chatcollab/chatcollab/repositories"
 )
 
+var (
+	// ErrInvalidStatus is returned for a session status that does not exist,
+	// or that a new session cannot start in
+	ErrInvalidStatus = errors.New("invalid session status")
+
+	// ErrInvalidTransition is returned when a session's lifecycle does not
+	// allow moving to the requested status
+	ErrInvalidTransition = errors.New("session cannot move to that status")
+
+	// ErrSessionNotRunning is returned when posting to a session that is not running
+	ErrSessionNotRunning = errors.New("session is not running")
+
+	// ErrInvalidMessageLimit is returned for a negative message cap
+	ErrInvalidMessageLimit = errors.New("maxMessages cannot be negative")
+
+	// errUnchanged ends a unit of work that found nothing to change
+	errUnchanged = errors.New("session unchanged")
+)
+
+// DefaultSessionTimeout is how long a session may go without a heartbeat
+// before it no longer counts as active
+const DefaultSessionTimeout = 5 * time.Minute
+
 // SessionService handles business logic for sessions
 type SessionService struct {
-	repo repositories.SessionRepository
+	repo        repositories.SessionStore
+	work        repositories.UnitOfWork
+	events      *events.Broker
+	timeout     time.Duration
+	maxMessages int
 }
 
-// NewSessionService creates a new SessionService
-func NewSessionService() *SessionService {
+// NewSessionService creates a new SessionService backed by the given store,
+// running multi-step changes as units of work
+func NewSessionService(store repositories.SessionStore, work repositories.UnitOfWork) *SessionService {
 	return &SessionService{
-		repo: repositories.SessionRepository{},
+		repo:    store,
+		work:    work,
+		events:  events.Default,
+		timeout: DefaultSessionTimeout,
 	}
 }
 
-// CreateSession creates a new session
+// InWorkspace returns a SessionService that only sees and creates the
+// sessions of one workspace. An empty ID returns s itself.
+func (s *SessionService) InWorkspace(id string) *SessionService {
+	if id == "" {
+		return s
+	}
+	store := s.work.InWorkspace(id)
+	scoped := *s
+	scoped.repo = store.Sessions
+	scoped.work = store
+	return &scoped
+}
+
+// Timeout returns how long a session may go without a heartbeat before it
+// no longer counts as active
+func (s *SessionService) Timeout() time.Duration {
+	return s.timeout
+}
+
+// SetTimeout changes how long a session may go without a heartbeat
+func (s *SessionService) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+// SetMaxMessages changes how many messages new sessions may hold before
+// they pause. Zero means no cap.
+func (s *SessionService) SetMaxMessages(max int) {
+	s.maxMessages = max
+}
+
+// CreateSession creates a new running session
 func (s *SessionService) CreateSession() (*models.Session, error) {
-	session := models.NewSession()
-	err := s.repo.Create(session)
+	return s.CreateSessionWithDetails("", "", nil, models.SessionRunning)
+}
+
+// CreateSessionWithDetails creates a new session with a title, goal and
+// tags, either as a draft or already running
+func (s *SessionService) CreateSessionWithDetails(title, goal string, tags []string, status models.SessionStatus) (*models.Session, error) {
+	if status != models.SessionDraft && status != models.SessionRunning {
+		return nil, ErrInvalidStatus
+	}
+	
+	session := newSession(title, goal, tags, status)
+	session.MaxMessages = s.maxMessages
+	err := s.work.Do(func(tx *repositories.Store) error {
+		if err := checkQuota(tx, tx.Workspace(), sessionQuota, 1); err != nil {
+			return err
+		}
+		return tx.Sessions.Create(session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// CreateOwnedSession creates a new session like CreateSessionWithDetails
+// with the given user as its owner
+func (s *SessionService) CreateOwnedSession(ownerID, title, goal string, tags []string, status models.SessionStatus) (*models.Session, error) {
+	if status != models.SessionDraft && status != models.SessionRunning {
+		return nil, ErrInvalidStatus
+	}
+
+	session := newSession(title, goal, tags, status)
+	session.MaxMessages = s.maxMessages
+	err := s.work.Do(func(tx *repositories.Store) error {
+		owner, err := tx.Users.GetByID(ownerID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUnknownUser
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(tx, tx.Workspace(), sessionQuota, 1); err != nil {
+			return err
+		}
+		if err := tx.Sessions.Create(session); err != nil {
+			return err
+		}
+		member := owner.JoinSession(session.ID)
+		member.SessionRole = models.RoleOwner
+		return tx.Users.AddMember(member)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
+// newSession builds a session with the given details, not yet stored
+func newSession(title, goal string, tags []string, status models.SessionStatus) *models.Session {
+	session := models.NewSession()
+	session.Title = title
+	session.Goal = goal
+	if tags != nil {
+		session.Tags = tags
+	}
+	session.Status = status
+	return session
+}
+
 // GetSession retrieves a session by ID
 func (s *SessionService) GetSession(id string) (*models.Session, error) {
 	return s.repo.GetByID(id)
 }
 
-// UpdateHeartbeat updates a session's heartbeat
+// UpdateHeartbeat updates a session's heartbeat, waking it if it went idle
 func (s *SessionService) UpdateHeartbeat(id string) error {
-	session, err := s.repo.GetByID(id)
+	session, err := s.repo.Touch(id, time.Now())
 	if err != nil {
 		return err
 	}
-	
-	session.UpdateHeartbeat()
-	return s.repo.Update(session)
+	s.events.Publish(events.SessionHeartbeat, session.ID, session)
+	return nil
+}
+
+// UpdateDetails replaces the title, goal, tags and message cap of a session
+// that is still at the given version, or at any version when it is zero. A
+// session that has moved on returns repositories.ErrConflict.
+func (s *SessionService) UpdateDetails(id string, version int, title, goal string, tags []string, maxMessages int) (*models.Session, error) {
+	if maxMessages < 0 {
+		return nil, ErrInvalidMessageLimit
+	}
+	return s.change(id, version, func(session *models.Session) error {
+		session.Title = title
+		session.Goal = goal
+		session.Tags = tags
+		session.MaxMessages = maxMessages
+		return nil
+	})
 }
 
-// DeleteSession deletes a session
-func (s *SessionService) DeleteSession(id string) error {
-	return s.repo.Delete(id)
+// TransitionSession moves a session to the next status in its lifecycle
+func (s *SessionService) TransitionSession(id string, status models.SessionStatus) (*models.Session, error) {
+	if !status.Valid() {
+		return nil, ErrInvalidStatus
+	}
+	return s.change(id, 0, func(session *models.Session) error {
+		if !session.Transition(status) {
+			return ErrInvalidTransition
+		}
+		return nil
+	})
+}
+
+// ExpireSession idles a running session that has gone without a heartbeat
+// for the timeout, reporting whether it did. A heartbeat arriving first
+// leaves the session running.
+func (s *SessionService) ExpireSession(id string, timeout time.Duration) (bool, error) {
+	_, err := s.change(id, 0, func(session *models.Session) error {
+		if session.Status != models.SessionRunning || session.IsActive(timeout) {
+			return errUnchanged
+		}
+		session.Transition(models.SessionIdle)
+		return nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// change applies fn to a session and stores the result as one unit of work,
+// announcing the change once it is committed. A non-zero version must match
+// the stored session's.
+func (s *SessionService) change(id string, version int, fn func(session *models.Session) error) (*models.Session, error) {
+	var session *models.Session
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		session, err = tx.Sessions.GetByID(id)
+		if err != nil {
+			return err
+		}
+		if version != 0 && session.Version != version {
+			return repositories.ErrConflict
+		}
+		if err := fn(session); err != nil {
+			return err
+		}
+		return tx.Sessions.Update(session)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.events.Publish(events.SessionUpdated, session.ID, session)
+	return session, nil
+}
+
+// DeleteSession deletes a session along with its agents, messages and
+// members. A non-zero version must match the stored session's, otherwise
+// repositories.ErrConflict is returned.
+func (s *SessionService) DeleteSession(id string, version int) error {
+	err := s.work.Do(func(tx *repositories.Store) error {
+		if version != 0 {
+			session, err := tx.Sessions.GetByID(id)
+			if err != nil {
+				return err
+			}
+			if session.Version != version {
+				return repositories.ErrConflict
+			}
+		}
+		return tx.Sessions.Delete(id)
+	})
+	if err != nil {
+		return err
+	}
+	s.events.Publish(events.SessionDeleted, id, map[string]string{"id": id})
+	return nil
+}
+
+// PurgeSession deletes a session, with everything in it, that has gone
+// without a heartbeat for the given age, reporting whether it did. A
+// heartbeat arriving first keeps the session.
+func (s *SessionService) PurgeSession(id string, age time.Duration) (bool, error) {
+	purged := false
+	err := s.work.Do(func(tx *repositories.Store) error {
+		session, err := tx.Sessions.GetByID(id)
+		if err != nil {
+			return err
+		}
+		if session.IsActive(age) {
+			return nil
+		}
+		purged = true
+		return tx.Sessions.Delete(id)
+	})
+	if err != nil || !purged {
+		return false, err
+	}
+	s.events.Publish(events.SessionDeleted, id, map[string]string{"id": id})
+	return true, nil
 }
 
 // ListSessions lists all sessions
@@ -55,11 +291,52 @@ func (s *SessionService) ListSessions() ([]*models.Session, error) {
 	return s.repo.ListAll()
 }
 
+// PageSessions retrieves one page of sessions
+func (s *SessionService) PageSessions(page repositories.PageRequest) (*repositories.Page[*models.Session], error) {
+	return s.repo.List(page)
+}
+
+// PageMemberSessions retrieves one page of the sessions a user is a member of
+func (s *SessionService) PageMemberSessions(userID string, page repositories.PageRequest) (*repositories.Page[*models.Session], error) {
+	return s.repo.ListByMember(userID, page)
+}
+
 // ListActiveSessions lists all active sessions
 func (s *SessionService) ListActiveSessions(timeout time.Duration) ([]*models.Session, error) {
 	return s.repo.GetActiveSessions(timeout)
 }
 
+// ListActiveMemberSessions lists the active sessions a user is a member of
+func (s *SessionService) ListActiveMemberSessions(userID string, timeout time.Duration) ([]*models.Session, error) {
+	var active []*models.Session
+	page := repositories.PageRequest{Limit: repositories.MaxPageLimit, Order: repositories.OrderAsc}
+	for {
+		sessions, err := s.repo.ListByMember(userID, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range sessions.Items {
+			if session.IsActive(timeout) {
+				active = append(active, session)
+			}
+		}
+		if sessions.NextCursor == "" {
+			return active, nil
+		}
+		cursor, err := repositories.DecodeCursor(sessions.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		page.After = &cursor
+	}
+}
+
+// ListInactiveSessions lists the sessions that have gone without a
+// heartbeat for longer than the given age
+func (s *SessionService) ListInactiveSessions(age time.Duration) ([]*models.Session, error) {
+	return s.repo.GetInactiveSessions(age)
+}
+
 // IsSessionActive checks if a session is active
 func (s *SessionService) IsSessionActive(id string, timeout time.Duration) (bool, error) {
 	session, err := s.repo.GetByID(id)
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := NewSessionService(store.Sessions, store)
+	messages := NewMessageService(store.Messages, store)
+
+	session, err := sessions.CreateSessionWithDetails("Launch", "Pick a date", []string{"launch"}, models.SessionDraft)
+	require.NoError(t, err)
+	_, err = sessions.CreateSessionWithDetails("Launch", "", nil, models.SessionCompleted)
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+	agent, err := NewAgentService(store.Agents, store).CreateAgent("Agent", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+
+	_, err = messages.CreateMessage("too early", agent.ID, session.ID)
+	assert.ErrorIs(t, err, ErrSessionNotRunning)
+
+	sub, _ := events.Default.Subscribe(session.ID, 0)
+	defer sub.Close()
+
+	session, err = sessions.TransitionSession(session.ID, models.SessionRunning)
+	require.NoError(t, err)
+	assert.Equal(t, models.SessionRunning, session.Status)
+	event := <-sub.Events()
+	assert.Equal(t, events.SessionUpdated, event.Type)
+
+	_, err = messages.CreateMessage("hello", agent.ID, session.ID)
+	require.NoError(t, err)
+
+	_, err = sessions.TransitionSession(session.ID, models.SessionCompleted)
+	require.NoError(t, err)
+	_, err = messages.CreateMessage("too late", agent.ID, session.ID)
+	assert.ErrorIs(t, err, ErrSessionNotRunning)
+	_, err = sessions.TransitionSession(session.ID, models.SessionPaused)
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+	_, err = sessions.TransitionSession(session.ID, "closed")
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+	_, err = sessions.TransitionSession("missing", models.SessionPaused)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
+
+func TestSessionServiceChecksBeforeChanging(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	sessions := NewSessionService(store.Sessions, store)
+	agents := NewAgentService(store.Agents, store)
+
+	_, err := agents.CreateAgent("Agent", "assistant", "prompt", "gpt-4", "missing")
+	assert.ErrorIs(t, err, ErrUnknownSession)
+	_, err = NewTemplateService(store.Templates, store).InstantiateTemplates("missing", nil, false)
+	assert.ErrorIs(t, err, ErrUnknownSession)
+
+	stale := models.NewSession()
+	stale.LastHeartbeat = time.Now().Add(-time.Hour)
+	require.NoError(t, store.Sessions.Create(stale))
+	fresh, err := sessions.CreateSession()
+	require.NoError(t, err)
+
+	// Sessions that sent a heartbeat are neither expired nor purged
+	expired, err := sessions.ExpireSession(fresh.ID, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, expired)
+	purged, err := sessions.PurgeSession(fresh.ID, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, purged)
+
+	expired, err = sessions.ExpireSession(stale.ID, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, expired)
+	expired, err = sessions.ExpireSession(stale.ID, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, expired)
+	purged, err = sessions.PurgeSession(stale.ID, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, purged)
+	_, err = sessions.PurgeSession(stale.ID, time.Minute)
+	assert.ErrorIs(t, err, repositories.ErrNotFound)
+}
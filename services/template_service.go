@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+var (
+	// ErrTemplateNotFound is returned when instantiating a template that does not exist
+	ErrTemplateNotFound = errors.New("agent template does not exist")
+
+	// ErrNoTemplate is returned when pinning an agent that was not made from a template
+	ErrNoTemplate = errors.New("agent was not made from a template")
+)
+
+// TemplateService handles business logic for agent templates
+type TemplateService struct {
+	repo repositories.TemplateStore
+	work repositories.UnitOfWork
+}
+
+// NewTemplateService creates a new TemplateService backed by the given store,
+// updating templates and their agents together as units of work
+func NewTemplateService(store repositories.TemplateStore, work repositories.UnitOfWork) *TemplateService {
+	return &TemplateService{
+		repo: store,
+		work: work,
+	}
+}
+
+// InWorkspace returns a TemplateService that only sees and creates the
+// templates of one workspace. An empty ID returns s itself.
+func (s *TemplateService) InWorkspace(id string) *TemplateService {
+	if id == "" {
+		return s
+	}
+	store := s.work.InWorkspace(id)
+	scoped := *s
+	scoped.repo = store.Templates
+	scoped.work = store
+	return &scoped
+}
+
+// CreateTemplate creates a new agent template
+func (s *TemplateService) CreateTemplate(name, role, prompt, model string) (*models.AgentTemplate, error) {
+	template := models.NewAgentTemplate(name, role, prompt, model)
+	if err := s.repo.Create(template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// GetTemplate retrieves a template by ID
+func (s *TemplateService) GetTemplate(id string) (*models.AgentTemplate, error) {
+	return s.repo.GetByID(id)
+}
+
+// PageTemplates retrieves one page of templates
+func (s *TemplateService) PageTemplates(page repositories.PageRequest) (*repositories.Page[*models.AgentTemplate], error) {
+	return s.repo.List(page)
+}
+
+// UpdateTemplate stores a new version of a template and moves every unpinned
+// agent made from it to that version
+func (s *TemplateService) UpdateTemplate(id, name, role, prompt, model string) (*models.AgentTemplate, error) {
+	var template *models.AgentTemplate
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		template, err = tx.Templates.GetByID(id)
+		if err != nil {
+			return err
+		}
+
+		template.Revise(name, role, prompt, model)
+		if err := tx.Templates.Update(template); err != nil {
+			return err
+		}
+
+		agents, err := tx.Agents.GetByTemplateID(template.ID)
+		if err != nil {
+			return err
+		}
+		for _, agent := range agents {
+			if !agent.SyncTemplate(template) {
+				continue
+			}
+			if err := tx.Agents.Update(agent); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// DeleteTemplate deletes a template. Agents made from it keep their
+// definition but no longer follow it.
+func (s *TemplateService) DeleteTemplate(id string) error {
+	return s.work.Do(func(tx *repositories.Store) error {
+		agents, err := tx.Agents.GetByTemplateID(id)
+		if err != nil {
+			return err
+		}
+		for _, agent := range agents {
+			agent.TemplateID = ""
+			agent.TemplateVersion = 0
+			agent.Pinned = false
+			if err := tx.Agents.Update(agent); err != nil {
+				return err
+			}
+		}
+		return tx.Templates.Delete(id)
+	})
+}
+
+// InstantiateTemplates creates one agent in the session from each template,
+// each with its own token. Pinned agents stay on the template's current version.
+func (s *TemplateService) InstantiateTemplates(sessionID string, templateIDs []string, pinned bool) ([]*models.Agent, error) {
+	agents := make([]*models.Agent, 0, len(templateIDs))
+	err := s.work.Do(func(tx *repositories.Store) error {
+		session, err := tx.Sessions.GetByID(sessionID)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrUnknownSession
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(tx, session.WorkspaceID, agentQuota, len(templateIDs)); err != nil {
+			return err
+		}
+
+		for _, id := range templateIDs {
+			template, err := tx.Templates.GetByID(id)
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrTemplateNotFound
+			}
+			if err != nil {
+				return err
+			}
+
+			agent := template.Instantiate(sessionID)
+			agent.Pinned = pinned
+			if err := tx.Agents.Create(agent); err != nil {
+				return err
+			}
+			if err := issueToken(tx, agent); err != nil {
+				return err
+			}
+			agents = append(agents, agent)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// SetAgentPinned pins an agent to the template version it runs, or unpins it
+// and brings it up to date with its template
+func (s *TemplateService) SetAgentPinned(agentID string, pinned bool) (*models.Agent, error) {
+	var agent *models.Agent
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		agent, err = tx.Agents.GetByID(agentID)
+		if err != nil {
+			return err
+		}
+		if agent.TemplateID == "" {
+			return ErrNoTemplate
+		}
+
+		agent.Pinned = pinned
+		if !pinned {
+			template, err := tx.Templates.GetByID(agent.TemplateID)
+			if err != nil {
+				return err
+			}
+			agent.SyncTemplate(template)
+		}
+		return tx.Agents.Update(agent)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
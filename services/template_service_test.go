@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestTemplateService(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	service := NewTemplateService(store.Templates, store)
+	session, err := NewSessionService(store.Sessions, store).CreateSession()
+	require.NoError(t, err)
+
+	template, err := service.CreateTemplate("Reviewer", "critic", "Review carefully", "gpt-4")
+	require.NoError(t, err)
+
+	agents, err := service.InstantiateTemplates(session.ID, []string{template.ID, template.ID}, false)
+	require.NoError(t, err)
+	require.Len(t, agents, 2)
+	_, err = service.SetAgentPinned(agents[1].ID, true)
+	require.NoError(t, err)
+
+	// Only the unpinned agent follows the new prompt
+	_, err = service.UpdateTemplate(template.ID, "Reviewer", "critic", "Review very carefully", "gpt-4")
+	require.NoError(t, err)
+	following, err := store.Agents.GetByID(agents[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Review very carefully", following.Prompt)
+	assert.Equal(t, 2, following.TemplateVersion)
+	pinned, err := store.Agents.GetByID(agents[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Review carefully", pinned.Prompt)
+
+	// Unpinning catches the agent up
+	unpinned, err := service.SetAgentPinned(pinned.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Review very carefully", unpinned.Prompt)
+
+	_, err = service.InstantiateTemplates(session.ID, []string{"missing"}, false)
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+	plain, err := NewAgentService(store.Agents, store).CreateAgent("Plain", "assistant", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	_, err = service.SetAgentPinned(plain.ID, true)
+	assert.ErrorIs(t, err, ErrNoTemplate)
+
+	// Deleting the template leaves its agents in place, detached
+	require.NoError(t, service.DeleteTemplate(template.ID))
+	detached, err := store.Agents.GetByID(agents[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, detached.TemplateID)
+	assert.Equal(t, "Review very carefully", detached.Prompt)
+}
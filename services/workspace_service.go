@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+var (
+	// ErrQuotaExceeded is returned when a workspace already holds as many
+	// sessions, agents or messages as its quotas allow
+	ErrQuotaExceeded = errors.New("workspace quota exceeded")
+
+	// ErrInvalidQuotas is returned for a negative quota
+	ErrInvalidQuotas = errors.New("quotas cannot be negative")
+
+	// ErrUnknownWorkspace is returned when a record names a workspace that does not exist
+	ErrUnknownWorkspace = errors.New("workspace does not exist")
+
+	// ErrDefaultWorkspace is returned when deleting the default workspace
+	ErrDefaultWorkspace = errors.New("the default workspace cannot be deleted")
+)
+
+// WorkspaceUsage counts what a workspace holds, to compare with its quotas
+type WorkspaceUsage struct {
+	Sessions int `json:"sessions"`
+	Agents   int `json:"agents"`
+	Messages int `json:"messages"`
+}
+
+// quota is one of a workspace's limits and how to count what it holds against it
+type quota struct {
+	name  string
+	limit func(models.Quotas) int
+	count func(tx *repositories.Store) (int, error)
+}
+
+var (
+	sessionQuota = quota{
+		name:  "sessions",
+		limit: func(q models.Quotas) int { return q.Sessions },
+		count: func(tx *repositories.Store) (int, error) { return tx.Sessions.Count() },
+	}
+	agentQuota = quota{
+		name:  "agents",
+		limit: func(q models.Quotas) int { return q.Agents },
+		count: func(tx *repositories.Store) (int, error) { return tx.Agents.Count() },
+	}
+	messageQuota = quota{
+		name:  "messages",
+		limit: func(q models.Quotas) int { return q.Messages },
+		count: func(tx *repositories.Store) (int, error) { return tx.Messages.Count() },
+	}
+)
+
+// checkQuota returns ErrQuotaExceeded unless a workspace has room for adding
+// more records under q. An empty workspace ID means the default workspace.
+// Stores assembled by hand have no workspaces, and so no quotas. The
+// workspace is only locked, serializing the writes that count against it,
+// when q limits it.
+func checkQuota(tx *repositories.Store, workspaceID string, q quota, adding int) error {
+	if tx.Workspaces == nil || adding == 0 {
+		return nil
+	}
+	if workspaceID == "" {
+		workspaceID = models.DefaultWorkspaceID
+	}
+	quotas, err := tx.Workspaces.GetQuotas(workspaceID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if q.limit(quotas) == 0 {
+		return nil
+	}
+
+	// Lock the workspace and read the limit again, as it may have changed
+	workspace, err := tx.Workspaces.GetByID(workspaceID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	limit := q.limit(workspace.Quotas)
+	if limit == 0 {
+		return nil
+	}
+	count, err := q.count(tx.InWorkspace(workspaceID))
+	if err != nil {
+		return err
+	}
+	if count+adding > limit {
+		return fmt.Errorf("%w: at most %d %s", ErrQuotaExceeded, limit, q.name)
+	}
+	return nil
+}
+
+// WorkspaceService handles business logic for workspaces
+type WorkspaceService struct {
+	repo repositories.WorkspaceStore
+	work repositories.UnitOfWork
+}
+
+// NewWorkspaceService creates a new WorkspaceService backed by the given
+// store, reading usage through units of work
+func NewWorkspaceService(store repositories.WorkspaceStore, work repositories.UnitOfWork) *WorkspaceService {
+	return &WorkspaceService{
+		repo: store,
+		work: work,
+	}
+}
+
+// CreateWorkspace creates a new workspace with the given quotas
+func (s *WorkspaceService) CreateWorkspace(name string, quotas models.Quotas) (*models.Workspace, error) {
+	if !quotas.Valid() {
+		return nil, ErrInvalidQuotas
+	}
+	workspace := models.NewWorkspace(strings.TrimSpace(name), quotas)
+	if err := s.repo.Create(workspace); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// GetWorkspace retrieves a workspace by ID
+func (s *WorkspaceService) GetWorkspace(id string) (*models.Workspace, error) {
+	return s.repo.GetByID(id)
+}
+
+// PageWorkspaces retrieves one page of workspaces
+func (s *WorkspaceService) PageWorkspaces(page repositories.PageRequest) (*repositories.Page[*models.Workspace], error) {
+	return s.repo.List(page)
+}
+
+// UpdateWorkspace renames a workspace and replaces its quotas. Lowering a
+// quota below what the workspace holds keeps its records but refuses new ones.
+func (s *WorkspaceService) UpdateWorkspace(id, name string, quotas models.Quotas) (*models.Workspace, error) {
+	if !quotas.Valid() {
+		return nil, ErrInvalidQuotas
+	}
+	var workspace *models.Workspace
+	err := s.work.Do(func(tx *repositories.Store) error {
+		var err error
+		workspace, err = tx.Workspaces.GetByID(id)
+		if err != nil {
+			return err
+		}
+		workspace.Name = strings.TrimSpace(name)
+		workspace.Quotas = quotas
+		return tx.Workspaces.Update(workspace)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+// DeleteWorkspace deletes a workspace with its users and API keys.
+// Workspaces that still have sessions or templates return
+// repositories.ErrReferenced.
+func (s *WorkspaceService) DeleteWorkspace(id string) error {
+	if id == models.DefaultWorkspaceID {
+		return ErrDefaultWorkspace
+	}
+	return s.repo.Delete(id)
+}
+
+// Usage counts the sessions, agents and messages a workspace holds
+func (s *WorkspaceService) Usage(id string) (*WorkspaceUsage, error) {
+	var usage WorkspaceUsage
+	err := s.work.Do(func(tx *repositories.Store) error {
+		if _, err := tx.Workspaces.GetByID(id); err != nil {
+			return err
+		}
+		scoped := tx.InWorkspace(id)
+		var err error
+		if usage.Sessions, err = scoped.Sessions.Count(); err != nil {
+			return err
+		}
+		if usage.Agents, err = scoped.Agents.Count(); err != nil {
+			return err
+		}
+		usage.Messages, err = scoped.Messages.Count()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
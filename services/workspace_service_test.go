@@ -0,0 +1,70 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestWorkspaceQuotas(t *testing.T) {
+	store := repositories.NewMemoryStore()
+	workspaces := NewWorkspaceService(store.Workspaces, store)
+	_, err := workspaces.CreateWorkspace("Bad", models.Quotas{Agents: -1})
+	assert.ErrorIs(t, err, ErrInvalidQuotas)
+	acme, err := workspaces.CreateWorkspace(" Acme ", models.Quotas{Sessions: 1, Agents: 2, Messages: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", acme.Name)
+	assert.ErrorIs(t, workspaces.DeleteWorkspace(models.DefaultWorkspaceID), ErrDefaultWorkspace)
+
+	sessions := NewSessionService(store.Sessions, store).InWorkspace(acme.ID)
+	agents := NewAgentService(store.Agents, store).InWorkspace(acme.ID)
+	templates := NewTemplateService(store.Templates, store).InWorkspace(acme.ID)
+	messages := NewMessageService(store.Messages, store).InWorkspace(acme.ID)
+	archive := NewArchiveService(store)
+
+	session, err := sessions.CreateSession()
+	require.NoError(t, err)
+	assert.Equal(t, acme.ID, session.WorkspaceID)
+	_, err = sessions.CreateSession()
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	agent, err := agents.CreateAgent("Writer", "author", "prompt", "gpt-4", session.ID)
+	require.NoError(t, err)
+	template, err := templates.CreateTemplate("Editor", "editor", "prompt", "gpt-4")
+	require.NoError(t, err)
+	_, err = templates.InstantiateTemplates(session.ID, []string{template.ID, template.ID}, false)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	_, err = templates.InstantiateTemplates(session.ID, []string{template.ID}, false)
+	require.NoError(t, err)
+	_, err = agents.CreateAgent("Third", "author", "prompt", "gpt-4", session.ID)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, err = messages.CreateReply("hello", agent.ID, session.ID, "")
+	require.NoError(t, err)
+	_, err = messages.CreateReply("again", agent.ID, session.ID, "")
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	usage, err := workspaces.Usage(acme.ID)
+	require.NoError(t, err)
+	assert.Equal(t, WorkspaceUsage{Sessions: 1, Agents: 2, Messages: 1}, *usage)
+
+	// Imports count against the workspace they land in; the default has no quotas
+	bundle, err := archive.ExportSession(session.ID)
+	require.NoError(t, err)
+	_, err = archive.InWorkspace(acme.ID).ImportSession(bundle, false)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	imported, err := archive.ImportSession(bundle, false)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultWorkspaceID, imported.WorkspaceID)
+
+	// Raising a quota makes room again
+	_, err = workspaces.UpdateWorkspace(acme.ID, "Acme", models.Quotas{Sessions: 2})
+	require.NoError(t, err)
+	_, err = sessions.CreateSession()
+	require.NoError(t, err)
+	_, err = messages.CreateReply("again", agent.ID, session.ID, "")
+	require.NoError(t, err)
+}
@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestAgentRunner(t *testing.T) {
+	testDBPath := "./agent_runner_test.db"
+	defer os.Remove(testDBPath)
+
+	err := db.Initialize(testDBPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	fake := providers.NewFake("Looks good to me")
+	registry := providers.NewRegistry()
+	registry.Register(fake)
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), registry)
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+
+	agents := app.agents
+	writer, err := agents.CreateAgent("Writer", "author", "You write stories", "fake/story", session.ID)
+	require.NoError(t, err)
+	critic, err := agents.CreateAgent("Critic", "reviewer", "You review stories", "fake/review", session.ID)
+	require.NoError(t, err)
+
+	messages := app.messages
+	_, err = messages.CreateMessage("Please review my draft", writer.ID, session.ID)
+	require.NoError(t, err)
+
+	turn, err := app.runner.RunAgent(context.Background(), critic.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Looks good to me", turn.Message.Content)
+	assert.Equal(t, critic.ID, turn.Message.AgentID)
+	assert.Equal(t, session.ID, turn.Message.SessionID)
+
+	// The transcript is built from the critic's point of view
+	requests := fake.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "review", requests[0].Model)
+	assert.Contains(t, requests[0].System, "You review stories")
+	assert.Equal(t, []providers.ChatMessage{{Role: providers.RoleUser, Content: "Writer: Please review my draft"}}, requests[0].Messages)
+
+	stored, err := messages.GetSessionMessages(session.ID)
+	require.NoError(t, err)
+	assert.Len(t, stored, 2)
+
+	// Long sessions send only their last 100 messages, oldest first
+	for i := 0; i < 105; i++ {
+		_, err = messages.CreateMessage(fmt.Sprintf("Note %d", i), writer.ID, session.ID)
+		require.NoError(t, err)
+	}
+	_, err = app.runner.RunAgent(context.Background(), critic.ID)
+	require.NoError(t, err)
+	requests = fake.Requests()
+	require.Len(t, requests, 2)
+	require.Len(t, requests[1].Messages, 100)
+	assert.Equal(t, "Writer: Note 5", requests[1].Messages[0].Content)
+	assert.Equal(t, "Writer: Note 104", requests[1].Messages[99].Content)
+
+	// The HTTP endpoint maps unknown models to 422
+	stranger, err := agents.CreateAgent("Stranger", "guest", "prompt", "unknown-model", session.ID)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/agents/"+stranger.ID+"/run", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
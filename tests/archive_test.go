@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestSessionExportImport(t *testing.T) {
+	testDBPath := "./archive_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSessionWithDetails("Launch", "Pick a date", []string{"launch"}, models.SessionRunning)
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "Write well", "fake/a", session.ID)
+	require.NoError(t, err)
+	user, err := app.participants.CreateUser("Alice")
+	require.NoError(t, err)
+	_, _, err = app.participants.JoinSession(session.ID, user.ID)
+	require.NoError(t, err)
+	root, err := app.messages.CreateMessage("Friday works", agent.ID, session.ID)
+	require.NoError(t, err)
+	_, err = app.messages.CreateUserReply("Agreed", user.ID, session.ID, root.ID)
+	require.NoError(t, err)
+	require.NoError(t, app.reasoning.AppendReasoningLog(agent.ID, "Fridays are quiet"))
+
+	w := app.do("", "GET", "/api/sessions/"+session.ID+"/export", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "session-"+session.ID+".json")
+	bundle := w.Body.Bytes()
+	var exported struct {
+		Agents   []map[string]interface{} `json:"agents"`
+		Messages []models.Message          `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(bundle, &exported))
+	require.Len(t, exported.Agents, 1)
+	assert.Equal(t, "Write well", exported.Agents[0]["prompt"])
+	assert.Len(t, exported.Agents[0]["reasoning"], 1)
+	require.Len(t, exported.Messages, 2)
+	assert.Equal(t, root.ID, exported.Messages[0].ID)
+
+	w = app.do("", "GET", "/api/sessions/"+session.ID+"/export?format=markdown", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "# Launch\n"))
+	assert.Contains(t, w.Body.String(), "**Goal:** Pick a date")
+	assert.Less(t, strings.Index(w.Body.String(), "Friday works"), strings.Index(w.Body.String(), "Agreed"))
+	assert.Contains(t, w.Body.String(), "Fridays are quiet")
+
+	w = app.do("", "GET", "/api/sessions/"+session.ID+"/export?format=jsonl", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var kinds []string
+	lines := bufio.NewScanner(w.Body)
+	for lines.Scan() {
+		var record struct {
+			Type string `json:"type"`
+		}
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &record))
+		kinds = append(kinds, record.Type)
+	}
+	assert.Equal(t, []string{"session", "agent", "reasoning", "user", "member", "message", "message"}, kinds)
+
+	assert.Equal(t, http.StatusBadRequest, app.do("", "GET", "/api/sessions/"+session.ID+"/export?format=pdf", nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", "/api/sessions/missing/export", nil).Code)
+
+	// Fresh IDs make a copy; preserved ones clash with the original
+	w = app.do("", "POST", "/api/sessions/import", bundle)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var imported struct {
+		models.Session
+		Agents []models.Agent `json:"agents"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &imported))
+	assert.NotEqual(t, session.ID, imported.ID)
+	require.Len(t, imported.Agents, 1)
+	assert.Equal(t, imported.ID, imported.Agents[0].SessionID)
+	assert.NotEmpty(t, imported.Agents[0].Token, "Imported agents should be issued tokens")
+	copied, err := app.messages.GetSessionMessages(imported.ID)
+	require.NoError(t, err)
+	require.Len(t, copied, 2)
+	assert.Equal(t, copied[0].ID, copied[1].ParentID)
+
+	assert.Equal(t, http.StatusConflict, app.do("", "POST", "/api/sessions/import?ids=preserve", bundle).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/sessions/import?ids=some", bundle).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/sessions/import", []byte("{broken")).Code)
+
+	broken := bytes.Replace(bundle, []byte(`"parentId":"`+root.ID), []byte(`"parentId":"missing`), 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do("", "POST", "/api/sessions/import", broken).Code)
+
+	require.NoError(t, app.sessions.DeleteSession(session.ID, 0))
+	w = app.do("", "POST", "/api/sessions/import?ids=preserve", bundle)
+	require.Equal(t, http.StatusCreated, w.Code)
+	restored, err := app.messages.GetSessionMessages(session.ID)
+	require.NoError(t, err)
+	require.Len(t, restored, 2)
+	assert.Equal(t, root.ID, restored[1].ParentID)
+}
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/handlers"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	testDBPath := "./auth_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	store := repositories.NewSQLStore(db.DB, db.Driver)
+	auth := handlers.NewAuthHandler(services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store))
+	app := setupTestApp(store, providers.NewRegistry(), auth.Authenticate)
+
+	mint := func(key string, body map[string]interface{}) (string, string) {
+		w := app.do(key, "POST", "/api/keys", body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var minted struct {
+			Key    string `json:"key"`
+			APIKey struct {
+				ID string `json:"id"`
+			} `json:"apiKey"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &minted))
+		return minted.Key, minted.APIKey.ID
+	}
+
+	admin, created, err := app.auth.Bootstrap("")
+	require.NoError(t, err)
+	require.True(t, created)
+	_, created, err = app.auth.Bootstrap("")
+	require.NoError(t, err)
+	assert.False(t, created, "Only the first start makes a bootstrap key")
+
+	// Requests need a valid key
+	w := app.do("", "GET", "/api/sessions", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, app.do("cck_wrong", "GET", "/api/sessions", nil).Code)
+	assert.Equal(t, http.StatusOK, app.do(admin, "GET", "/api/sessions", nil).Code)
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	other, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	outsider, err := app.agents.CreateAgent("Outsider", "author", "prompt", "fake/a", other.ID)
+	require.NoError(t, err)
+
+	// Scopes limit what a key can do, and only admins manage keys
+	reader, readerID := mint(admin, map[string]interface{}{"name": "dashboard", "scopes": []string{"sessions:read"}})
+	assert.Equal(t, http.StatusOK, app.do(reader, "GET", "/api/sessions/"+session.ID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(reader, "POST", "/api/sessions", nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(reader, "GET", "/api/agents/"+agent.ID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(reader, "GET", "/api/keys", nil).Code)
+
+	req, _ := http.NewRequest("GET", "/api/sessions/"+session.ID, nil)
+	req.Header.Set("X-API-Key", reader)
+	w = httptest.NewRecorder()
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Keys restricted to a session only reach that session's records
+	bot, _ := mint(admin, map[string]interface{}{
+		"name": "bot", "scopes": []string{"messages:write", "sessions:read"}, "sessionId": session.ID,
+	})
+	w = app.do(bot, "POST", "/api/messages", map[string]string{"content": "hi", "agentId": agent.ID, "sessionId": session.ID})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var message struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &message))
+	assert.Equal(t, http.StatusOK, app.do(bot, "GET", "/api/messages/"+message.ID, nil).Code)
+	assert.Equal(t, http.StatusOK, app.do(bot, "GET", "/api/sessions/"+session.ID+"/messages", nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bot, "POST", "/api/messages", map[string]string{
+		"content": "hi", "agentId": outsider.ID, "sessionId": other.ID,
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bot, "GET", "/api/sessions/"+other.ID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bot, "GET", "/api/sessions", nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bot, "PUT", "/api/agents/"+outsider.ID+"/online", map[string]bool{"isOnline": false}).Code)
+
+	// Keys must be minted with known scopes, and admin keys cannot be restricted
+	assert.Equal(t, http.StatusBadRequest, app.do(admin, "POST", "/api/keys", map[string]interface{}{"name": "x", "scopes": []string{"sessions:delete"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do(admin, "POST", "/api/keys", map[string]interface{}{
+		"name": "x", "scopes": []string{"admin"}, "sessionId": session.ID,
+	}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do(admin, "POST", "/api/keys", map[string]interface{}{
+		"name": "x", "scopes": []string{"sessions:read"}, "sessionId": "missing",
+	}).Code)
+
+	// Listing never shows secrets
+	w = app.do(admin, "GET", "/api/keys", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), reader)
+	assert.Contains(t, w.Body.String(), reader[:12])
+
+	// Revoked keys and keys of deleted sessions stop working
+	assert.Equal(t, http.StatusNoContent, app.do(admin, "DELETE", "/api/keys/"+readerID, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, app.do(reader, "GET", "/api/sessions/"+session.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(admin, "DELETE", "/api/keys/missing", nil).Code)
+	require.NoError(t, app.sessions.DeleteSession(session.ID, 0))
+	assert.Equal(t, http.StatusUnauthorized, app.do(bot, "GET", "/api/sessions/"+session.ID, nil).Code)
+}
+
+func TestAgentTokens(t *testing.T) {
+	testDBPath := "./agent_tokens_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	store := repositories.NewSQLStore(db.DB, db.Driver)
+	auth := handlers.NewAuthHandler(services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store))
+	app := setupTestApp(store, providers.NewRegistry(), auth.Authenticate)
+
+	admin, _, err := app.auth.Bootstrap("")
+	require.NoError(t, err)
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	other, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+
+	// Creating an agent issues its token, once
+	w := app.do(admin, "POST", "/api/agents", map[string]string{
+		"name": "Writer", "role": "author", "prompt": "prompt", "model": "fake/a", "sessionId": session.ID,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var writer struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &writer))
+	require.NotEmpty(t, writer.Token)
+	assert.NotContains(t, app.do(admin, "GET", "/api/agents/"+writer.ID, nil).Body.String(), writer.Token)
+
+	critic, err := app.agents.CreateAgent("Critic", "critic", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	user, err := app.participants.CreateUser("Alice")
+	require.NoError(t, err)
+
+	// Messages posted with the token are written by its agent
+	w = app.do(writer.Token, "POST", "/api/messages", map[string]string{"content": "hello", "sessionId": session.ID})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var message struct {
+		ID      string `json:"id"`
+		AgentID string `json:"agentId"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &message))
+	assert.Equal(t, writer.ID, message.AgentID)
+	assert.Equal(t, http.StatusCreated, app.do(writer.Token, "POST", "/api/messages", map[string]string{
+		"content": "again", "agentId": writer.ID, "sessionId": session.ID,
+	}).Code)
+
+	// and cannot speak as anyone else, or anywhere else
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "POST", "/api/messages", map[string]string{
+		"content": "hi", "agentId": critic.ID, "sessionId": session.ID,
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "POST", "/api/messages", map[string]string{
+		"content": "hi", "userId": user.ID, "sessionId": session.ID,
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "POST", "/api/messages", map[string]string{
+		"content": "hi", "sessionId": other.ID,
+	}).Code)
+
+	// Reasoning and presence are only the token's own agent's to change
+	assert.Equal(t, http.StatusNoContent, app.do(writer.Token, "POST", "/api/agents/"+writer.ID+"/reasoning", map[string]string{"log": "thinking"}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "POST", "/api/agents/"+critic.ID+"/reasoning", map[string]string{"log": "thinking"}).Code)
+	assert.Equal(t, http.StatusNoContent, app.do(writer.Token, "PUT", "/api/agents/"+writer.ID+"/online", map[string]bool{"isOnline": false}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "PUT", "/api/agents/"+critic.ID+"/online", map[string]bool{"isOnline": false}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "POST", "/api/agents", map[string]string{
+		"name": "Extra", "role": "author", "prompt": "prompt", "model": "fake/a", "sessionId": session.ID,
+	}).Code)
+
+	// Other agents' messages are off limits
+	theirs, err := app.messages.CreateMessage("mine", critic.ID, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "PUT", "/api/messages/"+theirs.ID, map[string]string{"content": "edited"}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(writer.Token, "DELETE", "/api/messages/"+theirs.ID, nil).Code)
+	assert.Equal(t, http.StatusNoContent, app.do(writer.Token, "PUT", "/api/messages/"+message.ID, map[string]string{"content": "edited"}).Code)
+
+	// Reissuing the token revokes the old one
+	w = app.do(admin, "POST", "/api/agents/"+writer.ID+"/token", nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var reissued struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reissued))
+	assert.Equal(t, http.StatusUnauthorized, app.do(writer.Token, "GET", "/api/sessions/"+session.ID, nil).Code)
+	assert.Equal(t, http.StatusOK, app.do(reissued.Token, "GET", "/api/sessions/"+session.ID, nil).Code)
+}
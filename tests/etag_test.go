@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	testDBPath := "./etag_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistry())
+
+	ifMatch := func(tag string) map[string]string { return map[string]string{"If-Match": tag} }
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	// GETs carry the version, and polling with it is answered without a body
+	w := app.do("", "GET", "/api/agents/"+agent.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1-online"`, w.Header().Get("ETag"))
+	w = app.do("", "GET", "/api/agents/"+agent.ID, nil, map[string]string{"If-None-Match": `"1-online"`})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	sessionTag := app.do("", "GET", "/api/sessions/"+session.ID, nil).Header().Get("ETag")
+	assert.Regexp(t, `^"1-[0-9a-z]+"$`, sessionTag)
+	w = app.do("", "GET", "/api/sessions/"+session.ID, nil, map[string]string{"If-None-Match": "W/" + sessionTag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// The first of two writers holding version 1 wins; the second is refused
+	w = app.do("", "PUT", "/api/agents/"+agent.ID, map[string]string{"prompt": "first"}, ifMatch(`"1-online"`))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2-online"`, w.Header().Get("ETag"))
+	var updated models.Agent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, 2, updated.Version)
+	w = app.do("", "PUT", "/api/agents/"+agent.ID, map[string]string{"prompt": "second"}, ifMatch(`"1"`))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = app.do("", "GET", "/api/agents/"+agent.ID, nil, map[string]string{"If-None-Match": `"1-online"`})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "first", updated.Prompt)
+
+	// Presence and heartbeats change the tag but not the version writes check
+	require.NoError(t, app.agents.SetAgentOnlineStatus(agent.ID, false))
+	w = app.do("", "GET", "/api/agents/"+agent.ID, nil, map[string]string{"If-None-Match": `"2-online"`})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2-offline"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"isOnline":false`)
+	require.NoError(t, app.sessions.UpdateHeartbeat(session.ID))
+	w = app.do("", "GET", "/api/sessions/"+session.ID, nil, map[string]string{"If-None-Match": sessionTag})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, sessionTag, w.Header().Get("ETag"))
+
+	// Sessions: lists of tags and * are honored
+	w = app.do("", "PUT", "/api/sessions/"+session.ID, map[string]string{"title": "Renamed"}, ifMatch(`"7", `+sessionTag))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Regexp(t, `^"2-[0-9a-z]+"$`, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusPreconditionFailed, app.do("", "PUT", "/api/sessions/"+session.ID, map[string]string{"title": "Weak"}, ifMatch(`W/"2"`)).Code)
+	assert.Equal(t, http.StatusOK, app.do("", "PUT", "/api/sessions/"+session.ID, map[string]string{"goal": "Any"}, ifMatch("*")).Code)
+
+	// Messages are versioned by revision
+	message, err := app.messages.CreateMessage("draft", agent.ID, session.ID)
+	require.NoError(t, err)
+	w = app.do("", "PUT", "/api/messages/"+message.ID, map[string]string{"content": "final"}, ifMatch(`"1"`))
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusPreconditionFailed, app.do("", "PUT", "/api/messages/"+message.ID, map[string]string{"content": "stale"}, ifMatch(`"1"`)).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, app.do("", "DELETE", "/api/messages/"+message.ID, nil, ifMatch(`"1"`)).Code)
+	assert.Equal(t, http.StatusNoContent, app.do("", "DELETE", "/api/messages/"+message.ID, nil, ifMatch(`"2"`)).Code)
+
+	// Deletes refuse stale versions too
+	assert.Equal(t, http.StatusPreconditionFailed, app.do("", "DELETE", "/api/agents/"+agent.ID, nil, ifMatch(`"1"`)).Code)
+	assert.Equal(t, http.StatusNoContent, app.do("", "DELETE", "/api/agents/"+agent.ID, nil, ifMatch(`"2"`)).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, app.do("", "DELETE", "/api/sessions/"+session.ID, nil, ifMatch(`"1"`)).Code)
+	assert.Equal(t, http.StatusNoContent, app.do("", "DELETE", "/api/sessions/"+session.ID, nil, ifMatch(`"3"`)).Code)
+}
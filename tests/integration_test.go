@@ -11,27 +11,93 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/events"
 	"github.com/chatcollab/chatcollab/handlers"
+	"github.com/chatcollab/chatcollab/orchestrator"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/realtime"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
 )
 
-func setupTestRouter() *gin.Engine {
+// testApp holds the services and router wired the way main does
+type testApp struct {
+	router        *gin.Engine
+	sessions      *services.SessionService
+	agents        *services.AgentService
+	participants  *services.ParticipantService
+	templates     *services.TemplateService
+	messages      *services.MessageService
+	reasoning     *services.ReasoningService
+	auth          *services.AuthService
+	workspaces    *services.WorkspaceService
+	runner        *services.AgentRunner
+	orchestrators *orchestrator.Manager
+}
+
+// setupTestApp wires the API over store. Routes are open unless middleware
+// such as an AuthHandler's Authenticate is given.
+func setupTestApp(store *repositories.Store, registry *providers.Registry, middleware ...gin.HandlerFunc) *testApp {
 	// Set Gin to test mode
 	gin.SetMode(gin.TestMode)
 	
-	// Initialize router
-	router := gin.Default()
+	app := &testApp{
+		router:       gin.Default(),
+		sessions:     services.NewSessionService(store.Sessions, store),
+		agents:       services.NewAgentService(store.Agents, store),
+		participants: services.NewParticipantService(store.Users, store.Agents, store),
+		templates:    services.NewTemplateService(store.Templates, store),
+		messages:     services.NewMessageService(store.Messages, store),
+		reasoning:    services.NewReasoningService(store.Reasoning, store.Agents, store),
+		auth:         services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store),
+		workspaces:   services.NewWorkspaceService(store.Workspaces, store),
+	}
+	app.runner = services.NewAgentRunner(app.sessions, app.agents, app.participants, app.messages, registry)
+	app.orchestrators = orchestrator.NewManager(app.runner, app.agents, app.messages, app.sessions)
+	hubs := realtime.NewManager(events.Default, app.messages, app.agents, app.sessions)
 	
 	// Register API routes
-	sessionHandler := handlers.NewSessionHandler()
-	sessionHandler.RegisterRoutes(router)
-	
-	agentHandler := handlers.NewAgentHandler()
-	agentHandler.RegisterRoutes(router)
-	
-	messageHandler := handlers.NewMessageHandler()
-	messageHandler.RegisterRoutes(router)
-	
-	return router
+	app.router.Use(middleware...)
+	handlers.NewAuthHandler(app.auth).RegisterRoutes(app.router)
+	handlers.NewWorkspaceHandler(app.workspaces).RegisterRoutes(app.router)
+	handlers.NewSessionHandler(app.sessions).RegisterRoutes(app.router)
+	handlers.NewAgentHandler(app.agents, app.runner).RegisterRoutes(app.router)
+	handlers.NewTemplateHandler(app.templates).RegisterRoutes(app.router)
+	handlers.NewParticipantHandler(app.participants).RegisterRoutes(app.router)
+	handlers.NewMessageHandler(app.messages).RegisterRoutes(app.router)
+	handlers.NewReasoningHandler(app.reasoning).RegisterRoutes(app.router)
+	handlers.NewArchiveHandler(services.NewArchiveService(store)).RegisterRoutes(app.router)
+	handlers.NewWebSocketHandler(hubs, app.sessions, app.agents).RegisterRoutes(app.router)
+	handlers.NewOrchestratorHandler(app.orchestrators).RegisterRoutes(app.router)
+	
+	return app
+}
+
+// do sends a request to the app's router, authenticated with key unless it
+// is empty. A []byte body is sent as it is and any other body as JSON; each
+// headers map adds its headers to the request.
+func (app *testApp) do(key, method, path string, body interface{}, headers ...map[string]string) *httptest.ResponseRecorder {
+	payload, ok := body.([]byte)
+	if !ok && body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	for _, set := range headers {
+		for name, value := range set {
+			req.Header.Set(name, value)
+		}
+	}
+	app.router.ServeHTTP(w, req)
+	return w
+}
+
+func setupTestRouter() *gin.Engine {
+	return setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistryFromEnv()).router
 }
 
 func TestIntegrationFlow(t *testing.T) {
@@ -44,9 +110,16 @@ func TestIntegrationFlow(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 	
-	// Setup router
-	router := setupTestRouter()
-	
+	runIntegrationFlow(t, setupTestRouter())
+}
+
+func TestIntegrationFlowInMemory(t *testing.T) {
+	// The same flow runs without a database file
+	app := setupTestApp(repositories.NewMemoryStore(), providers.NewRegistry())
+	runIntegrationFlow(t, app.router)
+}
+
+func runIntegrationFlow(t *testing.T, router *gin.Engine) {
 	// Step 1: Create a new session
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/sessions", nil)
@@ -55,7 +128,7 @@ func TestIntegrationFlow(t *testing.T) {
 	assert.Equal(t, http.StatusCreated, w.Code)
 	
 	var session map[string]interface{}
-	err = json.Unmarshal(w.Body.Bytes(), &session)
+	err := json.Unmarshal(w.Body.Bytes(), &session)
 	assert.NoError(t, err)
 	
 	sessionID := session["id"].(string)
@@ -114,10 +187,14 @@ func TestIntegrationFlow(t *testing.T) {
 	
 	assert.Equal(t, http.StatusOK, w.Code)
 	
-	var messages []interface{}
+	var messages struct {
+		Items      []interface{} `json:"items"`
+		NextCursor string        `json:"nextCursor"`
+	}
 	err = json.Unmarshal(w.Body.Bytes(), &messages)
 	assert.NoError(t, err)
-	assert.Len(t, messages, 1)
+	assert.Len(t, messages.Items, 1)
+	assert.Empty(t, messages.NextCursor)
 	
 	// Step 5: Get session agents
 	w = httptest.NewRecorder()
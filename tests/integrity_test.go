@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestReferentialIntegrity(t *testing.T) {
+	testDBPath := "./integrity_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	other, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	user, err := app.participants.CreateUser("Alice")
+	require.NoError(t, err)
+
+	// Messages must name a session, and an agent that belongs to it
+	post := func(body map[string]string) int {
+		return app.do("", "POST", "/api/messages", body).Code
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, post(map[string]string{"content": "hi", "agentId": agent.ID, "sessionId": "missing"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(map[string]string{"content": "hi", "agentId": "missing", "sessionId": session.ID}))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(map[string]string{"content": "hi", "agentId": agent.ID, "sessionId": other.ID}))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(map[string]string{"content": "hi", "userId": user.ID, "sessionId": "missing"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do("", "POST", "/api/agents", map[string]string{
+		"name": "Lost", "role": "assistant", "prompt": "prompt", "model": "fake/a", "sessionId": "missing",
+	}).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "POST", "/api/sessions/missing/participants", map[string]string{"userId": user.ID}).Code)
+
+	w := app.do("", "POST", "/api/messages", map[string]string{"content": "root", "agentId": agent.ID, "sessionId": session.ID})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var root models.Message
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &root))
+	require.Equal(t, http.StatusCreated, post(map[string]string{"content": "reply", "userId": user.ID, "sessionId": session.ID, "replyTo": root.ID}))
+
+	// Records others depend on cannot be deleted on their own
+	assert.Equal(t, http.StatusConflict, app.do("", "DELETE", "/api/messages/"+root.ID, nil).Code)
+	assert.Equal(t, http.StatusConflict, app.do("", "DELETE", "/api/agents/"+agent.ID, nil).Code)
+	assert.Equal(t, http.StatusConflict, app.do("", "DELETE", "/api/users/"+user.ID, nil).Code)
+
+	// Deleting the session takes its agents and messages with it
+	assert.Equal(t, http.StatusNoContent, app.do("", "DELETE", "/api/sessions/"+session.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", "/api/agents/"+agent.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", "/api/messages/"+root.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "DELETE", "/api/sessions/"+session.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "DELETE", "/api/agents/"+agent.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "DELETE", "/api/agent-templates/missing", nil).Code)
+
+	// Without their messages, users can go
+	assert.Equal(t, http.StatusNoContent, app.do("", "DELETE", "/api/users/"+user.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "DELETE", "/api/users/"+user.ID, nil).Code)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/orchestrator"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestOrchestratorRoundRobin(t *testing.T) {
+	testDBPath := "./orchestrator_test.db"
+	defer os.Remove(testDBPath)
+
+	err := db.Initialize(testDBPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	registry := providers.NewRegistry()
+	registry.Register(providers.NewFake("turn"))
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), registry)
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+
+	agents := app.agents
+	alice, err := agents.CreateAgent("Alice", "writer", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	bob, err := agents.CreateAgent("Bob", "critic", "prompt", "fake/b", session.ID)
+	require.NoError(t, err)
+
+	manager := app.orchestrators
+	defer manager.Shutdown()
+
+	status, err := manager.Start(session.ID, orchestrator.Config{MaxTurns: 4, IntervalMs: 1})
+	require.NoError(t, err)
+	assert.Equal(t, orchestrator.StateRunning, status.State)
+
+	_, err = manager.Start(session.ID, orchestrator.Config{})
+	assert.ErrorIs(t, err, orchestrator.ErrAlreadyRunning)
+
+	require.Eventually(t, func() bool {
+		status, _ := manager.Status(session.ID)
+		return status.State == orchestrator.StateFinished
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, _ = manager.Status(session.ID)
+	assert.Equal(t, 4, status.Turns)
+
+	messages, err := app.messages.GetSessionMessages(session.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 4)
+	for i, message := range messages {
+		want := alice.ID
+		if i%2 == 1 {
+			want = bob.ID
+		}
+		assert.Equal(t, want, message.AgentID, "Agents should alternate")
+	}
+
+	// A finished session can be started again, paused and resumed with a new configuration
+	_, err = manager.Start(session.ID, orchestrator.Config{MaxTurns: 100, IntervalMs: 1000})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		status, _ := manager.Status(session.ID)
+		return status.Turns == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	status, err = manager.Pause(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, orchestrator.StatePaused, status.State)
+
+	other, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	outsider, err := agents.CreateAgent("Carol", "moderator", "prompt", "fake/c", other.ID)
+	require.NoError(t, err)
+	_, err = manager.Start(session.ID, orchestrator.Config{Strategy: orchestrator.StrategyModerator, ModeratorID: outsider.ID})
+	assert.Error(t, err, "The moderator must be an agent of the session")
+	status, _ = manager.Status(session.ID)
+	assert.Equal(t, orchestrator.StatePaused, status.State, "A rejected configuration leaves the run paused")
+
+	status, err = manager.Start(session.ID, orchestrator.Config{Strategy: orchestrator.StrategyModerator, ModeratorID: bob.ID, MaxTurns: 3, IntervalMs: 1})
+	require.NoError(t, err)
+	assert.Equal(t, orchestrator.StateRunning, status.State)
+	assert.Equal(t, orchestrator.StrategyModerator, status.Config.Strategy)
+	require.Eventually(t, func() bool {
+		status, _ := manager.Status(session.ID)
+		return status.State == orchestrator.StateFinished
+	}, 5*time.Second, 10*time.Millisecond, "The new configuration should take effect")
+	messages, err = app.messages.GetSessionMessages(session.ID)
+	require.NoError(t, err)
+	last := messages[len(messages)-2:]
+	assert.True(t, (last[0].AgentID == bob.ID) != (last[1].AgentID == bob.ID), "The moderator should speak every other turn")
+
+	// An empty configuration resumes with the one already in use
+	_, err = manager.Start(session.ID, orchestrator.Config{MaxTurns: 100, IntervalMs: 1000})
+	require.NoError(t, err)
+	_, err = manager.Pause(session.ID)
+	require.NoError(t, err)
+	status, err = manager.Start(session.ID, orchestrator.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, 100, status.Config.MaxTurns)
+
+	status, err = manager.Stop(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, orchestrator.StateStopped, status.State)
+
+	_, err = manager.Stop(session.ID)
+	assert.ErrorIs(t, err, orchestrator.ErrNotRunning)
+}
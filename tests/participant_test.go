@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestHumanParticipants(t *testing.T) {
+	testDBPath := "./participant_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	fake := providers.NewFake("Hello Dana")
+	registry := providers.NewRegistry()
+	registry.Register(fake)
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), registry)
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Greeter", "host", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	w := app.do("", "POST", "/api/users", map[string]string{"name": "Dana"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var user models.User
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+
+	// A post that fails leaves the user out of the session
+	w = app.do("", "POST", "/api/messages", map[string]string{"content": "Hi all", "userId": user.ID, "sessionId": session.ID, "replyTo": "missing"})
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	w = app.do("", "GET", "/api/sessions/"+session.ID+"/participants", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var before []models.Participant
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &before))
+	for _, participant := range before {
+		assert.NotEqual(t, user.ID, participant.ID, "A rejected message must not join its author")
+	}
+
+	// Posting as a user joins the session
+	w = app.do("", "POST", "/api/messages", map[string]string{"content": "Hi all", "userId": user.ID, "sessionId": session.ID})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var message models.Message
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &message))
+	assert.Equal(t, models.ParticipantHuman, message.AuthorType)
+	assert.Equal(t, user.ID, message.UserID)
+	assert.Empty(t, message.AgentID)
+
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/messages", map[string]string{"content": "x", "sessionId": session.ID}).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/messages", map[string]string{"content": "x", "agentId": agent.ID, "userId": user.ID, "sessionId": session.ID}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do("", "POST", "/api/messages", map[string]string{"content": "x", "userId": "missing", "sessionId": session.ID}).Code)
+
+	// Joining again is harmless
+	assert.Equal(t, http.StatusOK, app.do("", "POST", "/api/sessions/"+session.ID+"/participants", map[string]string{"userId": user.ID}).Code)
+	require.Equal(t, http.StatusNoContent, app.do("", "PUT", "/api/sessions/"+session.ID+"/participants/"+user.ID+"/online", map[string]bool{"isOnline": false}).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "PUT", "/api/sessions/other/participants/"+user.ID+"/online", map[string]bool{"isOnline": false}).Code)
+
+	for _, path := range []string{"/participants", "/agents"} {
+		w = app.do("", "GET", "/api/sessions/"+session.ID+path, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var participants []models.Participant
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &participants))
+		require.Len(t, participants, 2)
+		assert.Equal(t, agent.ID, participants[0].ID)
+		assert.Equal(t, models.ParticipantAgent, participants[0].Kind)
+		assert.True(t, participants[0].IsOnline)
+		assert.Equal(t, user.ID, participants[1].ID)
+		assert.Equal(t, models.ParticipantHuman, participants[1].Kind)
+		assert.Equal(t, "Dana", participants[1].Name)
+		assert.False(t, participants[1].IsOnline)
+	}
+
+	// Agents see people by name
+	_, err = app.runner.RunAgent(context.Background(), agent.ID)
+	require.NoError(t, err)
+	requests := fake.Requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, []providers.ChatMessage{{Role: providers.RoleUser, Content: "Dana: Hi all"}}, requests[0].Messages)
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/handlers"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/ratelimit"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+func TestRateLimits(t *testing.T) {
+	testDBPath := "./rate_limit_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	store := repositories.NewSQLStore(db.DB, db.Driver)
+	auth := handlers.NewAuthHandler(services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store))
+	keys := ratelimit.NewLimiter(ratelimit.Limit{Count: 3, Per: time.Minute})
+	app := setupTestApp(store, providers.NewRegistry(), auth.Authenticate, handlers.NewRateLimitHandler(keys).Limit)
+	app.messages.SetRateLimits(
+		ratelimit.NewLimiter(ratelimit.Limit{Count: 2, Per: time.Minute}),
+		ratelimit.NewLimiter(ratelimit.Limit{Count: 3, Per: time.Hour}),
+	)
+
+	admin, _, err := app.auth.Bootstrap("")
+	require.NoError(t, err)
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	writer, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	editor, err := app.agents.CreateAgent("Editor", "editor", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	// Each key has a bucket of its own
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusOK, app.do(admin, "GET", "/api/sessions", nil).Code)
+	}
+	w := app.do(admin, "GET", "/api/sessions", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+
+	post := func(agent *models.Agent) *httptest.ResponseRecorder {
+		return app.do(agent.Token, "POST", "/api/messages", map[string]string{"content": "hi", "sessionId": session.ID})
+	}
+
+	// Agents and sessions are limited on top of keys
+	assert.Equal(t, http.StatusCreated, post(writer).Code)
+	assert.Equal(t, http.StatusCreated, post(writer).Code)
+	w = post(writer)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "per agent")
+
+	assert.Equal(t, http.StatusCreated, post(editor).Code)
+	w = post(editor)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1200", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "per session")
+}
+
+func TestSessionMessageLimit(t *testing.T) {
+	testDBPath := "./session_message_limit_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, app.do("", "PUT", "/api/sessions/"+session.ID, map[string]int{"maxMessages": -1}).Code)
+	w := app.do("", "PUT", "/api/sessions/"+session.ID, map[string]int{"maxMessages": 1})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"maxMessages":1`)
+
+	// The message reaching the cap pauses the session
+	message := map[string]string{"content": "hi", "agentId": agent.ID, "sessionId": session.ID}
+	assert.Equal(t, http.StatusCreated, app.do("", "POST", "/api/messages", message).Code)
+	stored, err := app.sessions.GetSession(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.SessionPaused, stored.Status)
+	assert.Equal(t, http.StatusConflict, app.do("", "POST", "/api/messages", message).Code)
+
+	// Resuming needs a higher cap before messages are taken again
+	require.Equal(t, http.StatusOK, app.do("", "POST", "/api/sessions/"+session.ID+"/transition", map[string]string{"status": "running"}).Code)
+	w = app.do("", "POST", "/api/messages", message)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "as many messages as it allows")
+	require.Equal(t, http.StatusOK, app.do("", "PUT", "/api/sessions/"+session.ID, map[string]int{"maxMessages": 0}).Code)
+	assert.Equal(t, http.StatusCreated, app.do("", "POST", "/api/messages", message).Code)
+}
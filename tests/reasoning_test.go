@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestReasoningEntries(t *testing.T) {
+	app := setupTestApp(repositories.NewMemoryStore(), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Planner", "planner", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	message, err := app.messages.CreateMessage("Here is the summary", agent.ID, session.ID)
+	require.NoError(t, err)
+
+	path := "/api/agents/" + agent.ID + "/reasoning"
+
+	// The legacy body still works and is recorded as a thought
+	require.Equal(t, http.StatusNoContent, app.do("", "POST", path, map[string]string{"log": "Read the brief"}).Code)
+
+	w := app.do("", "POST", path, map[string]interface{}{"type": "plan", "content": "Search, then summarise"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var plan models.ReasoningEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.Equal(t, models.StepPlan, plan.Step)
+	assert.Equal(t, session.ID, plan.SessionID)
+
+	w = app.do("", "POST", path, map[string]interface{}{
+		"type":      "tool-call",
+		"messageId": message.ID,
+		"payload":   map[string]string{"tool": "search"},
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do("", "POST", path, map[string]string{"type": "plan", "content": "x", "messageId": "missing"}).Code)
+
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", path, map[string]string{"type": "daydream", "content": "x"}).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", path, map[string]string{"type": "plan"}).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "POST", "/api/agents/missing/reasoning", map[string]string{"log": "x"}).Code)
+
+	w = app.do("", "GET", path, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page repositories.Page[*models.ReasoningEntry]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Items, 3)
+	assert.Equal(t, models.StepThought, page.Items[0].Step)
+	assert.JSONEq(t, `{"tool":"search"}`, string(page.Items[2].Payload))
+
+	w = app.do("", "GET", path+"?type=tool-call&messageId="+message.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, models.StepToolCall, page.Items[0].Step)
+
+	// The text view renders the legacy newline-separated log, one page at a time
+	w = app.do("", "GET", path+"?format=text", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Read the brief\nSearch, then summarise\n{\"tool\":\"search\"}", w.Body.String())
+
+	w = app.do("", "GET", path+"?format=text&limit=2", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Read the brief\nSearch, then summarise", w.Body.String())
+	next := w.Header().Get("X-Next-Cursor")
+	require.NotEmpty(t, next)
+	w = app.do("", "GET", path+"?format=text&limit=2&after="+next, nil)
+	assert.Equal(t, "{\"tool\":\"search\"}", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+
+	assert.Equal(t, http.StatusBadRequest, app.do("", "GET", path+"?type=daydream", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "GET", path+"?since=yesterday", nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", "/api/agents/missing/reasoning", nil).Code)
+}
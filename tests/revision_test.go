@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+func TestMessageRevisions(t *testing.T) {
+	app := setupTestApp(repositories.NewMemoryStore(), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	writer, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	editor, err := app.agents.CreateAgent("Editor", "editor", "prompt", "fake/b", session.ID)
+	require.NoError(t, err)
+
+	message, err := app.messages.CreateMessage("The plan:\nship on Monday", writer.ID, session.ID)
+	require.NoError(t, err)
+
+	path := "/api/messages/" + message.ID
+	require.Equal(t, http.StatusNoContent, app.do("", "PUT", path, map[string]string{"content": "The plan:\nship on Tuesday"}).Code)
+	require.Equal(t, http.StatusNoContent, app.do("", "PUT", path, map[string]string{"content": "The plan:\nship on Friday", "editorId": editor.ID}).Code)
+
+	w := app.do("", "GET", path, nil)
+	var stored models.Message
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Equal(t, 3, stored.Revision)
+	assert.Equal(t, editor.ID, stored.EditedBy)
+	assert.NotNil(t, stored.EditedAt)
+
+	w = app.do("", "GET", path+"/revisions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var revisions []models.MessageRevision
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+	require.Len(t, revisions, 3)
+	assert.Equal(t, "The plan:\nship on Monday", revisions[0].Content)
+	assert.Equal(t, writer.ID, revisions[0].EditorID)
+	assert.Equal(t, writer.ID, revisions[1].EditorID)
+	assert.Equal(t, editor.ID, revisions[2].EditorID)
+
+	w = app.do("", "GET", path+"/revisions/diff", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var diff services.RevisionDiff
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, 2, diff.From)
+	assert.Equal(t, 3, diff.To)
+	assert.Contains(t, diff.Diff, "-ship on Tuesday\n+ship on Friday\n")
+	assert.Contains(t, diff.Diff, " The plan:\n")
+
+	w = app.do("", "GET", path+"/revisions/diff?from=1&to=3", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Contains(t, diff.Diff, "-ship on Monday\n+ship on Friday\n")
+
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", path+"/revisions/diff?from=1&to=9", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "GET", path+"/revisions/diff?from=first", nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", "/api/messages/missing/revisions", nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "PUT", "/api/messages/missing", map[string]string{"content": "x"}).Code)
+}
+
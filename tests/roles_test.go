@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/handlers"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+func TestSessionRoles(t *testing.T) {
+	testDBPath := "./roles_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	store := repositories.NewSQLStore(db.DB, db.Driver)
+	auth := handlers.NewAuthHandler(services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store))
+	app := setupTestApp(store, providers.NewRegistry(), auth.Authenticate)
+
+	decode := func(w *httptest.ResponseRecorder, into interface{}) {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), into), w.Body.String())
+	}
+
+	admin, _, err := app.auth.Bootstrap("")
+	require.NoError(t, err)
+	keys := make(map[string]string)
+	users := make(map[string]string)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user, err := app.participants.CreateUser(name)
+		require.NoError(t, err)
+		users[name] = user.ID
+		w := app.do(admin, "POST", "/api/keys", map[string]interface{}{
+			"name": name, "userId": user.ID, "scopes": []string{"sessions:write", "agents:write", "messages:write"},
+		})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var minted struct {
+			Key string `json:"key"`
+		}
+		decode(w, &minted)
+		keys[name] = minted.Key
+	}
+	alice, bob, carol := keys["alice"], keys["bob"], keys["carol"]
+	assert.Equal(t, http.StatusBadRequest, app.do(admin, "POST", "/api/keys", map[string]interface{}{
+		"name": "root", "userId": users["alice"], "scopes": []string{"admin"},
+	}).Code)
+
+	// Creating a session makes the user its owner; users list only their sessions
+	w := app.do(alice, "POST", "/api/sessions", map[string]string{"title": "Plan"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var session struct {
+		ID string `json:"id"`
+	}
+	decode(w, &session)
+	_, err = app.sessions.CreateSession()
+	require.NoError(t, err)
+
+	var page struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	decode(app.do(alice, "GET", "/api/sessions", nil), &page)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, session.ID, page.Items[0].ID)
+	decode(app.do(bob, "GET", "/api/sessions", nil), &page)
+	assert.Empty(t, page.Items)
+	decode(app.do(admin, "GET", "/api/sessions", nil), &page)
+	assert.Len(t, page.Items, 2, "Keys acting for no one should see every session")
+
+	// Non-members cannot reach the session or anything without a session
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "GET", "/api/sessions/"+session.ID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "GET", "/api/agents", nil).Code)
+
+	// Owners manage members
+	w = app.do(alice, "PUT", "/api/sessions/"+session.ID+"/members/"+users["bob"], map[string]string{"role": "member"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = app.do(alice, "PUT", "/api/sessions/"+session.ID+"/members/"+users["carol"], map[string]string{"role": "owner"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = app.do(alice, "PUT", "/api/sessions/"+session.ID+"/members/"+users["carol"], map[string]string{"role": "viewer"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusBadRequest, app.do(alice, "PUT", "/api/sessions/"+session.ID+"/members/"+users["bob"], map[string]string{"role": "boss"}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do(alice, "PUT", "/api/sessions/"+session.ID+"/members/missing", map[string]string{"role": "viewer"}).Code)
+	assert.Equal(t, http.StatusConflict, app.do(alice, "PUT", "/api/sessions/"+session.ID+"/members/"+users["alice"], map[string]string{"role": "member"}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "PUT", "/api/sessions/"+session.ID+"/members/"+users["carol"], map[string]string{"role": "owner"}).Code)
+
+	var members []struct {
+		ID          string `json:"id"`
+		SessionRole string `json:"sessionRole"`
+	}
+	w = app.do(carol, "GET", "/api/sessions/"+session.ID+"/members", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	decode(w, &members)
+	roles := make(map[string]string)
+	for _, member := range members {
+		roles[member.ID] = member.SessionRole
+	}
+	assert.Equal(t, map[string]string{users["alice"]: "owner", users["bob"]: "member", users["carol"]: "viewer"}, roles)
+
+	// Viewers read, members post as themselves
+	assert.Equal(t, http.StatusOK, app.do(carol, "GET", "/api/sessions/"+session.ID+"/messages", nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(carol, "POST", "/api/messages", map[string]string{"content": "hi", "sessionId": session.ID}).Code)
+	w = app.do(bob, "POST", "/api/messages", map[string]string{"content": "hi", "sessionId": session.ID})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var message struct {
+		ID     string `json:"id"`
+		UserID string `json:"userId"`
+	}
+	decode(w, &message)
+	assert.Equal(t, users["bob"], message.UserID)
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "POST", "/api/messages", map[string]string{
+		"content": "hi", "userId": users["alice"], "sessionId": session.ID,
+	}).Code)
+	assert.Equal(t, http.StatusNoContent, app.do(bob, "PUT", "/api/messages/"+message.ID, map[string]string{"content": "hello"}).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(alice, "PUT", "/api/messages/"+message.ID, map[string]string{"content": "edited"}).Code)
+
+	// Only owners manage agents and delete
+	agent := map[string]string{"name": "Writer", "role": "author", "prompt": "prompt", "model": "fake/a", "sessionId": session.ID}
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "POST", "/api/agents", agent).Code)
+	assert.Equal(t, http.StatusCreated, app.do(alice, "POST", "/api/agents", agent).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "DELETE", "/api/messages/"+message.ID, nil).Code)
+	assert.Equal(t, http.StatusNoContent, app.do(alice, "DELETE", "/api/messages/"+message.ID, nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(bob, "DELETE", "/api/sessions/"+session.ID, nil).Code)
+
+	// Removed members lose access
+	assert.Equal(t, http.StatusNoContent, app.do(alice, "DELETE", "/api/sessions/"+session.ID+"/members/"+users["carol"], nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(alice, "DELETE", "/api/sessions/"+session.ID+"/members/"+users["carol"], nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(carol, "GET", "/api/sessions/"+session.ID, nil).Code)
+
+	assert.Equal(t, http.StatusNoContent, app.do(alice, "DELETE", "/api/sessions/"+session.ID, nil).Code)
+}
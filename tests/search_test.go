@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestSearchMessagesEndpoint(t *testing.T) {
+	app := setupTestApp(repositories.NewMemoryStore(), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+	_, err = app.messages.CreateMessage("The build is green", agent.ID, session.ID)
+	require.NoError(t, err)
+	_, err = app.messages.CreateMessage("The build is red", agent.ID, session.ID)
+	require.NoError(t, err)
+
+	search := func(query url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/search/messages?"+query.Encode(), nil)
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := search(url.Values{"q": {"build"}, "sessionId": {session.ID}, "limit": {"1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Items []struct {
+			Message struct {
+				ID      string `json:"id"`
+				AgentID string `json:"agentId"`
+			} `json:"message"`
+			Snippet string `json:"snippet"`
+		} `json:"items"`
+		NextOffset *int `json:"nextOffset"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Items, 1)
+	assert.Equal(t, agent.ID, response.Items[0].Message.AgentID)
+	assert.Contains(t, response.Items[0].Snippet, "<mark>build</mark>")
+	require.NotNil(t, response.NextOffset)
+	assert.Equal(t, 1, *response.NextOffset)
+
+	assert.Equal(t, http.StatusBadRequest, search(url.Values{}).Code)
+	assert.Equal(t, http.StatusBadRequest, search(url.Values{"q": {"build"}, "since": {"yesterday"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, search(url.Values{"q": {"build"}, "limit": {"-1"}}).Code)
+}
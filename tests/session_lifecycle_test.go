@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	testDBPath := "./session_lifecycle_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	fake := providers.NewFake("Friday works")
+	registry := providers.NewRegistry()
+	registry.Register(fake)
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), registry)
+
+	transition := func(sessionID string, status models.SessionStatus) int {
+		return app.do("", "POST", "/api/sessions/"+sessionID+"/transition", map[string]models.SessionStatus{"status": status}).Code
+	}
+
+	w := app.do("", "POST", "/api/sessions", map[string]interface{}{"title": "Launch", "goal": "Pick a launch date", "tags": []string{"launch"}, "status": "draft"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var session models.Session
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, models.SessionDraft, session.Status)
+	assert.Equal(t, []string{"launch"}, session.Tags)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/sessions", map[string]string{"status": "completed"}).Code)
+
+	agent, err := app.agents.CreateAgent("Planner", "planner", "You plan launches", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	// Drafts don't take messages or agent turns yet
+	message := map[string]string{"content": "Shall we start?", "agentId": agent.ID, "sessionId": session.ID}
+	assert.Equal(t, http.StatusConflict, app.do("", "POST", "/api/messages", message).Code)
+	assert.Equal(t, http.StatusConflict, app.do("", "POST", "/api/agents/"+agent.ID+"/run", nil).Code)
+	assert.Empty(t, fake.Requests())
+
+	assert.Equal(t, http.StatusConflict, transition(session.ID, models.SessionCompleted))
+	assert.Equal(t, http.StatusBadRequest, transition(session.ID, "closed"))
+	assert.Equal(t, http.StatusNotFound, transition("missing", models.SessionRunning))
+	require.Equal(t, http.StatusOK, transition(session.ID, models.SessionRunning))
+
+	require.Equal(t, http.StatusCreated, app.do("", "POST", "/api/messages", message).Code)
+	require.Equal(t, http.StatusCreated, app.do("", "POST", "/api/agents/"+agent.ID+"/run", nil).Code)
+	requests := fake.Requests()
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0].System, "Pick a launch date")
+
+	w = app.do("", "PUT", "/api/sessions/"+session.ID, map[string]string{"goal": "Pick a date and a venue"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, "Launch", session.Title)
+	assert.Equal(t, "Pick a date and a venue", session.Goal)
+
+	require.Equal(t, http.StatusOK, transition(session.ID, models.SessionPaused))
+	assert.Equal(t, http.StatusConflict, app.do("", "POST", "/api/messages", message).Code)
+	require.Equal(t, http.StatusOK, transition(session.ID, models.SessionCompleted))
+	require.Equal(t, http.StatusOK, transition(session.ID, models.SessionArchived))
+
+	w = app.do("", "GET", "/api/sessions/"+session.ID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, models.SessionArchived, session.Status)
+	assert.NotNil(t, session.ClosedAt)
+}
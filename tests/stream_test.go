@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+// sseEvent is one event read off a Server-Sent Events stream
+type sseEvent struct {
+	ID   string
+	Type string
+}
+
+func TestStreamResume(t *testing.T) {
+	app := setupTestApp(repositories.NewMemoryStore(), providers.NewRegistry())
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	first := events.Default.Publish(events.MessageCreated, session.ID, "one")
+	second := events.Default.Publish(events.MessageUpdated, session.ID, "two")
+	events.Default.Publish(events.MessageCreated, "other-session", "ignored")
+	third := events.Default.Publish(events.MessageDeleted, session.ID, "three")
+
+	// open connects to the stream and reads count events from it
+	open := func(query string, headers map[string]string, count int) (int, []sseEvent) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/sessions/"+session.ID+"/stream"+query, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, nil
+		}
+
+		var received []sseEvent
+		var current sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for len(received) < count && scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id:"):
+				current.ID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+			case strings.HasPrefix(line, "event:"):
+				current.Type = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case line == "" && current.ID != "":
+				received = append(received, current)
+				current = sseEvent{}
+			}
+		}
+		return resp.StatusCode, received
+	}
+	id := func(event events.Event) string { return strconv.FormatUint(event.ID, 10) }
+
+	// The Last-Event-ID header replays this session's later events
+	code, received := open("", map[string]string{"Last-Event-ID": id(first)}, 2)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []sseEvent{
+		{ID: id(second), Type: events.MessageUpdated},
+		{ID: id(third), Type: events.MessageDeleted},
+	}, received)
+
+	// Clients that cannot set headers use the query parameter
+	code, received = open("?lastEventId="+id(second), nil, 1)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []sseEvent{{ID: id(third), Type: events.MessageDeleted}}, received)
+
+	// Events published while connected follow the replay
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := app.messages.CreateMessage("Hello", agent.ID, session.ID)
+		assert.NoError(t, err)
+	}()
+	code, received = open("?lastEventId="+id(second), nil, 2)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, received, 2)
+	assert.Equal(t, events.MessageCreated, received[1].Type)
+
+	code, _ = open("", map[string]string{"Last-Event-ID": "not-a-number"}, 0)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// Once the events after the client's ID have been evicted, the replay opens with a reset
+	for i := 0; i < 1100; i++ {
+		events.Default.Publish(events.MessageCreated, "other-session", i)
+	}
+	latest := events.Default.Publish(events.MessageCreated, session.ID, "latest")
+	code, received = open("", map[string]string{"Last-Event-ID": id(first)}, 2)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, received, 2)
+	assert.Equal(t, events.StreamReset, received[0].Type)
+	assert.Equal(t, sseEvent{ID: id(latest), Type: events.MessageCreated}, received[1])
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestAgentTemplates(t *testing.T) {
+	testDBPath := "./template_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistry())
+
+	w := app.do("", "POST", "/api/agent-templates", map[string]string{"name": "Reviewer", "role": "critic", "prompt": "Review carefully", "model": "fake/a"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var template models.AgentTemplate
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &template))
+	assert.Equal(t, 1, template.Version)
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/agent-templates", map[string]string{"name": "Incomplete"}).Code)
+
+	// The same template seeds agents in two sessions, one of them pinned
+	first, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	second, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+
+	w = app.do("", "POST", "/api/sessions/"+first.ID+"/agents", map[string]interface{}{"templateId": template.ID})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var following []models.Agent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &following))
+	require.Len(t, following, 1)
+	assert.Equal(t, template.ID, following[0].TemplateID)
+	assert.Equal(t, first.ID, following[0].SessionID)
+
+	w = app.do("", "POST", "/api/sessions/"+second.ID+"/agents", map[string]interface{}{"templateIds": []string{template.ID}, "pinned": true})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var pinned []models.Agent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pinned))
+	require.Len(t, pinned, 1)
+	assert.True(t, pinned[0].Pinned)
+
+	assert.Equal(t, http.StatusBadRequest, app.do("", "POST", "/api/sessions/"+first.ID+"/agents", map[string]interface{}{}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do("", "POST", "/api/sessions/"+first.ID+"/agents", map[string]interface{}{"templateId": "missing"}).Code)
+
+	w = app.do("", "PUT", "/api/agent-templates/"+template.ID, map[string]string{"prompt": "Review very carefully"})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &template))
+	assert.Equal(t, 2, template.Version)
+	assert.Equal(t, "Reviewer", template.Name)
+	assert.Equal(t, http.StatusNotFound, app.do("", "PUT", "/api/agent-templates/missing", map[string]string{"prompt": "x"}).Code)
+
+	agent, err := app.agents.GetAgent(following[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Review very carefully", agent.Prompt)
+	agent, err = app.agents.GetAgent(pinned[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Review carefully", agent.Prompt)
+
+	// Unpinning brings the agent up to date
+	w = app.do("", "PUT", "/api/agents/"+pinned[0].ID+"/pinned", map[string]bool{"pinned": false})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), agent))
+	assert.False(t, agent.Pinned)
+	assert.Equal(t, 2, agent.TemplateVersion)
+	assert.Equal(t, "Review very carefully", agent.Prompt)
+	assert.Equal(t, http.StatusNotFound, app.do("", "PUT", "/api/agents/missing/pinned", map[string]bool{"pinned": true}).Code)
+
+	w = app.do("", "GET", "/api/agent-templates?limit=10", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page repositories.Page[*models.AgentTemplate]
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 1)
+
+	require.Equal(t, http.StatusNoContent, app.do("", "DELETE", "/api/agent-templates/"+template.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do("", "GET", "/api/agent-templates/"+template.ID, nil).Code)
+	agent, err = app.agents.GetAgent(following[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, agent.TemplateID)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do("", "PUT", "/api/agents/"+agent.ID+"/pinned", map[string]bool{"pinned": true}).Code)
+}
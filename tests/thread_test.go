@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/models"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestThreadedReplies(t *testing.T) {
+	app := setupTestApp(repositories.NewMemoryStore(), providers.NewRegistry())
+
+	session, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	other, err := app.sessions.CreateSession()
+	require.NoError(t, err)
+	agent, err := app.agents.CreateAgent("Writer", "author", "prompt", "fake/a", session.ID)
+	require.NoError(t, err)
+
+	post := func(body map[string]string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	get := func(path string, out interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		app.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+	}
+
+	root, err := app.messages.CreateMessage("What should we build?", agent.ID, session.ID)
+	require.NoError(t, err)
+
+	w := post(map[string]string{"content": "A search box", "agentId": agent.ID, "sessionId": session.ID, "replyTo": root.ID})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var reply models.Message
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+	assert.Equal(t, root.ID, reply.ParentID)
+	assert.Equal(t, root.ID, reply.ThreadRootID)
+
+	w = post(map[string]string{"content": "Agreed", "agentId": agent.ID, "sessionId": session.ID, "replyTo": reply.ID})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, post(map[string]string{"content": "?", "agentId": agent.ID, "sessionId": session.ID, "replyTo": "missing"}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, post(map[string]string{"content": "?", "agentId": agent.ID, "sessionId": other.ID, "replyTo": root.ID}).Code)
+
+	// Any message in the thread fetches the whole thread
+	var thread struct {
+		Root    models.Message   `json:"root"`
+		Replies []models.Message `json:"replies"`
+	}
+	get("/api/messages/"+reply.ID+"/thread", &thread)
+	assert.Equal(t, root.ID, thread.Root.ID)
+	require.Len(t, thread.Replies, 2)
+	assert.Equal(t, reply.ID, thread.Replies[0].ID)
+
+	var collapsed repositories.Page[models.Message]
+	get("/api/sessions/"+session.ID+"/messages?threads=collapsed", &collapsed)
+	require.Len(t, collapsed.Items, 1)
+	assert.Equal(t, 2, collapsed.Items[0].ReplyCount)
+
+	var expanded repositories.Page[models.Message]
+	get("/api/sessions/"+session.ID+"/messages", &expanded)
+	assert.Len(t, expanded.Items, 3)
+}
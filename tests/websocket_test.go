@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/events"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+)
+
+func TestWebSocketSession(t *testing.T) {
+	testDBPath := "./websocket_test.db"
+	defer os.Remove(testDBPath)
+
+	err := db.Initialize(testDBPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	app := setupTestApp(repositories.NewSQLStore(db.DB, db.Driver), providers.NewRegistry())
+	server := httptest.NewServer(app.router)
+	defer server.Close()
+
+	// Create a session and an agent over HTTP
+	resp, err := http.Post(server.URL+"/api/sessions", "application/json", nil)
+	require.NoError(t, err)
+	var session map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&session))
+	resp.Body.Close()
+	sessionID := session["id"].(string)
+
+	agentJSON, _ := json.Marshal(map[string]string{
+		"name":      "Socket Agent",
+		"role":      "assistant",
+		"prompt":    "You are a helpful assistant",
+		"model":     "gpt-4",
+		"sessionId": sessionID,
+	})
+	resp, err = http.Post(server.URL+"/api/agents", "application/json", bytes.NewBuffer(agentJSON))
+	require.NoError(t, err)
+	var agent map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&agent))
+	resp.Body.Close()
+	agentID := agent["id"].(string)
+
+	// Unknown sessions are rejected before the upgrade
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/sessions/"
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL+"missing/ws", nil)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// An observer without an agent receives everything happening in the session
+	observer, _, err := websocket.DefaultDialer.Dial(wsURL+sessionID+"/ws", nil)
+	require.NoError(t, err)
+	defer observer.Close()
+
+	// Wait for the observer to be registered with the session hub
+	err = observer.WriteJSON(map[string]string{"type": "heartbeat"})
+	require.NoError(t, err)
+	event := readEvent(t, observer)
+	assert.Equal(t, events.SessionHeartbeat, event.Type)
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+sessionID+"/ws?agentId="+agentID, nil)
+	require.NoError(t, err)
+
+	event = readEvent(t, observer)
+	assert.Equal(t, events.AgentPresence, event.Type)
+
+	// Send a message over the socket
+	err = conn.WriteJSON(map[string]string{"type": "message", "content": "Hello over websocket"})
+	require.NoError(t, err)
+
+	event = readEvent(t, observer)
+	assert.Equal(t, events.MessageCreated, event.Type)
+	assert.Equal(t, "Hello over websocket", event.Data.(map[string]interface{})["content"])
+
+	// Observers cannot speak without an agent
+	err = observer.WriteJSON(map[string]string{"type": "message", "content": "anonymous"})
+	require.NoError(t, err)
+	event = readEvent(t, observer)
+	assert.Equal(t, "error", event.Type)
+
+	// Heartbeats are broadcast as well
+	err = conn.WriteJSON(map[string]string{"type": "heartbeat"})
+	require.NoError(t, err)
+	event = readEvent(t, observer)
+	assert.Equal(t, events.SessionHeartbeat, event.Type)
+
+	// Disconnecting marks the agent offline
+	conn.Close()
+	event = readEvent(t, observer)
+	assert.Equal(t, events.AgentPresence, event.Type)
+	assert.Equal(t, false, event.Data.(map[string]interface{})["isOnline"])
+
+	stored, err := app.agents.GetAgent(agentID)
+	require.NoError(t, err)
+	assert.False(t, stored.IsOnline)
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) events.Event {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var event events.Event
+	err := conn.ReadJSON(&event)
+	require.NoError(t, err)
+	return event
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/chatcollab/chatcollab/db"
+	"github.com/chatcollab/chatcollab/handlers"
+	"github.com/chatcollab/chatcollab/providers"
+	"github.com/chatcollab/chatcollab/repositories"
+	"github.com/chatcollab/chatcollab/services"
+)
+
+func TestWorkspaces(t *testing.T) {
+	testDBPath := "./workspace_test.db"
+	defer os.Remove(testDBPath)
+
+	require.NoError(t, db.Initialize(testDBPath))
+	defer db.Close()
+
+	store := repositories.NewSQLStore(db.DB, db.Driver)
+	auth := handlers.NewAuthHandler(services.NewAuthService(store.APIKeys, store.Sessions, store.Agents, store.Messages, store.Users, store))
+	app := setupTestApp(store, providers.NewRegistry(), auth.Authenticate)
+
+	create := func(key, path string, body interface{}) string {
+		w := app.do(key, "POST", path, body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created struct {
+			ID  string `json:"id"`
+			Key string `json:"key"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		if created.Key != "" {
+			return created.Key
+		}
+		return created.ID
+	}
+
+	admin, _, err := app.auth.Bootstrap("")
+	require.NoError(t, err)
+
+	// Admins of the default workspace create workspaces and mint their keys
+	acme := create(admin, "/api/workspaces", map[string]interface{}{
+		"name": "Acme", "quotas": map[string]int{"sessions": 1, "agents": 1, "messages": 2},
+	})
+	globex := create(admin, "/api/workspaces", map[string]interface{}{"name": "Globex"})
+	assert.Equal(t, http.StatusBadRequest, app.do(admin, "POST", "/api/workspaces", map[string]interface{}{
+		"name": "Bad", "quotas": map[string]int{"sessions": -1},
+	}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do(admin, "POST", "/api/keys", map[string]interface{}{
+		"name": "x", "scopes": []string{"admin"}, "workspaceId": "missing",
+	}).Code)
+
+	acmeAdmin := create(admin, "/api/keys", map[string]interface{}{"name": "acme", "scopes": []string{"admin"}, "workspaceId": acme})
+	globexAdmin := create(admin, "/api/keys", map[string]interface{}{"name": "globex", "scopes": []string{"admin"}, "workspaceId": globex})
+	assert.Equal(t, http.StatusForbidden, app.do(acmeAdmin, "GET", "/api/workspaces", nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(acmeAdmin, "POST", "/api/keys", map[string]interface{}{
+		"name": "x", "scopes": []string{"admin"}, "workspaceId": globex,
+	}).Code)
+
+	// Each workspace only sees what it owns
+	acmeSession := create(acmeAdmin, "/api/sessions", nil)
+	globexSession := create(globexAdmin, "/api/sessions", nil)
+	acmeAgent := create(acmeAdmin, "/api/agents", map[string]string{
+		"name": "Writer", "role": "author", "prompt": "p", "model": "fake/a", "sessionId": acmeSession,
+	})
+	assert.Equal(t, http.StatusNotFound, app.do(globexAdmin, "GET", "/api/sessions/"+acmeSession, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(globexAdmin, "GET", "/api/sessions/"+acmeSession+"/messages", nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(globexAdmin, "GET", "/api/agents/"+acmeAgent, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(admin, "GET", "/api/sessions/"+globexSession, nil).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do(globexAdmin, "POST", "/api/agents", map[string]string{
+		"name": "Spy", "role": "author", "prompt": "p", "model": "fake/a", "sessionId": acmeSession,
+	}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do(globexAdmin, "POST", "/api/messages", map[string]string{
+		"content": "hi", "agentId": acmeAgent, "sessionId": globexSession,
+	}).Code)
+
+	w := app.do(globexAdmin, "GET", "/api/sessions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), globexSession)
+	assert.NotContains(t, w.Body.String(), acmeSession)
+
+	// Users are the workspace's own too
+	acmeUser := create(acmeAdmin, "/api/users", map[string]string{"name": "Ada"})
+	require.Equal(t, http.StatusCreated, app.do(acmeAdmin, "POST", "/api/sessions/"+acmeSession+"/participants", map[string]string{"userId": acmeUser}).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(globexAdmin, "GET", "/api/users/"+acmeUser, nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(globexAdmin, "PUT", "/api/users/"+acmeUser, map[string]string{"name": "Eve"}).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(globexAdmin, "DELETE", "/api/users/"+acmeUser, nil).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, app.do(globexAdmin, "POST", "/api/sessions/"+globexSession+"/participants", map[string]string{"userId": acmeUser}).Code)
+	w = app.do(globexAdmin, "GET", "/api/users", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), acmeUser)
+	w = app.do(acmeAdmin, "GET", "/api/sessions/"+acmeSession+"/members", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Ada"`)
+
+	w = app.do(globexAdmin, "GET", "/api/keys", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"globex"`)
+	assert.NotContains(t, w.Body.String(), `"name":"acme"`)
+	w = app.do(admin, "GET", "/api/keys?workspaceId="+acme, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"acme"`)
+
+	// Quotas refuse new records once reached
+	assert.Equal(t, http.StatusForbidden, app.do(acmeAdmin, "POST", "/api/sessions", nil).Code)
+	assert.Equal(t, http.StatusForbidden, app.do(acmeAdmin, "POST", "/api/agents", map[string]string{
+		"name": "Second", "role": "author", "prompt": "p", "model": "fake/a", "sessionId": acmeSession,
+	}).Code)
+	message := map[string]string{"content": "hi", "agentId": acmeAgent, "sessionId": acmeSession}
+	assert.Equal(t, http.StatusCreated, app.do(acmeAdmin, "POST", "/api/messages", message).Code)
+	assert.Equal(t, http.StatusCreated, app.do(acmeAdmin, "POST", "/api/messages", message).Code)
+	w = app.do(acmeAdmin, "POST", "/api/messages", message)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "at most 2 messages")
+
+	w = app.do(admin, "GET", "/api/workspaces/"+acme, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var detail struct {
+		Usage services.WorkspaceUsage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+	assert.Equal(t, services.WorkspaceUsage{Sessions: 1, Agents: 1, Messages: 2}, detail.Usage)
+
+	assert.Equal(t, http.StatusOK, app.do(admin, "PUT", "/api/workspaces/"+acme, map[string]interface{}{
+		"quotas": map[string]int{"messages": 3},
+	}).Code)
+	assert.Equal(t, http.StatusCreated, app.do(acmeAdmin, "POST", "/api/messages", message).Code)
+
+	// Workspaces with sessions and the default workspace cannot be deleted;
+	// deleting an empty one revokes its keys
+	assert.Equal(t, http.StatusConflict, app.do(admin, "DELETE", "/api/workspaces/default", nil).Code)
+	assert.Equal(t, http.StatusConflict, app.do(admin, "DELETE", "/api/workspaces/"+globex, nil).Code)
+	assert.Equal(t, http.StatusNoContent, app.do(globexAdmin, "DELETE", "/api/sessions/"+globexSession, nil).Code)
+	assert.Equal(t, http.StatusNoContent, app.do(admin, "DELETE", "/api/workspaces/"+globex, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, app.do(globexAdmin, "GET", "/api/sessions", nil).Code)
+	assert.Equal(t, http.StatusNotFound, app.do(admin, "GET", "/api/workspaces/"+globex, nil).Code)
+}